@@ -56,6 +56,8 @@ func SetHexyaFlags(c *cobra.Command) {
 	viper.BindPFlag("DataDir", c.PersistentFlags().Lookup("data-dir"))
 	c.PersistentFlags().String("resource-dir", "./res", "Path to the directory where Hexya should read its resources. Defaults to 'res' subdirectory of current directory")
 	viper.BindPFlag("ResourceDir", c.PersistentFlags().Lookup("resource-dir"))
+	c.PersistentFlags().String("encryption-key", "", "Base64 encoded 16, 24 or 32 bytes key used to encrypt the values of encrypted fields in the database")
+	viper.BindPFlag("EncryptionKey", c.PersistentFlags().Lookup("encryption-key"))
 	c.PersistentFlags().String("db-driver", "postgres", "Database driver to use")
 	viper.BindPFlag("DB.Driver", c.PersistentFlags().Lookup("db-driver"))
 	c.PersistentFlags().String("db-host", "/var/run/postgresql",
@@ -77,6 +79,16 @@ func SetHexyaFlags(c *cobra.Command) {
 	viper.BindPFlag("DB.SSLKey", c.PersistentFlags().Lookup("db-ssl-key"))
 	c.PersistentFlags().String("db-ssl-ca", "", "Path to certificate authority certificate(s) file")
 	viper.BindPFlag("DB.SSLCA", c.PersistentFlags().Lookup("db-ssl-ca"))
+	c.PersistentFlags().Int("db-max-open-conns", 0, "Maximum number of open connections to the database. 0 means unlimited")
+	viper.BindPFlag("DB.MaxOpenConns", c.PersistentFlags().Lookup("db-max-open-conns"))
+	c.PersistentFlags().Int("db-max-idle-conns", 0, "Maximum number of idle connections to the database. 0 means the driver's default")
+	viper.BindPFlag("DB.MaxIdleConns", c.PersistentFlags().Lookup("db-max-idle-conns"))
+	c.PersistentFlags().Duration("db-slow-query-threshold", 0, "Log queries taking longer than this duration. 0 disables slow query logging")
+	viper.BindPFlag("DB.SlowQueryThreshold", c.PersistentFlags().Lookup("db-slow-query-threshold"))
+	c.PersistentFlags().String("db-replica-host", "", "Host of a read only replica of the database. Leave empty to send all queries to the main database")
+	viper.BindPFlag("DB.ReplicaHost", c.PersistentFlags().Lookup("db-replica-host"))
+	c.PersistentFlags().String("db-replica-port", "5432", "Port of the read only replica of the database")
+	viper.BindPFlag("DB.ReplicaPort", c.PersistentFlags().Lookup("db-replica-port"))
 }
 
 // InitConfig initializes Hexya configuration system (viper).
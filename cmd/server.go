@@ -15,6 +15,7 @@
 package cmd
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
 	"os/exec"
@@ -79,6 +80,7 @@ func StartServer() {
 	server.ResourceDir = resourceDir
 	server.PreInit()
 	connectToDB()
+	setupEncryption()
 	i18n.BootStrap()
 	models.BootStrap()
 	models.RunWorkerLoop()
@@ -114,6 +116,7 @@ func setupLogger() {
 
 // setupDebug updates the server for debugging if Debug is enabled
 func setupDebug() {
+	models.SetDebugMode(viper.GetBool("Debug"))
 	if !viper.GetBool("Debug") {
 		return
 	}
@@ -122,19 +125,42 @@ func setupDebug() {
 }
 
 // connectToDB creates the connection to the database
+// and to its read only replica if one is configured
 func connectToDB() {
-	models.DBConnect(models.ConnectionParams{
-		Driver:   viper.GetString("DB.Driver"),
-		Host:     viper.GetString("DB.Host"),
-		Port:     viper.GetString("DB.Port"),
-		User:     viper.GetString("DB.User"),
-		Password: viper.GetString("DB.Password"),
-		DBName:   viper.GetString("DB.Name"),
-		SSLMode:  viper.GetString("DB.SSLMode"),
-		SSLCert:  viper.GetString("DB.SSLCert"),
-		SSLKey:   viper.GetString("DB.SSLKey"),
-		SSLCA:    viper.GetString("DB.SSLCA"),
-	})
+	params := models.ConnectionParams{
+		Driver:             viper.GetString("DB.Driver"),
+		Host:               viper.GetString("DB.Host"),
+		Port:               viper.GetString("DB.Port"),
+		User:               viper.GetString("DB.User"),
+		Password:           viper.GetString("DB.Password"),
+		DBName:             viper.GetString("DB.Name"),
+		SSLMode:            viper.GetString("DB.SSLMode"),
+		SSLCert:            viper.GetString("DB.SSLCert"),
+		SSLKey:             viper.GetString("DB.SSLKey"),
+		SSLCA:              viper.GetString("DB.SSLCA"),
+		MaxOpenConns:       viper.GetInt("DB.MaxOpenConns"),
+		MaxIdleConns:       viper.GetInt("DB.MaxIdleConns"),
+		SlowQueryThreshold: viper.GetDuration("DB.SlowQueryThreshold"),
+	}
+	models.DBConnect(params)
+	if replicaHost := viper.GetString("DB.ReplicaHost"); replicaHost != "" {
+		params.Host = replicaHost
+		params.Port = viper.GetString("DB.ReplicaPort")
+		models.DBConnectReplica(params)
+	}
+}
+
+// setupEncryption sets the key of encrypted fields if one is configured
+func setupEncryption() {
+	keyStr := viper.GetString("EncryptionKey")
+	if keyStr == "" {
+		return
+	}
+	key, err := base64.StdEncoding.DecodeString(keyStr)
+	if err != nil {
+		log.Panic("Encryption key must be base64 encoded", "error", err)
+	}
+	models.SetEncryptionKey(key)
 }
 
 // SetServerFlags adds the server flags to the given command.
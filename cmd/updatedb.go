@@ -32,6 +32,7 @@ func UpdateDB() {
 	setupDebug()
 	server.PreInit()
 	connectToDB()
+	setupEncryption()
 	models.BootStrap()
 	models.SyncDatabase()
 	resourceDir, err := filepath.Abs(viper.GetString("ResourceDir"))
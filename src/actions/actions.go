@@ -24,6 +24,7 @@ import (
 	"sync"
 
 	"github.com/beevik/etree"
+	"github.com/hexya-erp/hexya/src/models"
 	"github.com/hexya-erp/hexya/src/models/types"
 	"github.com/hexya-erp/hexya/src/tools/xmlutils"
 	"github.com/hexya-erp/hexya/src/views"
@@ -399,3 +400,49 @@ func (a Action) ActionString() ActionString {
 func LoadFromEtree(element *etree.Element) {
 	Registry.LoadFromEtree(element)
 }
+
+// NewWindowAction returns a window action displaying the records of the given
+// model with the given comma separated view modes (e.g. "tree,form").
+//
+// If cond is not nil, only the records matching cond are displayed.
+// ctx is the context passed to the client and may be nil.
+func NewWindowAction(model models.Modeler, viewMode string, cond models.Conditioner, ctx *types.Context) *Action {
+	modelName := model.Underlying().Name()
+	return &Action{
+		Type:     ActionActWindow,
+		Name:     modelName,
+		Model:    modelName,
+		ViewMode: viewMode,
+		Domain:   domainString(cond),
+		Context:  ctx,
+		Target:   "current",
+	}
+}
+
+// NewOpenRecordAction returns a window action opening the given record
+// in form view. It panics if rs is not a singleton.
+func NewOpenRecordAction(rs models.RecordSet) *Action {
+	rs.EnsureOne()
+	return &Action{
+		Type:     ActionActWindow,
+		Name:     rs.ModelName(),
+		Model:    rs.ModelName(),
+		ResID:    rs.Ids()[0],
+		ViewMode: "form",
+		Context:  rs.Env().Context(),
+		Target:   "current",
+	}
+}
+
+// domainString returns the given condition serialized as a
+// JSON domain, or an empty string if cond is nil or empty.
+func domainString(cond models.Conditioner) string {
+	if cond == nil || cond.Underlying().IsEmpty() {
+		return ""
+	}
+	res, err := json.Marshal(cond.Underlying().Serialize())
+	if err != nil {
+		log.Panic("Unable to serialize domain", "error", err, "condition", cond.Underlying())
+	}
+	return string(res)
+}
@@ -21,6 +21,7 @@ import (
 
 	"github.com/hexya-erp/hexya/src/models"
 	"github.com/hexya-erp/hexya/src/models/fields"
+	"github.com/hexya-erp/hexya/src/models/types"
 	"github.com/hexya-erp/hexya/src/tools/xmlutils"
 	"github.com/hexya-erp/hexya/src/views"
 	. "github.com/smartystreets/goconvey/convey"
@@ -185,4 +186,21 @@ func TestActions(t *testing.T) {
 		So(err, ShouldBeNil)
 		So(string(d), ShouldEqual, "false")
 	})
+	Convey("Testing window action helpers", t, func() {
+		partnerModel := models.Registry.MustGet("Partner")
+		Convey("Window action without domain", func() {
+			act := NewWindowAction(partnerModel, "tree,form", nil, nil)
+			So(act.Type, ShouldEqual, ActionActWindow)
+			So(act.Model, ShouldEqual, "Partner")
+			So(act.ViewMode, ShouldEqual, "tree,form")
+			So(act.Domain, ShouldBeEmpty)
+			So(act.ResID, ShouldEqual, 0)
+		})
+		Convey("Window action with domain and context", func() {
+			cond := partnerModel.Field(models.NewFieldName("Name", "name")).Equals("John")
+			act := NewWindowAction(partnerModel, "form", cond, types.NewContext().WithKey("default_name", "John"))
+			So(act.Domain, ShouldEqual, `[["name","=","John"]]`)
+			So(act.Context.GetString("default_name"), ShouldEqual, "John")
+		})
+	})
 }
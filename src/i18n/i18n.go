@@ -20,6 +20,7 @@ var Registry *TranslationsCollection
 type TranslationsCollection struct {
 	fieldDescription map[fieldRef]string
 	fieldHelp        map[fieldRef]string
+	fieldPlaceholder map[fieldRef]string
 	fieldSelection   map[selectionRef]string
 	resource         map[resourceRef]string
 	code             map[codeRef]string
@@ -50,6 +51,18 @@ func (tc *TranslationsCollection) TranslateFieldHelp(lang, model, field, default
 	return val
 }
 
+// TranslateFieldPlaceholder returns the translation for the given model field
+// placeholder in the given lang. If no translation is found or if the translation
+// is the empty string defaultValue is returned.
+func (tc *TranslationsCollection) TranslateFieldPlaceholder(lang, model, field, defaultValue string) string {
+	key := fieldRef{lang: lang, model: model, field: field}
+	val, ok := tc.fieldPlaceholder[key]
+	if !ok || val == "" {
+		return defaultValue
+	}
+	return val
+}
+
 // TranslateFieldSelection returns the translated version of the given selection in the given lang.
 // When no translation is found for an item, the original string is used.
 func (tc *TranslationsCollection) TranslateFieldSelection(lang, model, field string, selection types.Selection) types.Selection {
@@ -138,6 +151,14 @@ func (tc *TranslationsCollection) LoadPOFile(fileName string) {
 					log.Panic("Invalid format for PO comment. Field reference should be 'Model.Field'", "file", fileName, "line", msg.StartLine, "comment", line)
 				}
 				tc.fieldHelp[fieldRef{lang: lang, model: r[0], field: r[1]}] = msg.MsgStr
+			case "placeholder":
+				// #. placeholder:Model.Field
+				meta := strings.Replace(tokens[1], " ", "", -1)
+				r := strings.Split(meta, fieldSep)
+				if len(r) != 2 {
+					log.Panic("Invalid format for PO comment. Field reference should be 'Model.Field'", "file", fileName, "line", msg.StartLine, "comment", line)
+				}
+				tc.fieldPlaceholder[fieldRef{lang: lang, model: r[0], field: r[1]}] = msg.MsgStr
 			case "selection":
 				// #. selection:Model.Field
 				meta := strings.Replace(tokens[1], " ", "", -1)
@@ -179,6 +200,14 @@ func TranslateFieldHelp(lang, model, field, defaultValue string) string {
 	return Registry.TranslateFieldHelp(lang, model, field, defaultValue)
 }
 
+// TranslateFieldPlaceholder returns the translation for the given model field
+// placeholder in the given lang, using the default translation Registry. If no
+// translation is found or if the translation is the empty string defaultValue
+// is returned.
+func TranslateFieldPlaceholder(lang, model, field, defaultValue string) string {
+	return Registry.TranslateFieldPlaceholder(lang, model, field, defaultValue)
+}
+
 // TranslateFieldSelection returns the translated version of the given selection
 // in the given lang, using the default translation Registry. When no
 // translation is found for an item, the original string is used.
@@ -251,6 +280,7 @@ func NewTranslationsCollection() *TranslationsCollection {
 	return &TranslationsCollection{
 		fieldDescription: make(map[fieldRef]string),
 		fieldHelp:        make(map[fieldRef]string),
+		fieldPlaceholder: make(map[fieldRef]string),
 		fieldSelection:   make(map[selectionRef]string),
 		resource:         make(map[resourceRef]string),
 		code:             make(map[codeRef]string),
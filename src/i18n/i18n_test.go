@@ -55,6 +55,14 @@ func TestI18N(t *testing.T) {
 			trans = TranslateFieldHelp("fr", "User", "Login", "defaultHelp")
 			So(trans, ShouldEqual, "defaultHelp")
 		})
+		Convey("Translating field placeholder should work", func() {
+			trans := TranslateFieldPlaceholder("fr", "User", "Login", "")
+			So(trans, ShouldEqual, "ex. jdupont")
+			trans = TranslateFieldPlaceholder("de", "User", "Login", "defaultValue")
+			So(trans, ShouldEqual, "defaultValue")
+			trans = TranslateFieldPlaceholder("fr", "User", "Active", "defaultPlaceholder")
+			So(trans, ShouldEqual, "defaultPlaceholder")
+		})
 		Convey("Translating field selection should work", func() {
 			trans := TranslateFieldSelection("fr", "Profile", "State", types.Selection{"active": "Active", "inactive": "Inactive"})
 			So(trans, ShouldHaveLength, 2)
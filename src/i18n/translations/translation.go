@@ -79,6 +79,7 @@ func UpdatePOFiles(config map[string]interface{}) {
 			for field, fieldASTData := range modelASTData.Fields {
 				messages = addDescriptionToMessages(lang, model, field, fieldASTData, messages)
 				messages = addHelpToMessages(lang, model, field, fieldASTData, messages)
+				messages = addPlaceholderToMessages(lang, model, field, fieldASTData, messages)
 				messages = addSelectionToMessages(lang, model, field, fieldASTData, messages)
 			}
 		}
@@ -359,3 +360,17 @@ func addHelpToMessages(lang string, model string, field string, fieldASTData gen
 	messages[msgRef] = msg
 	return messages
 }
+
+// addPlaceholderToMessages adds to the given messages map the placeholder translation for the given model and field
+func addPlaceholderToMessages(lang string, model string, field string, fieldASTData generate.FieldASTData, messages MessageMap) MessageMap {
+	placeholder := fieldASTData.Placeholder
+	if placeholder == "" {
+		return messages
+	}
+	placeholderTranslated := i18n.TranslateFieldPlaceholder(lang, model, field, "")
+	msgRef := MessageRef{MsgId: placeholder}
+	msg := GetOrCreateMessage(messages, msgRef, placeholderTranslated)
+	msg.ExtractedComment += fmt.Sprintf("placeholder:%s.%s\n", model, field)
+	messages[msgRef] = msg
+	return messages
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// An aggregateFunction is the function applied by an Aggregate
+// on the values of the related records.
+type aggregateFunction string
+
+const (
+	aggregateSum   aggregateFunction = "sum"
+	aggregateCount aggregateFunction = "count"
+	aggregateAvg   aggregateFunction = "avg"
+	aggregateMin   aggregateFunction = "min"
+	aggregateMax   aggregateFunction = "max"
+)
+
+// An Aggregate defines the value of a numeric field as an aggregate of a field
+// of the records of a one2many or many2many relation of the same model.
+//
+// A field with an Aggregate is a stored computed field whose compute method and
+// dependencies are generated automatically. Use the SumOf, CountOf, AvgOf, MinOf
+// and MaxOf functions to create an Aggregate.
+type Aggregate struct {
+	function aggregateFunction
+	relation string
+	field    string
+}
+
+// SumOf returns an Aggregate which is the sum of the given field of the records
+// of the given relation, e.g. SumOf("Lines", "Subtotal").
+func SumOf(relation, field string) *Aggregate {
+	return &Aggregate{function: aggregateSum, relation: relation, field: field}
+}
+
+// CountOf returns an Aggregate which is the number of records of the given relation.
+func CountOf(relation string) *Aggregate {
+	return &Aggregate{function: aggregateCount, relation: relation}
+}
+
+// AvgOf returns an Aggregate which is the average of the given field of the records
+// of the given relation. It is 0 if the relation is empty.
+func AvgOf(relation, field string) *Aggregate {
+	return &Aggregate{function: aggregateAvg, relation: relation, field: field}
+}
+
+// MinOf returns an Aggregate which is the smallest value of the given field of the
+// records of the given relation. It is 0 if the relation is empty.
+func MinOf(relation, field string) *Aggregate {
+	return &Aggregate{function: aggregateMin, relation: relation, field: field}
+}
+
+// MaxOf returns an Aggregate which is the greatest value of the given field of the
+// records of the given relation. It is 0 if the relation is empty.
+func MaxOf(relation, field string) *Aggregate {
+	return &Aggregate{function: aggregateMax, relation: relation, field: field}
+}
+
+// depends returns the dependencies of a field with this Aggregate
+func (a *Aggregate) depends() []string {
+	if a.function == aggregateCount {
+		return []string{a.relation}
+	}
+	return []string{a.relation, fmt.Sprintf("%s%s%s", a.relation, ExprSep, a.field)}
+}
+
+// declareComputeMethod adds to the given model the compute method of the
+// field fieldName with this Aggregate and returns the method name.
+func (a *Aggregate) declareComputeMethod(model *Model, fieldName string) string {
+	methName := fmt.Sprintf("ComputeAggregate%s", fieldName)
+	// Not NewMethod, which the code generator would try to parse
+	model.AddEmptyMethod(methName).finalize(func(rc *RecordCollection) *ModelData {
+		fi := rc.model.fields.MustGet(fieldName)
+		records := rc.Get(rc.model.FieldName(a.relation)).(RecordSet).Collection()
+		res := a.compute(records)
+		value := reflect.ValueOf(res).Convert(fi.structField.Type).Interface()
+		return NewModelData(rc.model).Set(rc.model.FieldName(fieldName), value)
+	})
+	return methName
+}
+
+// compute returns the value of this Aggregate for the given related records.
+func (a *Aggregate) compute(records *RecordCollection) float64 {
+	if a.function == aggregateCount {
+		return float64(records.Len())
+	}
+	if records.IsEmpty() {
+		return 0
+	}
+	fName := records.model.FieldName(a.field)
+	var res float64
+	for i, rec := range records.Records() {
+		value := reflect.ValueOf(rec.Get(fName))
+		if !value.Type().ConvertibleTo(reflect.TypeOf(res)) {
+			log.Panic("Unable to aggregate non numeric field", "model", records.model.name, "field", a.field)
+		}
+		val := value.Convert(reflect.TypeOf(res)).Float()
+		switch {
+		case i == 0:
+			res = val
+		case a.function == aggregateMin && val < res:
+			res = val
+		case a.function == aggregateMax && val > res:
+			res = val
+		case a.function == aggregateSum || a.function == aggregateAvg:
+			res += val
+		}
+	}
+	if a.function == aggregateAvg {
+		res /= float64(records.Len())
+	}
+	return res
+}
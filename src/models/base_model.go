@@ -26,6 +26,7 @@ import (
 	"github.com/hexya-erp/hexya/src/models/operator"
 	"github.com/hexya-erp/hexya/src/models/types"
 	"github.com/hexya-erp/hexya/src/models/types/dates"
+	"github.com/hexya-erp/hexya/src/tools/exceptions"
 	"github.com/hexya-erp/hexya/src/tools/nbutils"
 )
 
@@ -60,6 +61,7 @@ func declareCommonMixin() {
 	commonMixin.addMethod("CopyData", commonMixinCopyData)
 	commonMixin.addMethod("Copy", commonMixinCopy)
 	commonMixin.addMethod("NameGet", commonMixinNameGet)
+	commonMixin.addMethod("DisplayNames", commonMixinDisplayNames)
 	commonMixin.addMethod("SearchByName", commonMixinSearchByName)
 	commonMixin.addMethod("FieldsGet", commonMixinFieldsGet)
 	commonMixin.addMethod("FieldGet", commonMixinFieldGet)
@@ -69,7 +71,11 @@ func declareCommonMixin() {
 	commonMixin.addMethod("Search", commonMixinSearch)
 	commonMixin.addMethod("Browse", commonMixinBrowse)
 	commonMixin.addMethod("BrowseOne", commonMixinBrowseOne)
+	commonMixin.addMethod("BrowseStrict", commonMixinBrowseStrict)
+	commonMixin.addMethod("BrowseExternal", commonMixinBrowseExternal)
+	commonMixin.addMethod("BrowseOrdered", commonMixinBrowseOrdered)
 	commonMixin.addMethod("SearchCount", commonMixinSearchCount)
+	commonMixin.addMethod("SearchCountEstimate", commonMixinSearchCountEstimate)
 	commonMixin.addMethod("Fetch", commonMixinFetch)
 	commonMixin.addMethod("SearchAll", commonMixinSearchAll)
 	commonMixin.addMethod("GroupBy", commonMixinGroupBy)
@@ -84,6 +90,8 @@ func declareCommonMixin() {
 	commonMixin.addMethod("Sorted", commonMixinSorted)
 	commonMixin.addMethod("SortedDefault", commonMixinSortedDefault)
 	commonMixin.addMethod("SortedByField", commonMixinSortedByField)
+	commonMixin.addMethod("Resort", commonMixinResort)
+	commonMixin.addMethod("DiffWith", commonMixinDiffWith)
 	commonMixin.addMethod("Filtered", commonMixinFiltered)
 	commonMixin.addMethod("GetRecord", commonMixinGetRecord)
 	commonMixin.addMethod("CheckExecutionPermission", commonMixinCheckExecutionPermission)
@@ -211,6 +219,23 @@ func commonMixinNameGet(rc *RecordCollection) string {
 	return rc.String()
 }
 
+// DisplayNames returns the display name of each record of this RecordSet as
+// returned by NameGet, mapped by record ID. Records are loaded in batch first
+// so that the number of queries does not depend on the size of the RecordSet.
+func commonMixinDisplayNames(rc *RecordCollection) map[int64]string {
+	res := make(map[int64]string, len(rc.ids))
+	if rc.IsEmpty() {
+		return res
+	}
+	if !rc.hasNegIds {
+		rc.Load()
+	}
+	for _, rec := range rc.Records() {
+		res[rec.ids[0]] = rec.Call("NameGet").(string)
+	}
+	return res
+}
+
 // SearchByName searches for records that have a display name matching the given
 // "name" pattern when compared with the given "op" operator, while also
 // matching the optional search condition ("additionalCond").
@@ -231,7 +256,7 @@ func commonMixinSearchByName(rc *RecordCollection, name string, op operator.Oper
 
 // FieldsGet returns the definition of each field.
 // The embedded fields are included.
-// The string, help, and selection (if present) attributes are translated.
+// The string, help, placeholder, and selection (if present) attributes are translated.
 //
 // The result map is indexed by the fields JSON names.
 func commonMixinFieldsGet(rc *RecordCollection, args FieldsGetArgs) map[string]*FieldInfo {
@@ -242,6 +267,7 @@ func commonMixinFieldsGet(rc *RecordCollection, args FieldsGetArgs) map[string]*
 	lang := rc.Env().Context().GetString("lang")
 	for fName, fInfo := range res {
 		res[fName].Help = i18n.Registry.TranslateFieldHelp(lang, rc.model.name, fInfo.Name, fInfo.Help)
+		res[fName].Placeholder = i18n.Registry.TranslateFieldPlaceholder(lang, rc.model.name, fInfo.Name, fInfo.Placeholder)
 		res[fName].String = i18n.Registry.TranslateFieldDescription(lang, rc.model.name, fInfo.Name, fInfo.String)
 		res[fName].Selection = i18n.Registry.TranslateFieldSelection(lang, rc.model.name, fInfo.Name, fInfo.Selection)
 	}
@@ -249,7 +275,7 @@ func commonMixinFieldsGet(rc *RecordCollection, args FieldsGetArgs) map[string]*
 }
 
 // FieldGet returns the definition of the given field.
-// The string, help, and selection (if present) attributes are translated.
+// The string, help, placeholder, and selection (if present) attributes are translated.
 func commonMixinFieldGet(rc *RecordCollection, field FieldName) *FieldInfo {
 	args := FieldsGetArgs{
 		Fields: []FieldName{field},
@@ -376,6 +402,24 @@ func commonMixinOnChange(rc *RecordCollection, params OnchangeParams) OnchangeRe
 				}
 			}
 		}
+		// Dynamic filters
+		dynFilterFields := make(map[string]bool)
+		for _, fi := range rs.model.fields.registryByName {
+			if !done[fi.json] {
+				continue
+			}
+			for _, target := range fi.filterTriggers {
+				dynFilterFields[target.name] = true
+			}
+		}
+		for fieldName := range dynFilterFields {
+			fName := rs.model.FieldName(fieldName)
+			filter := rs.RelationFilter(fName)
+			if ff, exists := filters[fName]; exists {
+				filter = ff.Underlying().AndCond(filter)
+			}
+			filters[fName] = filter
+		}
 		// Collect modified values
 		for field, val := range values {
 			fName := rs.model.FieldName(field)
@@ -427,11 +471,94 @@ func commonMixinBrowseOne(rc *RecordCollection, id int64) *RecordCollection {
 	return rc.Call("Search", rc.Model().Field(ID).Equals(id)).(RecordSet).Collection()
 }
 
+// BrowseStrict returns a new RecordSet with only the records with the given ids.
+// Contrary to Browse, the ids are checked against the database immediately and
+// this function panics with the list of missing ids if some records do not exist
+// or cannot be read by the current user.
+func commonMixinBrowseStrict(rc *RecordCollection, ids []int64) *RecordCollection {
+	res := rc.Call("Browse", ids).(RecordSet).Collection().Fetch()
+	existing := make(map[int64]bool)
+	for _, id := range res.Ids() {
+		existing[id] = true
+	}
+	var missing []int64
+	for _, id := range ids {
+		if !existing[id] {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		raise(exceptions.MissingError{Message: "Some records do not exist or cannot be accessed"}, "model", rc.model.name, "missingIDs", missing)
+	}
+	return res
+}
+
+// BrowseExternal returns a new RecordSet with the records with the given external IDs,
+// in the same order. All records are fetched with a single query and this function
+// panics with the list of unresolved external IDs if some records do not exist.
+func commonMixinBrowseExternal(rc *RecordCollection, externalIDs ...string) *RecordCollection {
+	extIDField := rc.model.FieldName("HexyaExternalID")
+	recs := rc.Call("Search", rc.model.Field(extIDField).In(externalIDs)).(RecordSet).Collection()
+	recs.Load(extIDField)
+	idsByExtID := make(map[string]int64)
+	for _, rec := range recs.Records() {
+		idsByExtID[rec.Get(extIDField).(string)] = rec.ids[0]
+	}
+	var (
+		ids     []int64
+		missing []string
+	)
+	for _, externalID := range externalIDs {
+		id, ok := idsByExtID[externalID]
+		if !ok {
+			missing = append(missing, externalID)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(missing) > 0 {
+		raise(exceptions.MissingError{Message: "Unknown external IDs"}, "model", rc.model.name, "externalIDs", missing)
+	}
+	return newRecordCollection(rc.Env(), rc.ModelName()).withIds(ids)
+}
+
+// BrowseOrdered returns a new RecordSet with the records with the given ids, in
+// the same order. This is typically used with ids ranked by an external search
+// engine. Ids of records that do not exist or cannot be read by the current user
+// are skipped, as well as repeated ids.
+func commonMixinBrowseOrdered(rc *RecordCollection, ids []int64) *RecordCollection {
+	if len(ids) == 0 {
+		return newRecordCollection(rc.Env(), rc.ModelName())
+	}
+	recs := rc.Call("Browse", ids).(RecordSet).Collection().Fetch()
+	existing := make(map[int64]bool)
+	for _, id := range recs.Ids() {
+		existing[id] = true
+	}
+	var res []int64
+	for _, id := range ids {
+		if !existing[id] {
+			continue
+		}
+		res = append(res, id)
+		existing[id] = false
+	}
+	return newRecordCollection(rc.Env(), rc.ModelName()).withIds(res)
+}
+
 // SearchCount fetch from the database the number of records that match the RecordSet conditions.
 func commonMixinSearchCount(rc *RecordCollection) int {
 	return rc.SearchCount()
 }
 
+// SearchCountEstimate returns the number of records that match the RecordSet
+// conditions and true if this number is an estimate taken from the database
+// statistics. The count is estimated only for unfiltered queries on tables with
+// more rows than the threshold set by models.SetCountEstimateThreshold.
+func commonMixinSearchCountEstimate(rc *RecordCollection) (int, bool) {
+	return rc.SearchCountEstimate()
+}
+
 // Fetch query the database with the current filter and returns a RecordSet
 // with the queries ids.
 //
@@ -518,6 +645,21 @@ func commonMixinSortedByField(rc *RecordCollection, namer FieldName, reverse boo
 	return rc.SortedByField(namer, reverse)
 }
 
+// Resort returns a new record set with the same records as rc sorted again by the
+// database according to the order of rc, or the default order of the model.
+// This is useful after writing on fields used to order the records.
+func commonMixinResort(rc *RecordCollection) *RecordCollection {
+	return rc.Resort()
+}
+
+// DiffWith compares field by field the records of this RecordSet with the records of
+// other that have the same ids. If no fields are given, all the stored or related fields except ID
+// are compared, but not the non stored computed fields. Records that are only in one of the
+// RecordSets are reported separately.
+func commonMixinDiffWith(rc *RecordCollection, other RecordSet, fields ...FieldName) *RecordsDiff {
+	return rc.DiffWith(other, fields...)
+}
+
 // Filtered returns a new record set with only the elements of this record set
 // for which test is true.
 //
@@ -708,6 +850,8 @@ func ConvertLimitToInt(limit interface{}) int {
 type FieldInfo struct {
 	ChangeDefault    bool                                  `json:"change_default"`
 	Help             string                                `json:"help"`
+	Placeholder      string                                `json:"placeholder"`
+	Section          string                                `json:"section"`
 	Searchable       bool                                  `json:"searchable"`
 	Views            map[string]interface{}                `json:"views"`
 	Required         bool                                  `json:"required"`
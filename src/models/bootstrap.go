@@ -17,6 +17,7 @@ package models
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"time"
 
@@ -54,17 +55,25 @@ func BootStrap() {
 	inflateEmbeddings()
 	processUpdates()
 	updateFieldDefs()
+	createSearchShadowFields()
+	createBlindIndexFields()
+	createVersionFields()
+	createLazyMarkerFields()
 	updateRelatedPaths()
 	syncRelatedFieldInfo()
 	inflateContexts()
 	updateRelatedPaths()
 	updateDefaultOrder()
+	updateCascadeFields()
+	updateFilterTriggers()
 	bootStrapMethods()
 	processDepends()
 	checkFieldMethodsExist()
+	checkViewStructs()
 	checkComputeMethodsSignature()
 	setupSecurity()
 	RegisterWorker(NewWorkerFunction(FreeTransientModels, freeTransientPeriod))
+	RegisterWorker(NewWorkerFunction(PurgeTombstones, purgeTombstonesPeriod))
 
 	Registry.bootstrapped = true
 }
@@ -299,6 +308,9 @@ func syncRelatedFieldInfo() {
 			newFI.onChange = ""
 			newFI.onChangeWarning = ""
 			newFI.onChangeFilters = ""
+			newFI.dynamicFilter = ""
+			newFI.filterDepends = nil
+			newFI.filterTriggers = nil
 			newFI.index = false
 			newFI.compute = ""
 			newFI.constraint = ""
@@ -375,11 +387,15 @@ func bootStrapMethods() {
 
 // setupSecurity adds execution permission to:
 // - the admin group for all methods
+// - the groups with declared access rights on CRUD methods
 // - to CRUD methods to call "Load"
 // - to "Create" method to call "Write"
 // - to execute CRUD on context models
 func setupSecurity() {
 	for _, model := range Registry.registryByName {
+		if !model.IsMixin() {
+			model.applyAccessRights()
+		}
 		loadMeth, loadExists := model.methods.Get("Load")
 		fetchMeth, fetchExists := model.methods.Get("Fetch")
 		writeMeth, writeExists := model.methods.Get("Write")
@@ -420,6 +436,93 @@ func updateContextModelsSecurity() {
 	}
 }
 
+// createSearchShadowFields adds a hidden stored computed field for each non
+// stored computed field with SearchShadow set. The shadow field is recomputed
+// with the same dependencies and is used instead of the computed field in
+// search conditions and orders.
+func createSearchShadowFields() {
+	for _, model := range Registry.registryByName {
+		if model.IsMixin() || model.IsManual() {
+			continue
+		}
+		var shadowed []*Field
+		for _, fi := range model.fields.registryByName {
+			if fi.searchShadow {
+				shadowed = append(shadowed, fi)
+			}
+		}
+		for _, fi := range shadowed {
+			if !fi.isComputedField() || fi.stored || fi.isRelationField() {
+				log.Panic("SearchShadow can only be set on non stored computed fields that are not relations", "model", model.name, "field", fi.name)
+			}
+			computeName := fi.compute
+			fieldName := model.FieldName(fi.name)
+			shadowName := fmt.Sprintf("Hexya%sShadow", fi.name)
+			shadowCompute := fmt.Sprintf("HexyaCompute%sShadow", fi.name)
+			// We do not use NewMethod so that code generation does not pick this method
+			model.AddEmptyMethod(shadowCompute).finalize(func(rc *RecordCollection) *ModelData {
+				val := rc.Call(computeName).(RecordData).Underlying().Get(fieldName)
+				return NewModelData(rc.model).Set(rc.model.FieldName(shadowName), val)
+			})
+			shadow := &Field{
+				model:       model,
+				name:        shadowName,
+				json:        fmt.Sprintf("hexya_%s_shadow", fi.json),
+				description: fi.description,
+				fieldType:   fi.fieldType,
+				structField: reflect.StructField{Name: shadowName, Type: fi.structField.Type},
+				selection:   fi.selection,
+				size:        fi.size,
+				digits:      fi.digits,
+				stored:      true,
+				readOnly:    true,
+				noCopy:      true,
+				index:       true,
+				compute:     shadowCompute,
+				depends:     fi.depends,
+				shadowOf:    fi,
+			}
+			model.fields.add(shadow)
+			fi.shadow = shadow
+		}
+	}
+}
+
+// createLazyMarkerFields adds a hidden stored boolean field to each lazily
+// computed field, which is set when the value has been computed and stored.
+// This tells an empty computed value from a value that has not been computed
+// yet or that has been cleared.
+func createLazyMarkerFields() {
+	for _, model := range Registry.registryByName {
+		if model.IsMixin() || model.IsManual() {
+			continue
+		}
+		var lazy []*Field
+		for _, fi := range model.fields.registryByName {
+			if fi.lazyCompute {
+				lazy = append(lazy, fi)
+			}
+		}
+		for _, fi := range lazy {
+			markerName := fmt.Sprintf("Hexya%sComputed", fi.name)
+			marker := &Field{
+				model:        model,
+				name:         markerName,
+				json:         fmt.Sprintf("hexya_%s_computed", fi.json),
+				description:  fi.description,
+				fieldType:    fieldtype.Boolean,
+				structField:  reflect.StructField{Name: markerName, Type: reflect.TypeOf(false)},
+				stored:       true,
+				readOnly:     true,
+				noCopy:       true,
+				lazyMarkerOf: fi,
+			}
+			model.fields.add(marker)
+			fi.lazyMarker = marker
+		}
+	}
+}
+
 // updateRelatedPaths sets relatedPath from relatedPathStr
 func updateRelatedPaths() {
 	for _, model := range Registry.registryByName {
@@ -441,6 +544,55 @@ func updateDefaultOrder() {
 	}
 }
 
+// updateCascadeFields sets on each model the fields of other models
+// that reference it with the Cascade OnDelete action.
+func updateCascadeFields() {
+	for _, model := range Registry.registryByName {
+		model.cascadeFields = nil
+	}
+	for _, model := range Registry.registryByName {
+		if model.IsMixin() || model.IsManual() || model.IsM2MLink() || model.isContext() {
+			continue
+		}
+		for _, field := range model.fields.registryByName {
+			if !field.fieldType.IsFKRelationType() || field.onDelete != Cascade || !field.isStored() || field.isRelatedField() || field.noFK {
+				continue
+			}
+			field.relatedModel.cascadeFields = append(field.relatedModel.cascadeFields, field)
+		}
+	}
+	for _, model := range Registry.registryByName {
+		sort.Slice(model.cascadeFields, func(i, j int) bool {
+			fi, fj := model.cascadeFields[i], model.cascadeFields[j]
+			if fi.model.name != fj.model.name {
+				return fi.model.name < fj.model.name
+			}
+			return fi.name < fj.name
+		})
+	}
+}
+
+// updateFilterTriggers sets on each field the relation fields of the same
+// model whose dynamic filter depends on it.
+func updateFilterTriggers() {
+	for _, model := range Registry.registryByName {
+		for _, field := range model.fields.registryByName {
+			field.filterTriggers = nil
+		}
+	}
+	for _, model := range Registry.registryByName {
+		for _, field := range model.fields.registryByName {
+			if field.dynamicFilter == "" {
+				continue
+			}
+			for _, dep := range field.filterDepends {
+				trigger := model.fields.MustGet(dep)
+				trigger.filterTriggers = append(trigger.filterTriggers, field)
+			}
+		}
+	}
+}
+
 // checkFieldMethodsExist checks that all methods referenced by fields,
 // such as Compute, Constraint or Onchange exist.
 func checkFieldMethodsExist() {
@@ -455,12 +607,82 @@ func checkFieldMethodsExist() {
 			if field.onChangeFilters != "" {
 				model.methods.MustGet(field.onChangeFilters)
 			}
+			if field.dynamicFilter != "" {
+				model.methods.MustGet(field.dynamicFilter)
+			}
 			if field.constraint != "" {
 				model.methods.MustGet(field.constraint)
 			}
+			if field.timeDependent {
+				if field.compute == "" {
+					log.Panic("Time dependent fields must be computed", "model", model.name, "field", field.name)
+				}
+				if field.stored {
+					log.Panic("Time dependent fields cannot be stored", "model", model.name, "field", field.name)
+				}
+			}
+			if field.computeOnCreate {
+				if field.compute == "" {
+					log.Panic("Fields computed on create only must be computed", "model", model.name, "field", field.name)
+				}
+				if !field.stored {
+					log.Panic("Fields computed on create only must be stored", "model", model.name, "field", field.name)
+				}
+			}
+			if field.lazyCompute {
+				if field.compute == "" || !field.stored {
+					log.Panic("Lazily computed fields must be stored and computed", "model", model.name, "field", field.name)
+				}
+				if field.computeOnCreate || field.required || field.isContextedField() || field.fieldType.IsNonStoredRelationType() {
+					log.Panic("Lazily computed fields cannot be computed on create only, required, contexted or non stored relations", "model", model.name, "field", field.name)
+				}
+			}
+			if field.checkCompany {
+				if field.fieldType != fieldtype.Many2One {
+					log.Panic("CheckCompany can only be set on many2one fields", "model", model.name, "field", field.name)
+				}
+				for _, mi := range []*Model{model, field.relatedModel} {
+					if cf, ok := mi.fields.Get(companyFieldName); !ok || cf.fieldType != fieldtype.Many2One {
+						log.Panic("CheckCompany requires both models to have a many2one 'Company' field", "model", model.name, "field", field.name, "checkedModel", mi.name)
+					}
+				}
+			}
+			if field.noFK && (field.fieldType != fieldtype.Many2One || field.embed) {
+				log.Panic("NoFK can only be set on many2one fields that are not embedded", "model", model.name, "field", field.name)
+			}
+			if field.fieldType == fieldtype.Array {
+				switch field.structField.Type {
+				case reflect.TypeOf(types.StringArray{}), reflect.TypeOf(types.IntegerArray{}), reflect.TypeOf(types.FloatArray{}):
+				default:
+					log.Panic("Array fields must have a StringArray, IntegerArray or FloatArray Go type", "model", model.name, "field", field.name, "type", field.structField.Type)
+				}
+			}
+			if field.fieldType == fieldtype.Encrypted && field.structField.Type.Kind() != reflect.String {
+				log.Panic("Encrypted fields must have a string Go type", "model", model.name, "field", field.name, "type", field.structField.Type)
+			}
+			if field.precompute != "" {
+				if field.compute == "" || !field.stored {
+					log.Panic("Precompute methods can only be set on stored computed fields", "model", model.name, "field", field.name)
+				}
+				model.methods.MustGet(field.precompute)
+			}
+			if field.computeGuard != "" {
+				checkComputeGuard(field)
+			}
+			switch field.searchType {
+			case DefaultSearch:
+			case TrigramSearch:
+				switch field.fieldType {
+				case fieldtype.Char, fieldtype.Text, fieldtype.HTML:
+				default:
+					log.Panic("Trigram search is only available on char, text and html fields", "model", model.name, "field", field.name)
+				}
+			default:
+				log.Panic("Unknown search type", "model", model.name, "field", field.name, "searchType", field.searchType)
+			}
 			if field.compute != "" && field.stored {
 				model.methods.MustGet(field.compute)
-				if len(field.depends) == 0 {
+				if len(field.depends) == 0 && !field.computeOnCreate {
 					log.Warn("Computed fields should have a 'Depends' parameter set", "model", model.name, "field", field.name)
 				}
 			}
@@ -474,6 +696,30 @@ func checkFieldMethodsExist() {
 	}
 }
 
+// checkComputeGuard panics if the compute guard of the given field is not a
+// boolean field of its model, or if it is set on a field that is not computed,
+// lazily computed or with a versioned cache. Stored fields computed by the same
+// method must also have the same guard, since it is checked once per record
+// before calling the method.
+func checkComputeGuard(field *Field) {
+	model := field.model
+	if field.compute == "" || field.isRelatedField() || field.lazyCompute || field.versionedCache {
+		log.Panic("Compute guards can only be set on computed fields that are neither related, lazy nor versioned", "model", model.name, "field", field.name)
+	}
+	guard, ok := model.fields.Get(field.computeGuard)
+	if !ok || guard.fieldType != fieldtype.Boolean || guard == field {
+		log.Panic("Compute guard must be another boolean field of the model", "model", model.name, "field", field.name, "guard", field.computeGuard)
+	}
+	if !field.stored {
+		return
+	}
+	for _, fi := range model.fields.computedStoredFields {
+		if fi.compute == field.compute && fi.computeGuard != field.computeGuard {
+			log.Panic("Stored fields computed by the same method must have the same compute guard", "model", model.name, "field", field.name, "otherField", fi.name)
+		}
+	}
+}
+
 // loadManualSequencesFromDB fetches manual sequences from DB and updates registry
 func loadManualSequencesFromDB() {
 	if db == nil {
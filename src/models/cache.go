@@ -29,6 +29,10 @@ type cache struct {
 	data       map[string]map[int64]FieldMap                    // cache data values by model and id
 	x2mRelated map[string]map[int64]map[string]map[string]int64 // o2m and r2m relations by model, id, field, context
 	m2mLinks   map[string]map[[2]int64]bool                     // many2many relations by relation model and ids
+	memo       map[string][]interface{}                         // memoized method results by call key
+	// timeDependentReads counts the reads of time dependent fields, so that
+	// the results of methods that read them are not memoized.
+	timeDependentReads int
 }
 
 // notInCacheError is returned when a request in cache returns no entry
@@ -47,6 +51,23 @@ func (nepe nonExistentPathError) Error() string {
 	return "requested path is broken"
 }
 
+// getMemo returns the memoized results of the method call with the given key
+func (c *cache) getMemo(key string) ([]interface{}, bool) {
+	res, ok := c.memo[key]
+	return res, ok
+}
+
+// setMemo memoizes the results of the method call with the given key
+func (c *cache) setMemo(key string, res []interface{}) {
+	c.memo[key] = res
+}
+
+// clearMemo removes all memoized method results.
+// It must be called each time records are modified.
+func (c *cache) clearMemo() {
+	c.memo = make(map[string][]interface{})
+}
+
 // updateEntry creates or updates an entry in the cache defined by its model, id and fieldName.
 // fieldName can be a path
 func (c *cache) updateEntry(mi *Model, id int64, fieldName string, value interface{}, ctxSlug string) error {
@@ -192,6 +213,22 @@ func (c *cache) removeM2MLinks(fi *Field, id int64) {
 	}
 }
 
+// removeM2MLink removes the M2M link between the record with the given
+// ID and the record with the given relID on the given field.
+func (c *cache) removeM2MLink(fi *Field, id, relID int64) {
+	c.Lock()
+	defer c.Unlock()
+	if _, exists := c.m2mLinks[fi.m2mRelModel.name]; !exists {
+		return
+	}
+	ourIndex := (strings.Compare(fi.m2mOurField.name, fi.m2mTheirField.name) + 1) / 2
+	theirIndex := (ourIndex + 1) % 2
+	var link [2]int64
+	link[ourIndex] = id
+	link[theirIndex] = relID
+	delete(c.m2mLinks[fi.m2mRelModel.name], link)
+}
+
 // addM2MLink adds an M2M link between this record with its given ID
 // and the records given by values on the given field.
 func (c *cache) addM2MLink(fi *Field, id int64, values []int64) {
@@ -253,6 +290,7 @@ func (c *cache) addRecord(mi *Model, id int64, fMap FieldMap, ctxSlug string) {
 // this method, since this will bring discrepancies in the other
 // records references (One2Many and Many2Many fields).
 func (c *cache) invalidateRecord(mi *Model, id int64) {
+	c.clearMemo()
 	c.deleteData(mi.name, id)
 	for _, fi := range mi.fields.registryByJSON {
 		if fi.fieldType == fieldtype.Many2Many {
@@ -263,6 +301,7 @@ func (c *cache) invalidateRecord(mi *Model, id int64) {
 
 // removeEntry removes the given entry from cache
 func (c *cache) removeEntry(mi *Model, id int64, fieldName, ctxSlug string) {
+	c.clearMemo()
 	if !c.checkIfInCache(mi, []int64{id}, []string{fieldName}, ctxSlug, true) {
 		return
 	}
@@ -394,6 +433,7 @@ func newCache() *cache {
 		data:       make(map[string]map[int64]FieldMap),
 		x2mRelated: make(map[string]map[int64]map[string]map[string]int64),
 		m2mLinks:   make(map[string]map[[2]int64]bool),
+		memo:       make(map[string][]interface{}),
 	}
 	return &res
 }
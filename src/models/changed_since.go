@@ -0,0 +1,31 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"time"
+
+	"github.com/hexya-erp/hexya/src/models/types/dates"
+)
+
+// ChangedSince returns the records of this model that have been created or
+// written at or after since, typically to synchronize an external system
+// with the changes made since its last synchronization.
+//
+// Records are ordered by write date, then by creation date for the records
+// that have never been written. Deleted records are not returned since they
+// are not kept in the database. ChangedSince panics if this model has no
+// CreateDate and WriteDate fields, i.e. if it is a manual or a mixin model.
+func (m *Model) ChangedSince(env Environment, since time.Time) *RecordCollection {
+	_, hasCreateDate := m.fields.Get("CreateDate")
+	_, hasWriteDate := m.fields.Get("WriteDate")
+	if !hasCreateDate || !hasWriteDate {
+		log.Panic("ChangedSince can only be used on models with CreateDate and WriteDate fields", "model", m.name)
+	}
+	sinceDT := dates.DateTime{Time: since.UTC()}
+	writeDate := m.FieldName("WriteDate")
+	createDate := m.FieldName("CreateDate")
+	cond := m.Field(writeDate).GreaterOrEqual(sinceDT).Or().Field(createDate).GreaterOrEqual(sinceDT)
+	return env.Pool(m.name).Search(cond).OrderBy("WriteDate", "CreateDate", "ID").Fetch()
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"reflect"
+	"sort"
+)
+
+// A FieldChange holds the values of a field of a record
+// before and after a write.
+type FieldChange struct {
+	Old interface{}
+	New interface{}
+}
+
+// A Changeset holds the changes made by a write to a record,
+// by field name. Only the fields whose value has changed are listed.
+type Changeset map[string]FieldChange
+
+// An AfterWriteHook is a function called after each write on the records
+// of a model, with the Changeset of each record by id. Records whose values
+// have not changed are not included.
+type AfterWriteHook func(rc *RecordCollection, changes map[int64]Changeset)
+
+// AfterWrite registers the given hook to be called after each write on the
+// records of this model, once the computed fields have been updated and the
+// constraints checked.
+//
+// Only the stored fields given to the write are compared. Their values are
+// read before and after the update in a single query each, and only when at
+// least one hook is registered on the model.
+func (m *Model) AfterWrite(hook AfterWriteHook) {
+	m.afterWriteHooks = append(m.afterWriteHooks, hook)
+}
+
+// changesetFields returns the names of the stored fields of fMap, which must
+// have JSON field names as keys, that are compared by changesets. It returns
+// nil if no AfterWriteHook is registered on the model.
+func (rc *RecordCollection) changesetFields(fMap FieldMap) []FieldName {
+	if len(rc.model.afterWriteHooks) == 0 || rc.hasNegIds {
+		return nil
+	}
+	var res []FieldName
+	for jsonName := range fMap {
+		fi := rc.model.fields.MustGet(jsonName)
+		if fi.json == "write_date" || fi.json == "write_uid" || fi.isContextedField() {
+			continue
+		}
+		res = append(res, rc.model.FieldName(fi.name))
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name() < res[j].Name()
+	})
+	return res
+}
+
+// readChangesetValues reads the given fields of the records of this
+// RecordCollection from the database in a single query and returns
+// their values by record id and field name.
+func (rc *RecordCollection) readChangesetValues(fields []FieldName) map[int64]map[string]interface{} {
+	if len(fields) == 0 {
+		return nil
+	}
+	rSet := rc.ForceLoad(fields...)
+	res := make(map[int64]map[string]interface{}, rSet.Len())
+	for _, id := range rSet.Ids() {
+		values := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			values[field.Name()] = rc.env.cache.get(rc.model, id, field.JSON(), rc.query.ctxArgsSlug())
+		}
+		res[id] = values
+	}
+	return res
+}
+
+// callAfterWriteHooks calls the AfterWriteHook functions of the model with the
+// changes of the given fields between oldValues, as returned by readChangesetValues
+// before the update, and their current values in the database.
+func (rc *RecordCollection) callAfterWriteHooks(fields []FieldName, oldValues map[int64]map[string]interface{}) {
+	if len(fields) == 0 {
+		return
+	}
+	newValues := rc.readChangesetValues(fields)
+	changes := make(map[int64]Changeset)
+	for id, oldVals := range oldValues {
+		for field, oldVal := range oldVals {
+			newVal := newValues[id][field]
+			if reflect.DeepEqual(oldVal, newVal) {
+				continue
+			}
+			if changes[id] == nil {
+				changes[id] = make(Changeset)
+			}
+			changes[id][field] = FieldChange{Old: oldVal, New: newVal}
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+	for _, hook := range rc.model.afterWriteHooks {
+		hook(rc, changes)
+	}
+}
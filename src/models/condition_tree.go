@@ -0,0 +1,187 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"reflect"
+
+	"github.com/hexya-erp/hexya/src/models/fieldtype"
+	"github.com/hexya-erp/hexya/src/models/operator"
+	"github.com/hexya-erp/hexya/src/tools/nbutils"
+	"github.com/hexya-erp/hexya/src/tools/typesutils"
+)
+
+// A GroupOperator is the boolean operator that joins
+// the children of a group of a ConditionTree.
+type GroupOperator string
+
+// Group operators
+const (
+	And GroupOperator = "AND"
+	Or  GroupOperator = "OR"
+)
+
+// A ConditionNode is a node of a ConditionTree. It is either a group
+// of other nodes joined by a GroupOperator or a leaf predicate.
+type ConditionNode struct {
+	group    GroupOperator
+	children []ConditionNode
+	field    FieldName
+	operator operator.Operator
+	value    interface{}
+}
+
+// A ConditionTree builds a Condition on a model from a tree of AND/OR groups
+// and leaf predicates. Unlike the fluent Condition API, the fields, operators
+// and values of a ConditionTree are only known at runtime, typically when the
+// condition is built by a program or by an advanced search UI.
+//
+// Leaves are validated against the fields of the model when the tree is compiled.
+type ConditionTree struct {
+	model *Model
+}
+
+// NewConditionTree returns a new ConditionTree to build a Condition on this model.
+func (m *Model) NewConditionTree() *ConditionTree {
+	return &ConditionTree{model: m}
+}
+
+// Group returns a node joining the given children with op, which
+// must be And or Or. An empty group matches all records.
+func (ct *ConditionTree) Group(op GroupOperator, children ...ConditionNode) ConditionNode {
+	return ConditionNode{
+		group:    op,
+		children: children,
+	}
+}
+
+// Leaf returns a node with the predicate 'field op value'. field can be a
+// path through relation fields such as "Partner.Country.Name".
+func (ct *ConditionTree) Leaf(field FieldName, op operator.Operator, value interface{}) ConditionNode {
+	return ConditionNode{
+		field:    field,
+		operator: op,
+		value:    value,
+	}
+}
+
+// Compile returns the Condition of the given root node of this tree.
+//
+// Compile panics if a group operator is neither And nor Or, if a field does
+// not exist, if an operator cannot be used on its field or if a value cannot
+// be converted to the type of its field.
+func (ct *ConditionTree) Compile(root ConditionNode) *Condition {
+	if root.field == nil {
+		return ct.compileGroup(root)
+	}
+	return ct.compileLeaf(root)
+}
+
+// compileGroup returns the Condition of the given group node
+func (ct *ConditionTree) compileGroup(node ConditionNode) *Condition {
+	if node.group != And && node.group != Or {
+		log.Panic("Unknown group operator in condition tree", "model", ct.model.name, "operator", node.group)
+	}
+	res := newCondition()
+	for _, child := range node.children {
+		cond := ct.Compile(child)
+		if node.group == Or && !res.IsEmpty() {
+			res = res.OrCond(cond)
+			continue
+		}
+		res = res.AndCond(cond)
+	}
+	return res
+}
+
+// compileLeaf returns the Condition of the given leaf node
+func (ct *ConditionTree) compileLeaf(node ConditionNode) *Condition {
+	fi := ct.model.getRelatedFieldInfo(node.field)
+	if !node.operator.IsValid() {
+		log.Panic("Unknown operator in condition tree", "model", ct.model.name, "field", node.field.Name(), "operator", node.operator)
+	}
+	if !operatorAppliesToField(node.operator, fi) {
+		log.Panic("Operator cannot be used on this field", "model", ct.model.name, "field", node.field.Name(), "type", fi.fieldType, "operator", node.operator)
+	}
+	checkConditionTreeValue(ct.model, node, fi)
+	return (&ConditionStart{}).Field(node.field).AddOperator(node.operator, node.value)
+}
+
+// operatorAppliesToField returns true if op can be used in a condition on fi.
+func operatorAppliesToField(op operator.Operator, fi *Field) bool {
+	switch op {
+	case operator.Like, operator.ILike, operator.Contains, operator.NotContains, operator.IContains, operator.NotIContains:
+		switch fi.fieldType {
+		case fieldtype.Char, fieldtype.Text, fieldtype.HTML, fieldtype.Selection, fieldtype.Reference:
+			return true
+		case fieldtype.Array:
+			return op == operator.Contains
+		}
+		// Relation fields are searched by name
+		return fi.isRelationField()
+	case operator.Greater, operator.GreaterOrEqual, operator.Lower, operator.LowerOrEqual:
+		switch fi.fieldType {
+		case fieldtype.Integer, fieldtype.Float, fieldtype.Date, fieldtype.DateTime, fieldtype.Char, fieldtype.Text, fieldtype.Selection:
+			return true
+		}
+		return false
+	case operator.ChildOf:
+		return fi.isRelationField() || fi.json == ID.JSON()
+	case operator.ContainsAll, operator.Overlaps:
+		return fi.fieldType == fieldtype.Array
+	}
+	return true
+}
+
+// checkConditionTreeValue panics if the value of the given leaf node
+// cannot be converted to the type of fi. Nil values and functions
+// evaluated at query time are not checked.
+func checkConditionTreeValue(m *Model, node ConditionNode, fi *Field) {
+	if node.value == nil || reflect.ValueOf(node.value).Kind() == reflect.Func {
+		return
+	}
+	if _, ok := node.value.(RecordSet); ok {
+		if !fi.isRelationField() && fi.json != ID.JSON() {
+			log.Panic("RecordSet values can only be used on relation fields", "model", m.name, "field", node.field.Name())
+		}
+		return
+	}
+	values := []interface{}{node.value}
+	if node.operator.IsMulti() {
+		val := reflect.ValueOf(node.value)
+		if val.Kind() != reflect.Slice {
+			log.Panic("Operator expects a slice value", "model", m.name, "field", node.field.Name(), "operator", node.operator, "value", node.value)
+		}
+		values = make([]interface{}, val.Len())
+		for i := 0; i < val.Len(); i++ {
+			values[i] = val.Index(i).Interface()
+		}
+	}
+	for _, v := range values {
+		var err error
+		switch {
+		case fi.isRelationField(), fi.json == ID.JSON():
+			if _, isString := v.(string); isString && fi.isRelationField() && !node.operator.IsMulti() {
+				// Name search on the related model
+				continue
+			}
+			_, err = nbutils.CastToInteger(v)
+		case fi.fieldType == fieldtype.Array && node.operator == operator.Contains:
+			err = typesutils.Convert([]interface{}{v}, reflect.New(fi.structField.Type).Interface(), false)
+		case node.operator == operator.Like, node.operator == operator.ILike, node.operator == operator.Contains,
+			node.operator == operator.NotContains, node.operator == operator.IContains, node.operator == operator.NotIContains:
+			if _, isString := v.(string); !isString {
+				log.Panic("Operator expects a string value", "model", m.name, "field", node.field.Name(), "operator", node.operator, "value", v)
+			}
+		case fi.structField.Type.Kind() == reflect.String && reflect.TypeOf(v).Kind() != reflect.String:
+			// Go would convert integers to strings as runes
+			log.Panic("Field expects a string value", "model", m.name, "field", node.field.Name(), "value", v)
+		default:
+			err = typesutils.Convert(v, reflect.New(fi.structField.Type).Interface(), false)
+		}
+		if err != nil {
+			log.Panic("Value cannot be converted to the type of the field", "model", m.name, "field", node.field.Name(), "type", fi.structField.Type, "value", v, "error", err)
+		}
+	}
+}
@@ -17,8 +17,11 @@ package models
 import (
 	"fmt"
 	"reflect"
+	"time"
 
+	"github.com/hexya-erp/hexya/src/models/fieldtype"
 	"github.com/hexya-erp/hexya/src/models/operator"
+	"github.com/hexya-erp/hexya/src/models/types/dates"
 )
 
 // Expression separation symbols
@@ -171,6 +174,26 @@ func (c Condition) HasField(f *Field) bool {
 	return len(preds) > 0
 }
 
+// equalityValues returns the values of the fields of this model that are
+// searched with the Equals operator and combined with AND at the top level
+// of this condition. Such values must be set on any record matching it.
+func (c Condition) equalityValues() FieldMap {
+	res := make(FieldMap)
+	for i, p := range c.predicates {
+		if p.isCond || p.isNot || p.isOr || len(p.exprs) != 1 || p.operator != operator.Equals {
+			continue
+		}
+		if i+1 < len(c.predicates) && c.predicates[i+1].isOr {
+			continue
+		}
+		if reflect.ValueOf(p.arg).Kind() == reflect.Func {
+			continue
+		}
+		res[p.exprs[0].JSON()] = p.arg
+	}
+	return res
+}
+
 // PredicatesWithField returns all predicates of this condition (including
 // nested conditions) that concern the given field.
 func (c Condition) PredicatesWithField(f *Field) []*predicate {
@@ -188,6 +211,93 @@ func (c Condition) PredicatesWithField(f *Field) []*predicate {
 	return res
 }
 
+// A Predicate is a read-only view of a leaf predicate of a Condition,
+// as given to Walk visitors.
+type Predicate struct {
+	field    FieldName
+	operator operator.Operator
+	arg      interface{}
+	isOr     bool
+	isNot    bool
+	parent   *Predicate
+}
+
+// Field returns the field path of this predicate (e.g. "Profile.Age")
+func (p Predicate) Field() FieldName {
+	return p.field
+}
+
+// Operator returns the operator of this predicate
+func (p Predicate) Operator() operator.Operator {
+	return p.operator
+}
+
+// Argument returns the argument of this predicate
+func (p Predicate) Argument() interface{} {
+	return p.arg
+}
+
+// IsOr returns true if this predicate is joined to the previous
+// one of its condition with OR, and false if it is joined with AND.
+func (p Predicate) IsOr() bool {
+	return p.isOr
+}
+
+// IsNot returns true if this predicate is negated
+func (p Predicate) IsNot() bool {
+	return p.isNot
+}
+
+// IsGroup returns true if this predicate stands for a nested condition.
+// Group predicates are never given to visitors, but can be reached with Parent.
+func (p Predicate) IsGroup() bool {
+	return p.field == nil
+}
+
+// Parent returns the group predicate of the nested condition this
+// predicate belongs to, or nil if it belongs to the condition being walked.
+func (p Predicate) Parent() *Predicate {
+	return p.parent
+}
+
+// Depth returns the nesting level of this predicate, 0 being at the
+// top level of the condition being walked.
+func (p Predicate) Depth() int {
+	var depth int
+	for par := p.parent; par != nil; par = par.parent {
+		depth++
+	}
+	return depth
+}
+
+// Walk calls visitor for each leaf predicate of this condition, recursing
+// into nested conditions in order. The logical structure can be retrieved
+// through the IsOr, IsNot and Parent methods of the given Predicate.
+func (c Condition) Walk(visitor func(predicate Predicate)) {
+	c.walk(visitor, nil)
+}
+
+// walk is the recursive implementation of Walk
+func (c Condition) walk(visitor func(predicate Predicate), parent *Predicate) {
+	for _, p := range c.predicates {
+		if p.isCond {
+			if p.cond == nil {
+				continue
+			}
+			p.cond.walk(visitor, &Predicate{isOr: p.isOr, isNot: p.isNot, parent: parent})
+			continue
+		}
+		visitor(Predicate{
+			field:    joinFieldNames(p.exprs, ExprSep),
+			operator: p.operator,
+			arg:      p.arg,
+			isOr:     p.isOr,
+			isNot:    p.isNot,
+			parent:   parent,
+		})
+	}
+}
+
 // String method for the Condition. Recursively print all predicates.
 func (c Condition) String() string {
 	var res string
@@ -246,6 +356,36 @@ func (cs ConditionStart) FilteredOn(field FieldName, condition *Condition) *Cond
 	return &res
 }
 
+// Any adds a condition matching the records that have at least one record in
+// the given one2many or many2many field matching the given condition. It is
+// rendered as an SQL EXISTS subquery, so that no join is made on the related
+// records. A nil or empty condition matches any related record.
+func (cs ConditionStart) Any(field FieldName, condition *Condition) *Condition {
+	return cs.existsPredicate(field, condition, operator.In)
+}
+
+// None adds a condition matching the records that have no record in the given
+// one2many or many2many field matching the given condition. It is rendered as
+// an SQL NOT EXISTS subquery. A nil or empty condition matches the records
+// without any related record.
+func (cs ConditionStart) None(field FieldName, condition *Condition) *Condition {
+	return cs.existsPredicate(field, condition, operator.NotIn)
+}
+
+// existsPredicate returns a new Condition with a predicate on the ID of the
+// owner of the given to-many field and an existsSubquery argument.
+func (cs ConditionStart) existsPredicate(field FieldName, condition *Condition, op operator.Operator) *Condition {
+	if condition == nil {
+		condition = newCondition()
+	}
+	exprs := splitFieldNames(field, ExprSep)
+	idPath := append(append([]FieldName{}, exprs[:len(exprs)-1]...), ID)
+	return cs.Field(joinFieldNames(idPath, ExprSep)).AddOperator(op, existsSubquery{
+		field: exprs[len(exprs)-1],
+		cond:  condition,
+	})
+}
+
 // A ConditionField is a partial Condition when we have set
 // a field name in a predicate and are about to add an operator.
 type ConditionField struct {
@@ -355,7 +495,8 @@ func (c ConditionField) ILike(data interface{}) *Condition {
 	return c.AddOperator(operator.ILike, data)
 }
 
-// Contains appends the 'LIKE %%' operator to the current Condition
+// Contains appends the 'LIKE %%' operator to the current Condition.
+// On array fields, it matches the records whose field contains data.
 func (c ConditionField) Contains(data interface{}) *Condition {
 	return c.AddOperator(operator.Contains, data)
 }
@@ -375,6 +516,20 @@ func (c ConditionField) NotIContains(data interface{}) *Condition {
 	return c.AddOperator(operator.NotIContains, data)
 }
 
+// ContainsAll appends the '@>' operator to the current Condition.
+// It can only be used on array fields and matches the records whose
+// field contains all the elements of data.
+func (c ConditionField) ContainsAll(data interface{}) *Condition {
+	return c.AddOperator(operator.ContainsAll, data)
+}
+
+// Overlaps appends the '&&' operator to the current Condition.
+// It can only be used on array fields and matches the records whose
+// field has at least one element in common with data.
+func (c ConditionField) Overlaps(data interface{}) *Condition {
+	return c.AddOperator(operator.Overlaps, data)
+}
+
 // In appends the 'IN' operator to the current Condition
 func (c ConditionField) In(data interface{}) *Condition {
 	return c.AddOperator(operator.In, data)
@@ -390,6 +545,16 @@ func (c ConditionField) ChildOf(data interface{}) *Condition {
 	return c.AddOperator(operator.ChildOf, data)
 }
 
+// InIdsOrChildOf appends a condition matching the records whose value is one of
+// the given ids or a descendant of one of them through the "Parent" field of the
+// related model. If the related model has no "Parent" field, it is the same as In.
+func (c ConditionField) InIdsOrChildOf(ids []int64) *Condition {
+	if len(ids) == 0 {
+		return c.In(ids)
+	}
+	return c.AddOperator(operator.ChildOf, ids)
+}
+
 // IsNull checks if the current condition field is null
 func (c ConditionField) IsNull() *Condition {
 	return c.AddOperator(operator.Equals, nil)
@@ -400,6 +565,104 @@ func (c ConditionField) IsNotNull() *Condition {
 	return c.AddOperator(operator.NotEquals, nil)
 }
 
+// Today matches the date or datetime values of this field that are on the current day.
+//
+// Like the other relative date methods, the current date is computed when the query
+// is performed, in the timezone given by the "tz" key of the context (UTC by default).
+func (c ConditionField) Today() *Condition {
+	return c.dateRange(todayRange)
+}
+
+// LastNDays matches the date or datetime values of this field that are on
+// one of the last n days, including the current day.
+func (c ConditionField) LastNDays(n int) *Condition {
+	if n < 1 {
+		log.Panic("LastNDays requires a strictly positive number of days", "field", c.Name(), "days", n)
+	}
+	return c.dateRange(lastNDaysRange(n))
+}
+
+// ThisMonth matches the date or datetime values of this field that are in the current month.
+func (c ConditionField) ThisMonth() *Condition {
+	return c.dateRange(thisMonthRange)
+}
+
+// ThisYear matches the date or datetime values of this field that are in the current year.
+func (c ConditionField) ThisYear() *Condition {
+	return c.dateRange(thisYearRange)
+}
+
+// A dateRangeFunc returns the first day of a date range and the first day
+// after it, given the current day at midnight.
+type dateRangeFunc func(today time.Time) (time.Time, time.Time)
+
+// todayRange is the dateRangeFunc of the current day
+func todayRange(today time.Time) (time.Time, time.Time) {
+	return today, today.AddDate(0, 0, 1)
+}
+
+// lastNDaysRange returns the dateRangeFunc of the last n days, including the current day
+func lastNDaysRange(n int) dateRangeFunc {
+	return func(today time.Time) (time.Time, time.Time) {
+		return today.AddDate(0, 0, 1-n), today.AddDate(0, 0, 1)
+	}
+}
+
+// thisMonthRange is the dateRangeFunc of the current month
+func thisMonthRange(today time.Time) (time.Time, time.Time) {
+	start := today.AddDate(0, 0, 1-today.Day())
+	return start, start.AddDate(0, 1, 0)
+}
+
+// thisYearRange is the dateRangeFunc of the current year
+func thisYearRange(today time.Time) (time.Time, time.Time) {
+	start := today.AddDate(0, 0, 1-today.YearDay())
+	return start, start.AddDate(1, 0, 0)
+}
+
+// dateRange adds to the current condition a predicate group matching the values
+// of this field between the bounds returned by limits, the end bound excluded.
+func (c ConditionField) dateRange(limits dateRangeFunc) *Condition {
+	field := joinFieldNames(c.exprs, ExprSep)
+	bound := func(end bool) func(RecordSet) interface{} {
+		return func(rs RecordSet) interface{} {
+			fi := rs.Collection().model.getRelatedFieldInfo(field)
+			start, stop := dateRangeBounds(time.Now(), rs.Env().Context().GetString("tz"), limits, fi.fieldType == fieldtype.DateTime)
+			if end {
+				return stop
+			}
+			return start
+		}
+	}
+	rangeCond := ConditionStart{}.Field(field).GreaterOrEqual(bound(false)).And().Field(field).Lower(bound(true))
+	cond := c.cs.cond
+	cond.predicates = append(cond.predicates, predicate{
+		cond:   rangeCond,
+		isCond: true,
+		isNot:  c.cs.nextIsNot,
+		isOr:   c.cs.nextIsOr,
+	})
+	return &cond
+}
+
+// dateRangeBounds returns the bounds computed by limits for the day of now in
+// the timezone tz. Bounds are dates.Date values, or UTC dates.DateTime values
+// of midnight in tz if datetime is true.
+func dateRangeBounds(now time.Time, tz string, limits dateRangeFunc, datetime bool) (interface{}, interface{}) {
+	loc, err := dates.LoadLocation(tz)
+	if err != nil {
+		log.Warn("Unknown timezone in context, using UTC", "tz", tz, "error", err)
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	start, end := limits(time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc))
+	if datetime {
+		return dates.DateTime{Time: start.UTC()}, dates.DateTime{Time: end.UTC()}
+	}
+	return dates.Date{Time: time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)},
+		dates.Date{Time: time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)}
+}
+
 // IsEmpty check the condition arguments are empty or not.
 func (c *Condition) IsEmpty() bool {
 	switch {
@@ -454,8 +717,11 @@ func (c *Condition) substituteChildOfOperator(rc *RecordCollection) {
 		}
 		recModel := rc.model.getRelatedModelInfo(joinFieldNames(p.exprs, ExprSep))
 		if !recModel.hasParentField() {
-			// If we have no parent field, then we fetch only the "parent" record
+			// If we have no parent field, then we fetch only the "parent" record(s)
 			c.predicates[i].operator = operator.Equals
+			if reflect.ValueOf(p.arg).Kind() == reflect.Slice {
+				c.predicates[i].operator = operator.In
+			}
 			continue
 		}
 		var parentIds []int64
@@ -467,3 +733,52 @@ func (c *Condition) substituteChildOfOperator(rc *RecordCollection) {
 
 // A ClientEvaluatedString is a string that contains code that will be evaluated by the client
 type ClientEvaluatedString string
+
+// A sqlNull is the argument of a predicate that only matches NULL values
+// with the Equals operator and non NULL values with the NotEquals operator.
+// Unlike nil, it does not match the zero value of the field type.
+type sqlNull struct{}
+
+// An existsSubquery is the argument of a predicate on the ID of a record that
+// matches if the record has (In operator) or has not (NotIn operator) related
+// records in the given to-many field matching cond.
+type existsSubquery struct {
+	field FieldName
+	cond  *Condition
+}
+
+// serialize returns the given predicate with this existsSubquery argument
+// as an Odoo "any" (or "not any" for the NotIn operator) domain leaf on the
+// to-many field, with the serialized condition of the related records.
+func (es existsSubquery) serialize(p predicate) []interface{} {
+	path := append(append([]FieldName{}, p.exprs[:len(p.exprs)-1]...), es.field)
+	op := operator.Operator("any")
+	if p.operator == operator.NotIn {
+		op = "not any"
+	}
+	subDomain := serializePredicates(es.cond.predicates)
+	if subDomain == nil {
+		subDomain = []interface{}{}
+	}
+	return []interface{}{joinFieldNames(path, ExprSep).JSON(), op, subDomain}
+}
+
+// A Subquery selects the ids of the records of a model matching a condition.
+//
+// It can be used as argument of the In and NotIn operators of a relation field
+// pointing to this model, in which case it is rendered as an SQL subquery and the
+// ids are never fetched from the database.
+type Subquery struct {
+	model *Model
+	cond  *Condition
+}
+
+// Model returns the model of the records selected by this Subquery
+func (s Subquery) Model() *Model {
+	return s.model
+}
+
+// Condition returns the condition on which records are selected by this Subquery
+func (s Subquery) Condition() *Condition {
+	return s.cond
+}
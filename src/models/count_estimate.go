@@ -0,0 +1,39 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+// countEstimateThreshold is the minimum estimated number of rows
+// of a table for SearchCountEstimate to return an estimated count.
+var countEstimateThreshold = 100000
+
+// SetCountEstimateThreshold sets the minimum number of rows a table must have,
+// according to the statistics of the database, for SearchCountEstimate to return
+// an estimated count instead of an exact one. Default is 100000.
+func SetCountEstimateThreshold(threshold int) {
+	countEstimateThreshold = threshold
+}
+
+// SearchCountEstimate returns the number of records that match the RecordSet
+// conditions and true if this number is an estimate.
+//
+// An exact COUNT query is slow on huge tables. If the RecordSet has no
+// condition and is not grouped, the number of rows of the table is taken from
+// the statistics of the database (pg_class.reltuples), which are updated by
+// VACUUM and ANALYZE. This estimate is returned if it is at least the threshold
+// set by SetCountEstimateThreshold. In all other cases, the exact number of
+// records is returned as with SearchCount, and the second value is false.
+func (rc *RecordCollection) SearchCountEstimate() (int, bool) {
+	rSet := rc.Limit(0)
+	rSet.applyContexts()
+	if rc.model.IsManual() || len(rSet.query.groups) > 0 || !rSet.query.cond.IsEmpty() || !rSet.query.ctxCond.IsEmpty() {
+		return rc.SearchCount(), false
+	}
+	var estimate float64
+	rSet.env.cr.readGet(rSet.env.readOnly, &estimate, `SELECT COALESCE((SELECT reltuples FROM pg_class WHERE oid = to_regclass(?)), -1)`,
+		adapters[db.DriverName()].quoteTableName(rc.model.tableName))
+	if estimate < 0 || estimate < float64(countEstimateThreshold) {
+		return rc.SearchCount(), false
+	}
+	return int(estimate), true
+}
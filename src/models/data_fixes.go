@@ -0,0 +1,227 @@
+// Copyright 2019 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hexya-erp/hexya/src/models/security"
+)
+
+// dataFixLogTable is the name of the table in which applied data fixes are logged.
+const dataFixLogTable = "hexya_data_fix_log"
+
+// A DataFix is a one-off script that fixes data in the database.
+//
+// Data fixes are run once after the database schema has been synchronized,
+// ordered by their version. Each data fix that has been run successfully is
+// logged in the database so that it is never run again.
+type DataFix struct {
+	name    string
+	version string
+	fnct    func(Environment) error
+}
+
+// Name returns the name of this DataFix
+func (df *DataFix) Name() string {
+	return df.name
+}
+
+// Version returns the version of this DataFix
+func (df *DataFix) Version() string {
+	return df.version
+}
+
+// RegisterDataFix registers a new data fix script with the given name.
+//
+// version must be a semantic version such as "1.2.0" and is used to order
+// data fixes between each other. The script is executed as super user in
+// its own transaction. If it returns an error, the transaction is rolled
+// back and the database synchronization panics. Since the data fix has not
+// been logged, it will be run again at the next synchronization.
+func RegisterDataFix(name, version string, fnct func(env Environment) error) *DataFix {
+	if _, err := parseSemVer(version); err != nil {
+		log.Panic("Invalid data fix version", "name", name, "version", version, "error", err)
+	}
+	df := &DataFix{
+		name:    name,
+		version: version,
+		fnct:    fnct,
+	}
+	Registry.Lock()
+	defer Registry.Unlock()
+	if _, exists := Registry.dataFixes[name]; exists {
+		log.Panic("Trying to register already existing data fix", "name", name)
+	}
+	Registry.dataFixes[name] = df
+	return df
+}
+
+// runDataFixes executes all the registered data fixes that have not
+// been applied yet on the database, ordered by version.
+func runDataFixes() {
+	dbExecuteNoTx(fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+	name varchar NOT NULL PRIMARY KEY,
+	version varchar NOT NULL,
+	applied_at timestamp without time zone NOT NULL DEFAULT (now() at time zone 'UTC')
+)`, dataFixLogTable))
+	dataFixes := make([]*DataFix, 0, len(Registry.dataFixes))
+	for _, df := range Registry.dataFixes {
+		dataFixes = append(dataFixes, df)
+	}
+	sort.Slice(dataFixes, func(i, j int) bool {
+		vi, _ := parseSemVer(dataFixes[i].version)
+		vj, _ := parseSemVer(dataFixes[j].version)
+		if cmp := vi.compare(vj); cmp != 0 {
+			return cmp < 0
+		}
+		return dataFixes[i].name < dataFixes[j].name
+	})
+	for _, df := range dataFixes {
+		df.run()
+	}
+}
+
+// run executes this DataFix if it has not been applied yet and logs it.
+func (df *DataFix) run() {
+	err := ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+		var count int
+		env.Cr().Get(&count, fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE name = ?`, dataFixLogTable), df.name)
+		if count > 0 {
+			return
+		}
+		log.Info("Running data fix", "name", df.name, "version", df.version)
+		if err := df.fnct(env); err != nil {
+			log.Panic("Data fix returned an error", "name", df.name, "error", err)
+		}
+		env.Cr().Execute(fmt.Sprintf(`INSERT INTO %s (name, version) VALUES (?, ?)`, dataFixLogTable), df.name, df.version)
+	})
+	if err != nil {
+		log.Panic("Error while running data fix", "name", df.name, "version", df.version, "error", err)
+	}
+}
+
+// A semVer is a parsed semantic version
+type semVer struct {
+	numbers    [3]int
+	preRelease string
+}
+
+// parseSemVer parses the given semantic version string.
+// A leading 'v' is accepted and missing minor or patch numbers are set to 0.
+// Build metadata is ignored.
+func parseSemVer(version string) (semVer, error) {
+	var res semVer
+	v := strings.TrimPrefix(version, "v")
+	if i := strings.Index(v, "+"); i >= 0 {
+		v = v[:i]
+	}
+	if i := strings.Index(v, "-"); i >= 0 {
+		res.preRelease = v[i+1:]
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) > 3 {
+		return res, fmt.Errorf("too many version numbers in '%s'", version)
+	}
+	for i, part := range parts {
+		num, err := strconv.Atoi(part)
+		if err != nil || num < 0 {
+			return res, fmt.Errorf("invalid version number '%s' in '%s'", part, version)
+		}
+		res.numbers[i] = num
+	}
+	return res, nil
+}
+
+// compare returns -1 if sv is lower than other, 1 if it is greater and 0 if they are equal.
+// A pre-release version is lower than the corresponding release.
+func (sv semVer) compare(other semVer) int {
+	for i := range sv.numbers {
+		switch {
+		case sv.numbers[i] < other.numbers[i]:
+			return -1
+		case sv.numbers[i] > other.numbers[i]:
+			return 1
+		}
+	}
+	switch {
+	case sv.preRelease == other.preRelease:
+		return 0
+	case sv.preRelease == "":
+		return 1
+	case other.preRelease == "":
+		return -1
+	}
+	return comparePreReleases(sv.preRelease, other.preRelease)
+}
+
+// comparePreReleases compares the two given non empty pre-release strings
+// following the semantic versioning precedence rules. Dot separated
+// identifiers are compared one by one: numeric identifiers are compared
+// numerically and have a lower precedence than alphanumeric identifiers.
+// Leading letters followed by digits (such as "rc10") are compared by
+// their letters first, then numerically by their digits, a bare prefix
+// (such as "rc") being lower.
+func comparePreReleases(pr1, pr2 string) int {
+	ids1 := strings.Split(pr1, ".")
+	ids2 := strings.Split(pr2, ".")
+	for i := 0; i < len(ids1) && i < len(ids2); i++ {
+		if cmp := comparePreReleaseIdentifiers(ids1[i], ids2[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	switch {
+	case len(ids1) < len(ids2):
+		return -1
+	case len(ids1) > len(ids2):
+		return 1
+	}
+	return 0
+}
+
+// comparePreReleaseIdentifiers compares two pre-release identifiers.
+func comparePreReleaseIdentifiers(id1, id2 string) int {
+	prefix1, num1, isNum1 := splitPreReleaseIdentifier(id1)
+	prefix2, num2, isNum2 := splitPreReleaseIdentifier(id2)
+	switch {
+	case prefix1 < prefix2:
+		return -1
+	case prefix1 > prefix2:
+		return 1
+	case !isNum1 && isNum2:
+		return -1
+	case isNum1 && !isNum2:
+		return 1
+	case isNum1 && num1 != num2:
+		if num1 < num2 {
+			return -1
+		}
+		return 1
+	case id1 < id2:
+		return -1
+	case id1 > id2:
+		return 1
+	}
+	return 0
+}
+
+// splitPreReleaseIdentifier splits the given identifier into its leading
+// non-digit prefix and its trailing number. isNum is false if the identifier
+// does not end with digits only after its prefix.
+func splitPreReleaseIdentifier(id string) (prefix string, num int, isNum bool) {
+	i := strings.IndexAny(id, "0123456789")
+	if i < 0 {
+		return id, 0, false
+	}
+	num, err := strconv.Atoi(id[i:])
+	if err != nil {
+		return id, 0, false
+	}
+	return id[:i], num, true
+}
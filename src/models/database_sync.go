@@ -5,6 +5,7 @@ package models
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 
 	"github.com/hexya-erp/hexya/src/models/security"
@@ -17,7 +18,12 @@ func SyncDatabase() {
 	dbTables := adapter.tables()
 	// Create or update sequences
 	updateDBSequences()
+	// Create extensions needed by indexes
+	createDBExtensions()
+	// Create the table of deleted records ids
+	createTombstoneTable()
 	// Create or update existing tables
+	var newComputedFields []*Field
 	for tableName, model := range Registry.registryByTableName {
 		if model.IsMixin() || model.IsManual() {
 			continue
@@ -25,7 +31,7 @@ func SyncDatabase() {
 		if _, ok := dbTables[tableName]; !ok {
 			createDBTable(model)
 		}
-		updateDBColumns(model)
+		newComputedFields = append(newComputedFields, updateDBColumns(model)...)
 		updateDBIndexes(model)
 	}
 	// Setup constraints
@@ -36,7 +42,10 @@ func SyncDatabase() {
 		buildSQLErrorSubstitutionMap(model)
 		updateDBForeignKeyConstraints(model)
 		updateDBConstraints(model)
+		updateDBPartialUniqueIndexes(model)
 	}
+	// Compute the values of new stored computed fields for existing records
+	computeNewStoredFields(newComputedFields)
 	// Run init method on each model
 	for _, model := range Registry.registryByTableName {
 		if model.IsMixin() {
@@ -47,6 +56,9 @@ func SyncDatabase() {
 
 	// Drop DB tables that are not in the models
 	for dbTable := range adapter.tables() {
+		if dbTable == dataFixLogTable || dbTable == tombstoneTable {
+			continue
+		}
 		var modelExists bool
 		for tableName, model := range Registry.registryByTableName {
 			if dbTable != tableName || model.IsMixin() {
@@ -59,6 +71,8 @@ func SyncDatabase() {
 			dropDBTable(dbTable)
 		}
 	}
+	// Run data fixes that have not been applied yet
+	runDataFixes()
 }
 
 // buildSQLErrorSubstitutionMap populates the sqlErrors map of the
@@ -67,12 +81,15 @@ func buildSQLErrorSubstitutionMap(model *Model) {
 	for sqlConstrName, sqlConstr := range model.sqlConstraints {
 		model.sqlErrors[sqlConstrName] = sqlConstr.errorString
 	}
+	for indexName, index := range model.partialUniques {
+		model.sqlErrors[indexName] = index.errorString
+	}
 	for _, field := range model.fields.registryByJSON {
 		if field.unique {
 			cName := fmt.Sprintf("%s_%s_key", model.tableName, field.json)
 			model.sqlErrors[cName] = fmt.Sprintf("%s must be unique", field.name)
 		}
-		if field.fieldType.IsFKRelationType() {
+		if field.fieldType.IsFKRelationType() && !field.noFK {
 			cName := fmt.Sprintf("%s_%s_fkey", model.tableName, field.json)
 			model.sqlErrors[cName] = fmt.Sprintf("%s must reference an existing %s record", field.name, field.relatedModelName)
 		}
@@ -145,10 +162,12 @@ func dropDBTable(tableName string) {
 }
 
 // updateDBColumns synchronizes the colums of the database with the
-// given Model.
-func updateDBColumns(mi *Model) {
+// given Model. It returns the stored computed fields whose column has
+// just been created.
+func updateDBColumns(mi *Model) []*Field {
 	adapter := adapters[db.DriverName()]
 	dbColumns := adapter.columns(mi.tableName)
+	var newComputedFields []*Field
 	// create or update columns from registry data
 	for colName, fi := range mi.fields.registryByJSON {
 		if colName == "id" || !fi.isStored() {
@@ -157,6 +176,9 @@ func updateDBColumns(mi *Model) {
 		dbColData, ok := dbColumns[colName]
 		if !ok {
 			createDBColumn(fi)
+			if fi.isComputedField() {
+				newComputedFields = append(newComputedFields, fi)
+			}
 			continue
 		}
 		if dbColData.DataType != adapter.typeSQL(fi) {
@@ -173,6 +195,44 @@ func updateDBColumns(mi *Model) {
 			dropDBColumn(mi.tableName, colName)
 		}
 	}
+	return newComputedFields
+}
+
+// computeBatchSize is the number of records computed in each
+// transaction by computeNewStoredFields.
+var computeBatchSize = 1000
+
+// computeNewStoredFields computes the values of the given stored computed
+// fields for all the records in the database. Records are computed by
+// batches of computeBatchSize, each in its own transaction.
+func computeNewStoredFields(fields []*Field) {
+	done := make(map[string]bool)
+	for _, fi := range fields {
+		key := fmt.Sprintf("%s-%s", fi.model.name, fi.compute)
+		if done[key] {
+			// Another field with the same compute method has been computed
+			continue
+		}
+		done[key] = true
+		log.Info("Computing new stored field", "model", fi.model.name, "field", fi.name)
+		var ids []int64
+		query := fmt.Sprintf(`SELECT id FROM %s ORDER BY id`, adapters[db.DriverName()].quoteTableName(fi.model.tableName))
+		if err := db.Select(&ids, query); err != nil {
+			log.Panic("Unable to fetch records to compute", "model", fi.model.name, "field", fi.name, "error", err)
+		}
+		for i := 0; i < len(ids); i += computeBatchSize {
+			end := i + computeBatchSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+			err := ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				env.Pool(fi.model.name).withIds(ids[i:end]).applyMethod(fi.compute, fi.precompute)
+			})
+			if err != nil {
+				log.Panic("Error while computing new stored field", "model", fi.model.name, "field", fi.name, "error", err)
+			}
+		}
+	}
 }
 
 // createDBColumn insert the column described by Field in the database
@@ -248,7 +308,7 @@ func updateDBForeignKeyConstraints(m *Model) {
 	adapter := adapters[db.DriverName()]
 	for colName, fi := range m.fields.registryByJSON {
 		fkContraintInDB := adapter.constraintExists(fmt.Sprintf("%s_%s_fkey", m.tableName, colName))
-		fieldIsFK := fi.fieldType.IsFKRelationType() && fi.isStored()
+		fieldIsFK := fi.fieldType.IsFKRelationType() && fi.isStored() && !fi.noFK
 		switch {
 		case fieldIsFK && !fkContraintInDB:
 			createFKConstraint(m.tableName, colName, fi.relatedModel.tableName, string(fi.onDelete))
@@ -320,9 +380,50 @@ func updateDBIndexes(m *Model) {
 		case indexInDB && !fi.index:
 			dropColumnIndex(m.tableName, colName)
 		}
+		trgmIndexInDB := adapter.indexExists(m.tableName, fmt.Sprintf("%s_%s_trgm_index", m.tableName, colName))
+		isTrgm := fi.searchType == TrigramSearch && fi.isStored()
+		switch {
+		case isTrgm && !trgmIndexInDB:
+			createColumnTrigramIndex(m.tableName, colName)
+		case trgmIndexInDB && !isTrgm:
+			dropColumnTrigramIndex(m.tableName, colName)
+		}
 	}
 }
 
+// createDBExtensions creates the PostgreSQL extensions required by the
+// fields of the registry if they do not exist yet.
+func createDBExtensions() {
+	for _, model := range Registry.registryByTableName {
+		if model.IsMixin() || model.IsManual() {
+			continue
+		}
+		for _, fi := range model.fields.registryByJSON {
+			if fi.searchType == TrigramSearch {
+				dbExecuteNoTx("CREATE EXTENSION IF NOT EXISTS pg_trgm")
+				return
+			}
+		}
+	}
+}
+
+// createColumnTrigramIndex creates a GIN trigram index for colName in the given table
+func createColumnTrigramIndex(tableName, colName string) {
+	adapter := adapters[db.DriverName()]
+	query := fmt.Sprintf(`
+		CREATE INDEX %s ON %s USING gin (%s gin_trgm_ops)
+	`, fmt.Sprintf("%s_%s_trgm_index", tableName, colName), adapter.quoteTableName(tableName), colName)
+	dbExecuteNoTx(query)
+}
+
+// dropColumnTrigramIndex drops the trigram index of colName in the given table
+func dropColumnTrigramIndex(tableName, colName string) {
+	query := fmt.Sprintf(`
+		DROP INDEX IF EXISTS %s
+	`, fmt.Sprintf("%s_%s_trgm_index", tableName, colName))
+	dbExecuteNoTx(query)
+}
+
 // createColumnIndex creates an column index for colName in the given table
 func createColumnIndex(tableName, colName string) {
 	adapter := adapters[db.DriverName()]
@@ -340,6 +441,127 @@ func dropColumnIndex(tableName, colName string) {
 	dbExecuteNoTx(query)
 }
 
+// updateDBPartialUniqueIndexes creates or drops the partial unique
+// indexes of the given Model
+func updateDBPartialUniqueIndexes(m *Model) {
+	adapter := adapters[db.DriverName()]
+	for indexName, index := range m.partialUniques {
+		definition := partialUniqueIndexSQL(m, index)
+		if adapter.indexExists(m.tableName, indexName) {
+			if adapter.indexComment(indexName) == definition {
+				continue
+			}
+			// The fields or the condition of the index have changed
+			dropIndex(indexName)
+		}
+		createPartialUniqueIndex(indexName, definition)
+	}
+dbIdxLoop:
+	for _, dbIndexName := range adapter.indexes(m.tableName, fmt.Sprintf("%%_%s_uniqidx", m.tableName)) {
+		for indexName := range m.partialUniques {
+			if indexName == dbIndexName {
+				continue dbIdxLoop
+			}
+		}
+		dropIndex(dbIndexName)
+	}
+}
+
+// createPartialUniqueIndex creates a partial unique index with the given name and
+// SQL definition, which is stored as the comment of the index so that changes of
+// the definition can be detected.
+func createPartialUniqueIndex(indexName, definition string) {
+	dbExecuteNoTx(definition)
+	dbExecuteNoTx(fmt.Sprintf(`COMMENT ON INDEX %s IS %s`, indexName, sqlLiteral(definition)))
+}
+
+// partialUniqueIndexSQL returns the SQL query that creates the given partial
+// unique index on the table of m
+func partialUniqueIndexSQL(m *Model, index partialUniqueIndex) string {
+	adapter := adapters[db.DriverName()]
+	cols := make([]string, len(index.fields))
+	for i, f := range index.fields {
+		fi := m.fields.MustGet(f.Name())
+		if !fi.isStored() {
+			log.Panic("Partial unique constraints can only be set on stored fields", "model", m.name, "constraint", index.name, "field", f.Name())
+		}
+		cols[i] = fi.json
+	}
+	checkPartialUniqueCondition(m, index.name, index.cond)
+	rc := InvalidRecordCollection(m.name)
+	condSQL, args := newQuery(rc).conditionSQLClause(index.cond)
+	query := fmt.Sprintf(`CREATE UNIQUE INDEX %s ON %s (%s)`, index.name, adapter.quoteTableName(m.tableName), strings.Join(cols, ", "))
+	if condSQL != "" {
+		query = fmt.Sprintf("%s WHERE %s", query, inlineSQLParams(condSQL, args))
+	}
+	return query
+}
+
+// checkPartialUniqueCondition panics if the given condition of a partial unique index
+// refers to fields of other models, which cannot be part of an index predicate.
+func checkPartialUniqueCondition(m *Model, indexName string, cond *Condition) {
+	for _, p := range cond.predicates {
+		if p.isCond {
+			checkPartialUniqueCondition(m, indexName, p.cond)
+			continue
+		}
+		if len(p.exprs) != 1 || !m.fields.MustGet(p.exprs[0].Name()).isStored() {
+			log.Panic("Partial unique constraints conditions can only refer to stored fields of the model",
+				"model", m.name, "constraint", indexName, "field", joinFieldNames(p.exprs, ExprSep).Name())
+		}
+	}
+}
+
+// inlineSQLParams returns the given SQL string with each placeholder
+// replaced by the literal value of the corresponding argument.
+//
+// This is used for DDL statements which do not accept parameters.
+func inlineSQLParams(sql string, args SQLParams) string {
+	parts := strings.Split(sql, "?")
+	if len(parts) != len(args)+1 {
+		log.Panic("Mismatch between SQL placeholders and arguments", "sql", sql, "args", args)
+	}
+	res := parts[0]
+	for i, arg := range args {
+		res += sqlLiteral(arg) + parts[i+1]
+	}
+	return res
+}
+
+// sqlLiteral returns the SQL literal representation of the given value
+func sqlLiteral(value interface{}) string {
+	if value == nil {
+		return "NULL"
+	}
+	val := reflect.ValueOf(value)
+	switch val.Kind() {
+	case reflect.Bool:
+		if val.Bool() {
+			return "TRUE"
+		}
+		return "FALSE"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return fmt.Sprintf("%v", value)
+	case reflect.Slice:
+		items := make([]string, val.Len())
+		for i := 0; i < val.Len(); i++ {
+			items[i] = sqlLiteral(val.Index(i).Interface())
+		}
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprintf("'%s'", strings.Replace(fmt.Sprintf("%v", value), "'", "''", -1))
+}
+
+// dropIndex drops the index with the given name
+func dropIndex(indexName string) {
+	query := fmt.Sprintf(`
+		DROP INDEX IF EXISTS %s
+	`, indexName)
+	dbExecuteNoTx(query)
+}
+
 // runInit runs the Init function of the given model if it exists
 func runInit(model *Model) {
 	if _, exists := model.methods.Get("Init"); exists {
@@ -15,6 +15,7 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"time"
 
@@ -25,22 +26,32 @@ import (
 
 var (
 	db         *sqlx.DB
+	replicaDB  *sqlx.DB
 	connParams ConnectionParams
 	adapters   map[string]dbAdapter
 )
 
 // ConnectionParams are the database agnostic parameters to connect to the database
+//
+// MaxOpenConns and MaxIdleConns configure the connection pool.
+// They are left to the driver's defaults when zero.
+//
+// Queries taking longer than SlowQueryThreshold are logged as warnings.
+// Slow queries are not logged when it is zero.
 type ConnectionParams struct {
-	Driver   string
-	Host     string
-	Port     string
-	User     string
-	Password string
-	DBName   string
-	SSLMode  string
-	SSLCert  string
-	SSLKey   string
-	SSLCA    string
+	Driver             string
+	Host               string
+	Port               string
+	User               string
+	Password           string
+	DBName             string
+	SSLMode            string
+	SSLCert            string
+	SSLKey             string
+	SSLCA              string
+	MaxOpenConns       int
+	MaxIdleConns       int
+	SlowQueryThreshold time.Duration
 }
 
 // ConnectionString returns the connection string for these connection params
@@ -86,6 +97,10 @@ type dbAdapter interface {
 	quoteTableName(string) string
 	// indexExists returns true if an index with the given name exists in the given table
 	indexExists(table string, name string) bool
+	// indexes returns the names of the indexes of the given table matching the given SQL pattern
+	indexes(table string, pattern string) []string
+	// indexComment returns the comment of the index with the given name
+	indexComment(name string) string
 	// constraintExists returns true if a constraint with the given name exists
 	constraintExists(name string) bool
 	// constraints returns a list of all constraints matching the given SQL pattern
@@ -104,14 +119,28 @@ type dbAdapter interface {
 	// sequences returns a list of all sequences matching the given SQL pattern
 	sequences(pattern string) []seqData
 	// childrenIdsQuery returns a query that finds all descendant of the given
-	// a record from table including itself. The query has a placeholder for the
-	// record's ID
+	// records from table including themselves. The query has a placeholder for
+	// the records' ids
 	childrenIdsQuery(table string) string
+	// descendantIdsQuery returns a query that finds all the descendants of the
+	// records of table through the given parent column, excluding the records
+	// themselves. The query has a placeholder for the records' ids.
+	descendantIdsQuery(table, parentColumn string) string
+	// ancestorIdsQuery returns a query that finds all the ancestors of the
+	// records of table through the given parent column, excluding the records
+	// themselves. The query has a placeholder for the records' ids.
+	ancestorIdsQuery(table, parentColumn string) string
 	// substituteErrorMessage substitutes the given error's message by newMsg
 	substituteErrorMessage(err error, newMsg string) error
 	// isSerializationError returns true if the given error is a serialization error
 	// and that the failed transaction should be retried.
 	isSerializationError(err error) bool
+	// isConstraintViolationError returns true if the given error has been raised
+	// because of an integrity constraint violation.
+	isConstraintViolationError(err error) bool
+	// explainQuery returns the SQL query that gives the execution plan
+	// of the given query with its actual run time statistics
+	explainQuery(query string) string
 }
 
 // registerDBAdapter adds a adapter to the adapters registry
@@ -120,29 +149,98 @@ func registerDBAdapter(name string, adapter dbAdapter) {
 	adapters[name] = adapter
 }
 
+// QueryStats holds the number and the total duration of the queries
+// executed by a Cursor.
+type QueryStats struct {
+	Count     int
+	TotalTime time.Duration
+}
+
 // Cursor is a wrapper around a database transaction
 type Cursor struct {
-	tx *sqlx.Tx
+	tx        *sqlx.Tx
+	replicaTx *sqlx.Tx
+	written   bool
+	stats     QueryStats
 }
 
 // Execute a query without returning any rows. It panics in case of error.
 // The args are for any placeholder parameters in the query.
 func (c *Cursor) Execute(query string, args ...interface{}) sql.Result {
+	defer c.track(time.Now(), query, args)
+	c.written = true
 	return dbExecute(c.tx, query, args...)
 }
 
 // Get queries a row into the database and maps the result into dest.
 // The query must return only one row. Get panics on errors
 func (c *Cursor) Get(dest interface{}, query string, args ...interface{}) {
+	defer c.track(time.Now(), query, args)
 	dbGet(c.tx, dest, query, args...)
 }
 
 // Select queries multiple rows and map the result into dest which must be a slice.
 // Select panics on errors.
 func (c *Cursor) Select(dest interface{}, query string, args ...interface{}) {
+	defer c.track(time.Now(), query, args)
 	dbSelect(c.tx, dest, query, args...)
 }
 
+// readGet is the same as Get but on the transaction returned by readTx.
+func (c *Cursor) readGet(readOnly bool, dest interface{}, query string, args ...interface{}) {
+	defer c.track(time.Now(), query, args)
+	dbGet(c.readTx(readOnly), dest, query, args...)
+}
+
+// readSelect is the same as Select but on the transaction returned by readTx.
+func (c *Cursor) readSelect(readOnly bool, dest interface{}, query string, args ...interface{}) {
+	defer c.track(time.Now(), query, args)
+	dbSelect(c.readTx(readOnly), dest, query, args...)
+}
+
+// readQuery executes the given query on the transaction returned by readTx
+// and returns the resulting rows.
+func (c *Cursor) readQuery(readOnly bool, query string, args ...interface{}) *sqlx.Rows {
+	defer c.track(time.Now(), query, args)
+	return dbQuery(c.readTx(readOnly), query, args...)
+}
+
+// track adds the given query started at start to the statistics of this Cursor.
+// The query is logged if it took longer than the slow query threshold.
+func (c *Cursor) track(start time.Time, query string, args []interface{}) {
+	duration := time.Since(start)
+	c.stats.Count++
+	c.stats.TotalTime += duration
+	if threshold := connParams.SlowQueryThreshold; threshold > 0 && duration >= threshold {
+		log.Warn("Slow query", "query", query, "args", strutils.TrimArgs(args), "duration", duration)
+	}
+}
+
+// readTx returns the transaction to use for a read query.
+//
+// This is a read only transaction on the replica database if readOnly is true,
+// a replica is connected and nothing has been written with this Cursor yet.
+// Otherwise, this is the main transaction, so that reads following a write
+// are not subject to the replica lag.
+func (c *Cursor) readTx(readOnly bool) *sqlx.Tx {
+	if !readOnly || replicaDB == nil || c.written {
+		return c.tx
+	}
+	if c.replicaTx == nil {
+		c.replicaTx = replicaDB.MustBeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	}
+	return c.replicaTx
+}
+
+// closeReplica releases the replica transaction of this Cursor if any.
+func (c *Cursor) closeReplica() {
+	if c.replicaTx == nil {
+		return
+	}
+	c.replicaTx.Rollback()
+	c.replicaTx = nil
+}
+
 // newCursor returns a new db cursor on the given database
 func newCursor(db *sqlx.DB) *Cursor {
 	adapter := adapters[db.DriverName()]
@@ -163,14 +261,41 @@ func DBConnect(params ConnectionParams) {
 	connParams = params
 	connStr := DBParams().ConnectionString()
 	db = sqlx.MustConnect(params.Driver, connStr)
+	setPoolParams(db, params)
 	log.Info("Connected to database", "driver", params.Driver, "connStr", connStr)
 }
 
+// DBConnectReplica connects to a read only replica of the database.
+//
+// Once connected, the read queries of environments returned by
+// Environment.ReadOnly are sent to this replica.
+func DBConnectReplica(params ConnectionParams) {
+	connStr := params.ConnectionString()
+	replicaDB = sqlx.MustConnect(params.Driver, connStr)
+	setPoolParams(replicaDB, params)
+	log.Info("Connected to replica database", "driver", params.Driver, "connStr", connStr)
+}
+
+// setPoolParams applies the connection pool parameters of params to the given database.
+func setPoolParams(database *sqlx.DB, params ConnectionParams) {
+	if params.MaxOpenConns > 0 {
+		database.SetMaxOpenConns(params.MaxOpenConns)
+	}
+	if params.MaxIdleConns > 0 {
+		database.SetMaxIdleConns(params.MaxIdleConns)
+	}
+}
+
 // DBClose is a wrapper around sqlx.Close
-// It closes the connection to the database
+// It closes the connection to the database and to the replica if any
 func DBClose() {
 	err := db.Close()
 	log.Info("Closed database", "error", err)
+	if replicaDB != nil {
+		err = replicaDB.Close()
+		replicaDB = nil
+		log.Info("Closed replica database", "error", err)
+	}
 }
 
 // dbExecute is a wrapper around sqlx.MustExec
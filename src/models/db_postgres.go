@@ -16,9 +16,12 @@ package models
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 
 	"github.com/hexya-erp/hexya/src/models/fieldtype"
 	"github.com/hexya-erp/hexya/src/models/operator"
+	"github.com/hexya-erp/hexya/src/models/types"
 	"github.com/hexya-erp/hexya/src/tools/nbutils"
 	"github.com/lib/pq"
 )
@@ -40,6 +43,8 @@ var pgOperators = map[operator.Operator]string{
 	operator.LowerOrEqual:   "<= ?",
 	operator.Greater:        "> ?",
 	operator.GreaterOrEqual: ">= ?",
+	operator.ContainsAll:    "@> ?",
+	operator.Overlaps:       "&& ?",
 }
 
 var pgTypes = map[fieldtype.Type]string{
@@ -53,8 +58,45 @@ var pgTypes = map[fieldtype.Type]string{
 	fieldtype.HTML:      "text",
 	fieldtype.Binary:    "bytea",
 	fieldtype.Selection: "character varying",
+	fieldtype.Reference: "character varying",
 	fieldtype.Many2One:  "integer",
 	fieldtype.One2One:   "integer",
+	fieldtype.Array:     "text[]",
+	fieldtype.Encrypted: "text",
+}
+
+// pgArrayOperators are the custom operators registered with multi set, whose
+// argument is bound as a PostgreSQL array
+var pgArrayOperators = map[operator.Operator]bool{}
+
+// pgArrayTypes gives the SQL type of the elements of array fields for each Go type
+var pgArrayTypes = map[reflect.Type]string{
+	reflect.TypeOf(types.StringArray{}):  "text",
+	reflect.TypeOf(types.IntegerArray{}): "int8",
+	reflect.TypeOf(types.FloatArray{}):   "float8",
+}
+
+// RegisterOperator registers a custom operator that can be used in conditions
+// with ConditionField.AddOperator. sql is the SQL of the operator and its
+// argument that follows the column in the WHERE clause, with a '?' placeholder
+// for the argument, e.g. "@> ?". If multi is true, the operator expects a
+// slice as argument, which is bound as a PostgreSQL array, e.g. with
+// "= ANY(?)".
+//
+// It panics if op is already a known operator. This function must be called
+// before bootstrap, typically in an init function.
+func RegisterOperator(op operator.Operator, sql string, multi bool) {
+	if op.IsValid() {
+		log.Panic("Operator is already registered", "operator", op)
+	}
+	if !strings.Contains(sql, "?") {
+		log.Panic("Operator SQL must contain a placeholder for the argument", "operator", op, "sql", sql)
+	}
+	operator.Register(op, multi)
+	pgOperators[op] = sql
+	if multi {
+		pgArrayOperators[op] = true
+	}
 }
 
 // connectionString returns the connection string for the given parameters
@@ -95,11 +137,18 @@ func (d *postgresAdapter) operatorSQL(do operator.Operator, arg interface{}) (st
 	case operator.Contains, operator.IContains, operator.NotContains, operator.NotIContains:
 		arg = fmt.Sprintf("%%%s%%", arg)
 	}
+	if pgArrayOperators[do] && arg != nil {
+		// Slices would be expanded into a list of arguments otherwise
+		arg = pq.Array(arg)
+	}
 	return op, arg
 }
 
 // typeSQL returns the sql type string for the given Field
 func (d *postgresAdapter) typeSQL(fi *Field) string {
+	if fi.fieldType == fieldtype.Array {
+		return fmt.Sprintf("%s[]", pgArrayTypes[fi.structField.Type])
+	}
 	typ, _ := pgTypes[fi.fieldType]
 	return typ
 }
@@ -119,6 +168,8 @@ func (d *postgresAdapter) columnSQLDefinition(fi *Field, null bool) string {
 		if fi.size > 0 {
 			res = fmt.Sprintf("%s(%d)", res, fi.size)
 		}
+	case fieldtype.Array:
+		res = d.typeSQL(fi)
 	case fieldtype.Float:
 		emptyD := nbutils.Digits{}
 		if fi.digits != emptyD {
@@ -166,7 +217,8 @@ func (d *postgresAdapter) quoteTableName(tableName string) string {
 // columns returns a list of ColumnData for the given tableName
 func (d *postgresAdapter) columns(tableName string) map[string]ColumnData {
 	query := fmt.Sprintf(`
-		SELECT column_name, data_type, is_nullable, column_default
+		SELECT column_name, is_nullable, column_default,
+			CASE WHEN data_type = 'ARRAY' THEN substr(udt_name, 2) || '[]' ELSE data_type END AS data_type
 		FROM information_schema.columns
 		WHERE table_schema NOT IN ('pg_catalog', 'information_schema') AND table_name = '%s'
 	`, tableName)
@@ -189,6 +241,21 @@ func (d *postgresAdapter) indexExists(table string, name string) bool {
 	return cnt > 0
 }
 
+// indexes returns the names of the indexes of the given table matching the given SQL pattern
+func (d *postgresAdapter) indexes(table string, pattern string) []string {
+	query := "SELECT indexname FROM pg_indexes WHERE tablename = ? AND indexname ILIKE ?"
+	var res []string
+	dbSelectNoTx(&res, query, table, pattern)
+	return res
+}
+
+// indexComment returns the comment of the index with the given name
+func (d *postgresAdapter) indexComment(name string) string {
+	var res string
+	dbGetNoTx(&res, "SELECT COALESCE(obj_description(?::regclass, 'pg_class'), '')", name)
+	return res
+}
+
 // constraintExists returns true if a constraint with the given name exists in the given table
 func (d *postgresAdapter) constraintExists(name string) bool {
 	query := fmt.Sprintf("SELECT COUNT(*) FROM pg_constraint WHERE conname = '%s'", name)
@@ -252,15 +319,15 @@ func (d *postgresAdapter) setTransactionIsolation() string {
 }
 
 // childrenIdsQuery returns a query that finds all descendant of the given
-// a record from table including itself. The query has a placeholder for the
-// record's ID
+// records from table including themselves. The query has a placeholder for
+// the records' ids
 func (d *postgresAdapter) childrenIdsQuery(table string) string {
 	res := fmt.Sprintf(`
 WITH RECURSIVE "recursive_query_children_ids" AS
 (
 	SELECT  id
 	FROM    %s "m1"
-	WHERE   id = ?
+	WHERE   id IN (?)
 UNION ALL
 	SELECT  "m2".id
 	FROM    %s "m2"
@@ -272,6 +339,56 @@ FROM    recursive_query_children_ids`, d.quoteTableName(table), d.quoteTableName
 	return res
 }
 
+// descendantIdsQuery returns a query that finds all the descendants of the
+// records of table through the given parent column, excluding the records
+// themselves. The query has a placeholder for the records' ids.
+//
+// UNION discards the rows that have already been found so that the query
+// terminates even if the hierarchy has cycles.
+func (d *postgresAdapter) descendantIdsQuery(table, parentColumn string) string {
+	res := fmt.Sprintf(`
+WITH RECURSIVE "recursive_query_descendant_ids" AS
+(
+	SELECT  id
+	FROM    %s "m1"
+	WHERE   %s IN (?)
+UNION
+	SELECT  "m2".id
+	FROM    %s "m2"
+	JOIN    "recursive_query_descendant_ids"
+	ON      "m2".%s = "recursive_query_descendant_ids".id
+)
+SELECT  id
+FROM    recursive_query_descendant_ids`, d.quoteTableName(table), parentColumn, d.quoteTableName(table), parentColumn)
+	return res
+}
+
+// ancestorIdsQuery returns a query that finds all the ancestors of the
+// records of table through the given parent column, excluding the records
+// themselves. The query has a placeholder for the records' ids.
+//
+// UNION discards the rows that have already been found so that the query
+// terminates even if the hierarchy has cycles.
+func (d *postgresAdapter) ancestorIdsQuery(table, parentColumn string) string {
+	res := fmt.Sprintf(`
+WITH RECURSIVE "recursive_query_ancestor_ids" AS
+(
+	SELECT  %s AS id
+	FROM    %s "m1"
+	WHERE   id IN (?) AND %s IS NOT NULL
+UNION
+	SELECT  "m2".%s
+	FROM    %s "m2"
+	JOIN    "recursive_query_ancestor_ids"
+	ON      "m2".id = "recursive_query_ancestor_ids".id
+	WHERE   "m2".%s IS NOT NULL
+)
+SELECT  id
+FROM    recursive_query_ancestor_ids`, parentColumn, d.quoteTableName(table), parentColumn,
+		parentColumn, d.quoteTableName(table), parentColumn)
+	return res
+}
+
 // substituteErrorMessage substitutes the given error's message by newMsg
 func (d *postgresAdapter) substituteErrorMessage(err error, newMsg string) error {
 	pgError, ok := err.(*pq.Error)
@@ -291,4 +408,19 @@ func (d *postgresAdapter) isSerializationError(err error) bool {
 	return false
 }
 
+// isConstraintViolationError returns true if the given error has been raised
+// because of an integrity constraint violation.
+func (d *postgresAdapter) isConstraintViolationError(err error) bool {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Class() == "23" {
+		return true
+	}
+	return false
+}
+
 var _ dbAdapter = new(postgresAdapter)
+
+// explainQuery returns the SQL query that gives the execution plan
+// of the given query with its actual run time statistics
+func (d *postgresAdapter) explainQuery(query string) string {
+	return fmt.Sprintf("EXPLAIN (ANALYZE, BUFFERS) %s", query)
+}
@@ -0,0 +1,222 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/hexya-erp/hexya/src/models/fieldtype"
+	"github.com/hexya-erp/hexya/src/models/operator"
+)
+
+// blindIndexSize is the size of the hex encoded blind index values
+const blindIndexSize = 2 * sha256.Size
+
+// encryption holds the ciphers used for encrypted fields
+var encryption struct {
+	aead          cipher.AEAD
+	blindIndexKey []byte
+}
+
+// SetEncryptionKey sets the key with which the values of encrypted fields are
+// encrypted in the database. The key must be 16, 24 or 32 bytes long to select
+// AES-128, AES-192 or AES-256. The key of blind indexes is derived from it.
+//
+// The key must not change once values have been written, since they would not
+// be readable anymore.
+func SetEncryptionKey(key []byte) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		log.Panic("Invalid encryption key", "error", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		log.Panic("Unable to create cipher for encryption key", "error", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("hexya blind index"))
+	encryption.aead = aead
+	encryption.blindIndexKey = mac.Sum(nil)
+}
+
+// encryptValue returns the base64 encoded ciphertext of the given value,
+// prefixed by its random nonce.
+func encryptValue(value string) string {
+	if encryption.aead == nil {
+		log.Panic("No encryption key set for encrypted fields")
+	}
+	nonce := make([]byte, encryption.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		log.Panic("Unable to generate nonce", "error", err)
+	}
+	return base64.StdEncoding.EncodeToString(encryption.aead.Seal(nonce, nonce, []byte(value), nil))
+}
+
+// decryptValue returns the plain text of the given value encrypted by encryptValue.
+func decryptValue(value string) (string, error) {
+	if encryption.aead == nil {
+		return "", errors.New("no encryption key set for encrypted fields")
+	}
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	nonceSize := encryption.aead.NonceSize()
+	if len(data) < nonceSize {
+		return "", errors.New("ciphertext too short")
+	}
+	res, err := encryption.aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(res), nil
+}
+
+// blindIndexValue returns the blind index of the given value, i.e.
+// its hex encoded HMAC. The blind index of the empty string is empty.
+func blindIndexValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	if encryption.aead == nil {
+		log.Panic("No encryption key set for encrypted fields")
+	}
+	mac := hmac.New(sha256.New, encryption.blindIndexKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// encryptedSQLValue returns the value to write in the database for the given
+// value of fi. Non empty values of encrypted fields are encrypted, other values
+// are returned as is.
+func encryptedSQLValue(fi *Field, value interface{}) interface{} {
+	if fi.fieldType != fieldtype.Encrypted {
+		return value
+	}
+	val := reflect.ValueOf(value)
+	if val.Kind() != reflect.String || val.String() == "" {
+		return value
+	}
+	return encryptValue(val.String())
+}
+
+// decryptFieldMap decrypts in place the values of the encrypted
+// fields of the given FieldMap that has been read from the database.
+func (m *Model) decryptFieldMap(fMap *FieldMap) {
+	for colName, value := range *fMap {
+		if value == nil {
+			continue
+		}
+		fi := m.getRelatedFieldInfo(m.FieldName(colName))
+		if fi.fieldType != fieldtype.Encrypted {
+			continue
+		}
+		var cipherText string
+		switch v := value.(type) {
+		case string:
+			cipherText = v
+		case []byte:
+			cipherText = string(v)
+		default:
+			continue
+		}
+		if cipherText == "" {
+			continue
+		}
+		plainText, err := decryptValue(cipherText)
+		if err != nil {
+			log.Panic("Unable to decrypt field value", "model", m.name, "field", fi.name, "error", err)
+		}
+		(*fMap)[colName] = plainText
+	}
+}
+
+// blindIndexConditionArg returns the operator and argument to search the
+// blind index of the given encrypted field with op and arg. It panics if op
+// is not an exact match operator.
+func blindIndexConditionArg(fi *Field, op operator.Operator, arg interface{}) (operator.Operator, interface{}) {
+	switch op {
+	case operator.Equals, operator.NotEquals:
+		if str, ok := arg.(string); ok {
+			return op, blindIndexValue(str)
+		}
+		return op, arg
+	case operator.In, operator.NotIn:
+		val := reflect.ValueOf(arg)
+		if val.Kind() != reflect.Slice {
+			return op, arg
+		}
+		res := make([]string, val.Len())
+		for i := 0; i < val.Len(); i++ {
+			res[i] = blindIndexValue(fmt.Sprintf("%v", val.Index(i).Interface()))
+		}
+		return op, res
+	}
+	log.Panic("Encrypted fields can only be searched with exact match operators", "model", fi.model.name, "field", fi.name, "operator", op)
+	return op, arg
+}
+
+// createBlindIndexFields adds a hidden stored computed field holding the blind
+// index of each encrypted field with BlindIndex set. Search conditions on the
+// encrypted field are made on its blind index instead, as for search shadows.
+func createBlindIndexFields() {
+	for _, model := range Registry.registryByName {
+		if model.IsMixin() || model.IsManual() {
+			continue
+		}
+		var indexed []*Field
+		for _, fi := range model.fields.registryByName {
+			if fi.blindIndex {
+				indexed = append(indexed, fi)
+			}
+		}
+		for _, fi := range indexed {
+			if fi.fieldType != fieldtype.Encrypted || !fi.isStored() {
+				log.Panic("BlindIndex can only be set on stored encrypted fields", "model", model.name, "field", fi.name)
+			}
+			if fi.shadow != nil {
+				log.Panic("BlindIndex cannot be set on fields with SearchShadow", "model", model.name, "field", fi.name)
+			}
+			fieldName := model.FieldName(fi.name)
+			indexName := fmt.Sprintf("Hexya%sBlindIndex", fi.name)
+			indexCompute := fmt.Sprintf("HexyaCompute%sBlindIndex", fi.name)
+			// We do not use NewMethod so that code generation does not pick this method
+			model.AddEmptyMethod(indexCompute).finalize(func(rc *RecordCollection) *ModelData {
+				var val string
+				if v := reflect.ValueOf(rc.Get(fieldName)); v.Kind() == reflect.String {
+					val = v.String()
+				}
+				return NewModelData(rc.model).Set(rc.model.FieldName(indexName), blindIndexValue(val))
+			})
+			index := &Field{
+				model:       model,
+				name:        indexName,
+				json:        fmt.Sprintf("hexya_%s_blind_index", fi.json),
+				description: fi.description,
+				fieldType:   fieldtype.Char,
+				structField: reflect.StructField{Name: indexName, Type: reflect.TypeOf("")},
+				size:        blindIndexSize,
+				stored:      true,
+				readOnly:    true,
+				noCopy:      true,
+				index:       true,
+				compute:     indexCompute,
+				depends:     []string{fi.name},
+				shadowOf:    fi,
+			}
+			model.fields.add(index)
+			fi.shadow = index
+		}
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 
 	"github.com/hexya-erp/hexya/src/models/types"
+	"github.com/hexya-erp/hexya/src/tools/exceptions"
 	"github.com/hexya-erp/hexya/src/tools/logging"
 )
 
@@ -45,6 +46,11 @@ type Environment struct {
 	previousMethod *Method
 	recursions     uint8
 	nextNegativeID int64
+	readOnly       bool
+	recomputeQueue *recomputeQueue
+	logContext     []interface{}
+	unlinking      map[string]map[int64]bool
+	postCommit     *[]func()
 }
 
 // Cr returns a pointer to the Cursor of the Environment
@@ -62,12 +68,116 @@ func (env Environment) Context() *types.Context {
 	return env.context
 }
 
+// ActiveId returns the id of the record on which the current action
+// is executed, as given by the 'active_id' context key.
+// It returns 0 if there is no such key in the context.
+func (env Environment) ActiveId() int64 {
+	return env.context.GetInteger("active_id")
+}
+
+// ActiveIds returns the ids of the records on which the current action
+// is executed, as given by the 'active_ids' context key. If this key is not
+// set, a slice with the 'active_id' is returned if the latter is set.
+func (env Environment) ActiveIds() []int64 {
+	if env.context.HasKey("active_ids") {
+		return env.context.GetIntegerSlice("active_ids")
+	}
+	if id := env.ActiveId(); id != 0 {
+		return []int64{id}
+	}
+	return []int64{}
+}
+
+// ActiveModel returns the name of the model on which the current action
+// is executed, as given by the 'active_model' context key.
+func (env Environment) ActiveModel() string {
+	return env.context.GetString("active_model")
+}
+
+// ReadOnly returns a copy of this Environment whose read queries (Search, Load,
+// SearchCount, ReadGroup, ...) are sent to the replica database if one has been
+// connected with DBConnectReplica.
+//
+// Writes are always sent to the main database. After the first write in the
+// transaction, reads are sent to the main database too.
+func (env Environment) ReadOnly() Environment {
+	env.readOnly = true
+	return env
+}
+
+// Logger returns a logger whose log lines are tagged with the user of this
+// Environment and, inside a method call, with the model, the method and the
+// ids of the RecordSet the method is called on.
+func (env Environment) Logger() logging.Logger {
+	ctx := make([]interface{}, 0, len(env.logContext)+2)
+	ctx = append(ctx, env.logContext...)
+	ctx = append(ctx, "uid", env.uid)
+	return log.New(ctx...)
+}
+
+// QueryStats returns the number and the total duration of the SQL
+// queries executed so far in the transaction of this Environment.
+func (env Environment) QueryStats() QueryStats {
+	return env.cr.stats
+}
+
+// Flush recomputes the stored computed fields whose recomputation has been
+// deferred in this transaction with the 'hexya_defer_recompute' context key.
+//
+// Flush is called automatically at the end of the transaction and when a
+// stored computed field is read or searched while recomputations are pending.
+func (env Environment) Flush() {
+	if env.recomputeQueue == nil {
+		return
+	}
+	for len(env.recomputeQueue.keys) > 0 {
+		for _, rp := range env.recomputeQueue.pop() {
+			// Records may have been unlinked since the recomputation was deferred
+			recs := rp.recs.existingRecords()
+			if recs.IsEmpty() {
+				continue
+			}
+			recs.applyMethod(rp.method, rp.precompute)
+		}
+	}
+}
+
+// afterCommit registers the given fnct to be called once the transaction
+// of this Environment has been committed. Registered functions are discarded
+// if the transaction is rolled back.
+func (env Environment) afterCommit(fnct func()) {
+	if env.postCommit == nil {
+		return
+	}
+	*env.postCommit = append(*env.postCommit, fnct)
+}
+
+// runPostCommit calls the functions registered with afterCommit.
+// Since the transaction is already committed, panics are only logged.
+func (env Environment) runPostCommit() {
+	if env.postCommit == nil {
+		return
+	}
+	for _, fnct := range *env.postCommit {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Warn("Error in post commit function", "error", r)
+				}
+			}()
+			fnct()
+		}()
+	}
+	*env.postCommit = nil
+}
+
 // commit the transaction of this environment.
 //
 // WARNING: Do NOT call Commit on Environment instances that you
 // did not create yourself with NewEnvironment. The framework will
 // automatically commit the Environment.
 func (env Environment) commit() {
+	env.Cr().closeReplica()
 	env.Cr().tx.Commit()
 }
 
@@ -77,6 +187,7 @@ func (env Environment) commit() {
 // did not create yourself with NewEnvironment. Just panic instead
 // for the framework to roll back automatically for you.
 func (env Environment) rollback() {
+	env.Cr().closeReplica()
 	env.Cr().tx.Rollback()
 }
 
@@ -122,10 +233,13 @@ func (env Environment) DumpCache() string {
 // the database connection.
 func newEnvironment(uid int64) Environment {
 	env := Environment{
-		cr:      newCursor(db),
-		uid:     uid,
-		context: types.NewContext(),
-		cache:   newCache(),
+		cr:             newCursor(db),
+		uid:            uid,
+		context:        types.NewContext(),
+		cache:          newCache(),
+		recomputeQueue: newRecomputeQueue(),
+		unlinking:      make(map[string]map[int64]bool),
+		postCommit:     new([]func()),
 	}
 	return env
 }
@@ -141,7 +255,22 @@ func ExecuteInNewEnvironment(uid int64, fnct func(Environment)) error {
 	return doExecuteInNewEnvironment(uid, 0, fnct)
 }
 
-func doExecuteInNewEnvironment(uid int64, retries uint8, fnct func(Environment)) (rError error) {
+// executeInNewEnvironmentWithError executes the given fnct in a new Environment
+// within a new transaction like ExecuteInNewEnvironment. The transaction is also
+// rolled back if fnct returns an error, which is then returned as is without
+// being logged as a panic.
+func executeInNewEnvironmentWithError(uid int64, fnct func(Environment) error) error {
+	return doExecuteInNewEnvironmentWithError(uid, 0, fnct)
+}
+
+func doExecuteInNewEnvironment(uid int64, retries uint8, fnct func(Environment)) error {
+	return doExecuteInNewEnvironmentWithError(uid, retries, func(env Environment) error {
+		fnct(env)
+		return nil
+	})
+}
+
+func doExecuteInNewEnvironmentWithError(uid int64, retries uint8, fnct func(Environment) error) (rError error) {
 	env := newEnvironment(uid)
 	defer func() {
 		if r := recover(); r != nil {
@@ -150,18 +279,27 @@ func doExecuteInNewEnvironment(uid int64, retries uint8, fnct func(Environment))
 				// Transaction error
 				retries++
 				if retries < DBSerializationMaxRetries {
-					if doExecuteInNewEnvironment(uid, retries, fnct) == nil {
+					if doExecuteInNewEnvironmentWithError(uid, retries, fnct) == nil {
 						rError = nil
 						return
 					}
 				}
+				r = concurrencyError(err)
 			}
 			rError = logging.LogPanicData(r)
 			return
 		}
+		if rError != nil {
+			env.rollback()
+			return
+		}
 		env.commit()
+		env.runPostCommit()
 	}()
-	fnct(env)
+	if err := fnct(env); err != nil {
+		return err
+	}
+	env.Flush()
 	return nil
 }
 
@@ -189,15 +327,25 @@ func doSimulateInNewEnvironment(uid int64, retries uint8, fnct func(Environment)
 						return
 					}
 				}
+				r = concurrencyError(err)
 			}
 			rError = logging.LogPanicData(r)
 			return
 		}
 	}()
 	fnct(env)
+	env.Flush()
 	return
 }
 
+// concurrencyError returns the given serialization error as a ConcurrencyError
+func concurrencyError(err error) exceptions.ConcurrencyError {
+	return exceptions.ConcurrencyError{
+		Message: "The operation could not be completed because of concurrent updates, please try again",
+		Debug:   err.Error(),
+	}
+}
+
 // Pool returns an empty RecordCollection for the given modelName
 func (env Environment) Pool(modelName string) *RecordCollection {
 	return newRecordCollection(env, modelName)
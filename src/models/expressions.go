@@ -0,0 +1,158 @@
+// Copyright 2019 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hexya-erp/hexya/src/models/fieldtype"
+	"github.com/hexya-erp/hexya/src/models/security"
+)
+
+// An Expr is an arithmetic expression on the columns of a model that is
+// computed by the database. It is used by UpdateExpr to set fields from the
+// values of other fields without loading the records.
+//
+// Use the Col and Val functions to create an Expr and its Add, Sub, Mul and
+// Div methods to combine them, e.g. Col("Qty").Mul(Col("Price")).
+type Expr struct {
+	field string
+	value interface{}
+	op    string
+	left  *Expr
+	right *Expr
+}
+
+// Col returns an Expr with the value of the given field of the record.
+// NULL values of numeric fields are taken as 0.
+func Col(field string) Expr {
+	return Expr{field: field}
+}
+
+// Val returns an Expr with the given constant value.
+func Val(value interface{}) Expr {
+	return Expr{value: value}
+}
+
+// binary returns a new Expr applying the given SQL operator to e and other.
+func (e Expr) binary(op string, other Expr) Expr {
+	return Expr{op: op, left: &e, right: &other}
+}
+
+// Add returns an Expr that adds other to e.
+func (e Expr) Add(other Expr) Expr {
+	return e.binary("+", other)
+}
+
+// Sub returns an Expr that subtracts other from e.
+func (e Expr) Sub(other Expr) Expr {
+	return e.binary("-", other)
+}
+
+// Mul returns an Expr that multiplies e by other.
+func (e Expr) Mul(other Expr) Expr {
+	return e.binary("*", other)
+}
+
+// Div returns an Expr that divides e by other.
+func (e Expr) Div(other Expr) Expr {
+	return e.binary("/", other)
+}
+
+// sql returns the SQL string and arguments of this Expr on the given model
+// with the names of the fields it references. It panics if a referenced field
+// is not a stored column of the model, if it is encrypted, or if an operand of an arithmetic
+// operator is not a numeric field.
+func (e Expr) sql(m *Model, numeric bool) (string, SQLParams, []string) {
+	switch {
+	case e.op != "":
+		lSQL, lArgs, lFields := e.left.sql(m, true)
+		rSQL, rArgs, rFields := e.right.sql(m, true)
+		return fmt.Sprintf("(%s %s %s)", lSQL, e.op, rSQL), lArgs.Extend(rArgs), append(lFields, rFields...)
+	case e.field != "":
+		fi := m.fields.MustGet(e.field)
+		if !fi.isStored() || fi.isRelatedField() || fi.isContextedField() || fi.isRelationField() || fi.fieldType == fieldtype.Encrypted {
+			log.Panic("Expressions can only reference stored fields that are neither related, contexted, relations nor encrypted", "model", m.name, "field", e.field)
+		}
+		isNumeric := fi.fieldType == fieldtype.Integer || fi.fieldType == fieldtype.Float
+		if numeric && !isNumeric {
+			log.Panic("Arithmetic expressions can only reference integer and float fields", "model", m.name, "field", e.field)
+		}
+		if isNumeric {
+			return fmt.Sprintf("COALESCE(%s, 0)", fi.json), SQLParams{}, []string{fi.name}
+		}
+		return fi.json, SQLParams{}, []string{fi.name}
+	default:
+		return "?", SQLParams{e.value}, nil
+	}
+}
+
+// A fieldExpr is a value of a FieldMap that sets the field to the given
+// SQL expression computed by the database.
+type fieldExpr struct {
+	sql  string
+	args SQLParams
+}
+
+// UpdateExpr sets the fields of the records of this model matching cond to the
+// given expressions, in a single UPDATE query computed by the database, so that
+// the records are never loaded. Each key of assignments is the name of the field
+// to set. All the records are updated if cond is empty. It returns the number of
+// updated records.
+//
+// Write is not called, but write record rules apply, and stored computed fields
+// and constraints depending on the updated fields are processed. UpdateExpr panics
+// if an assigned field is not a stored field of this model that is neither
+// computed, related, contexted, a relation, encrypted nor declared with NoWrite.
+func (m *Model) UpdateExpr(env Environment, cond Conditioner, assignments map[string]Expr) int {
+	rc := env.Pool(m.name)
+	rc.CheckExecutionPermission(m.methods.MustGet("Write"))
+	if len(assignments) == 0 {
+		log.Panic("No assignments given to UpdateExpr", "model", m.name)
+	}
+	fieldNames := make([]string, 0, len(assignments))
+	for f := range assignments {
+		fieldNames = append(fieldNames, f)
+	}
+	sort.Strings(fieldNames)
+	fMap := make(FieldMap)
+	var (
+		fields FieldNames
+		reads  [][]FieldName
+	)
+	for _, f := range fieldNames {
+		fi := m.fields.MustGet(f)
+		if !fi.isStored() || fi.isComputedField() || fi.isRelatedField() || fi.isContextedField() || fi.isRelationField() || fi.noWrite ||
+			fi.fieldType == fieldtype.Encrypted {
+			log.Panic("UpdateExpr can only set stored fields that are neither computed, related, contexted, relations, encrypted nor NoWrite", "model", m.name, "field", f)
+		}
+		if assignments[f].op != "" && fi.fieldType != fieldtype.Integer && fi.fieldType != fieldtype.Float {
+			log.Panic("Arithmetic expressions can only be assigned to integer and float fields", "model", m.name, "field", f)
+		}
+		sql, args, refs := assignments[f].sql(m, false)
+		for _, ref := range refs {
+			reads = append(reads, []FieldName{m.FieldName(ref)})
+		}
+		fMap[fi.json] = fieldExpr{sql: sql, args: args}
+		fields = append(fields, m.FieldName(fi.name))
+	}
+	rc.flushIfPending(reads...)
+	rSet := rc.Search(m.Field(ID).In(m.SubqueryIds(cond))).addRecordRuleConditions(env.uid, security.Write)
+	rSet.addAccessFieldsUpdateData(&fMap)
+	query, args := rSet.query.updateQuery(fMap)
+	var ids []int64
+	env.cr.written = true
+	env.cr.Select(&ids, fmt.Sprintf("%s RETURNING id", query), args...)
+	env.cache.clearMemo()
+	for _, id := range ids {
+		env.cache.invalidateRecord(m, id)
+	}
+	if len(ids) > 0 {
+		res := env.Pool(m.name).withIds(ids)
+		res.processTriggers(fields)
+		res.CheckConstraints(fields)
+	}
+	return len(ids)
+}
@@ -40,6 +40,22 @@ const (
 	Cascade OnDeleteAction = "cascade"
 )
 
+// A SearchType defines how a char or text field is indexed for searching.
+type SearchType string
+
+const (
+	// DefaultSearch does not create any specific search index on the field.
+	DefaultSearch SearchType = ""
+	// TrigramSearch creates a GIN trigram index on the field so that
+	// Contains, IContains, Like and ILike conditions can use it.
+	// It requires the pg_trgm extension of PostgreSQL.
+	TrigramSearch SearchType = "trigram"
+)
+
+// companyFieldName is the name of the many2one field holding the company
+// of a record, used by fields with CheckCompany set.
+const companyFieldName = "Company"
+
 type ctxType int
 
 const (
@@ -53,15 +69,19 @@ const (
 // - model is a pointer to the Model instance to recompute
 // - fieldName is the name of the field to recompute in model.
 // - compute is the name of the method to call on model
+// - precompute is the name of the method to call once on all the records
+// to recompute before calling compute
 // - path is the search string that will be used to find records to update
 // (e.g. path = "Profile.BestPost").
 // - stored is true if the computed field is stored
 type computeData struct {
-	model     *Model
-	stored    bool
-	fieldName string
-	compute   string
-	path      string
+	model      *Model
+	stored     bool
+	fieldName  string
+	compute    string
+	precompute string
+	path       string
+	lazy       bool
 }
 
 // FieldsCollection is a collection of Field instances in a model.
@@ -150,6 +170,17 @@ func (fc *FieldsCollection) getComputedFields(fields ...string) (fil []*Field) {
 	return
 }
 
+// computeGuard returns the name of the compute guard of the stored
+// fields computed by the given method, or the empty string if none.
+func (fc *FieldsCollection) computeGuard(method string) string {
+	for _, fInfo := range fc.computedStoredFields {
+		if fInfo.compute == method && fInfo.computeGuard != "" {
+			return fInfo.computeGuard
+		}
+	}
+	return ""
+}
+
 // Model returns this FieldsCollection Model
 func (fc *FieldsCollection) Model() *Model {
 	return fc.model
@@ -201,16 +232,36 @@ type Field struct {
 	json             string
 	description      string
 	help             string
+	placeholder      string
+	section          string
 	stored           bool
+	searchShadow     bool
+	blindIndex       bool
+	shadow           *Field
+	shadowOf         *Field
 	required         bool
 	readOnly         bool
+	noWrite          bool
 	requiredFunc     func(Environment) (bool, Conditioner)
 	readOnlyFunc     func(Environment) (bool, Conditioner)
 	invisibleFunc    func(Environment) (bool, Conditioner)
 	unique           bool
 	index            bool
+	searchType       SearchType
 	compute          string
 	depends          []string
+	timeDependent    bool
+	computeOnCreate  bool
+	lazyCompute      bool
+	versionedCache   bool
+	version          *Field
+	versionOf        *Field
+	lazyMarker       *Field
+	lazyMarkerOf     *Field
+	precompute       string
+	computeGuard     string
+	checkCompany     bool
+	noFK             bool
 	relatedModelName string
 	relatedModel     *Model
 	reverseFK        string
@@ -238,6 +289,9 @@ type Field struct {
 	constraint       string
 	inverse          string
 	filter           *Condition
+	dynamicFilter    string
+	filterDepends    []string
+	filterTriggers   []*Field
 	contexts         FieldContexts
 	ctxType          ctxType
 	updates          []map[string]interface{}
@@ -284,7 +338,7 @@ func (f *Field) isSettable() bool {
 // isReadOnly returns true if this field must not be set directly
 // by the user.
 func (f *Field) isReadOnly() bool {
-	if f.readOnly {
+	if f.readOnly || f.noWrite {
 		return true
 	}
 	fInfo := f
@@ -355,6 +409,20 @@ func SnakeCaseFieldName(fName string, typ fieldtype.Type) string {
 	return res
 }
 
+// inverseM2MField returns the many2many field of the related model that
+// uses the same relation model as this many2many field, if any.
+func (f *Field) inverseM2MField() (*Field, bool) {
+	for _, fi := range f.relatedModel.fields.registryByJSON {
+		if fi.fieldType != fieldtype.Many2Many || fi.m2mRelModel.name != f.m2mRelModel.name {
+			continue
+		}
+		if fi.m2mOurField.name == f.m2mTheirField.name && fi.m2mTheirField.name == f.m2mOurField.name {
+			return fi, true
+		}
+	}
+	return nil, false
+}
+
 // CreateM2MRelModelInfo creates a Model relModelName (if it does not exist)
 // for the m2m relation defined between model1 and model2.
 // It returns the Model of the intermediate model, the Field of that model
@@ -477,6 +545,8 @@ func createContextsModel(fi *Field, contexts FieldContexts) *Model {
 	valueField.embed = false
 	valueField.stored = false
 	valueField.onChange = ""
+	valueField.dynamicFilter = ""
+	valueField.filterDepends = nil
 	valueField.constraint = ""
 	valueField.contexts = nil
 	valueField.ctxType = ctxValue
@@ -512,7 +582,12 @@ func processDepends() {
 	for _, mi := range Registry.registryByTableName {
 		for _, fInfo := range mi.fields.registryByJSON {
 			var refName string
-			for _, depString := range fInfo.depends {
+			depends := fInfo.depends
+			if fInfo.computeGuard != "" && !strutils.IsIn(fInfo.computeGuard, depends...) {
+				// Setting the guard must compute the field
+				depends = append(append([]string{}, depends...), fInfo.computeGuard)
+			}
+			for _, depString := range depends {
 				if depString == "" {
 					continue
 				}
@@ -520,14 +595,23 @@ func processDepends() {
 				refName = tokens[len(tokens)-1]
 				path := strings.Join(tokens[:len(tokens)-1], ExprSep)
 				targetComputeData := computeData{
-					model:     mi,
-					stored:    fInfo.stored,
-					fieldName: fInfo.name,
-					compute:   fInfo.compute,
-					path:      path,
+					model:      mi,
+					stored:     fInfo.stored,
+					fieldName:  fInfo.name,
+					compute:    fInfo.compute,
+					precompute: fInfo.precompute,
+					path:       path,
+					lazy:       fInfo.lazyCompute,
 				}
 				refModelInfo := mi.getRelatedModelInfo(mi.FieldName(path))
 				refField := refModelInfo.fields.MustGet(refName)
+				if refField.timeDependent && fInfo.stored {
+					log.Panic("Stored fields cannot depend on time dependent fields", "model", mi.name, "field", fInfo.name, "dependency", depString)
+				}
+				if fInfo.computeOnCreate {
+					// Computed once at creation, so we never trigger recomputation
+					continue
+				}
 				refField.dependencies = append(refField.dependencies, targetComputeData)
 			}
 		}
@@ -551,6 +635,15 @@ func checkComputeMethodsSignature() {
 				log.Panic(err.Error(), "model", method.model.name, "method", method.name, "field", fi.name)
 			}
 		}
+		for _, fi := range model.fields.computedStoredFields {
+			if fi.precompute == "" {
+				continue
+			}
+			method := fi.model.methods.MustGet(fi.precompute)
+			if err := checkPrecomputeType(method); err != nil {
+				log.Panic(err.Error(), "model", method.model.name, "method", method.name, "field", fi.name)
+			}
+		}
 		for _, fi := range model.fields.registryByName {
 			if fi.onChange == "" {
 				continue
@@ -578,6 +671,15 @@ func checkComputeMethodsSignature() {
 				log.Panic(err.Error(), "model", method.model.name, "method", method.name, "field", fi.name)
 			}
 		}
+		for _, fi := range model.fields.registryByName {
+			if fi.dynamicFilter == "" {
+				continue
+			}
+			method := fi.model.methods.MustGet(fi.dynamicFilter)
+			if err := checkDynamicFilterType(method); err != nil {
+				log.Panic(err.Error(), "model", method.model.name, "method", method.name, "field", fi.name)
+			}
+		}
 		for _, fi := range model.fields.registryByName {
 			if fi.inverse == "" {
 				continue
@@ -615,6 +717,27 @@ func checkMethType(method *Method, label string) error {
 	return nil
 }
 
+// checkPrecomputeType panics if the given method does not have
+// the correct number and type of arguments and returns for a precompute method
+func checkPrecomputeType(method *Method) error {
+	methType := method.methodType
+	var msg string
+	switch {
+	case methType.NumIn() != 1:
+		msg = "Precompute methods should have no arguments"
+	case methType.NumOut() == 0:
+		msg = "Precompute methods should return a value"
+	case methType.NumOut() > 1:
+		msg = "Too many return values for Precompute method"
+	case methType.Out(0) != reflect.TypeOf(new(types.Context)):
+		msg = "Precompute methods returned value must be of type *types.Context"
+	}
+	if msg != "" {
+		return errors.New(msg)
+	}
+	return nil
+}
+
 // checkOnChangeWarningType panics if the given method does not have
 // the correct number and type of arguments and returns for a onChangeWarning method
 func checkOnChangeWarningType(method *Method) error {
@@ -656,3 +779,24 @@ func checkOnChangeFiltersType(method *Method) error {
 	}
 	return nil
 }
+
+// checkDynamicFilterType panics if the given method does not have
+// the correct number and type of arguments and returns for a dynamicFilter method
+func checkDynamicFilterType(method *Method) error {
+	methType := method.methodType
+	var msg string
+	switch {
+	case methType.NumIn() != 1:
+		msg = "DynamicFilter methods should have no arguments"
+	case methType.NumOut() == 0:
+		msg = "DynamicFilter methods should return a value"
+	case methType.NumOut() > 1:
+		msg = "Too many return values for DynamicFilter method"
+	case !methType.Out(0).Implements(reflect.TypeOf((*Conditioner)(nil)).Elem()):
+		msg = "DynamicFilter methods returned value must implement models.Conditioner"
+	}
+	if msg != "" {
+		return errors.New(msg)
+	}
+	return nil
+}
@@ -22,6 +22,51 @@ type FieldDefinition interface {
 	DeclareField(*models.FieldsCollection, string) *models.Field
 }
 
+// An Array is a field for storing a list of values in a database array
+// column, when a relation to another model is not needed, such as tags.
+//
+// The GoType of an array field must be one of types.StringArray (the
+// default), types.IntegerArray or types.FloatArray.
+type Array struct {
+	JSON            string
+	String          string
+	Help            string
+	Placeholder     string
+	Section         string
+	Stored          bool
+	Required        bool
+	ReadOnly        bool
+	RequiredFunc    func(models.Environment) (bool, models.Conditioner)
+	ReadOnlyFunc    func(models.Environment) (bool, models.Conditioner)
+	InvisibleFunc   func(models.Environment) (bool, models.Conditioner)
+	Index           bool
+	Compute         models.Methoder
+	Depends         []string
+	TimeDependent   bool
+	LazyCompute     bool
+	VersionedCache  bool
+	Precompute      models.Methoder
+	ComputeGuard    string
+	Related         string
+	NoCopy          bool
+	NoWrite         bool
+	GoType          interface{}
+	OnChange        models.Methoder
+	OnChangeWarning models.Methoder
+	OnChangeFilters models.Methoder
+	Constraint      models.Methoder
+	Inverse         models.Methoder
+	Contexts        models.FieldContexts
+	Default         func(models.Environment) interface{}
+
+	ComputeOnCreateOnly bool
+}
+
+// DeclareField creates an array field for the given models.FieldsCollection with the given name.
+func (af Array) DeclareField(fc *models.FieldsCollection, name string) *models.Field {
+	return models.CreateFieldFromStruct(fc, &af, name, fieldtype.Array, new(types.StringArray))
+}
+
 // A Binary is a field for storing binary data, such as images.
 //
 // Clients are expected to handle binary fields as file uploads.
@@ -32,6 +77,8 @@ type Binary struct {
 	JSON            string
 	String          string
 	Help            string
+	Placeholder     string
+	Section         string
 	Stored          bool
 	Required        bool
 	ReadOnly        bool
@@ -42,8 +89,14 @@ type Binary struct {
 	Index           bool
 	Compute         models.Methoder
 	Depends         []string
+	TimeDependent   bool
+	LazyCompute     bool
+	VersionedCache  bool
+	Precompute      models.Methoder
+	ComputeGuard    string
 	Related         string
 	NoCopy          bool
+	NoWrite         bool
 	GoType          interface{}
 	OnChange        models.Methoder
 	OnChangeWarning models.Methoder
@@ -52,6 +105,8 @@ type Binary struct {
 	Inverse         models.Methoder
 	Contexts        models.FieldContexts
 	Default         func(models.Environment) interface{}
+
+	ComputeOnCreateOnly bool
 }
 
 // DeclareField creates a binary field for the given models.FieldsCollection with the given name.
@@ -66,7 +121,10 @@ type Boolean struct {
 	JSON            string
 	String          string
 	Help            string
+	Placeholder     string
+	Section         string
 	Stored          bool
+	SearchShadow    bool
 	Required        bool
 	ReadOnly        bool
 	RequiredFunc    func(models.Environment) (bool, models.Conditioner)
@@ -76,8 +134,14 @@ type Boolean struct {
 	Index           bool
 	Compute         models.Methoder
 	Depends         []string
+	TimeDependent   bool
+	LazyCompute     bool
+	VersionedCache  bool
+	Precompute      models.Methoder
+	ComputeGuard    string
 	Related         string
 	NoCopy          bool
+	NoWrite         bool
 	GoType          interface{}
 	OnChange        models.Methoder
 	OnChangeWarning models.Methoder
@@ -86,6 +150,8 @@ type Boolean struct {
 	Inverse         models.Methoder
 	Contexts        models.FieldContexts
 	Default         func(models.Environment) interface{}
+
+	ComputeOnCreateOnly bool
 }
 
 // DeclareField creates a boolean field for the given models.FieldsCollection with the given name.
@@ -104,7 +170,10 @@ type Char struct {
 	JSON            string
 	String          string
 	Help            string
+	Placeholder     string
+	Section         string
 	Stored          bool
+	SearchShadow    bool
 	Required        bool
 	ReadOnly        bool
 	RequiredFunc    func(models.Environment) (bool, models.Conditioner)
@@ -112,10 +181,17 @@ type Char struct {
 	InvisibleFunc   func(models.Environment) (bool, models.Conditioner)
 	Unique          bool
 	Index           bool
+	SearchType      models.SearchType
 	Compute         models.Methoder
 	Depends         []string
+	TimeDependent   bool
+	LazyCompute     bool
+	VersionedCache  bool
+	Precompute      models.Methoder
+	ComputeGuard    string
 	Related         string
 	NoCopy          bool
+	NoWrite         bool
 	Size            int
 	GoType          interface{}
 	Translate       bool
@@ -126,6 +202,8 @@ type Char struct {
 	Inverse         models.Methoder
 	Contexts        models.FieldContexts
 	Default         func(models.Environment) interface{}
+
+	ComputeOnCreateOnly bool
 }
 
 // DeclareField creates a char field for the given models.FieldsCollection with the given name.
@@ -142,7 +220,10 @@ type Date struct {
 	JSON            string
 	String          string
 	Help            string
+	Placeholder     string
+	Section         string
 	Stored          bool
+	SearchShadow    bool
 	Required        bool
 	ReadOnly        bool
 	RequiredFunc    func(models.Environment) (bool, models.Conditioner)
@@ -152,9 +233,15 @@ type Date struct {
 	Index           bool
 	Compute         models.Methoder
 	Depends         []string
+	TimeDependent   bool
+	LazyCompute     bool
+	VersionedCache  bool
+	Precompute      models.Methoder
+	ComputeGuard    string
 	Related         string
 	GroupOperator   string
 	NoCopy          bool
+	NoWrite         bool
 	GoType          interface{}
 	OnChange        models.Methoder
 	OnChangeWarning models.Methoder
@@ -163,6 +250,8 @@ type Date struct {
 	Inverse         models.Methoder
 	Contexts        models.FieldContexts
 	Default         func(models.Environment) interface{}
+
+	ComputeOnCreateOnly bool
 }
 
 // DeclareField creates a date field for the given models.FieldsCollection with the given name.
@@ -179,7 +268,10 @@ type DateTime struct {
 	JSON            string
 	String          string
 	Help            string
+	Placeholder     string
+	Section         string
 	Stored          bool
+	SearchShadow    bool
 	Required        bool
 	ReadOnly        bool
 	RequiredFunc    func(models.Environment) (bool, models.Conditioner)
@@ -189,9 +281,15 @@ type DateTime struct {
 	Index           bool
 	Compute         models.Methoder
 	Depends         []string
+	TimeDependent   bool
+	LazyCompute     bool
+	VersionedCache  bool
+	Precompute      models.Methoder
+	ComputeGuard    string
 	Related         string
 	GroupOperator   string
 	NoCopy          bool
+	NoWrite         bool
 	GoType          interface{}
 	OnChange        models.Methoder
 	OnChangeWarning models.Methoder
@@ -200,6 +298,8 @@ type DateTime struct {
 	Inverse         models.Methoder
 	Contexts        models.FieldContexts
 	Default         func(models.Environment) interface{}
+
+	ComputeOnCreateOnly bool
 }
 
 // DeclareField creates a datetime field for the given models.FieldsCollection with the given name.
@@ -209,12 +309,57 @@ func (df DateTime) DeclareField(fc *models.FieldsCollection, name string) *model
 	return fInfo
 }
 
+// An Encrypted is a field for storing sensitive text, such as social security
+// numbers or API keys. Values are encrypted with the key set by
+// models.SetEncryptionKey when they are written to the database and decrypted
+// when they are read, so that the database only holds ciphertext.
+//
+// Since encryption is not deterministic, encrypted fields cannot be searched
+// unless BlindIndex is set. A blind index is a keyed hash of the value stored
+// in a hidden indexed column, that allows searching for exact matches only.
+type Encrypted struct {
+	JSON            string
+	String          string
+	Help            string
+	Placeholder     string
+	Section         string
+	Stored          bool
+	Required        bool
+	ReadOnly        bool
+	RequiredFunc    func(models.Environment) (bool, models.Conditioner)
+	ReadOnlyFunc    func(models.Environment) (bool, models.Conditioner)
+	InvisibleFunc   func(models.Environment) (bool, models.Conditioner)
+	BlindIndex      bool
+	Compute         models.Methoder
+	Depends         []string
+	Related         string
+	NoCopy          bool
+	NoWrite         bool
+	GoType          interface{}
+	OnChange        models.Methoder
+	OnChangeWarning models.Methoder
+	OnChangeFilters models.Methoder
+	Constraint      models.Methoder
+	Inverse         models.Methoder
+	Default         func(models.Environment) interface{}
+
+	ComputeOnCreateOnly bool
+}
+
+// DeclareField creates an encrypted field for the given models.FieldsCollection with the given name.
+func (ef Encrypted) DeclareField(fc *models.FieldsCollection, name string) *models.Field {
+	return models.CreateFieldFromStruct(fc, &ef, name, fieldtype.Encrypted, new(string))
+}
+
 // A Float is a field for storing decimal numbers.
 type Float struct {
 	JSON            string
 	String          string
 	Help            string
+	Placeholder     string
+	Section         string
 	Stored          bool
+	SearchShadow    bool
 	Required        bool
 	ReadOnly        bool
 	RequiredFunc    func(models.Environment) (bool, models.Conditioner)
@@ -224,9 +369,16 @@ type Float struct {
 	Index           bool
 	Compute         models.Methoder
 	Depends         []string
+	TimeDependent   bool
+	LazyCompute     bool
+	VersionedCache  bool
+	Precompute      models.Methoder
+	ComputeGuard    string
+	Aggregate       *models.Aggregate
 	Related         string
 	GroupOperator   string
 	NoCopy          bool
+	NoWrite         bool
 	Digits          nbutils.Digits
 	GoType          interface{}
 	OnChange        models.Methoder
@@ -236,6 +388,8 @@ type Float struct {
 	Inverse         models.Methoder
 	Contexts        models.FieldContexts
 	Default         func(models.Environment) interface{}
+
+	ComputeOnCreateOnly bool
 }
 
 // DeclareField adds this datetime field for the given models.FieldsCollection with the given name.
@@ -256,7 +410,10 @@ type HTML struct {
 	JSON            string
 	String          string
 	Help            string
+	Placeholder     string
+	Section         string
 	Stored          bool
+	SearchShadow    bool
 	Required        bool
 	ReadOnly        bool
 	RequiredFunc    func(models.Environment) (bool, models.Conditioner)
@@ -264,10 +421,17 @@ type HTML struct {
 	InvisibleFunc   func(models.Environment) (bool, models.Conditioner)
 	Unique          bool
 	Index           bool
+	SearchType      models.SearchType
 	Compute         models.Methoder
 	Depends         []string
+	TimeDependent   bool
+	LazyCompute     bool
+	VersionedCache  bool
+	Precompute      models.Methoder
+	ComputeGuard    string
 	Related         string
 	NoCopy          bool
+	NoWrite         bool
 	Size            int
 	GoType          interface{}
 	Translate       bool
@@ -278,6 +442,8 @@ type HTML struct {
 	Inverse         models.Methoder
 	Contexts        models.FieldContexts
 	Default         func(models.Environment) interface{}
+
+	ComputeOnCreateOnly bool
 }
 
 // DeclareField creates a html field for the given models.FieldsCollection with the given name.
@@ -292,7 +458,10 @@ type Integer struct {
 	JSON            string
 	String          string
 	Help            string
+	Placeholder     string
+	Section         string
 	Stored          bool
+	SearchShadow    bool
 	Required        bool
 	ReadOnly        bool
 	RequiredFunc    func(models.Environment) (bool, models.Conditioner)
@@ -302,9 +471,16 @@ type Integer struct {
 	Index           bool
 	Compute         models.Methoder
 	Depends         []string
+	TimeDependent   bool
+	LazyCompute     bool
+	VersionedCache  bool
+	Precompute      models.Methoder
+	ComputeGuard    string
+	Aggregate       *models.Aggregate
 	Related         string
 	GroupOperator   string
 	NoCopy          bool
+	NoWrite         bool
 	GoType          interface{}
 	OnChange        models.Methoder
 	OnChangeWarning models.Methoder
@@ -313,6 +489,8 @@ type Integer struct {
 	Inverse         models.Methoder
 	Contexts        models.FieldContexts
 	Default         func(models.Environment) interface{}
+
+	ComputeOnCreateOnly bool
 }
 
 // DeclareField creates a datetime field for the given models.FieldsCollection with the given name.
@@ -332,6 +510,8 @@ type Many2Many struct {
 	JSON             string
 	String           string
 	Help             string
+	Placeholder      string
+	Section          string
 	Stored           bool
 	Required         bool
 	ReadOnly         bool
@@ -343,6 +523,7 @@ type Many2Many struct {
 	Depends          []string
 	Related          string
 	NoCopy           bool
+	NoWrite          bool
 	RelationModel    models.Modeler
 	M2MLinkModelName string
 	M2MOurField      string
@@ -352,6 +533,9 @@ type Many2Many struct {
 	OnChangeFilters  models.Methoder
 	Constraint       models.Methoder
 	Filter           models.Conditioner
+	DynamicFilter    models.Methoder
+	FilterDepends    []string
+	Mapped           []string
 	Inverse          models.Methoder
 	Default          func(models.Environment) interface{}
 }
@@ -398,6 +582,8 @@ type Many2One struct {
 	JSON            string
 	String          string
 	Help            string
+	Placeholder     string
+	Section         string
 	Stored          bool
 	Required        bool
 	ReadOnly        bool
@@ -407,19 +593,30 @@ type Many2One struct {
 	Index           bool
 	Compute         models.Methoder
 	Depends         []string
+	LazyCompute     bool
+	VersionedCache  bool
+	Precompute      models.Methoder
+	ComputeGuard    string
 	Related         string
 	NoCopy          bool
+	NoWrite         bool
 	RelationModel   models.Modeler
 	Embed           bool
 	OnDelete        models.OnDeleteAction
+	CheckCompany    bool
+	NoFK            bool
 	OnChange        models.Methoder
 	OnChangeWarning models.Methoder
 	OnChangeFilters models.Methoder
 	Constraint      models.Methoder
 	Filter          models.Conditioner
+	DynamicFilter   models.Methoder
+	FilterDepends   []string
 	Inverse         models.Methoder
 	Contexts        models.FieldContexts
 	Default         func(models.Environment) interface{}
+
+	ComputeOnCreateOnly bool
 }
 
 // DeclareField creates a many2one field for the given models.FieldsCollection with the given name.
@@ -444,6 +641,8 @@ func (mf Many2One) DeclareField(fc *models.FieldsCollection, name string) *model
 	fInfo.SetProperty("noCopy", noCopy)
 	fInfo.SetProperty("required", required)
 	fInfo.SetProperty("embed", mf.Embed)
+	fInfo.SetProperty("checkCompany", mf.CheckCompany)
+	fInfo.SetProperty("noFK", mf.NoFK)
 	return fInfo
 }
 
@@ -454,6 +653,8 @@ type One2Many struct {
 	JSON            string
 	String          string
 	Help            string
+	Placeholder     string
+	Section         string
 	Stored          bool
 	Required        bool
 	ReadOnly        bool
@@ -472,6 +673,9 @@ type One2Many struct {
 	OnChangeFilters models.Methoder
 	Constraint      models.Methoder
 	Filter          models.Conditioner
+	DynamicFilter   models.Methoder
+	FilterDepends   []string
+	Mapped          []string
 	Inverse         models.Methoder
 	Default         func(models.Environment) interface{}
 }
@@ -498,6 +702,8 @@ type One2One struct {
 	JSON            string
 	String          string
 	Help            string
+	Placeholder     string
+	Section         string
 	Stored          bool
 	Required        bool
 	ReadOnly        bool
@@ -507,8 +713,13 @@ type One2One struct {
 	Index           bool
 	Compute         models.Methoder
 	Depends         []string
+	LazyCompute     bool
+	VersionedCache  bool
+	Precompute      models.Methoder
+	ComputeGuard    string
 	Related         string
 	NoCopy          bool
+	NoWrite         bool
 	RelationModel   models.Modeler
 	Embed           bool
 	OnDelete        models.OnDeleteAction
@@ -517,9 +728,13 @@ type One2One struct {
 	OnChangeFilters models.Methoder
 	Constraint      models.Methoder
 	Filter          models.Conditioner
+	DynamicFilter   models.Methoder
+	FilterDepends   []string
 	Inverse         models.Methoder
 	Contexts        models.FieldContexts
 	Default         func(models.Environment) interface{}
+
+	ComputeOnCreateOnly bool
 }
 
 // DeclareField creates a one2one field for the given models.FieldsCollection with the given name.
@@ -547,6 +762,48 @@ func (of One2One) DeclareField(fc *models.FieldsCollection, name string) *models
 	return fInfo
 }
 
+// A Reference is a field for storing a pointer to a record of any model.
+//
+// The reference is stored in the database as a "ModelName,ID" string.
+// Reading the field returns a RecordSet of the referenced model, or nil
+// if the field is not set.
+type Reference struct {
+	JSON            string
+	String          string
+	Help            string
+	Placeholder     string
+	Section         string
+	Stored          bool
+	Required        bool
+	ReadOnly        bool
+	RequiredFunc    func(models.Environment) (bool, models.Conditioner)
+	ReadOnlyFunc    func(models.Environment) (bool, models.Conditioner)
+	InvisibleFunc   func(models.Environment) (bool, models.Conditioner)
+	Index           bool
+	Compute         models.Methoder
+	Depends         []string
+	LazyCompute     bool
+	VersionedCache  bool
+	Precompute      models.Methoder
+	ComputeGuard    string
+	Related         string
+	NoCopy          bool
+	NoWrite         bool
+	OnChange        models.Methoder
+	OnChangeWarning models.Methoder
+	OnChangeFilters models.Methoder
+	Constraint      models.Methoder
+	Inverse         models.Methoder
+	Default         func(models.Environment) interface{}
+
+	ComputeOnCreateOnly bool
+}
+
+// DeclareField creates a reference field for the given models.FieldsCollection with the given name.
+func (rf Reference) DeclareField(fc *models.FieldsCollection, name string) *models.Field {
+	return models.CreateFieldFromStruct(fc, &rf, name, fieldtype.Reference, new(string))
+}
+
 // A Rev2One is a field for storing reverse one-to-one relations,
 // i.e. the relation on the model without FK.
 //
@@ -555,6 +812,8 @@ type Rev2One struct {
 	JSON            string
 	String          string
 	Help            string
+	Placeholder     string
+	Section         string
 	Stored          bool
 	Required        bool
 	ReadOnly        bool
@@ -573,6 +832,8 @@ type Rev2One struct {
 	OnChangeFilters models.Methoder
 	Constraint      models.Methoder
 	Filter          models.Conditioner
+	DynamicFilter   models.Methoder
+	FilterDepends   []string
 	Inverse         models.Methoder
 	Default         func(models.Environment) interface{}
 }
@@ -598,7 +859,10 @@ type Selection struct {
 	JSON            string
 	String          string
 	Help            string
+	Placeholder     string
+	Section         string
 	Stored          bool
+	SearchShadow    bool
 	Required        bool
 	ReadOnly        bool
 	RequiredFunc    func(models.Environment) (bool, models.Conditioner)
@@ -608,8 +872,14 @@ type Selection struct {
 	Index           bool
 	Compute         models.Methoder
 	Depends         []string
+	TimeDependent   bool
+	LazyCompute     bool
+	VersionedCache  bool
+	Precompute      models.Methoder
+	ComputeGuard    string
 	Related         string
 	NoCopy          bool
+	NoWrite         bool
 	Selection       types.Selection
 	SelectionFunc   func() types.Selection
 	OnChange        models.Methoder
@@ -619,6 +889,8 @@ type Selection struct {
 	Inverse         models.Methoder
 	Contexts        models.FieldContexts
 	Default         func(models.Environment) interface{}
+
+	ComputeOnCreateOnly bool
 }
 
 // DeclareField creates a selection field for the given models.FieldsCollection with the given name.
@@ -637,7 +909,10 @@ type Text struct {
 	JSON            string
 	String          string
 	Help            string
+	Placeholder     string
+	Section         string
 	Stored          bool
+	SearchShadow    bool
 	Required        bool
 	ReadOnly        bool
 	RequiredFunc    func(models.Environment) (bool, models.Conditioner)
@@ -645,10 +920,17 @@ type Text struct {
 	InvisibleFunc   func(models.Environment) (bool, models.Conditioner)
 	Unique          bool
 	Index           bool
+	SearchType      models.SearchType
 	Compute         models.Methoder
 	Depends         []string
+	TimeDependent   bool
+	LazyCompute     bool
+	VersionedCache  bool
+	Precompute      models.Methoder
+	ComputeGuard    string
 	Related         string
 	NoCopy          bool
+	NoWrite         bool
 	Size            int
 	GoType          interface{}
 	Translate       bool
@@ -659,6 +941,8 @@ type Text struct {
 	Inverse         models.Methoder
 	Contexts        models.FieldContexts
 	Default         func(models.Environment) interface{}
+
+	ComputeOnCreateOnly bool
 }
 
 // DeclareField creates a text field for the given models.FieldsCollection with the given name.
@@ -82,31 +82,117 @@ func CreateFieldFromStruct(fc *FieldsCollection, fStruct interface{}, name strin
 	if noc := val.FieldByName("NoCopy"); noc.IsValid() {
 		noCopy = noc.Bool()
 	}
+	var noWrite bool
+	if now := val.FieldByName("NoWrite"); now.IsValid() {
+		noWrite = now.Bool()
+	}
+	var timeDependent bool
+	if td := val.FieldByName("TimeDependent"); td.IsValid() {
+		timeDependent = td.Bool()
+	}
+	var computeOnCreate bool
+	if coc := val.FieldByName("ComputeOnCreateOnly"); coc.IsValid() {
+		computeOnCreate = coc.Bool()
+	}
+	var lazyCompute bool
+	if lc := val.FieldByName("LazyCompute"); lc.IsValid() {
+		lazyCompute = lc.Bool()
+	}
+	var versionedCache bool
+	if vc := val.FieldByName("VersionedCache"); vc.IsValid() {
+		versionedCache = vc.Bool()
+	}
+	var precompute string
+	if pre := val.FieldByName("Precompute"); pre.IsValid() {
+		if meth, ok := pre.Interface().(Methoder); ok && meth != nil {
+			precompute = meth.Underlying().name
+		}
+	}
+	var computeGuard string
+	if cg := val.FieldByName("ComputeGuard"); cg.IsValid() {
+		computeGuard = cg.String()
+	}
+	var dynamicFilter string
+	if df := val.FieldByName("DynamicFilter"); df.IsValid() {
+		if meth, ok := df.Interface().(Methoder); ok && meth != nil {
+			dynamicFilter = meth.Underlying().name
+		}
+	}
+	var filterDepends []string
+	if fd := val.FieldByName("FilterDepends"); fd.IsValid() {
+		filterDepends = fd.Interface().([]string)
+	}
+	var placeholder string
+	if ph := val.FieldByName("Placeholder"); ph.IsValid() {
+		placeholder = ph.String()
+	}
+	var section string
+	if sec := val.FieldByName("Section"); sec.IsValid() {
+		section = sec.String()
+	}
+	var searchShadow bool
+	if ss := val.FieldByName("SearchShadow"); ss.IsValid() {
+		searchShadow = ss.Bool()
+	}
+	var blindIndex bool
+	if bi := val.FieldByName("BlindIndex"); bi.IsValid() {
+		blindIndex = bi.Bool()
+	}
+	var index bool
+	if idx := val.FieldByName("Index"); idx.IsValid() {
+		index = idx.Bool()
+	}
+	var searchType SearchType
+	if st := val.FieldByName("SearchType"); st.IsValid() {
+		searchType = st.Interface().(SearchType)
+	}
+	stored := val.FieldByName("Stored").Bool()
+	depends := val.FieldByName("Depends").Interface().([]string)
+	if agg := val.FieldByName("Aggregate"); agg.IsValid() && !agg.IsNil() {
+		aggregate := agg.Interface().(*Aggregate)
+		compute = aggregate.declareComputeMethod(fc.model, name)
+		depends = aggregate.depends()
+		stored = true
+	}
 	fInfo := &Field{
 		model:           fc.model,
 		name:            name,
 		json:            json,
 		description:     str,
 		help:            val.FieldByName("Help").String(),
-		stored:          val.FieldByName("Stored").Bool(),
+		placeholder:     placeholder,
+		section:         section,
+		stored:          stored,
+		searchShadow:    searchShadow,
+		blindIndex:      blindIndex,
 		required:        val.FieldByName("Required").Bool(),
 		readOnly:        val.FieldByName("ReadOnly").Bool(),
 		readOnlyFunc:    val.FieldByName("ReadOnlyFunc").Interface().(func(Environment) (bool, Conditioner)),
 		requiredFunc:    val.FieldByName("RequiredFunc").Interface().(func(Environment) (bool, Conditioner)),
 		invisibleFunc:   val.FieldByName("InvisibleFunc").Interface().(func(Environment) (bool, Conditioner)),
 		unique:          unique,
-		index:           val.FieldByName("Index").Bool(),
+		index:           index,
+		searchType:      searchType,
 		compute:         compute,
 		inverse:         inverse,
-		depends:         val.FieldByName("Depends").Interface().([]string),
+		depends:         depends,
+		timeDependent:   timeDependent,
+		computeOnCreate: computeOnCreate,
+		lazyCompute:     lazyCompute,
+		versionedCache:  versionedCache,
+		precompute:      precompute,
+		computeGuard:    computeGuard,
 		relatedPathStr:  val.FieldByName("Related").String(),
 		noCopy:          noCopy,
+		noWrite:         noWrite,
 		structField:     structField,
 		fieldType:       fieldType,
 		defaultFunc:     val.FieldByName("Default").Interface().(func(Environment) interface{}),
 		onChange:        onchange,
 		onChangeWarning: onchangeWarning,
 		onChangeFilters: onchangeFilters,
+		dynamicFilter:   dynamicFilter,
+		filterDepends:   filterDepends,
 		constraint:      constraint,
 		contexts:        contexts,
 	}
@@ -170,8 +256,16 @@ func (f *Field) SetProperty(property string, value interface{}) {
 		f.description = value.(string)
 	case "help":
 		f.help = value.(string)
+	case "placeholder":
+		f.placeholder = value.(string)
+	case "section":
+		f.section = value.(string)
 	case "stored":
 		f.stored = value.(bool)
+	case "searchShadow":
+		f.searchShadow = value.(bool)
+	case "blindIndex":
+		f.blindIndex = value.(bool)
 	case "required":
 		f.required = value.(bool)
 	case "readOnly":
@@ -186,10 +280,24 @@ func (f *Field) SetProperty(property string, value interface{}) {
 		f.unique = value.(bool)
 	case "index":
 		f.index = value.(bool)
+	case "searchType":
+		f.searchType = value.(SearchType)
 	case "compute":
 		f.compute = value.(string)
 	case "depends":
 		f.depends = value.([]string)
+	case "timeDependent":
+		f.timeDependent = value.(bool)
+	case "computeOnCreate":
+		f.computeOnCreate = value.(bool)
+	case "lazyCompute":
+		f.lazyCompute = value.(bool)
+	case "versionedCache":
+		f.versionedCache = value.(bool)
+	case "precompute":
+		f.precompute = value.(string)
+	case "computeGuard":
+		f.computeGuard = value.(string)
 	case "selection":
 		f.selection = value.(types.Selection)
 	case "selectionFunc":
@@ -206,10 +314,16 @@ func (f *Field) SetProperty(property string, value interface{}) {
 		f.embed = value.(bool)
 	case "noCopy":
 		f.noCopy = value.(bool)
+	case "noWrite":
+		f.noWrite = value.(bool)
 	case "defaultFunc":
 		f.defaultFunc = value.(func(Environment) interface{})
 	case "onDelete":
 		f.onDelete = value.(OnDeleteAction)
+	case "checkCompany":
+		f.checkCompany = value.(bool)
+	case "noFK":
+		f.noFK = value.(bool)
 	case "onChange":
 		f.onChange = value.(string)
 	case "onChangeWarning":
@@ -222,6 +336,10 @@ func (f *Field) SetProperty(property string, value interface{}) {
 		f.inverse = value.(string)
 	case "filter":
 		f.filter = value.(*Condition)
+	case "dynamicFilter":
+		f.dynamicFilter = value.(string)
+	case "filterDepends":
+		f.filterDepends = value.([]string)
 	case "relationModel":
 		f.relatedModelName = value.(*Model).Name()
 	case "m2mRelModel":
@@ -275,6 +393,18 @@ func (f *Field) SetHelp(value string) *Field {
 	return f
 }
 
+// SetPlaceholder overrides the value of the Placeholder parameter of this Field
+func (f *Field) SetPlaceholder(value string) *Field {
+	f.addUpdate("placeholder", value)
+	return f
+}
+
+// SetSection overrides the value of the Section parameter of this Field
+func (f *Field) SetSection(value string) *Field {
+	f.addUpdate("section", value)
+	return f
+}
+
 // SetGroupOperator overrides the value of the GroupOperator parameter of this Field
 func (f *Field) SetGroupOperator(value string) *Field {
 	f.addUpdate("groupOperator", value)
@@ -293,6 +423,18 @@ func (f *Field) SetOnDelete(value OnDeleteAction) *Field {
 	return f
 }
 
+// SetCheckCompany overrides the value of the CheckCompany parameter of this Field
+func (f *Field) SetCheckCompany(value bool) *Field {
+	f.addUpdate("checkCompany", value)
+	return f
+}
+
+// SetNoFK overrides the value of the NoFK parameter of this Field
+func (f *Field) SetNoFK(value bool) *Field {
+	f.addUpdate("noFK", value)
+	return f
+}
+
 // SetCompute overrides the value of the Compute parameter of this Field
 func (f *Field) SetCompute(value Methoder) *Field {
 	var methName string
@@ -309,12 +451,64 @@ func (f *Field) SetDepends(value []string) *Field {
 	return f
 }
 
+// SetTimeDependent overrides the value of the TimeDependent parameter of this Field
+func (f *Field) SetTimeDependent(value bool) *Field {
+	f.addUpdate("timeDependent", value)
+	return f
+}
+
+// SetComputeOnCreateOnly overrides the value of the ComputeOnCreateOnly parameter of this Field
+func (f *Field) SetComputeOnCreateOnly(value bool) *Field {
+	f.addUpdate("computeOnCreate", value)
+	return f
+}
+
+// SetLazyCompute overrides the value of the LazyCompute parameter of this Field
+func (f *Field) SetLazyCompute(value bool) *Field {
+	f.addUpdate("lazyCompute", value)
+	return f
+}
+
+// SetVersionedCache overrides the value of the VersionedCache parameter of this Field
+func (f *Field) SetVersionedCache(value bool) *Field {
+	f.addUpdate("versionedCache", value)
+	return f
+}
+
+// SetPrecompute overrides the value of the Precompute parameter of this Field
+func (f *Field) SetPrecompute(value Methoder) *Field {
+	var methName string
+	if value != nil {
+		methName = value.Underlying().name
+	}
+	f.addUpdate("precompute", methName)
+	return f
+}
+
+// SetComputeGuard overrides the value of the ComputeGuard parameter of this Field
+func (f *Field) SetComputeGuard(value string) *Field {
+	f.addUpdate("computeGuard", value)
+	return f
+}
+
 // SetStored overrides the value of the Stored parameter of this Field
 func (f *Field) SetStored(value bool) *Field {
 	f.addUpdate("stored", value)
 	return f
 }
 
+// SetSearchShadow overrides the value of the SearchShadow parameter of this Field
+func (f *Field) SetSearchShadow(value bool) *Field {
+	f.addUpdate("searchShadow", value)
+	return f
+}
+
+// SetBlindIndex overrides the value of the BlindIndex parameter of this Field
+func (f *Field) SetBlindIndex(value bool) *Field {
+	f.addUpdate("blindIndex", value)
+	return f
+}
+
 // SetRequired overrides the value of the Required parameter of this Field
 func (f *Field) SetRequired(value bool) *Field {
 	f.addUpdate("required", value)
@@ -357,6 +551,12 @@ func (f *Field) SetIndex(value bool) *Field {
 	return f
 }
 
+// SetSearchType overrides the value of the SearchType parameter of this Field
+func (f *Field) SetSearchType(value SearchType) *Field {
+	f.addUpdate("searchType", value)
+	return f
+}
+
 // SetEmbed overrides the value of the Embed parameter of this Field
 func (f *Field) SetEmbed(value bool) *Field {
 	f.addUpdate("embed", value)
@@ -381,6 +581,12 @@ func (f *Field) SetNoCopy(value bool) *Field {
 	return f
 }
 
+// SetNoWrite overrides the value of the NoWrite parameter of this Field
+func (f *Field) SetNoWrite(value bool) *Field {
+	f.addUpdate("noWrite", value)
+	return f
+}
+
 // SetTranslate overrides the value of the Translate parameter of this Field
 func (f *Field) SetTranslate(value bool) *Field {
 	f.addUpdate("translate", value)
@@ -474,6 +680,22 @@ func (f *Field) SetFilter(value Conditioner) *Field {
 	return f
 }
 
+// SetDynamicFilter overrides the value of the DynamicFilter parameter of this Field
+func (f *Field) SetDynamicFilter(value Methoder) *Field {
+	var methName string
+	if value != nil {
+		methName = value.Underlying().name
+	}
+	f.addUpdate("dynamicFilter", methName)
+	return f
+}
+
+// SetFilterDepends overrides the value of the FilterDepends parameter of this Field
+func (f *Field) SetFilterDepends(value []string) *Field {
+	f.addUpdate("filterDepends", value)
+	return f
+}
+
 // SetRelationModel overrides the value of the Filter parameter of this Field
 func (f *Field) SetRelationModel(value Modeler) *Field {
 	f.addUpdate("relationModel", value.Underlying())
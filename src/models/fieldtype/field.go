@@ -6,6 +6,7 @@ package fieldtype
 import (
 	"reflect"
 
+	"github.com/hexya-erp/hexya/src/models/types"
 	"github.com/hexya-erp/hexya/src/models/types/dates"
 )
 
@@ -15,11 +16,13 @@ type Type string
 // Types for model fields
 const (
 	NoType    Type = ""
+	Array     Type = "array"
 	Binary    Type = "binary"
 	Boolean   Type = "boolean"
 	Char      Type = "char"
 	Date      Type = "date"
 	DateTime  Type = "datetime"
+	Encrypted Type = "encrypted"
 	Float     Type = "float"
 	HTML      Type = "html"
 	Integer   Type = "integer"
@@ -71,7 +74,7 @@ func (t Type) Is2ManyRelationType() bool {
 // IsNullInDB returns true if this type's zero value is
 // saved as null in database.
 func (t Type) IsNullInDB() bool {
-	return t.IsFKRelationType() || t == Binary || t == Char || t == Text || t == HTML || t == Selection || t == Date || t == DateTime
+	return t.IsFKRelationType() || t == Binary || t == Char || t == Text || t == HTML || t == Selection || t == Reference || t == Date || t == DateTime || t == Encrypted
 }
 
 // DefaultGoType returns this Type's default Go type
@@ -79,7 +82,9 @@ func (t Type) DefaultGoType() reflect.Type {
 	switch t {
 	case NoType:
 		return reflect.TypeOf(nil)
-	case Binary, Char, Text, HTML, Selection:
+	case Array:
+		return reflect.TypeOf(*new(types.StringArray))
+	case Binary, Char, Encrypted, Text, HTML, Selection, Reference:
 		return reflect.TypeOf(*new(string))
 	case Boolean:
 		return reflect.TypeOf(true)
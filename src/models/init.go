@@ -27,8 +27,17 @@ var (
 	// Views is a map to store views created automatically.
 	// It will be processed by the views package and added to the views registry.
 	Views map[*Model][]string
+	// debugMode enables debugging tools such as Explain
+	debugMode bool
 )
 
+// SetDebugMode enables or disables the debugging tools of the models, such as
+// RecordCollection.Explain. It is meant to be called before bootstrap with the
+// Debug setting of the server.
+func SetDebugMode(enabled bool) {
+	debugMode = enabled
+}
+
 func init() {
 	log = logging.GetLogger("models")
 	sqlx.NameMapper = strutils.SnakeCase
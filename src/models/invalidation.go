@@ -0,0 +1,71 @@
+// Copyright 2019 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+// A ComputedInvalidationHook is a function called each time the values of a
+// computed field are invalidated with Model.InvalidateComputed.
+//
+// ids is empty if the values of all the records of the model are invalidated.
+type ComputedInvalidationHook func(model, field string, ids []int64)
+
+// OnComputedInvalidation registers the given hook to be called after each
+// call to Model.InvalidateComputed, once the transaction has been committed.
+// Hooks are not called if the transaction is rolled back.
+//
+// Hooks are meant to publish invalidations to the other nodes of a cluster,
+// which apply them on their side with ApplyComputedInvalidation.
+func OnComputedInvalidation(hook ComputedInvalidationHook) {
+	Registry.Lock()
+	defer Registry.Unlock()
+	Registry.computedInvalidationHooks = append(Registry.computedInvalidationHooks, hook)
+}
+
+// InvalidateComputed invalidates the values of the given computed field for the
+// records with the given ids, or for all the records of this model if no ids
+// are given. This is useful when the data a compute method depends on has been
+// modified outside of this Environment, for instance by an external process.
+//
+// Non stored fields will be computed again on next read. Stored fields are
+// recomputed immediately. The registered ComputedInvalidationHook functions
+// are called after the transaction of env has been committed, so that other
+// nodes do not recompute values from uncommitted data.
+func (m *Model) InvalidateComputed(env Environment, field string, ids ...int64) {
+	ApplyComputedInvalidation(env, m.name, field, ids)
+	for _, hook := range Registry.computedInvalidationHooks {
+		h := hook
+		env.afterCommit(func() {
+			h(m.name, field, ids)
+		})
+	}
+}
+
+// ApplyComputedInvalidation invalidates the values of the given computed field
+// of the given model like Model.InvalidateComputed, but without calling the
+// registered hooks. It is meant to apply invalidations received from other nodes.
+func ApplyComputedInvalidation(env Environment, model, field string, ids []int64) {
+	rc := env.Pool(model)
+	fi := rc.model.fields.MustGet(field)
+	if !fi.isComputedField() {
+		log.Panic("Only computed fields can be invalidated", "model", model, "field", field)
+	}
+	if len(ids) == 0 {
+		rc = rc.SearchAll()
+	} else {
+		rc = rc.Search(rc.model.Field(ID).In(ids))
+	}
+	rc.invalidateComputed(fi)
+}
+
+// invalidateComputed removes the cached values of the given computed field for the
+// records of this RecordCollection and recomputes them if the field is stored.
+func (rc *RecordCollection) invalidateComputed(fi *Field) {
+	rc = rc.Fetch()
+	for _, id := range rc.Ids() {
+		rc.env.cache.removeEntry(rc.model, id, fi.json, rc.query.ctxArgsSlug())
+	}
+	if !fi.isStored() || rc.IsEmpty() {
+		return
+	}
+	rc.applyMethod(fi.compute, fi.precompute)
+}
@@ -0,0 +1,138 @@
+// Copyright 2019 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"crypto/sha1"
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hexya-erp/hexya/src/models/fieldtype"
+	"github.com/ugorji/go/codec"
+)
+
+// msgpackHandle is the codec used to marshal RecordCollections
+var msgpackHandle = newMsgpackHandle()
+
+// newMsgpackHandle returns a msgpack handle that encodes time.Time values
+// natively and decodes strings as Go strings.
+func newMsgpackHandle() *codec.MsgpackHandle {
+	h := new(codec.MsgpackHandle)
+	h.WriteExt = true
+	h.RawToString = true
+	return h
+}
+
+// marshaledRecords is the envelope of marshaled RecordCollections.
+type marshaledRecords struct {
+	Model   string
+	Version string
+	Ids     []int64
+	Records []map[string]interface{}
+}
+
+// marshaledFields returns the fields of this model that are
+// marshaled, i.e. the columns of the model's table.
+//
+// Encrypted fields are left out so that their plain text values never
+// reach external caches. They are loaded from the database when read.
+func (m *Model) marshaledFields() []*Field {
+	var res []*Field
+	for _, fi := range m.fields.registryByJSON {
+		if !fi.isStored() || fi.isRelatedField() || fi.isContextedField() || fi.fieldType.Is2ManyRelationType() ||
+			fi.fieldType == fieldtype.Encrypted {
+			continue
+		}
+		res = append(res, fi)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].json < res[j].json
+	})
+	return res
+}
+
+// marshalVersion returns a signature of the marshaled fields of this
+// model, so that data marshaled with another definition is detected.
+func (m *Model) marshalVersion() string {
+	fields := m.marshaledFields()
+	sigs := make([]string, len(fields))
+	for i, fi := range fields {
+		sigs[i] = fmt.Sprintf("%s:%s:%s", fi.json, fi.fieldType, fi.structField.Type)
+	}
+	return fmt.Sprintf("%x", sha1.Sum([]byte(strings.Join(sigs, ","))))
+}
+
+// Marshal returns the values of the stored fields of the records of this
+// RecordCollection encoded with msgpack, typically to store them in an
+// external cache. Relation fields are given by the ID of the related record.
+// Lazily computed fields that have not been computed yet are computed and
+// stored first.
+//
+// The result can be loaded back with the Unmarshal method of the model.
+func (rc *RecordCollection) Marshal() ([]byte, error) {
+	rc.computeLazyFields()
+	fields := rc.model.marshaledFields()
+	fieldNames := make([]FieldName, len(fields))
+	for i, fi := range fields {
+		fieldNames[i] = rc.model.FieldName(fi.json)
+	}
+	rSet := rc.Load(fieldNames...)
+	data := marshaledRecords{
+		Model:   rc.model.name,
+		Version: rc.model.marshalVersion(),
+		Ids:     rSet.Ids(),
+		Records: make([]map[string]interface{}, len(rSet.Ids())),
+	}
+	for i, id := range data.Ids {
+		record := make(map[string]interface{}, len(fields))
+		for _, fi := range fields {
+			value := rSet.env.cache.get(rSet.model, id, fi.json, rSet.query.ctxArgsSlug())
+			if valuer, ok := value.(driver.Valuer); ok {
+				var err error
+				value, err = valuer.Value()
+				if err != nil {
+					return nil, err
+				}
+			}
+			record[fi.json] = value
+		}
+		data.Records[i] = record
+	}
+	var res []byte
+	err := codec.NewEncoderBytes(&res, msgpackHandle).Encode(data)
+	return res, err
+}
+
+// Unmarshal returns a RecordCollection of this model in the given Environment
+// with the records of data, which must have been returned by Marshal. The
+// values of data are put in the cache, so that the records are not fetched
+// again from the database.
+//
+// If data has been marshaled with another definition of the model, the
+// values are discarded and the records will be fetched from the database when
+// needed. An empty RecordCollection is returned if data cannot be decoded.
+func (m *Model) Unmarshal(env Environment, data []byte) *RecordCollection {
+	var records marshaledRecords
+	if err := codec.NewDecoderBytes(data, msgpackHandle).Decode(&records); err != nil {
+		log.Warn("Unable to unmarshal records", "model", m.name, "error", err)
+		return env.Pool(m.name)
+	}
+	if records.Model != m.name {
+		log.Warn("Unmarshaling records of another model", "model", m.name, "dataModel", records.Model)
+		return env.Pool(m.name)
+	}
+	rc := m.Browse(env, records.Ids)
+	if records.Version != m.marshalVersion() || len(records.Records) != len(records.Ids) {
+		log.Debug("Discarding marshaled values of an older model definition", "model", m.name)
+		return rc
+	}
+	for i, id := range records.Ids {
+		fMap := FieldMap(records.Records[i])
+		m.convertValuesToFieldType(&fMap, false)
+		env.cache.addRecord(m, id, fMap, rc.query.ctxArgsSlug())
+	}
+	return rc
+}
@@ -15,7 +15,9 @@
 package models
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"sync"
 
 	"github.com/hexya-erp/hexya/src/models/security"
@@ -139,6 +141,9 @@ type Method struct {
 	nextLayer     map[*methodLayer]*methodLayer
 	groups        map[*security.Group]bool
 	groupsCallers map[callerGroup]bool
+	modelLevel    bool
+	memoized      bool
+	memoContext   []string
 }
 
 // MethodType returns the methodType of a Method
@@ -205,6 +210,59 @@ func (m *Method) RevokeGroup(group *security.Group) *Method {
 	return m
 }
 
+// IsModelLevel returns true if this method has been declared with
+// NewModelMethod and does not operate on records.
+func (m *Method) IsModelLevel() bool {
+	return m.modelLevel
+}
+
+// Memoize caches the results of this method in the Environment, keyed by
+// the records, the arguments, the user and the context of the call.
+//
+// Further calls with the same arguments return the cached results without
+// executing the method until records are created, modified or deleted in
+// the Environment. This is meant for methods behaving like fields with
+// parameters, such as a price at a given quantity.
+func (m *Method) Memoize() *Method {
+	m.Lock()
+	defer m.Unlock()
+	m.memoized = true
+	return m
+}
+
+// MemoizeOn caches the results of this method in the Environment as Memoize
+// does, but only the given keys of the context are part of the cache key. Calls
+// made with contexts that only differ by other keys share the same results.
+//
+// This should be used for methods whose results only depend on a few context
+// keys, such as the language.
+func (m *Method) MemoizeOn(ctxKeys ...string) *Method {
+	m.Lock()
+	defer m.Unlock()
+	m.memoized = true
+	m.memoContext = append([]string{}, ctxKeys...)
+	return m
+}
+
+// memoKey returns the key of the memoized results of the
+// call of this method on rc with the given arguments.
+func (m *Method) memoKey(rc *RecordCollection, args []interface{}) string {
+	ctxKey := fmt.Sprintf("%v", rc.env.context)
+	if m.memoContext != nil {
+		ctxValues := make([]string, len(m.memoContext))
+		for i, key := range m.memoContext {
+			ctxValues[i] = fmt.Sprintf("%s=%v", key, rc.env.context.Get(key))
+		}
+		ctxKey = strings.Join(ctxValues, ",")
+	}
+	return fmt.Sprintf("%s.%s%v|%d|%s|%v", rc.model.name, m.name, rc.ids, rc.env.uid, ctxKey, args)
+}
+
+// IsMemoized returns true if the results of this method are cached.
+func (m *Method) IsMemoized() bool {
+	return m.memoized
+}
+
 // Underlying returns the underlysing method data object
 func (m *Method) Underlying() *Method {
 	return m
@@ -241,6 +299,9 @@ func copyMethod(m *Model, method *Method) *Method {
 		nextLayer:     make(map[*methodLayer]*methodLayer),
 		groups:        make(map[*security.Group]bool),
 		groupsCallers: make(map[callerGroup]bool),
+		modelLevel:    method.modelLevel,
+		memoized:      method.memoized,
+		memoContext:   method.memoContext,
 	}
 }
 
@@ -370,6 +431,26 @@ func (m *Model) NewMethod(methodName string, fnct interface{}) *Method {
 	return meth
 }
 
+// NewModelMethod is used in modules to declare a new model level method for this model.
+//
+// A model level method does not operate on records, such as a factory method. It is
+// called on an empty RecordSet and the code generator declares it on the Model type
+// (e.g. h.Partner().MyMethod(env)) instead of the RecordSet type.
+func (m *Model) NewModelMethod(methodName string, fnct interface{}) *Method {
+	meth, exists, inModel := m.methods.get(methodName)
+	if exists && !inModel {
+		// We are trying to add an existing mixin method as a new method
+		log.Panic("Call to NewModelMethod with an existing method name", "model", m.name, "method", methodName)
+	}
+	// meth might not exist if it has not been declared in pool package
+	if !exists {
+		meth = m.AddEmptyMethod(methodName)
+	}
+	meth.finalize(fnct)
+	meth.modelLevel = true
+	return meth
+}
+
 // AddEmptyMethod creates a new method without function layer
 // The resulting method cannot be called until finalize is called
 func (m *Model) AddEmptyMethod(methodName string) *Method {
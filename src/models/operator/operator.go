@@ -23,6 +23,8 @@ const (
 	In             Operator = "in"
 	NotIn          Operator = "not in"
 	ChildOf        Operator = "child_of"
+	ContainsAll    Operator = "@>"
+	Overlaps       Operator = "&&"
 )
 
 var allowedOperators = map[Operator]bool{
@@ -41,6 +43,8 @@ var allowedOperators = map[Operator]bool{
 	In:             true,
 	NotIn:          true,
 	ChildOf:        true,
+	ContainsAll:    true,
+	Overlaps:       true,
 }
 
 var negativeOperators = map[Operator]bool{
@@ -86,3 +90,15 @@ func (o Operator) IsPositive() bool {
 	_, res := positiveOperators[o]
 	return res
 }
+
+// Register adds op to the known operators. If multi is true, the
+// operator expects an array as argument, like In.
+//
+// Operators are usually registered with models.RegisterOperator, which
+// also defines their SQL.
+func Register(op Operator, multi bool) {
+	allowedOperators[op] = true
+	if multi {
+		multiOperator[op] = true
+	}
+}
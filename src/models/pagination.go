@@ -0,0 +1,65 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+// PageInfo holds the pagination metadata of a page of records
+// returned by Model.Paginate.
+type PageInfo struct {
+	// Page is the number of this page, starting at 1
+	Page int
+	// PageSize is the maximum number of records in a page
+	PageSize int
+	// Total is the number of records matching the condition in all pages
+	Total int
+	// Estimated is true if Total is an estimate of the number of records
+	Estimated bool
+	// PageCount is the number of pages. It is 0 if no records match.
+	PageCount int
+	// HasNext is true if there is a page after this one
+	HasNext bool
+	// HasPrev is true if there is a page before this one
+	HasPrev bool
+}
+
+// Paginate returns the records of this model matching cond on the given page,
+// pages having pageSize records and starting at 1, sorted by the given order
+// or by the default order of the model. All the records are considered if cond
+// is empty.
+//
+// It also returns the pagination metadata of the page. The total number of
+// records is fetched with a single count query. If the 'hexya_estimate_count'
+// context key is set, it is estimated as with SearchCountEstimate instead, so
+// that it is not counted on large unfiltered tables. Paginate panics if page or
+// pageSize is lower than 1.
+func (m *Model) Paginate(env Environment, cond Conditioner, page, pageSize int, order ...string) (*RecordCollection, PageInfo) {
+	if page < 1 || pageSize < 1 {
+		log.Panic("Page and page size must be at least 1", "model", m.name, "page", page, "pageSize", pageSize)
+	}
+	rc := env.Pool(m.name).SearchAll()
+	if !cond.Underlying().IsEmpty() {
+		rc = rc.Search(cond.Underlying())
+	}
+	var (
+		total     int
+		estimated bool
+	)
+	if env.Context().GetBool("hexya_estimate_count") {
+		total, estimated = rc.SearchCountEstimate()
+	} else {
+		total = rc.SearchCount()
+	}
+	info := PageInfo{
+		Page:      page,
+		PageSize:  pageSize,
+		Total:     total,
+		Estimated: estimated,
+		PageCount: (total + pageSize - 1) / pageSize,
+		HasPrev:   page > 1,
+	}
+	info.HasNext = page < info.PageCount
+	if len(order) > 0 {
+		rc = rc.OrderBy(order...)
+	}
+	return rc.Limit(pageSize).Offset((page - 1) * pageSize).Fetch(), info
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/hexya-erp/hexya/src/models/fieldtype"
 	"github.com/hexya-erp/hexya/src/models/operator"
+	"github.com/hexya-erp/hexya/src/models/security"
 	"github.com/hexya-erp/hexya/src/tools/nbutils"
 	"github.com/hexya-erp/hexya/src/tools/strutils"
 )
@@ -145,6 +146,12 @@ func (q *Query) predicateSQLClause(p predicate) (string, SQLParams) {
 	if p.isCond {
 		return q.conditionSQLClause(p.cond)
 	}
+	if es, ok := p.arg.(existsSubquery); ok {
+		return q.existsSQLClause(p, es)
+	}
+	if _, ok := p.arg.(sqlNull); ok {
+		return q.sqlNullClause(p)
+	}
 
 	fi := q.recordSet.model.getRelatedFieldInfo(joinFieldNames(p.exprs, ExprSep))
 	if fi.fieldType.IsFKRelationType() {
@@ -162,6 +169,22 @@ func (q *Query) predicateSQLClause(p predicate) (string, SQLParams) {
 
 	adapter := adapters[db.DriverName()]
 	arg := q.evaluateConditionArgFunctions(p)
+	if fi.fieldType == fieldtype.Reference {
+		arg = referenceConditionValue(arg)
+	}
+	switch {
+	case fi.fieldType == fieldtype.Array:
+		p.operator, arg = arrayConditionArg(fi, p.operator, arg)
+	case p.operator == operator.ContainsAll, p.operator == operator.Overlaps:
+		log.Panic("ContainsAll and Overlaps operators can only be used on array fields", "model", fi.model.name, "field", fi.name)
+	case fi.shadowOf != nil && fi.shadowOf.fieldType == fieldtype.Encrypted:
+		p.operator, arg = blindIndexConditionArg(fi.shadowOf, p.operator, arg)
+	case fi.fieldType == fieldtype.Encrypted && arg != nil && arg != "":
+		log.Panic("Encrypted fields can only be searched with a blind index", "model", fi.model.name, "field", fi.name)
+	}
+	if sq, ok := arg.(Subquery); ok {
+		return q.subquerySQLClause(field, p.operator, fi, sq)
+	}
 	opSql, arg := adapter.operatorSQL(p.operator, arg)
 
 	var isNull bool
@@ -182,7 +205,7 @@ func (q *Query) predicateSQLClause(p predicate) (string, SQLParams) {
 	}
 
 	sql = fmt.Sprintf(`%s %s`, field, opSql)
-	if p.operator.IsNegative() {
+	if q.nullSafeOperator(p.operator) {
 		sql = fmt.Sprintf(`(%s IS NULL OR %s)`, field, sql)
 	}
 
@@ -190,24 +213,125 @@ func (q *Query) predicateSQLClause(p predicate) (string, SQLParams) {
 	return sql, args
 }
 
+// subquerySQLClause returns the sql string and arguments for searching the given field
+// with a Subquery argument.
+func (q *Query) subquerySQLClause(field string, op operator.Operator, fi *Field, sq Subquery) (string, SQLParams) {
+	if op != operator.In && op != operator.NotIn {
+		log.Panic("Subqueries can only be used with In and NotIn operators", "operator", op)
+	}
+	targetModel := fi.relatedModel
+	if fi.json == ID.JSON() {
+		targetModel = fi.model
+	}
+	if targetModel != sq.model {
+		log.Panic("Subquery must be of the model of the relation field", "model", fi.model.name, "field", fi.name,
+			"subqueryModel", sq.model.name)
+	}
+	rSet := q.recordSet.Env().Pool(sq.model.name).Search(sq.cond)
+	rSet = rSet.addRecordRuleConditions(q.recordSet.env.uid, security.Read)
+	addNameSearchesToCondition(rSet.model, rSet.query.cond)
+	rSet.applyContexts()
+	rSet = rSet.substituteRelatedInQuery()
+	subSQL, args, _ := rSet.query.selectCommonQuery([]FieldName{ID})
+
+	opSql, _ := adapters[db.DriverName()].operatorSQL(op, nil)
+	sql := fmt.Sprintf(`%s %s`, field, strings.Replace(opSql, "?", subSQL, 1))
+	if q.nullSafeOperator(op) {
+		sql = fmt.Sprintf(`(%s IS NULL OR %s)`, field, sql)
+	}
+	return sql, args
+}
+
+// existsSQLClause returns the sql string and arguments of the given predicate
+// on the ID of a record with an existsSubquery argument. This is an EXISTS (or
+// NOT EXISTS for the NotIn operator) subquery correlated on this ID.
+func (q *Query) existsSQLClause(p predicate, es existsSubquery) (string, SQLParams) {
+	ownerModel := q.recordSet.model.getRelatedModelInfo(joinFieldNames(p.exprs, ExprSep))
+	fi := ownerModel.fields.MustGet(es.field.Name())
+	if fi.fieldType != fieldtype.One2Many && fi.fieldType != fieldtype.Many2Many {
+		log.Panic("Any and None conditions can only be used on one2many and many2many fields", "model", ownerModel.name, "field", fi.name)
+	}
+	idField, _, _ := q.joinedFieldExpression(p.exprs, false, 0)
+	rSet := q.recordSet.Env().Pool(fi.relatedModelName).Search(es.cond)
+	rSet = rSet.addRecordRuleConditions(q.recordSet.env.uid, security.Read)
+	addNameSearchesToCondition(rSet.model, rSet.query.cond)
+	rSet.applyContexts()
+	rSet = rSet.substituteRelatedInQuery()
+	var (
+		sql  string
+		args SQLParams
+	)
+	switch fi.fieldType {
+	case fieldtype.One2Many:
+		var subSQL string
+		subSQL, args, _ = rSet.query.selectCommonQuery([]FieldName{rSet.model.FieldName(fi.reverseFK)})
+		sql = fmt.Sprintf(`EXISTS (SELECT 1 FROM (%s) hexya_exists WHERE hexya_exists.%s = %s)`, subSQL, fi.jsonReverseFK, idField)
+	case fieldtype.Many2Many:
+		var subSQL string
+		subSQL, args, _ = rSet.query.selectCommonQuery([]FieldName{ID})
+		sql = fmt.Sprintf(`EXISTS (SELECT 1 FROM %s hexya_exists WHERE hexya_exists.%s = %s AND hexya_exists.%s IN (%s))`,
+			adapters[db.DriverName()].quoteTableName(fi.m2mRelModel.tableName), fi.m2mOurField.json, idField, fi.m2mTheirField.json, subSQL)
+	}
+	if p.operator == operator.NotIn {
+		sql = "NOT " + sql
+	}
+	return sql, args
+}
+
+// sqlNullClause returns the sql string and arguments of the given predicate
+// with a sqlNull argument.
+func (q *Query) sqlNullClause(p predicate) (string, SQLParams) {
+	field, _, _ := q.joinedFieldExpression(p.exprs, false, 0)
+	switch p.operator {
+	case operator.Equals:
+		return fmt.Sprintf(`%s IS NULL`, field), nil
+	case operator.NotEquals:
+		return fmt.Sprintf(`%s IS NOT NULL`, field), nil
+	}
+	log.Panic("Strict NULL argument can only be used with = and != operators", "operator", p.operator)
+	// Unreachable
+	return "", nil
+}
+
+// nullSafeOperator returns true if NULL values must match the given operator.
+//
+// Negative operators match NULL values by default, so that searching for
+// name != 'John' also returns records without name. This can be disabled
+// by setting the 'hexya_strict_null_comparison' key in the context.
+func (q *Query) nullSafeOperator(op operator.Operator) bool {
+	if !op.IsNegative() {
+		return false
+	}
+	if q.recordSet.env == nil {
+		// Queries built without environment, e.g. for index predicates
+		return true
+	}
+	return !q.recordSet.env.context.GetBool("hexya_strict_null_comparison")
+}
+
 //nullSQLClause returns the sql string and arguments for searching the given field with an empty argument
 func nullSQLClause(field string, op operator.Operator, fi *Field) (string, SQLParams) {
 	var (
 		sql  string
 		args SQLParams
 	)
+	zero := reflect.Zero(fi.fieldType.DefaultGoType()).Interface()
+	if fi.fieldType == fieldtype.Array {
+		// Compare with an empty array of the field's type instead of NULL
+		zero = reflect.MakeSlice(fi.structField.Type, 0, 0).Interface()
+	}
 	switch op {
 	case operator.Equals, operator.Like, operator.ILike, operator.Contains, operator.IContains:
 		sql = fmt.Sprintf(`%s IS NULL`, field)
 		if !fi.isRelationField() {
 			sql = fmt.Sprintf(`(%s OR %s = ?)`, sql, field)
-			args = SQLParams{reflect.Zero(fi.fieldType.DefaultGoType()).Interface()}
+			args = SQLParams{zero}
 		}
 	case operator.NotEquals, operator.NotContains, operator.NotIContains:
 		sql = fmt.Sprintf(`%s IS NOT NULL`, field)
 		if !fi.isRelationField() {
 			sql = fmt.Sprintf(`(%s AND %s != ?)`, sql, field)
-			args = SQLParams{reflect.Zero(fi.fieldType.DefaultGoType()).Interface()}
+			args = SQLParams{zero}
 		}
 	default:
 		log.Panic("Null argument can only be used with = and != operators", "operator", op)
@@ -352,7 +476,7 @@ func (q *Query) insertQuery(data FieldMap) (string, SQLParams) {
 			}
 		}
 		cols = append(cols, fi.json)
-		vals = append(vals, v)
+		vals = append(vals, encryptedSQLValue(fi, v))
 		i++
 	}
 	tableName := adapter.quoteTableName(q.recordSet.model.tableName)
@@ -418,6 +542,65 @@ func (q *Query) selectQuery(fields []FieldName) (string, SQLParams, map[string]s
 	return selQuery, args, substs
 }
 
+// distinctQuery returns the SQL query string and parameters to retrieve the
+// distinct non null values of the given field in the rows pointed at by this
+// Query object, in ascending order.
+//
+// This query must not have a Group By clause.
+func (q *Query) distinctQuery(field FieldName) (string, SQLParams, map[string]string) {
+	if len(q.groups) > 0 {
+		log.Panic("Calling distinctQuery on a Group By query")
+	}
+	subQuery, args, substs := q.selectCommonQuery([]FieldName{field})
+	_, _, alias := q.joinedFieldExpression(splitFieldNames(field, ExprSep), true, 0)
+	selQuery := fmt.Sprintf(`SELECT DISTINCT %s FROM (%s) foo WHERE %s IS NOT NULL ORDER BY %s`,
+		alias, subQuery, alias, alias)
+	return selQuery, args, substs
+}
+
+// totalsQuery returns the SQL query string and parameters to retrieve in a
+// single row the sums of the given fields over the rows pointed at by this
+// Query object. NULL values are taken as 0.
+func (q *Query) totalsQuery(fields []FieldName) (string, SQLParams) {
+	if len(q.groups) > 0 {
+		log.Panic("Calling totalsQuery on a Group By query")
+	}
+	subQuery, args, _ := q.selectCommonQuery(fields)
+	sums := make([]string, len(fields))
+	for i, field := range fields {
+		_, _, alias := q.joinedFieldExpression(splitFieldNames(field, ExprSep), true, 0)
+		sums[i] = fmt.Sprintf("COALESCE(SUM(%s), 0)", alias)
+	}
+	return fmt.Sprintf(`SELECT %s FROM (%s) foo`, strings.Join(sums, ", "), subQuery), args
+}
+
+// taggedIdsQuery returns the SQL query string and parameters to retrieve the ids
+// of the rows pointed at by this Query object, in ascending order, together with
+// one boolean column per given condition telling whether the row matches it.
+//
+// The given conditions must only use expressions that also appear in the
+// condition of this Query so that their tables are joined. A nil condition
+// never matches.
+func (q *Query) taggedIdsQuery(tags []*Condition) (string, SQLParams) {
+	_, allExprs := q.selectData([]FieldName{ID}, true)
+	tablesSQL, joinsMap := q.tablesSQL(allExprs)
+	whereSQL, whereArgs := q.sqlWhereClause(true)
+	tagsSQL := make([]string, len(tags))
+	var args SQLParams
+	for i, tag := range tags {
+		tagSQL, tagArgs := q.conditionSQLClause(tag)
+		if tagSQL == "" {
+			tagSQL = "FALSE"
+		}
+		tagsSQL[i] = fmt.Sprintf("COALESCE(BOOL_OR(%s), FALSE) AS tag%d", tagSQL, i)
+		args = args.Extend(tagArgs)
+	}
+	selQuery := fmt.Sprintf(`SELECT %s.id, %s FROM %s %s GROUP BY %s.id ORDER BY %s.id`,
+		q.thisTable(), strings.Join(tagsSQL, ", "), tablesSQL, whereSQL, q.thisTable(), q.thisTable())
+	selQuery = strutils.Substitute(selQuery, joinsMap)
+	return selQuery, args.Extend(whereArgs)
+}
+
 // selectGroupQuery returns the SQL query string and parameters to retrieve
 // the result of this Query object, which must include a Group By.
 // fields is the list of fields to retrieve.
@@ -488,6 +671,57 @@ func (q *Query) substituteChildOfPredicates() {
 	q.cond.substituteChildOfOperator(q.recordSet)
 }
 
+// upsertQuery returns the SQL query string and parameters to insert the given rows
+// or update the existing rows conflicting on conflictCols with the values of updateCols.
+// Columns missing in a row take their database default value.
+func (q *Query) upsertQuery(rows []FieldMap, conflictCols, updateCols []string) (string, SQLParams) {
+	adapter := adapters[db.DriverName()]
+	if len(rows) == 0 {
+		log.Panic("No data given for upsert")
+	}
+	colsMap := make(map[string]bool)
+	for _, row := range rows {
+		for k := range row {
+			colsMap[q.recordSet.model.fields.MustGet(k).json] = true
+		}
+	}
+	cols := make([]string, 0, len(colsMap))
+	for col := range colsMap {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+	var vals SQLParams
+	values := make([]string, len(rows))
+	for i, row := range rows {
+		rowValues := make([]string, len(cols))
+		for j, col := range cols {
+			v, ok := row[col]
+			if !ok {
+				rowValues[j] = "DEFAULT"
+				continue
+			}
+			if _, isNull := v.(*interface{}); isNull {
+				v = nil
+			}
+			rowValues[j] = "?"
+			vals = append(vals, encryptedSQLValue(q.recordSet.model.fields.MustGet(col), v))
+		}
+		values[i] = fmt.Sprintf("(%s)", strings.Join(rowValues, ", "))
+	}
+	if len(updateCols) == 0 {
+		// We need to update at least a column so that the existing rows are returned
+		updateCols = conflictCols[:1]
+	}
+	updates := make([]string, len(updateCols))
+	for i, col := range updateCols {
+		updates[i] = fmt.Sprintf("%s = EXCLUDED.%s", col, col)
+	}
+	tableName := adapter.quoteTableName(q.recordSet.model.tableName)
+	sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s ON CONFLICT (%s) DO UPDATE SET %s RETURNING id",
+		tableName, strings.Join(cols, ", "), strings.Join(values, ", "), strings.Join(conflictCols, ", "), strings.Join(updates, ", "))
+	return sql, vals
+}
+
 // updateQuery returns the SQL update string and parameters to update
 // the rows pointed at by this Query object with the given FieldMap.
 func (q *Query) updateQuery(data FieldMap) (string, SQLParams) {
@@ -495,17 +729,24 @@ func (q *Query) updateQuery(data FieldMap) (string, SQLParams) {
 	if len(data) == 0 {
 		log.Panic("No data given for update")
 	}
-	cols := make([]string, len(data))
-	vals := make(SQLParams, len(data))
-	var (
-		i   int
-		sql string
-	)
+	cols := make([]string, 0, len(data))
+	vals := make(SQLParams, 0, len(data))
+	var sql string
 	for k, v := range data {
 		fi := q.recordSet.model.fields.MustGet(k)
-		cols[i] = fmt.Sprintf("%s = ?", fi.json)
-		vals[i] = v
-		i++
+		switch val := v.(type) {
+		case fieldIncrement:
+			cols = append(cols, fmt.Sprintf("%s = COALESCE(%s, 0) + ?", fi.json, fi.json))
+			vals = append(vals, val.delta)
+		case fieldSQLFunction:
+			cols = append(cols, fmt.Sprintf("%s = %s", fi.json, fmt.Sprintf(val.sqlFunc, fi.json)))
+		case fieldExpr:
+			cols = append(cols, fmt.Sprintf("%s = %s", fi.json, val.sql))
+			vals = append(vals, val.args...)
+		default:
+			cols = append(cols, fmt.Sprintf("%s = ?", fi.json))
+			vals = append(vals, encryptedSQLValue(fi, v))
+		}
 	}
 	tableName := adapter.quoteTableName(q.recordSet.model.tableName)
 	updates := strings.Join(cols, ", ")
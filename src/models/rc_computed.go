@@ -18,18 +18,95 @@ import (
 	"fmt"
 	"sort"
 
+	"github.com/hexya-erp/hexya/src/models/types"
+	"github.com/hexya-erp/hexya/src/tools/exceptions"
 	"github.com/hexya-erp/hexya/src/tools/typesutils"
 )
 
 // A recomputePair gives a method to apply on a record collection.
+//
+// If lazyField is set, the field is cleared instead, so that it is
+// recomputed when it is next read.
 type recomputePair struct {
-	recs   *RecordCollection
-	method string
+	recs       *RecordCollection
+	method     string
+	precompute string
+	lazyField  string
+}
+
+// A recomputeQueue holds the recomputations of stored fields that have been
+// deferred to the end of the transaction. Recomputations are deduplicated by
+// model and compute method.
+type recomputeQueue struct {
+	keys  []string
+	items map[string]*deferredRecompute
+}
+
+// A deferredRecompute is a compute method to apply on ids of a model.
+type deferredRecompute struct {
+	recs       *RecordCollection
+	method     string
+	precompute string
+	ids        []int64
+	idsMap     map[int64]bool
+}
+
+// newRecomputeQueue returns a pointer to a new empty recomputeQueue
+func newRecomputeQueue() *recomputeQueue {
+	return &recomputeQueue{
+		items: make(map[string]*deferredRecompute),
+	}
+}
+
+// add the given recomputePair to this queue, merging its records
+// with those of a previously added pair with the same method if any.
+func (rq *recomputeQueue) add(rp recomputePair) {
+	key := fmt.Sprintf("%s-%s-%s", rp.recs.model.name, rp.method, rp.precompute)
+	item, exists := rq.items[key]
+	if !exists {
+		item = &deferredRecompute{
+			recs:       rp.recs,
+			method:     rp.method,
+			precompute: rp.precompute,
+			idsMap:     make(map[int64]bool),
+		}
+		rq.items[key] = item
+		rq.keys = append(rq.keys, key)
+	}
+	for _, id := range rp.recs.Ids() {
+		if !item.idsMap[id] {
+			item.ids = append(item.ids, id)
+			item.idsMap[id] = true
+		}
+	}
+}
+
+// pop empties this queue and returns the recomputePairs it contained.
+func (rq *recomputeQueue) pop() []recomputePair {
+	res := make([]recomputePair, len(rq.keys))
+	for i, key := range rq.keys {
+		item := rq.items[key]
+		res[i] = recomputePair{
+			recs:       item.recs.env.Pool(item.recs.model.name).Call("Browse", item.ids).(RecordSet).Collection(),
+			method:     item.method,
+			precompute: item.precompute,
+		}
+	}
+	rq.keys = nil
+	rq.items = make(map[string]*deferredRecompute)
+	return res
 }
 
 // computeFieldValues updates the given params with the given computed (non stored) fields
 // or all the computed fields of the model if not given.
 // Returned fieldMap keys are field's JSON name
+//
+// Fields whose compute guard is not set are left out of params so that they
+// read as their zero value.
+//
+// If a compute method panics, the error is logged and the field is left out of params
+// so that it reads as its zero value. Set the 'hexya_strict_compute' context key to
+// propagate the panic instead.
 func (rc *RecordCollection) computeFieldValues(params *FieldMap, fields ...string) {
 	rc.EnsureOne()
 	for _, fInfo := range rc.model.fields.getComputedFields(fields...) {
@@ -38,19 +115,156 @@ func (rc *RecordCollection) computeFieldValues(params *FieldMap, fields ...strin
 			// probably because it was computed with another field
 			continue
 		}
-		newParams := rc.Call(fInfo.compute).(RecordData).Underlying().FieldMap
+		if !rc.computeGuardSet(fInfo.computeGuard) {
+			continue
+		}
+		newParams, ok := rc.callComputeMethod(fInfo)
+		if !ok {
+			continue
+		}
 		(*params).MergeWith(newParams, rc.model)
 	}
 }
 
+// callComputeMethod calls the compute method of the given field on this RecordCollection
+// and returns the computed values. The second returned value is false if the compute
+// method panicked with a compute error and strict compute mode is not set.
+func (rc *RecordCollection) callComputeMethod(fInfo *Field) (res FieldMap, ok bool) {
+	if !rc.Env().Context().GetBool("hexya_strict_compute") {
+		defer func() {
+			if r := recover(); r != nil {
+				if !isComputeError(r) {
+					panic(r)
+				}
+				log.Error("Error while computing field", "model", rc.model.name, "field", fInfo.name, "id", rc.ids[0], "error", r)
+				res, ok = nil, false
+			}
+		}()
+	}
+	return rc.Call(fInfo.compute).(RecordData).Underlying().FieldMap, true
+}
+
+// isComputeError returns true if the given panic data has been raised by
+// the code of a compute method, i.e. with log.Panic or as an exception,
+// and not by the database. Database errors abort the transaction, so that
+// they must always be propagated.
+func isComputeError(panicData interface{}) bool {
+	switch panicData.(type) {
+	case string:
+		return true
+	case exceptions.ConcurrencyError:
+		return false
+	case exceptions.Exception:
+		return true
+	}
+	return false
+}
+
 // processTriggers execute computed fields recomputation (for stored fields) or
 // invalidation (for non stored fields) based on the data of each fields 'Depends'
 // attribute.
+//
+// If the 'hexya_defer_recompute' context key is set, stored fields recomputation
+// is deferred until the environment is flushed.
 func (rc *RecordCollection) processTriggers(keys FieldNames) {
 	if rc.Env().Context().GetBool("hexya_no_recompute_stored_fields") {
 		return
 	}
-	rc.updateStoredFields(rc.retrieveComputeData(keys))
+	compPairs := rc.retrieveComputeData(keys)
+	if rc.Env().Context().GetBool("hexya_defer_recompute") && rc.env.recomputeQueue != nil {
+		for _, rp := range compPairs {
+			if rp.lazyField != "" {
+				rp.recs.clearLazyField(rp.lazyField)
+				continue
+			}
+			rc.env.recomputeQueue.add(rp)
+		}
+		return
+	}
+	rc.updateStoredFields(compPairs)
+}
+
+// processInverseM2MTriggers processes the triggers of the inverse field of the
+// given many2many field on the related records with the given ids.
+//
+// It must be called when the relation table of fi has been modified from this
+// side, so that the computed fields of the related model that depend on the
+// inverse field are updated too.
+func (rc *RecordCollection) processInverseM2MTriggers(fi *Field, relIds []int64) {
+	invField, ok := fi.inverseM2MField()
+	if !ok || len(relIds) == 0 {
+		return
+	}
+	relRecs := rc.env.Pool(fi.relatedModelName).withIds(relIds)
+	relRecs.processTriggers(FieldNames{fi.relatedModel.FieldName(invField.name)})
+}
+
+// flushIfPending recomputes all deferred stored fields if one of the given
+// fields of this RecordCollection's model is a stored computed field and
+// some recomputations are pending.
+//
+// We do not check which fields are actually pending since a deferred
+// recomputation may itself trigger the recomputation of other fields.
+//
+// Fields are given as expressions that may go through relation fields.
+//
+// Pending recomputations are also flushed when searching in read only
+// environments, since the database would otherwise be queried against stale
+// values. As any write, the flush is sent to the main database. Get does not
+// flush in read only environments and computes pending values in memory instead.
+func (rc *RecordCollection) flushIfPending(exprs ...[]FieldName) {
+	rq := rc.env.recomputeQueue
+	if rq == nil || len(rq.keys) == 0 {
+		return
+	}
+	for _, expr := range exprs {
+		if len(expr) == 0 {
+			continue
+		}
+		fi := rc.model.getRelatedFieldInfo(joinFieldNames(expr, ExprSep))
+		if (fi.isStored() && fi.compute != "") || fi.shadow != nil {
+			rc.env.Flush()
+			return
+		}
+	}
+}
+
+// pendingComputedValue returns the value of the given field for the first record
+// of this RecordCollection if it is a stored computed field whose recomputation
+// has been deferred for this record. The value is computed in memory and is neither
+// written to the database nor cached, so that the pending recomputation still
+// persists it when the environment is flushed. The second returned value is false
+// if the field has no pending recomputation for this record.
+//
+// The field is given as an expression that may go through relation fields.
+func (rc *RecordCollection) pendingComputedValue(field FieldName) (interface{}, bool) {
+	rq := rc.env.recomputeQueue
+	if rq == nil || len(rq.keys) == 0 || rc.IsEmpty() {
+		return nil, false
+	}
+	fi := rc.model.getRelatedFieldInfo(field)
+	if !fi.isStored() || fi.compute == "" {
+		return nil, false
+	}
+	rec := rc.Records()[0]
+	if exprs := splitFieldNames(field, ExprSep); len(exprs) > 1 {
+		rec = rec.Get(joinFieldNames(exprs[:len(exprs)-1], ExprSep)).(RecordSet).Collection()
+		if rec.IsEmpty() {
+			return nil, false
+		}
+		rec = rec.Records()[0]
+	}
+	item, ok := rq.items[fmt.Sprintf("%s-%s-%s", fi.model.name, fi.compute, fi.precompute)]
+	if !ok || !item.idsMap[rec.ids[0]] || !rec.computeGuardSet(fi.computeGuard) {
+		return nil, false
+	}
+	if fi.precompute != "" {
+		ctx := rec.Env().Context().Copy()
+		ctx.Update(rec.Call(fi.precompute).(*types.Context))
+		rec = rec.WithNewContext(ctx)
+	}
+	data := rec.Call(fi.compute).(RecordData).Underlying()
+	return data.Get(fieldName{name: fi.name, json: fi.json}), true
 }
 
 // retrieveComputeData looks up fields that need to be recomputed when the given fields are modified.
@@ -94,11 +308,47 @@ func (rc *RecordCollection) retrieveComputeData(fields FieldNames) []recomputePa
 			continue
 		}
 		recs.Fetch()
-		res = append(res, recomputePair{recs: recs, method: cData.compute})
+		if cData.lazy {
+			res = append(res, recomputePair{recs: recs, lazyField: cData.fieldName})
+			continue
+		}
+		res = append(res, recomputePair{recs: recs, method: cData.compute, precompute: cData.precompute})
 	}
 	return res
 }
 
+// computeOnCreateFields computes the stored fields of this RecordCollection
+// that are computed only once, when the record is created.
+//
+// Search shadow fields are also computed here so that they are set even
+// if none of their dependencies have been given at creation.
+//
+// Fields computed on create only that are given in the create data keep
+// their given value.
+func (rc *RecordCollection) computeOnCreateFields(given *ModelData) {
+	if rc.Env().Context().GetBool("hexya_no_recompute_stored_fields") {
+		return
+	}
+	var keep []FieldName
+	for _, fi := range rc.model.fields.computedStoredFields {
+		fName := fieldName{name: fi.name, json: fi.json}
+		if fi.computeOnCreate && given.Has(fName) {
+			keep = append(keep, fName)
+		}
+	}
+	applied := make(map[string]bool)
+	for _, fi := range rc.model.fields.computedStoredFields {
+		if (!fi.computeOnCreate && fi.shadowOf == nil) || applied[fi.compute] {
+			continue
+		}
+		if fi.computeOnCreate && given.Has(fieldName{name: fi.name, json: fi.json}) {
+			continue
+		}
+		rc.applyMethod(fi.compute, fi.precompute, keep...)
+		applied[fi.compute] = true
+	}
+}
+
 // updateStoredFields applies each method on each record defined by compPairs
 func (rc *RecordCollection) updateStoredFields(compPairs []recomputePair) {
 	for _, rp := range compPairs {
@@ -107,15 +357,149 @@ func (rc *RecordCollection) updateStoredFields(compPairs []recomputePair) {
 			// if it is empty now, it must be because the records have been unlinked in between
 			continue
 		}
-		rp.recs.applyMethod(rp.method)
+		if rp.lazyField != "" {
+			rp.recs.clearLazyField(rp.lazyField)
+			continue
+		}
+		rp.recs.applyMethod(rp.method, rp.precompute)
 	}
 }
 
+// clearLazyField sets the given lazily computed field to NULL and unsets its
+// computed marker in the database for the records of this RecordCollection, so
+// that it is recomputed and stored again when it is next read. The triggers of
+// the field are processed for the records whose value has actually been cleared.
+func (rc *RecordCollection) clearLazyField(fieldName string) {
+	fi := rc.model.fields.MustGet(fieldName)
+	query := fmt.Sprintf(`UPDATE %s SET %s = NULL, %s = FALSE WHERE id IN (?) AND (%s IS NOT NULL OR %s) RETURNING id`,
+		adapters[db.DriverName()].quoteTableName(rc.model.tableName), fi.json, fi.lazyMarker.json, fi.json, fi.lazyMarker.json)
+	var ids []int64
+	rc.env.cr.written = true
+	rc.env.cr.Select(&ids, query, rc.ids)
+	for _, id := range rc.ids {
+		rc.env.cache.removeEntry(rc.model, id, fi.json, rc.query.ctxArgsSlug())
+		rc.env.cache.removeEntry(rc.model, id, fi.lazyMarker.json, rc.query.ctxArgsSlug())
+	}
+	if len(ids) > 0 {
+		rc.withIds(ids).processTriggers(FieldNames{rc.model.FieldName(fi.name)})
+	}
+}
+
+// lazyFieldComputed returns true if the lazily computed field fi, given by
+// the path exprs, has been computed and stored for the first record of this
+// RecordCollection.
+func (rc *RecordCollection) lazyFieldComputed(fi *Field, exprs []FieldName) bool {
+	markerPath := append(append([]FieldName{}, exprs[:len(exprs)-1]...), fi.model.FieldName(fi.lazyMarker.name))
+	computed, _ := rc.get(joinFieldNames(markerPath, ExprSep), true)
+	res, _ := computed.(bool)
+	return res
+}
+
+// computeLazyFields computes and stores the lazily computed fields of the
+// records of this RecordCollection that have not been computed yet, so that
+// their values can be read directly from the cache.
+//
+// Nothing is computed in read only environments, where values are computed
+// in memory by Get instead.
+func (rc *RecordCollection) computeLazyFields() {
+	if rc.IsEmpty() || rc.hasNegIds || rc.env.readOnly {
+		return
+	}
+	for _, fi := range rc.model.fields.registryByName {
+		if !fi.lazyCompute {
+			continue
+		}
+		marker := rc.model.FieldName(fi.lazyMarker.name)
+		rc.Load(marker)
+		for _, rec := range rc.Records() {
+			if !rec.Get(marker).(bool) {
+				rec.computeLazyField(rc.model.FieldName(fi.name))
+			}
+		}
+	}
+}
+
+// computeLazyField computes the given lazily computed field of the first record
+// of this RecordCollection and stores it in the database with its computed
+// marker set. It returns the computed value.
+//
+// The value is stored as super user since reading a field must not require
+// write access on the model. In read only environments, the value is returned
+// without being stored.
+//
+// The field is given as an expression that may go through relation fields.
+func (rc *RecordCollection) computeLazyField(field FieldName) interface{} {
+	if rc.IsEmpty() {
+		return nil
+	}
+	rec := rc.Records()[0]
+	if exprs := splitFieldNames(field, ExprSep); len(exprs) > 1 {
+		rec = rec.Get(joinFieldNames(exprs[:len(exprs)-1], ExprSep)).(RecordSet).Collection()
+		if rec.IsEmpty() {
+			return nil
+		}
+		rec = rec.Records()[0]
+	}
+	fi := rc.model.getRelatedFieldInfo(field)
+	computeRec := rec
+	if fi.precompute != "" {
+		ctx := rec.Env().Context().Copy()
+		ctx.Update(rec.Call(fi.precompute).(*types.Context))
+		computeRec = rec.WithNewContext(ctx)
+	}
+	data := computeRec.Call(fi.compute).(RecordData).Underlying()
+	value := data.Get(fieldName{name: fi.name, json: fi.json})
+	if rec.env.readOnly {
+		return value
+	}
+	data.Set(fieldName{name: fi.lazyMarker.name, json: fi.lazyMarker.json}, true)
+	rec.Sudo().WithContext("hexya_force_compute_write", true).Call("Write", data)
+	return value
+}
+
 // applyMethod calls the method on this recordset.
-func (rc *RecordCollection) applyMethod(methodName string) {
+//
+// If the fields computed by methodName have a compute guard, the records whose
+// guard is not set are skipped and keep their stored values.
+//
+// If precompute is set, this method is called once on the whole recordset
+// first and the context it returns is merged into the context of the calls
+// to methodName. Computed values are written with the original context.
+//
+// The values of the keep fields returned by methodName are discarded.
+func (rc *RecordCollection) applyMethod(methodName, precompute string, keep ...FieldName) {
+	if guard := rc.model.fields.computeGuard(methodName); guard != "" {
+		if !rc.hasNegIds {
+			// Load the guard of all the records at once
+			rc.Load(rc.model.FieldName(guard))
+		}
+		var ids []int64
+		for _, rec := range rc.Records() {
+			if rec.computeGuardSet(guard) {
+				ids = append(ids, rec.ids[0])
+			}
+		}
+		if len(ids) == 0 {
+			return
+		}
+		rc = newRecordCollection(rc.Env(), rc.ModelName()).withIds(ids)
+	}
+	var precomputeCtx *types.Context
+	if precompute != "" {
+		precomputeCtx = rc.Env().Context().Copy()
+		precomputeCtx.Update(rc.Call(precompute).(*types.Context))
+	}
 	for _, rec := range rc.Records() {
-		retVal := rec.Call(methodName)
+		computeRec := rec
+		if precomputeCtx != nil {
+			computeRec = rec.WithNewContext(precomputeCtx)
+		}
+		retVal := computeRec.Call(methodName)
 		data := retVal.(RecordData).Underlying()
+		for _, f := range keep {
+			data.Unset(f)
+		}
+		rec.addVersions(data)
 		// Check if the values actually changed
 		var doUpdate bool
 		for f, v := range data.FieldMap {
@@ -140,6 +524,16 @@ func (rc *RecordCollection) applyMethod(methodName string) {
 	}
 }
 
+// computeGuardSet returns true if the given boolean compute guard field is set
+// on the first record of this RecordCollection, or if guard is empty.
+func (rc *RecordCollection) computeGuardSet(guard string) bool {
+	if guard == "" {
+		return true
+	}
+	set, _ := rc.Get(rc.model.FieldName(guard)).(bool)
+	return set
+}
+
 // processInverseMethods executes inverse methods of fields in the given
 // FieldMap if it exists. It returns a new FieldMap to be used by Create/Write
 // instead of the original one.
@@ -15,6 +15,8 @@
 package models
 
 import (
+	"sync"
+
 	"github.com/hexya-erp/hexya/src/models/security"
 	"github.com/hexya-erp/hexya/src/models/types"
 )
@@ -44,6 +46,35 @@ func (rc *RecordCollection) WithNewContext(context *types.Context) *RecordCollec
 	return rc.WithEnv(newEnv)
 }
 
+// RelationWithContext returns the records of the given relation field of this
+// RecordCollection, read with its context extended by the keys of ctx, e.g.
+// to include archived records or to read them in a specific language.
+//
+// Unlike WithContext, the context of this RecordCollection is left unchanged:
+// only the returned RecordCollection keeps the extended context.
+func (rc *RecordCollection) RelationWithContext(field FieldName, ctx map[string]interface{}) *RecordCollection {
+	fi := rc.model.getRelatedFieldInfo(field)
+	if !fi.isRelationField() {
+		log.Panic("RelationWithContext can only be called on relation fields", "model", rc.model.name, "field", field.Name())
+	}
+	newCtx := rc.env.context.Copy()
+	for key, value := range ctx {
+		newCtx = newCtx.WithKey(key, value)
+	}
+	return rc.WithNewContext(newCtx).Get(field).(RecordSet).Collection()
+}
+
+// ActiveRecords returns a new RecordCollection of the same model with the
+// records of the 'active_ids' key of the context (see Environment.ActiveIds).
+//
+// It panics if the 'active_model' key of the context is set to another model.
+func (rc *RecordCollection) ActiveRecords() *RecordCollection {
+	if am := rc.env.ActiveModel(); am != "" && am != rc.model.name {
+		log.Panic("Active records belong to another model", "model", rc.model.name, "activeModel", am)
+	}
+	return rc.env.Pool(rc.model.name).Call("Browse", rc.env.ActiveIds()).(RecordSet).Collection()
+}
+
 // Sudo returns a new RecordCollection with the given userId
 // or the superuser id if not specified
 func (rc *RecordCollection) Sudo(userId ...int64) *RecordCollection {
@@ -55,3 +86,85 @@ func (rc *RecordCollection) Sudo(userId ...int64) *RecordCollection {
 	newEnv.uid = uid
 	return rc.WithEnv(newEnv)
 }
+
+// ForEachParallel calls fn on each record of this RecordCollection, with at most
+// concurrency calls running at the same time in separate goroutines.
+//
+// Each call is given the record in its own Environment, with the user and the context
+// of this RecordCollection, and runs in its own transaction. This transaction is
+// committed if fn returns nil and rolled back if it returns an error or panics.
+// Records created or modified in the current transaction and not yet committed are
+// therefore not visible to fn.
+//
+// fn must not modify records that the current transaction has modified or locked:
+// the current transaction waits for ForEachParallel to return, while fn waits for
+// these locks to be released, so that both would wait forever.
+//
+// ForEachParallel returns the errors of each record, in the order of Ids(), or nil
+// if all the calls succeeded. Errors returned by fn are returned as is, without
+// being logged.
+func (rc *RecordCollection) ForEachParallel(concurrency int, fn func(rec *RecordCollection) error) []error {
+	if concurrency < 1 {
+		log.Panic("ForEachParallel concurrency must be at least 1", "model", rc.model.name, "concurrency", concurrency)
+	}
+	var (
+		wg     sync.WaitGroup
+		failed bool
+	)
+	ids := rc.Ids()
+	errs := make([]error, len(ids))
+	sem := make(chan struct{}, concurrency)
+	for i, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, id int64) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = executeInNewEnvironmentWithError(rc.env.uid, func(env Environment) error {
+				env.context = rc.env.context.Copy()
+				return fn(env.Pool(rc.model.name).withIds([]int64{id}))
+			})
+		}(i, id)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			failed = true
+		}
+	}
+	if !failed {
+		return nil
+	}
+	return errs
+}
+
+// InNewTransaction calls fn with the records of this RecordCollection in a new
+// Environment with the same user and context, within a new transaction that is
+// committed if fn returns nil and rolled back if it returns an error or panics.
+// It returns the error of fn, or the panic as an error.
+//
+// The new transaction is independent of the current one, so that the changes
+// made by fn persist even if the current transaction is rolled back later. This
+// is meant for side effects such as logging or notifications.
+//
+// Each transaction works on its own snapshot and cache: fn does not see the
+// uncommitted changes of the current transaction, and the current transaction
+// does not see the changes of fn. fn must not modify records that the current
+// transaction has modified, since it would wait for their locks forever, and
+// the current transaction fails with a serialization error if it modifies
+// records that fn has modified. As with ExecuteInNewEnvironment, fn may be
+// called again if the new transaction fails with a serialization error.
+//
+// InNewTransaction panics if this RecordCollection has records that
+// have not been created in the database yet.
+func (rc *RecordCollection) InNewTransaction(fn func(rec *RecordCollection) error) error {
+	if rc.hasNegIds {
+		log.Panic("InNewTransaction cannot be called on records that are not in the database", "model", rc.model.name, "ids", rc.ids)
+	}
+	return executeInNewEnvironmentWithError(rc.env.uid, func(env Environment) error {
+		env.context = rc.env.context.Copy()
+		return fn(env.Pool(rc.model.name).withIds(rc.ids))
+	})
+}
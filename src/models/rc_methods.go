@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/hexya-erp/hexya/src/models/security"
+	"github.com/hexya-erp/hexya/src/tools/exceptions"
 	"github.com/hexya-erp/hexya/src/tools/strutils"
 )
 
@@ -60,9 +61,22 @@ func (rc *RecordCollection) CallMulti(methName string, args ...interface{}) []in
 	rSet := rc.WithEnv(newEnv)
 	rSet.env.currentLayer = methLayer
 	rSet.env.recursions += 1
+	rSet.env.logContext = []interface{}{"model", rc.model.name, "method", methName, "ids", rc.ids}
 	if rc.env.currentLayer != nil && rc.env.currentLayer.method != methInfo {
 		rSet.env.previousMethod = rc.env.currentLayer.method
 	}
+
+	var memoKey string
+	if methInfo.memoized && methLayer == methInfo.topLayer {
+		// Check the permission before looking up the memo, so that a cached
+		// result is never returned to a caller that may not execute the method.
+		rSet.CheckExecutionPermission(methLayer.method)
+		memoKey = methInfo.memoKey(rc, args)
+		if res, ok := rc.env.cache.getMemo(memoKey); ok {
+			return res
+		}
+	}
+	tdReads := rc.env.cache.timeDependentReads
 	res := rSet.callMulti(methLayer, args...)
 	for i, r := range res {
 		switch r.(type) {
@@ -70,11 +84,16 @@ func (rc *RecordCollection) CallMulti(methName string, args ...interface{}) []in
 			// Reset the current layer and previous method to this method context and not the called one.
 			res[i].(RecordSet).Collection().env.currentLayer = rc.env.currentLayer
 			res[i].(RecordSet).Collection().env.previousMethod = rc.env.previousMethod
+			res[i].(RecordSet).Collection().env.logContext = rc.env.logContext
 			if res[i].(RecordSet).Collection().env.recursions > 0 {
 				res[i].(RecordSet).Collection().env.recursions -= 1
 			}
 		}
 	}
+	if memoKey != "" && rc.env.cache.timeDependentReads == tdReads {
+		// Results depending on the current time are never memoized
+		rc.env.cache.setMemo(memoKey, res)
+	}
 	log.Debug("Called Recordset method", "model", rc.ModelName(), "method", methName, "ids", rc.ids, "duration", time.Now().Sub(startTime), "args", strutils.TrimArgs(args))
 	return res
 }
@@ -165,7 +184,7 @@ func (rc *RecordCollection) CheckExecutionPermission(method *Method, dontPanic .
 	if caller != nil {
 		methodCaller = fmt.Sprintf("%s.%s()", caller.model.name, caller.name)
 	}
-	log.Panic("You are not allowed to execute this method", "model", rc.ModelName(),
+	raise(exceptions.AccessError{Message: "You are not allowed to execute this method"}, "model", rc.ModelName(),
 		"method", fmt.Sprintf("%s.%s()", method.model.name, method.name), "uid", rc.env.uid,
 		"methodCaller", methodCaller)
 	// Unreachable
@@ -4,6 +4,7 @@
 package models
 
 import (
+	"reflect"
 	"sort"
 
 	"github.com/hexya-erp/hexya/src/tools/typesutils"
@@ -187,6 +188,93 @@ func (rc *RecordCollection) SortedByField(name FieldName, reverse bool) *RecordC
 	})
 }
 
+// Resort returns a new record set with the same records as rc sorted again by the
+// database according to the order of rc, or the default order of the model if rc
+// has no specific order. Unlike SortedDefault, it takes into account the values
+// written in the database since rc has been fetched.
+func (rc *RecordCollection) Resort() *RecordCollection {
+	if rc.IsEmpty() {
+		return rc
+	}
+	res := rc.env.Pool(rc.ModelName()).Search(rc.model.Field(ID).In(rc.Ids()))
+	res.query.orders = rc.query.orders
+	return res.Fetch()
+}
+
+// A RecordsDiff holds the differences between two RecordSets of the same
+// model, as returned by DiffWith.
+type RecordsDiff struct {
+	// Fields maps the id of each record that is in both RecordSets and has
+	// different values to the Go names of the fields that differ. Records
+	// with the same values are not listed.
+	Fields map[int64][]string
+	// OnlyInRecords holds the ids of the records that are only in the compared RecordSet
+	OnlyInRecords []int64
+	// OnlyInOther holds the ids of the records that are only in the other RecordSet
+	OnlyInOther []int64
+}
+
+// DiffWith compares field by field the records of rc with the records of other that
+// have the same ids, e.g. to check that two environments see the same values.
+// If no fields are given, all the fields that are stored in the database (including
+// stored computed fields) or related are compared in name order, except ID.
+// Non stored computed fields are not compared. Relation fields are compared by the ids of their records.
+func (rc *RecordCollection) DiffWith(other RecordSet, fields ...FieldName) *RecordsDiff {
+	if rc.ModelName() != other.ModelName() {
+		log.Panic("Unable to diff RecordCollections of different models", "this", rc.ModelName(),
+			"other", other.ModelName())
+	}
+	if len(fields) == 0 {
+		for _, f := range rc.model.fields.storedFieldNames() {
+			if f.Name() != "ID" {
+				fields = append(fields, f)
+			}
+		}
+		sort.Slice(fields, func(i, j int) bool {
+			return fields[i].Name() < fields[j].Name()
+		})
+	}
+	otherRecords := make(map[int64]*RecordCollection)
+	for _, rec := range other.Collection().Records() {
+		otherRecords[rec.ids[0]] = rec
+	}
+	res := &RecordsDiff{Fields: make(map[int64][]string)}
+	for _, rec := range rc.Records() {
+		id := rec.ids[0]
+		otherRec, ok := otherRecords[id]
+		if !ok {
+			res.OnlyInRecords = append(res.OnlyInRecords, id)
+			continue
+		}
+		delete(otherRecords, id)
+		for _, f := range fields {
+			if !reflect.DeepEqual(diffValue(rec.Get(f)), diffValue(otherRec.Get(f))) {
+				res.Fields[id] = append(res.Fields[id], rc.model.fields.MustGet(f.Name()).name)
+			}
+		}
+	}
+	for _, rec := range other.Collection().Records() {
+		if _, ok := otherRecords[rec.ids[0]]; ok {
+			res.OnlyInOther = append(res.OnlyInOther, rec.ids[0])
+		}
+	}
+	return res
+}
+
+// diffValue returns the given field value in a form suitable for comparison,
+// i.e. the sorted ids of RecordSets.
+func diffValue(value interface{}) interface{} {
+	rs, ok := value.(RecordSet)
+	if !ok {
+		return value
+	}
+	ids := append([]int64{}, rs.Ids()...)
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
 // Filtered returns a new record set with only the elements of this record set
 // for which test is true.
 //
@@ -206,3 +294,36 @@ func (rc *RecordCollection) Filtered(test func(rs RecordSet) bool) *RecordCollec
 	}
 	return res
 }
+
+// Every returns true if test is true for all the records of this record set.
+// It stops at the first record for which test is false and returns true if
+// this record set is empty.
+//
+// As with Filtered, the fields used by test are loaded from the database if
+// this record set is not fully loaded.
+func (rc *RecordCollection) Every(test func(rs RecordSet) bool) bool {
+	if !rc.IsValid() {
+		return true
+	}
+	for _, rec := range rc.Records() {
+		if !test(rec) {
+			return false
+		}
+	}
+	return true
+}
+
+// Some returns true if test is true for at least one record of this record set.
+// It stops at the first record for which test is true and returns false if
+// this record set is empty.
+func (rc *RecordCollection) Some(test func(rs RecordSet) bool) bool {
+	if !rc.IsValid() {
+		return false
+	}
+	for _, rec := range rc.Records() {
+		if test(rec) {
+			return true
+		}
+	}
+	return false
+}
@@ -115,6 +115,10 @@ func (rc *RecordCollection) substituteRelatedInQuery() *RecordCollection {
 				curFI = rc.model.getRelatedFieldInfo(joinFieldNames(resExprs, ExprSep))
 			}
 		}
+		if lastFI := rc.model.getRelatedFieldInfo(joinFieldNames(resExprs, ExprSep)); lastFI.shadow != nil {
+			// Search on the stored shadow of this computed field
+			resExprs[len(resExprs)-1] = lastFI.model.FieldName(lastFI.shadow.name)
+		}
 		substs[joinFieldNames(exprs, ExprSep)] = resExprs
 	}
 	rc.query.substituteConditionExprs(substs)
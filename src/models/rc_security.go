@@ -16,6 +16,23 @@ package models
 
 import "github.com/hexya-erp/hexya/src/models/security"
 
+// CheckAccessRights returns true if the user of this RecordCollection's Environment
+// has all the given permissions on the records of its model.
+//
+// It panics with an AccessError if the user lacks one of the permissions, unless
+// dontPanic is set, in which case it returns false.
+func (rc *RecordCollection) CheckAccessRights(perms security.Permission, dontPanic ...bool) bool {
+	for perm, methName := range accessRightsMethods {
+		if perms&perm == 0 {
+			continue
+		}
+		if !rc.CheckExecutionPermission(rc.model.methods.MustGet(methName), dontPanic...) {
+			return false
+		}
+	}
+	return true
+}
+
 // addRecordRuleConditions adds the RecordRule conditions on the query of this
 // RecordSet for the user with the given uid and for the given perm Permission.
 func (rc *RecordCollection) addRecordRuleConditions(uid int64, perm security.Permission) *RecordCollection {
@@ -29,6 +46,14 @@ func (rc *RecordCollection) addRecordRuleConditions(uid int64, perm security.Per
 			rSet = rSet.Search(rule.Condition)
 		}
 	}
+	// Add search restrictions
+	if uid != security.SuperUserID {
+		for _, cond := range rSet.searchRestrictionConditions() {
+			if !cond.IsEmpty() {
+				rSet = rSet.Search(cond)
+			}
+		}
+	}
 	// Add groups rules
 	userGroups := security.Registry.UserGroups(uid)
 	groupCondition := newCondition()
@@ -25,6 +25,8 @@ import (
 	"github.com/hexya-erp/hexya/src/models/fieldtype"
 	"github.com/hexya-erp/hexya/src/models/security"
 	"github.com/hexya-erp/hexya/src/models/types/dates"
+	"github.com/hexya-erp/hexya/src/tools/exceptions"
+	"github.com/hexya-erp/hexya/src/tools/strutils"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -35,6 +37,7 @@ type RecordCollection struct {
 	query      *Query
 	env        *Environment
 	prefetchRC *RecordCollection
+	withFields []FieldName
 	ids        []int64
 	fetched    bool
 	filtered   bool
@@ -168,10 +171,13 @@ func (rc *RecordCollection) create(data RecordData) *RecordCollection {
 	// clean our fMap from ID and non stored fields
 	fMap.RemovePKIfZero()
 	storedFieldMap := rc.filterMapOnStoredFields(fMap)
+	rc.checkRequiredFields(storedFieldMap, true)
 	// insert in DB
 	var createdId int64
 	query, args := rc.query.insertQuery(storedFieldMap)
+	rc.env.cr.written = true
 	rc.env.cr.Get(&createdId, query, args...)
+	rc.env.cache.clearMemo()
 
 	rc.env.cache.addRecord(rc.model, createdId, storedFieldMap, rc.query.ctxArgsSlug())
 	rSet := rc.withIds([]int64{createdId})
@@ -184,6 +190,7 @@ func (rc *RecordCollection) create(data RecordData) *RecordCollection {
 	// compute stored fields
 	rSet.processInverseMethods(data)
 	rSet.processTriggers(fMap.FieldNames(rSet.model))
+	rSet.computeOnCreateFields(data.Underlying())
 	rSet.CheckConstraints(data.Underlying().FieldNames())
 	return rSet
 }
@@ -247,8 +254,19 @@ func (rc *RecordCollection) addEmbeddedfields(fMap FieldMap) FieldMap {
 // are not already set.
 //
 // If create is true, default values are not set for computed fields.
+//
+// The default functions of the fields that are already set are not called, so
+// that fields with a sequence default do not consume a number.
 func (rc *RecordCollection) applyDefaults(md *ModelData, create bool) {
-	defaults := rc.WithContext("hexya_ignore_computed_defaults", create).Call("DefaultGet").(RecordData).Underlying()
+	given := make([]string, 0, len(md.FieldMap))
+	for f := range md.FieldMap {
+		if fi, ok := rc.model.fields.Get(f); ok {
+			given = append(given, fi.json)
+		}
+	}
+	defaults := rc.WithContext("hexya_ignore_computed_defaults", create).
+		WithContext("hexya_default_skip_fields", given).
+		Call("DefaultGet").(RecordData).Underlying()
 	defaults.MergeWith(md)
 	*md = *defaults
 }
@@ -257,8 +275,13 @@ func (rc *RecordCollection) applyDefaults(md *ModelData, create bool) {
 // the context and fields default functions.
 //
 // If create is true, default values are not given for computed fields.
+// Fields listed in the 'hexya_default_skip_fields' context key are skipped.
 func (rc *RecordCollection) getDefaults(create bool) *ModelData {
 	md := NewModelData(rc.model)
+	skipped := make(map[string]bool)
+	for _, f := range rc.env.context.GetStringSlice("hexya_default_skip_fields") {
+		skipped[f] = true
+	}
 
 	// 1. Create a map with default values from context
 	ctxDefaults := make(FieldMap)
@@ -281,6 +304,9 @@ func (rc *RecordCollection) getDefaults(create bool) *ModelData {
 		if create && (fi.isComputedField() || (fi.isRelatedField() && !fi.isContextedField())) {
 			continue
 		}
+		if skipped[fi.json] {
+			continue
+		}
 		fName := rc.model.FieldName(fn)
 		if val, exists := ctxDefaults[fi.json]; exists {
 			md.Set(fName, val)
@@ -350,7 +376,61 @@ func (rc *RecordCollection) CheckConstraints(fields FieldNames) {
 	}
 	for method := range methods {
 		for _, rec := range rc.Records() {
-			rec.Call(method)
+			rec.checkConstraint(method)
+		}
+	}
+	rc.checkCompanies(fields)
+}
+
+// checkConstraint calls the given constraint method on this RecordCollection.
+// It panics with a ValidationError if the constraint fails. Database errors
+// that are not integrity constraint violations are raised unchanged.
+func (rc *RecordCollection) checkConstraint(method string) {
+	defer func() {
+		if r := recover(); r != nil {
+			if err, ok := r.(error); ok && !adapters[db.DriverName()].isConstraintViolationError(err) {
+				panic(r)
+			}
+			panic(asValidationError(r))
+		}
+	}()
+	rc.Call(method)
+}
+
+// checkCompanies panics if the company of the record pointed to by a many2one
+// field with CheckCompany set differs from the company of the record. Records
+// without company are shared and can be linked from any record.
+//
+// All CheckCompany fields are checked if the Company field itself is in fields.
+func (rc *RecordCollection) checkCompanies(fields FieldNames) {
+	written := make(map[string]bool)
+	for _, f := range fields {
+		written[f.JSON()] = true
+	}
+	companyField := rc.model.fields.registryByName[companyFieldName]
+	companyChanged := companyField != nil && written[companyField.json]
+	var toCheck []*Field
+	for _, fi := range rc.model.fields.registryByName {
+		if fi.checkCompany && (companyChanged || written[fi.json]) {
+			toCheck = append(toCheck, fi)
+		}
+	}
+	if len(toCheck) == 0 {
+		return
+	}
+	for _, rec := range rc.Sudo().Records() {
+		company := rec.Get(rec.model.FieldName(companyFieldName)).(RecordSet).Collection()
+		for _, fi := range toCheck {
+			relRec := rec.Get(rec.model.FieldName(fi.name)).(RecordSet).Collection()
+			if relRec.IsEmpty() {
+				continue
+			}
+			relCompany := relRec.Get(relRec.model.FieldName(companyFieldName)).(RecordSet).Collection()
+			if relCompany.IsEmpty() || relCompany.Equals(company) {
+				continue
+			}
+			raise(exceptions.ValidationError{Message: "Incompatible companies on records"}, "model", rc.model.name, "id", rec.ids[0],
+				"company", company.Ids(), "field", fi.name, "relatedID", relRec.ids[0], "relatedCompany", relCompany.Ids())
 		}
 	}
 }
@@ -364,6 +444,69 @@ func (rc *RecordCollection) addAccessFieldsCreateData(fMap *FieldMap) {
 	}
 }
 
+// upsert inserts the given data in the database, or updates the existing
+// records that have the same values for conflictFields. It returns the inserted
+// and updated records.
+//
+// Only the stored fields of the model are written. On existing records, only
+// the fields that are given in every data are updated.
+//
+// Since the Create and Write methods are not called and record rules are not
+// checked, upsert panics with an AccessError if rc's user is not the superuser.
+// This function is private and low level. It should not be called directly.
+// Instead use model.Upsert()
+func (rc *RecordCollection) upsert(data []RecordData, conflictFields []FieldName) *RecordCollection {
+	if rc.env.uid != security.SuperUserID {
+		raise(exceptions.AccessError{Message: "Upsert can only be called by the superuser"}, "model", rc.ModelName(), "uid", rc.env.uid)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			panic(rc.substituteSQLErrorMessage(r))
+		}
+	}()
+	conflictCols := rc.model.upsertConflictColumns(conflictFields)
+	if len(data) == 0 {
+		return rc.withIds([]int64{})
+	}
+	var fieldNames FieldNames
+	givenCols := make(map[string]int)
+	rows := make([]FieldMap, len(data))
+	for i, d := range data {
+		newData := d.Underlying().Copy()
+		fieldNames = append(fieldNames, newData.FieldMap.FieldNames(rc.model)...)
+		for col := range rc.filterMapOnStoredFields(newData.FieldMap) {
+			givenCols[col]++
+		}
+		rc.applyDefaults(newData, true)
+		fMap := newData.FieldMap
+		rc.addAccessFieldsCreateData(&fMap)
+		rc.addAccessFieldsUpdateData(&fMap)
+		rc.model.convertValuesToFieldType(&fMap, true)
+		fMap.RemovePKIfZero()
+		rows[i] = rc.filterMapOnStoredFields(fMap)
+	}
+	var updateCols []string
+	for col, num := range givenCols {
+		if num < len(data) || col == "id" || strutils.IsIn(col, conflictCols...) {
+			continue
+		}
+		updateCols = append(updateCols, col)
+	}
+	if !rc.model.isSystem() {
+		updateCols = append(updateCols, "write_date", "write_uid")
+	}
+	var ids []int64
+	query, args := rc.query.upsertQuery(rows, conflictCols, updateCols)
+	rc.env.cr.written = true
+	rc.env.cr.Select(&ids, query, args...)
+	rc.env.cache.clearMemo()
+	rSet := rc.withIds(ids)
+	rSet.InvalidateCache()
+	rSet.processTriggers(fieldNames)
+	rSet.CheckConstraints(fieldNames)
+	return rSet
+}
+
 // update updates the database with the given data and returns the number of updated rows.
 // It panics in case of error.
 // It returns without changes if rc is empty
@@ -373,6 +516,7 @@ func (rc *RecordCollection) update(data RecordData) bool {
 	if !rc.hasNegIds && rc.ForceLoad(ID).IsEmpty() {
 		return true
 	}
+	rc.checkNoWriteFields(data.Underlying().FieldNames())
 	rSet := rc.addRecordRuleConditions(rc.env.uid, security.Write)
 	// process create data for FK relations if any
 	data = rc.createFKRelationRecords(data)
@@ -386,6 +530,11 @@ func (rc *RecordCollection) update(data RecordData) bool {
 	// clean our fMap from ID and non stored fields
 	fMap.RemovePK()
 	storedFieldMap := rSet.filterMapOnStoredFields(fMap)
+	if !rSet.hasNegIds {
+		rSet.checkRequiredFields(storedFieldMap, false)
+	}
+	changesetFields := rSet.changesetFields(storedFieldMap)
+	oldValues := rSet.readChangesetValues(changesetFields)
 	rSet.doUpdate(storedFieldMap)
 	// Let's fetch once for all
 	rSet.Fetch()
@@ -398,6 +547,7 @@ func (rc *RecordCollection) update(data RecordData) bool {
 	// compute stored fields
 	rSet.processTriggers(fMap.FieldNames(rSet.model))
 	rSet.CheckConstraints(data.Underlying().FieldNames())
+	rSet.callAfterWriteHooks(changesetFields, oldValues)
 	return true
 }
 
@@ -410,6 +560,46 @@ func (rc *RecordCollection) addAccessFieldsUpdateData(fMap *FieldMap) {
 	}
 }
 
+// checkRequiredFields raises a ValidationError listing the required fields that
+// are empty in the given FieldMap, whose keys must be JSON field names.
+//
+// If create is true, required fields that are not in fMap are also listed.
+// Otherwise, only the given fields are checked, so that a Write can omit a
+// required field but not clear it. Computed fields are not checked.
+func (rc *RecordCollection) checkRequiredFields(fMap FieldMap, create bool) {
+	var missing []string
+	for _, fi := range rc.model.fields.registryByJSON {
+		if !fi.required || fi.json == ID.JSON() || !fi.isStored() || fi.isComputedField() || fi.isContextedField() {
+			continue
+		}
+		value, set := fMap[fi.json]
+		if (!set && create) || (set && valueIsEmpty(fi, value)) {
+			missing = append(missing, fi.description)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	sort.Strings(missing)
+	raise(exceptions.ValidationError{
+		Message: fmt.Sprintf("The following required fields are missing: %s", strings.Join(missing, ", ")),
+	}, "model", rc.model.name, "fields", missing)
+}
+
+// checkNoWriteFields panics if one of the given fields has been declared with
+// NoWrite, unless the fields are written by the ORM to store computed values,
+// i.e. if "hexya_force_compute_write" is set in the context.
+func (rc *RecordCollection) checkNoWriteFields(fields FieldNames) {
+	if rc.env.context.GetBool("hexya_force_compute_write") {
+		return
+	}
+	for _, field := range fields {
+		if fi, ok := rc.model.fields.Get(field.Name()); ok && fi.noWrite {
+			log.Panic("Trying to write a field declared with NoWrite", "model", rc.model.name, "field", fi.name)
+		}
+	}
+}
+
 // filterMapOnStoredFields returns a new FieldMap from fMap
 // with only fields keys stored directly in this model.
 // Fields with inverse methods are not returned unless
@@ -455,11 +645,18 @@ func (rc *RecordCollection) doUpdate(fMap FieldMap) {
 		query, args := rc.query.updateQuery(fMap)
 		res := rc.env.cr.Execute(query, args...)
 		if num, _ := res.RowsAffected(); num == 0 {
-			log.Panic("Unexpected noop on update (num = 0)", "model", rc.ModelName(), "values", fMap, "query", query, "args", args)
+			raise(exceptions.MissingError{Message: "Unexpected noop on update (num = 0)"}, "model", rc.ModelName(), "values", fMap, "query", query, "args", args)
 		}
 	}
+	rc.env.cache.clearMemo()
 	for _, rec := range rc.Records() {
 		for k, v := range fMap {
+			switch v.(type) {
+			case fieldIncrement, fieldSQLFunction:
+				// The new value is computed by the database
+				rc.env.cache.removeEntry(rc.model, rec.Ids()[0], k, rc.query.ctxArgsSlug())
+				continue
+			}
 			rc.env.cache.updateEntry(rc.model, rec.Ids()[0], k, v, rc.query.ctxArgsSlug())
 		}
 	}
@@ -493,6 +690,9 @@ func (rc *RecordCollection) updateRelationFields(fMap FieldMap) {
 
 		case fieldtype.Rev2One:
 		case fieldtype.Many2Many:
+			var oldIds []int64
+			selQuery := fmt.Sprintf(`SELECT %s FROM %s WHERE %s IN (?)`, fi.m2mTheirField.json, fi.m2mRelModel.tableName, fi.m2mOurField.json)
+			rc.env.cr.Select(&oldIds, selQuery, rc.ids)
 			delQuery := fmt.Sprintf(`DELETE FROM %s WHERE %s IN (?)`, fi.m2mRelModel.tableName, fi.m2mOurField.json)
 			rc.env.cr.Execute(delQuery, rc.ids)
 			for _, id := range rc.ids {
@@ -504,6 +704,7 @@ func (rc *RecordCollection) updateRelationFields(fMap FieldMap) {
 				}
 				rc.env.cache.addM2MLink(fi, id, value.([]int64))
 			}
+			rc.processInverseM2MTriggers(fi, append(oldIds, value.([]int64)...))
 		}
 	}
 }
@@ -646,7 +847,8 @@ func (rc *RecordCollection) relatedFieldMap(fMap FieldMap, field FieldName) (Fie
 }
 
 // substituteSQLErrorMessage changes the message from the given recover data
-// if it comes from the database with the message defined in this model
+// if it comes from the database with the message defined in this model.
+// Such errors are returned as ValidationError.
 func (rc *RecordCollection) substituteSQLErrorMessage(r interface{}) interface{} {
 	err, ok := r.(error)
 	if !ok {
@@ -654,8 +856,22 @@ func (rc *RecordCollection) substituteSQLErrorMessage(r interface{}) interface{}
 	}
 	for constraintName, constraint := range rc.model.sqlConstraints {
 		if strings.Contains(err.Error(), constraintName) {
+			debug := err.Error()
 			res := adapters[db.DriverName()].substituteErrorMessage(err, constraint.errorString)
-			return res
+			return exceptions.ValidationError{
+				Message: res.Error(),
+				Debug:   debug,
+			}
+		}
+	}
+	for indexName, index := range rc.model.partialUniques {
+		if strings.Contains(err.Error(), indexName) {
+			debug := err.Error()
+			res := adapters[db.DriverName()].substituteErrorMessage(err, index.errorString)
+			return exceptions.ValidationError{
+				Message: res.Error(),
+				Debug:   debug,
+			}
 		}
 	}
 	return r
@@ -675,9 +891,12 @@ func (rc *RecordCollection) unlink() int64 {
 	compData := rc.retrieveComputeData(rc.model.fields.allFieldNames())
 	var num int64
 	if !rSet.hasNegIds {
+		rSet.markUnlinking()
+		rSet.unlinkCascadeRecords()
 		query, args := rSet.query.deleteQuery()
 		res := rSet.env.cr.Execute(query, args...)
 		num, _ = res.RowsAffected()
+		rSet.addTombstones(ids)
 	}
 	for _, id := range ids {
 		rc.env.cache.invalidateRecord(rc.model, id)
@@ -687,6 +906,52 @@ func (rc *RecordCollection) unlink() int64 {
 	return num
 }
 
+// unlinkCascadeRecords unlinks the records that reference this RecordCollection
+// through a field with the Cascade OnDelete action, so that their Unlink method
+// is called and the cache is updated. There is a single Unlink call per such field
+// for all the records of this RecordCollection, whatever the number of children.
+//
+// Cascade records are searched and unlinked as superuser so that none is left
+// out, as the database would do with the foreign key. Records that are already
+// being unlinked in the environment are skipped, so that cascade cycles end.
+func (rc *RecordCollection) unlinkCascadeRecords() {
+	for _, fi := range rc.model.cascadeFields {
+		children := rc.env.Pool(fi.model.name).Sudo().Search(fi.model.Field(fi.model.FieldName(fi.name)).In(rc.Ids())).Fetch()
+		children = children.withoutUnlinking()
+		if children.IsEmpty() {
+			continue
+		}
+		children.Call("Unlink")
+	}
+}
+
+// markUnlinking records in the environment that the records of this
+// RecordCollection are being unlinked.
+func (rc *RecordCollection) markUnlinking() {
+	if rc.env.unlinking == nil {
+		return
+	}
+	if rc.env.unlinking[rc.model.name] == nil {
+		rc.env.unlinking[rc.model.name] = make(map[int64]bool)
+	}
+	for _, id := range rc.ids {
+		rc.env.unlinking[rc.model.name][id] = true
+	}
+}
+
+// withoutUnlinking returns a new RecordCollection with the records of this
+// RecordCollection that are not being unlinked in the environment.
+func (rc *RecordCollection) withoutUnlinking() *RecordCollection {
+	unlinking := rc.env.unlinking[rc.model.name]
+	var ids []int64
+	for _, id := range rc.ids {
+		if !unlinking[id] {
+			ids = append(ids, id)
+		}
+	}
+	return newRecordCollection(rc.Env(), rc.ModelName()).withIds(ids)
+}
+
 // Search returns a new RecordSet filtering on the current one with the
 // additional given Condition
 func (rc *RecordCollection) Search(cond *Condition) *RecordCollection {
@@ -696,6 +961,62 @@ func (rc *RecordCollection) Search(cond *Condition) *RecordCollection {
 	return &rSetVal
 }
 
+// MultiSearch returns one RecordSet per given condition with the records of this
+// RecordSet matching it. The records are fetched with a single query on all the
+// conditions OR-ed together and then dispatched into each RecordSet, so that a
+// record matching several conditions appears in each of their RecordSets.
+//
+// The records of each returned RecordSet are sorted by ID. The RecordSet of an
+// empty condition is empty, as it would be with Search.
+func (rc *RecordCollection) MultiSearch(conds ...*Condition) []*RecordCollection {
+	res := make([]*RecordCollection, len(conds))
+	combined := newCondition()
+	for i, cond := range conds {
+		res[i] = rc.env.Pool(rc.ModelName())
+		combined = combined.OrCond(cond)
+	}
+	if combined.IsEmpty() {
+		return res
+	}
+	rSet := rc.Search(combined)
+	rSet.flushIfPending(rSet.query.getAllExpressions()...)
+	rSet, _ = rSet.prepareLoadQuery([]FieldName{ID})
+	tags := make([]*Condition, len(conds))
+	for i, cond := range conds {
+		if cond.IsEmpty() {
+			continue
+		}
+		// We apply the same substitutions to each condition as to the whole query
+		tagSet, _ := rc.Search(cond).prepareLoadQuery([]FieldName{ID})
+		tagSet.query.substituteChildOfPredicates()
+		tags[i] = tagSet.query.cond
+	}
+	query, args := rSet.query.taggedIdsQuery(tags)
+	rows := rSet.env.cr.readQuery(rSet.env.readOnly, query, args...)
+	defer rows.Close()
+	ids := make([][]int64, len(conds))
+	for rows.Next() {
+		var id int64
+		matches := make([]bool, len(conds))
+		dest := []interface{}{&id}
+		for i := range matches {
+			dest = append(dest, &matches[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			log.Panic(err.Error(), "model", rc.model.name, "query", query)
+		}
+		for i, match := range matches {
+			if match {
+				ids[i] = append(ids[i], id)
+			}
+		}
+	}
+	for i := range res {
+		res[i] = res[i].withIds(ids[i])
+	}
+	return res
+}
+
 // Limit returns a new RecordSet with only the first 'limit' records.
 func (rc *RecordCollection) Limit(limit int) *RecordCollection {
 	rSet := *rc
@@ -712,20 +1033,30 @@ func (rc *RecordCollection) Offset(offset int) *RecordCollection {
 	return &rSet
 }
 
-// OrderBy returns a new RecordSet ordered by the given ORDER BY expressions
+// OrderBy returns a new RecordSet ordered by the given ORDER BY expressions.
+// It panics if an expression refers to an encrypted field.
 func (rc *RecordCollection) OrderBy(exprs ...string) *RecordCollection {
 	rSet := *rc
 	rSet.query = rSet.query.clone(&rSet)
 	rSet.query.orders = rc.model.ordersFromStrings(exprs)
+	for _, order := range rSet.query.orders {
+		if rc.model.getRelatedFieldInfo(order.field).fieldType == fieldtype.Encrypted {
+			log.Panic("Records cannot be ordered by encrypted fields", "model", rc.model.name, "field", order.field)
+		}
+	}
 	return &rSet
 }
 
-// GroupBy returns a new RecordSet grouped with the given GROUP BY expressions
+// GroupBy returns a new RecordSet grouped with the given GROUP BY expressions.
+// It panics if an expression refers to an encrypted field.
 func (rc *RecordCollection) GroupBy(fields ...FieldName) *RecordCollection {
 	rSet := *rc
 	rSet.query = rSet.query.clone(&rSet)
 	exprs := make([]FieldName, len(fields))
 	for i, f := range fields {
+		if rc.model.getRelatedFieldInfo(f).fieldType == fieldtype.Encrypted {
+			log.Panic("Records cannot be grouped by encrypted fields", "model", rc.model.name, "field", f)
+		}
 		exprs[i] = f
 	}
 	rSet.query.groups = append(rSet.query.groups, exprs...)
@@ -757,9 +1088,207 @@ func (rc *RecordCollection) SearchAll() *RecordCollection {
 	return rSet
 }
 
+// Next returns the record that comes right after this record when the records of
+// the RecordSet it has been taken from (e.g. with Records()) are sorted by the given
+// order, e.g. "Name desc, Date". If this record has not been taken from another
+// RecordSet, all the records of the model are considered. Records with the same
+// values for the order fields are sorted by ID. The record rules and the context of
+// this RecordSet apply as for a Search.
+//
+// Empty values of the order fields are sorted as NULL values by the database,
+// that is after all the other values in ascending order.
+//
+// Next returns an empty RecordSet if this record is the last one.
+// It panics if this RecordSet is not a singleton.
+func (rc *RecordCollection) Next(order string) *RecordCollection {
+	return rc.adjacentRecord(order, false)
+}
+
+// Previous returns the record that comes right before this record when the
+// records are sorted by the given order. See Next for details.
+//
+// Previous returns an empty RecordSet if this record is the first one.
+// It panics if this RecordSet is not a singleton.
+func (rc *RecordCollection) Previous(order string) *RecordCollection {
+	return rc.adjacentRecord(order, true)
+}
+
+// adjacentRecord returns the record after this one in the given order, or the
+// record before if previous is true.
+//
+// It uses a keyset condition, i.e. (f1 > v1) OR (f1 = v1 AND f2 > v2) OR ...
+// where fi are the order fields and vi their values for this record.
+func (rc *RecordCollection) adjacentRecord(order string, previous bool) *RecordCollection {
+	rc.EnsureOne()
+	exprs := rc.model.defaultOrderStr
+	if strings.TrimSpace(order) != "" {
+		exprs = strings.Split(order, ",")
+		for i, expr := range exprs {
+			exprs[i] = strings.TrimSpace(expr)
+		}
+	}
+	orders := rc.model.ordersFromStrings(exprs)
+	var hasID bool
+	for _, o := range orders {
+		if o.field.Name() == ID.Name() {
+			hasID = true
+		}
+	}
+	if !hasID {
+		orders = append(orders, orderPredicate{field: ID})
+	}
+	keys := make([]keysetValue, len(orders))
+	orderExprs := make([]string, len(orders))
+	for i, o := range orders {
+		keys[i] = rc.keysetValue(o.field)
+		orderExprs[i] = o.field.Name()
+		if o.desc != previous {
+			orderExprs[i] += " desc"
+		}
+	}
+	var cond *Condition
+	for i, o := range orders {
+		keyCond := keys[i].afterCondition(rc.model, o.field, o.desc == previous)
+		if keyCond == nil {
+			// No value comes after this one in this direction
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			keyCond = keys[j].equalCondition(rc.model, orders[j].field).AndCond(keyCond)
+		}
+		if cond == nil {
+			cond = keyCond
+			continue
+		}
+		cond = cond.OrCond(keyCond)
+	}
+	if cond == nil {
+		return rc.env.Pool(rc.ModelName())
+	}
+	rSet := rc.env.Pool(rc.ModelName()).SearchAll()
+	if !rc.prefetchRC.IsEmpty() && !rc.prefetchRC.query.cond.IsEmpty() {
+		// Keep the condition of the RecordSet this record has been taken from
+		rSet = rc.env.Pool(rc.ModelName()).Search(rc.prefetchRC.query.cond)
+	}
+	return rSet.Search(cond).OrderBy(orderExprs...).Limit(1).Fetch()
+}
+
+// A keysetValue is the value of an order field for a record, used to
+// build keyset conditions.
+type keysetValue struct {
+	value interface{}
+	null  bool
+}
+
+// keysetValue returns the value of the given order field for this singleton.
+//
+// Since NULL values are read as the zero value of the field type, the database
+// is queried for zero values to know whether they are actually NULL.
+func (rc *RecordCollection) keysetValue(field FieldName) keysetValue {
+	value := rc.Get(field)
+	if rs, ok := value.(RecordSet); ok {
+		return keysetValue{value: value, null: rs.IsEmpty()}
+	}
+	if value != nil && !reflect.ValueOf(value).IsZero() {
+		return keysetValue{value: value}
+	}
+	nullCond := rc.model.Field(ID).Equals(rc.ids[0]).AndCond(rc.model.Field(field).Equals(sqlNull{}))
+	return keysetValue{
+		value: value,
+		null:  rc.env.Pool(rc.ModelName()).Search(nullCond).SearchCount() > 0,
+	}
+}
+
+// emptyArg returns true if the value of this keysetValue is searched as
+// NULL by conditions, although it is not NULL in the database.
+func (kv keysetValue) emptyArg() bool {
+	switch v := kv.value.(type) {
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	}
+	return false
+}
+
+// equalCondition returns the condition on the given order field for
+// records having this value.
+func (kv keysetValue) equalCondition(m *Model, field FieldName) *Condition {
+	switch {
+	case kv.null:
+		return m.Field(field).Equals(sqlNull{})
+	case kv.emptyArg():
+		return m.Field(field).Equals(kv.value).And().Field(field).NotEquals(sqlNull{})
+	}
+	return m.Field(field).Equals(kv.value)
+}
+
+// afterCondition returns the condition on the given order field for records
+// whose value comes after this value, i.e. is greater if greater is true,
+// and lower otherwise. NULL values are greater than all the other values, as
+// in an ascending ORDER BY. It returns nil if no value comes after this value.
+func (kv keysetValue) afterCondition(m *Model, field FieldName, greater bool) *Condition {
+	switch {
+	case kv.null && greater:
+		return nil
+	case kv.null:
+		return m.Field(field).NotEquals(sqlNull{})
+	case kv.emptyArg() && greater:
+		return m.Field(field).NotEquals(kv.value).Or().Field(field).Equals(sqlNull{})
+	case kv.emptyArg():
+		return nil
+	case greater:
+		return m.Field(field).Greater(kv.value).Or().Field(field).Equals(sqlNull{})
+	}
+	return m.Field(field).Lower(kv.value)
+}
+
+// RecursiveChildren returns all the descendants of the records of this RecordSet,
+// following the given parentField which must be a many2one field of the model
+// pointing to the model itself. Descendants are fetched with a single recursive
+// query, whatever the depth of the hierarchy. The records of this RecordSet are
+// not included in the result unless they are also descendants of one of them.
+//
+// Cycles in the hierarchy are supported: each record is visited only once.
+func (rc *RecordCollection) RecursiveChildren(parentField FieldName) *RecordCollection {
+	return rc.recursiveHierarchy(parentField, false)
+}
+
+// RecursiveParents returns all the ancestors of the records of this RecordSet,
+// following the given parentField. See RecursiveChildren for details.
+func (rc *RecordCollection) RecursiveParents(parentField FieldName) *RecordCollection {
+	return rc.recursiveHierarchy(parentField, true)
+}
+
+// recursiveHierarchy returns the descendants of the records of rc through
+// parentField, or their ancestors if parents is true.
+func (rc *RecordCollection) recursiveHierarchy(parentField FieldName, parents bool) *RecordCollection {
+	fi := rc.model.fields.MustGet(parentField.JSON())
+	if fi.fieldType != fieldtype.Many2One || fi.relatedModel != rc.model {
+		log.Panic("Hierarchy field must be a many2one field of the model pointing to itself", "model", rc.model.name, "field", parentField)
+	}
+	res := rc.env.Pool(rc.ModelName())
+	if rc.IsEmpty() {
+		return res
+	}
+	rc.flushIfPending([]FieldName{parentField})
+	adapter := adapters[db.DriverName()]
+	query := adapter.descendantIdsQuery(rc.model.tableName, fi.json)
+	if parents {
+		query = adapter.ancestorIdsQuery(rc.model.tableName, fi.json)
+	}
+	var ids []int64
+	rc.env.cr.Select(&ids, query, rc.Ids())
+	if len(ids) == 0 {
+		return res
+	}
+	return res.Search(rc.model.Field(ID).In(ids))
+}
+
 // SearchCount fetch from the database the number of records that match the RecordSet conditions
 // It panics in case of error
 func (rc *RecordCollection) SearchCount() int {
+	rc.flushIfPending(rc.query.getAllExpressions()...)
 	rSet := rc.Limit(0)
 	rSet.applyDefaultOrder()
 	rSet.applyContexts()
@@ -767,7 +1296,7 @@ func (rc *RecordCollection) SearchCount() int {
 	rSet = rSet.substituteRelatedInQuery()
 	query, args := rSet.query.countQuery()
 	var res int
-	rSet.env.cr.Get(&res, query, args...)
+	rSet.env.cr.readGet(rSet.env.readOnly, &res, query, args...)
 	return res
 }
 
@@ -806,6 +1335,7 @@ func (rc *RecordCollection) ForceLoad(fieldNames ...FieldName) *RecordCollection
 	if len(rc.query.groups) > 0 {
 		log.Panic("Trying to load a grouped query", "model", rc.model, "groups", rc.query.groups)
 	}
+	rc.flushIfPending(rc.query.getAllExpressions()...)
 	rSet := rc
 	var prefetch bool
 	if !rc.prefetchRC.IsEmpty() && len(rc.ids) > 0 {
@@ -813,21 +1343,16 @@ func (rc *RecordCollection) ForceLoad(fieldNames ...FieldName) *RecordCollection
 		prefetch = true
 		rSet = rc.Union(rc.prefetchRC).WithEnv(rc.Env())
 	}
-	rSet = rSet.addRecordRuleConditions(rc.env.uid, security.Read)
-	rSet.applyDefaultOrder()
-
 	fields := make([]FieldName, len(fieldNames))
 	copy(fields, fieldNames)
 	if len(fields) == 0 {
 		fields = rSet.model.fields.storedFieldNames()
 	}
-	addNameSearchesToCondition(rSet.model, rSet.query.cond)
-	rSet.applyContexts()
-	subFields, _ := rSet.substituteRelatedFields(fields)
-	rSet = rSet.substituteRelatedInQuery()
+	fields = append(fields, rc.withFields...)
+	rSet, subFields := rSet.prepareLoadQuery(fields)
 	dbFields := filterOnDBFields(rSet.model, subFields)
 	query, args, substs := rSet.query.selectQuery(dbFields)
-	rows := dbQuery(rSet.env.cr.tx, query, args...)
+	rows := rSet.env.cr.readQuery(rSet.env.readOnly, query, args...)
 	defer rows.Close()
 	var ids []int64
 	for rows.Next() {
@@ -842,6 +1367,7 @@ func (rc *RecordCollection) ForceLoad(fieldNames ...FieldName) *RecordCollection
 
 	rSet = rSet.withIds(ids)
 	rSet.loadRelationFields(subFields)
+	rSet.checkVersionedFields(subFields)
 	if prefetch {
 		*rc = *rSet.Intersect(rc).WithEnv(rc.Env())
 		return rc
@@ -849,6 +1375,78 @@ func (rc *RecordCollection) ForceLoad(fieldNames ...FieldName) *RecordCollection
 	return rSet
 }
 
+// prepareLoadQuery applies record rules, default order and contexts to
+// the query of rc so that it can load the given fields. It returns the
+// resulting RecordCollection and the fields with related fields substituted.
+func (rc *RecordCollection) prepareLoadQuery(fields []FieldName) (*RecordCollection, []FieldName) {
+	rSet := rc.addRecordRuleConditions(rc.env.uid, security.Read)
+	rSet.applyDefaultOrder()
+	addNameSearchesToCondition(rSet.model, rSet.query.cond)
+	rSet.applyContexts()
+	subFields, _ := rSet.substituteRelatedFields(fields)
+	rSet = rSet.substituteRelatedInQuery()
+	return rSet, subFields
+}
+
+// Explain returns the execution plan of the query that loads the records
+// of this RecordCollection filtered by cond, including joins and record
+// rules. The query is actually run to gather execution statistics.
+//
+// Explain is a debugging tool and panics if the debug mode has not been
+// enabled with SetDebugMode.
+func (rc *RecordCollection) Explain(cond *Condition) string {
+	if !debugMode {
+		log.Panic("Explain is only available in Debug mode", "model", rc.model)
+	}
+	rc.CheckExecutionPermission(rc.model.methods.MustGet("Load"))
+	rSet := rc.Search(cond)
+	fields := append(rSet.model.fields.storedFieldNames(), rc.withFields...)
+	rSet, subFields := rSet.prepareLoadQuery(fields)
+	query, args, _ := rSet.query.selectQuery(filterOnDBFields(rSet.model, subFields))
+	adapter := adapters[db.DriverName()]
+	rows := rSet.env.cr.readQuery(false, adapter.explainQuery(query), args...)
+	defer rows.Close()
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			log.Panic(err.Error(), "model", rSet.ModelName(), "query", query)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// With returns a new RecordCollection that will load the given fields
+// of the records pointed at by relationField in the same query as its
+// own fields, using a single JOIN.
+//
+// relationField must be a many2one or one2one field of this model and
+// fields must be stored fields of the related model.
+func (rc *RecordCollection) With(relationField FieldName, fields ...FieldName) *RecordCollection {
+	fi := rc.model.fields.MustGet(relationField.JSON())
+	if !fi.fieldType.IsFKRelationType() {
+		log.Panic("With can only be used with many2one and one2one fields", "model", rc.model, "field", relationField)
+	}
+	withFields := make([]FieldName, len(rc.withFields), len(rc.withFields)+len(fields)+1)
+	copy(withFields, rc.withFields)
+	relField := fieldName{name: fi.name, json: fi.json}
+	withFields = append(withFields, relField)
+	for _, f := range fields {
+		rfi, ok := fi.relatedModel.fields.Get(f.JSON())
+		if !ok {
+			log.Panic("Unknown field in related model", "model", fi.relatedModel, "field", f)
+		}
+		if !rfi.isStored() {
+			log.Panic("With can only load stored fields", "model", fi.relatedModel, "field", f)
+		}
+		withFields = append(withFields, joinFieldNames([]FieldName{relField, fieldName{name: rfi.name, json: rfi.json}}, ExprSep))
+	}
+	rSet := rc.clone()
+	rSet.withFields = withFields
+	return rSet
+}
+
 // applyDefaultOrder adds the model's default order if this query has no specific order defined
 func (rc *RecordCollection) applyDefaultOrder() {
 	if len(rc.query.orders) == 0 {
@@ -894,7 +1492,7 @@ func (rc *RecordCollection) loadRelationFields(fields FieldNames) {
 				if thisRC.IsEmpty() {
 					continue
 				}
-				rc.env.cr.Select(&ids, query, thisRC.ids[0])
+				rc.env.cr.readSelect(rc.env.readOnly, &ids, query, thisRC.ids[0])
 				rc.env.cache.updateEntry(rc.model, id, fName.JSON(), ids, rc.query.ctxArgsSlug())
 			case fieldtype.Rev2One:
 				relRC := rc.env.Pool(fi.relatedModelName)
@@ -919,16 +1517,32 @@ func (rc *RecordCollection) Get(fieldName FieldName) interface{} {
 		if fi.isRelationField() {
 			res = rc.convertToRecordSet(res, fi.relatedModelName)
 		}
+		if fi.fieldType == fieldtype.Reference {
+			res = nil
+		}
 		return res
 	}
 	rc.CheckExecutionPermission(rc.model.methods.MustGet("Load"))
+	if !rc.env.readOnly {
+		// Read only environments get pending values computed in memory below
+		rc.flushIfPending(splitFieldNames(fieldName, ExprSep))
+	}
 	rc.Fetch()
 	var res interface{}
 
 	exprs := splitFieldNames(fieldName, ExprSep)
+	var (
+		pendingValue interface{}
+		pending      bool
+	)
+	if rc.env.readOnly {
+		pendingValue, pending = rc.pendingComputedValue(fieldName)
+	}
 	switch {
 	case rc.IsEmpty():
 		res = reflect.Zero(fi.structField.Type).Interface()
+	case pending:
+		res = pendingValue
 	case fi.isComputedField() && !fi.isStored():
 		prefix := joinFieldNames(exprs[:len(exprs)-1], ExprSep)
 		relRC := rc
@@ -938,6 +1552,9 @@ func (rc *RecordCollection) Get(fieldName FieldName) interface{} {
 		fMap := make(FieldMap)
 		relRC.computeFieldValues(&fMap, fi.json)
 		res = fMap[fi.json]
+		if fi.timeDependent {
+			rc.env.cache.timeDependentReads++
+		}
 	case fi.isRelatedField():
 		res = rc.Get(rc.substituteRelatedInPath(fieldName))
 	default:
@@ -953,6 +1570,10 @@ func (rc *RecordCollection) Get(fieldName FieldName) interface{} {
 		// except for the case of non stored relation fields, where we only load the requested field.
 		all := !fi.fieldType.IsNonStoredRelationType()
 		res, _ = rc.get(fieldName, all)
+		if fi.lazyCompute && !rc.hasNegIds && !rc.lazyFieldComputed(fi, exprs) {
+			// Lazily computed field that has not been computed yet or has been cleared
+			res = rc.computeLazyField(fieldName)
+		}
 	}
 
 	if res == nil || res == (*interface{})(nil) {
@@ -963,10 +1584,135 @@ func (rc *RecordCollection) Get(fieldName FieldName) interface{} {
 
 	if fi.isRelationField() {
 		res = rc.convertToRecordSet(res, fi.relatedModelName)
+		if fi.noFK {
+			res = res.(*RecordCollection).existingRecords()
+		}
+	}
+	if fi.fieldType == fieldtype.Reference {
+		res = rc.resolveReference(res)
+	}
+	return res
+}
+
+// existingRecords returns a RecordCollection with the records of this
+// RecordCollection that exist in the database. It is used to read many2one
+// fields declared with NoFK, which may reference deleted records.
+func (rc *RecordCollection) existingRecords() *RecordCollection {
+	if rc.IsEmpty() || rc.hasNegIds {
+		return rc
+	}
+	query := fmt.Sprintf(`SELECT id FROM %s WHERE id IN (?)`, adapters[db.DriverName()].quoteTableName(rc.model.tableName))
+	var ids []int64
+	rc.env.cr.readSelect(rc.env.readOnly, &ids, query, rc.ids)
+	if len(ids) == len(rc.ids) {
+		return rc
+	}
+	return rc.withIds(ids)
+}
+
+// Mapped returns the values of field for all the records linked to this RecordCollection
+// through the given one2many or many2many relation field.
+//
+// If field is a relation field, the result is a single RecordCollection of all the related
+// records, without duplicates. Otherwise, the result is a slice of the field's type with
+// the value of each linked record. Linked records are loaded with a single query.
+func (rc *RecordCollection) Mapped(relation, field FieldName) interface{} {
+	rfi := rc.model.fields.MustGet(relation.Name())
+	if !rfi.fieldType.Is2ManyRelationType() {
+		log.Panic("Mapped can only be used on one2many or many2many fields", "model", rc.ModelName(), "relation", relation)
+	}
+	fi := rfi.relatedModel.getRelatedFieldInfo(field)
+	if fi.fieldType == fieldtype.Reference {
+		log.Panic("Mapped cannot be used on reference fields", "model", rfi.relatedModelName, "field", field)
+	}
+	children := rc.mappedRecords(rfi)
+	if !children.hasNegIds {
+		children.Load(field)
+	}
+	if fi.isRelationField() {
+		var ids []int64
+		for _, child := range children.Records() {
+			ids = append(ids, child.Get(field).(RecordSet).Ids()...)
+		}
+		return newRecordCollection(rc.Env(), fi.relatedModelName).withIds(ids)
+	}
+	res := reflect.MakeSlice(reflect.SliceOf(fi.structField.Type), 0, children.Len())
+	for _, child := range children.Records() {
+		res = reflect.Append(res, reflect.ValueOf(child.Get(field)))
+	}
+	return res.Interface()
+}
+
+// A FieldTransform converts the value of a field of a record
+// to the value of a field of another model in MapTo.
+type FieldTransform func(value interface{}) interface{}
+
+// MapTo returns a new ModelData of the target model populated with the values of
+// this record. mapping gives for each field of this model (which can be a path such as
+// "Partner.Name") the name of the field of the target model to set.
+//
+// If transforms has an entry for a field of this model, the value is converted by
+// this function before being set. Otherwise values are copied as is, so that relation
+// fields of the target model reference the same records as this record.
+//
+// MapTo panics if this RecordCollection is not a singleton, if a target field does not
+// exist, or if a relation value does not point to the related model of its target field.
+func (rc *RecordCollection) MapTo(target Modeler, mapping map[string]string, transforms map[string]FieldTransform) *ModelData {
+	rc.EnsureOne()
+	tm := target.Underlying()
+	res := NewModelData(tm)
+	for source, dest := range mapping {
+		fi := tm.fields.MustGet(dest)
+		value := rc.Get(rc.model.FieldName(source))
+		if transform, ok := transforms[source]; ok {
+			value = transform(value)
+		}
+		if rs, ok := value.(RecordSet); ok && fi.isRelationField() && rs.ModelName() != fi.relatedModelName {
+			log.Panic("Mapped value does not point to the related model of the target field", "model", rc.ModelName(),
+				"field", source, "target", tm.name, "targetField", dest, "valueModel", rs.ModelName())
+		}
+		res.Set(tm.FieldName(fi.name), value)
 	}
 	return res
 }
 
+// mappedRecords returns all the records linked to this RecordCollection
+// through the given one2many or many2many field.
+func (rc *RecordCollection) mappedRecords(rfi *Field) *RecordCollection {
+	relRC := rc.env.Pool(rfi.relatedModelName)
+	switch {
+	case rc.IsEmpty():
+		return relRC
+	case rc.hasNegIds:
+		for _, rec := range rc.Records() {
+			relRC = relRC.Union(rec.Get(rc.model.FieldName(rfi.name)).(RecordSet))
+		}
+		return relRC
+	case rfi.fieldType == fieldtype.One2Many:
+		return relRC.Search(relRC.Model().Field(relRC.Model().FieldName(rfi.reverseFK)).In(rc.ids))
+	default:
+		query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s IN (?)`, rfi.m2mTheirField.json,
+			rfi.m2mRelModel.tableName, rfi.m2mOurField.json)
+		var ids []int64
+		rc.env.cr.readSelect(rc.env.readOnly, &ids, query, rc.ids)
+		if len(ids) == 0 {
+			return relRC
+		}
+		return relRC.Search(relRC.Model().Field(ID).In(ids))
+	}
+}
+
+// resolveReference returns the record pointed at by the given value
+// of a reference field, or nil if val is empty.
+func (rc *RecordCollection) resolveReference(val interface{}) interface{} {
+	ref, _ := val.(string)
+	if ref == "" || rc.env == nil {
+		return nil
+	}
+	rRef := parseReference(ref)
+	return rc.env.Pool(rRef.ModelName).withIds([]int64{rRef.ID})
+}
+
 // ConvertToRecordSet the given val which can be of type *interface{}(nil) int64, []int64
 // for the given related model name
 func (rc *RecordCollection) convertToRecordSet(val interface{}, relatedModelName string) *RecordCollection {
@@ -1012,6 +1758,221 @@ func (rc *RecordCollection) Set(fieldName FieldName, value interface{}) {
 	rc.Call("Write", md)
 }
 
+// CompareAndSet sets the given field to value only if its current value in the
+// database equals expected. The comparison and the update are made in a single
+// UPDATE query so that no other transaction can modify the value in between.
+// It returns true if the record has been updated.
+//
+// Unlike Set, CompareAndSet does not call the Write method, but required fields
+// are checked and the AfterWrite hooks of the model are called. It panics if rc
+// is not a singleton or if fieldName is not a stored field of this model that is
+// neither computed, related nor contexted.
+func (rc *RecordCollection) CompareAndSet(fieldName FieldName, expected, value interface{}) bool {
+	rc.EnsureOne()
+	rc.CheckExecutionPermission(rc.model.methods.MustGet("Write"))
+	fi := rc.model.fields.MustGet(fieldName.Name())
+	if !fi.isStored() || fi.isComputedField() || fi.isRelatedField() || fi.isContextedField() {
+		log.Panic("CompareAndSet can only be used on stored fields that are neither computed, related nor contexted", "model", rc.ModelName(), "field", fieldName)
+	}
+	rc.checkNoWriteFields(FieldNames{fieldName})
+	if rc.hasNegIds {
+		log.Panic("CompareAndSet cannot be used on records that are not saved in the database", "model", rc.ModelName(), "ids", rc.ids)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			panic(rc.substituteSQLErrorMessage(r))
+		}
+	}()
+	rec := rc.Records()[0]
+	rSet := rec.Search(rc.model.Field(fieldName).Equals(expected))
+	rSet = rSet.addRecordRuleConditions(rc.env.uid, security.Write)
+	fMap := FieldMap{fi.json: value}
+	rSet.addAccessFieldsUpdateData(&fMap)
+	rSet.model.convertValuesToFieldType(&fMap, true)
+	fMap = rSet.filterMapOnStoredFields(fMap)
+	rec.checkRequiredFields(fMap, false)
+	changesetFields := rec.changesetFields(fMap)
+	oldValues := rec.readChangesetValues(changesetFields)
+	query, args := rSet.query.updateQuery(fMap)
+	res := rc.env.cr.Execute(query, args...)
+	if num, _ := res.RowsAffected(); num == 0 {
+		// The value in the cache is probably outdated
+		rc.env.cache.invalidateRecord(rc.model, rec.ids[0])
+		return false
+	}
+	for k, v := range fMap {
+		rc.env.cache.updateEntry(rc.model, rec.ids[0], k, v, rc.query.ctxArgsSlug())
+	}
+	rec.processTriggers(FieldNames{fieldName})
+	rec.CheckConstraints(FieldNames{fieldName})
+	rec.callAfterWriteHooks(changesetFields, oldValues)
+	return true
+}
+
+// Toggle inverts the value of the given boolean field in all the records of this
+// RecordCollection. The new values are computed by the database in a single UPDATE
+// query, without reading the current values first. Unset values are considered false.
+//
+// Toggle calls the Write method, in which the value of the field is an opaque
+// transform value. It panics if fieldName is not a stored boolean field of this
+// model that is neither computed, related nor contexted.
+func (rc *RecordCollection) Toggle(fieldName FieldName) *RecordCollection {
+	fi := rc.model.fields.MustGet(fieldName.Name())
+	if fi.fieldType != fieldtype.Boolean || !fi.isStored() || fi.isComputedField() || fi.isRelatedField() || fi.isContextedField() {
+		log.Panic("Toggle can only be used on stored boolean fields that are neither computed, related nor contexted", "model", rc.ModelName(), "field", fieldName)
+	}
+	if rc.IsEmpty() {
+		return rc
+	}
+	if rc.hasNegIds {
+		log.Panic("Toggle cannot be used on records that are not saved in the database", "model", rc.ModelName(), "ids", rc.ids)
+	}
+	rc.Call("Write", NewModelData(rc.model).Set(fieldName, fieldSQLFunction{sqlFunc: "NOT COALESCE(%s, FALSE)"}))
+	return rc
+}
+
+// A fieldIncrement is a value of a FieldMap that adds delta to
+// the current value of the field in the database.
+type fieldIncrement struct {
+	delta interface{}
+}
+
+// Increment adds delta to the value of the given numeric field in all the records
+// of this RecordCollection. The new values are computed by the database in a single
+// UPDATE query so that concurrent increments are never lost. Use a negative delta
+// to decrement.
+//
+// Increment calls the Write method, in which the value of the field is an opaque
+// increment value. It panics if fieldName is not a stored integer or float field
+// of this model that is neither computed, related nor contexted.
+func (rc *RecordCollection) Increment(fieldName FieldName, delta interface{}) *RecordCollection {
+	fi := rc.model.fields.MustGet(fieldName.Name())
+	if (fi.fieldType != fieldtype.Integer && fi.fieldType != fieldtype.Float) || !fi.isStored() ||
+		fi.isComputedField() || fi.isRelatedField() || fi.isContextedField() {
+		log.Panic("Increment can only be used on stored numeric fields that are neither computed, related nor contexted", "model", rc.ModelName(), "field", fieldName)
+	}
+	if rc.IsEmpty() {
+		return rc
+	}
+	if rc.hasNegIds {
+		log.Panic("Increment cannot be used on records that are not saved in the database", "model", rc.ModelName(), "ids", rc.ids)
+	}
+	md := NewModelData(rc.model).Set(fieldName, fieldIncrement{delta: delta})
+	rc.Call("Write", md)
+	return rc
+}
+
+// A fieldSQLFunction is a value of a FieldMap that sets the field to the result
+// of the given SQL function applied to its current value in the database.
+// sqlFunc is a format string with a single %s verb for the column name.
+type fieldSQLFunction struct {
+	sqlFunc string
+}
+
+// sqlUnicodeSpaces is an SQL string literal of all the characters that are
+// spaces according to unicode.IsSpace, so that trimming them in the database
+// gives the same result as strings.TrimSpace.
+const sqlUnicodeSpaces = `E'\u0009\u000A\u000B\u000C\u000D\u0020\u0085\u00A0\u1680` +
+	`\u2000\u2001\u2002\u2003\u2004\u2005\u2006\u2007\u2008\u2009\u200A` +
+	`\u2028\u2029\u202F\u205F\u3000'`
+
+// sqlStringTransforms maps the Go functions that can be executed by the
+// database in Transform to their SQL equivalent. UPPER and LOWER only match
+// strings.ToUpper and strings.ToLower for all letters if the LC_CTYPE of the
+// database is a UTF-8 locale.
+var sqlStringTransforms = map[uintptr]string{
+	reflect.ValueOf(strings.TrimSpace).Pointer(): "BTRIM(%s, " + sqlUnicodeSpaces + ")",
+	reflect.ValueOf(strings.ToUpper).Pointer():   "UPPER(%s)",
+	reflect.ValueOf(strings.ToLower).Pointer():   "LOWER(%s)",
+}
+
+// transformBatchSize is the number of records loaded at once by Transform
+const transformBatchSize = 1000
+
+// A transformGroup holds the ids of the records that get the same new value
+// in Transform.
+type transformGroup struct {
+	value interface{}
+	ids   []int64
+}
+
+// addToTransformGroups adds the record with the given id to the group of the given
+// value in groups, creating it if needed, and returns the updated groups.
+//
+// Values are compared with reflect.DeepEqual so that values of non-comparable
+// types such as slices can be grouped.
+func addToTransformGroups(groups []transformGroup, value interface{}, id int64) []transformGroup {
+	for i, group := range groups {
+		if reflect.DeepEqual(group.value, value) {
+			groups[i].ids = append(groups[i].ids, id)
+			return groups
+		}
+	}
+	return append(groups, transformGroup{value: value, ids: []int64{id}})
+}
+
+// Transform sets the given field of all the records of this RecordCollection to
+// the result of fn applied to its current value. fn must be a function taking and
+// returning a value of the Go type of the field.
+//
+// If fn is strings.TrimSpace, strings.ToUpper or strings.ToLower, the new values are
+// computed by the database in a single UPDATE query. Otherwise, records are loaded by
+// batches and Write is called once for each distinct new value of each batch.
+//
+// The SQL UPPER and LOWER functions depend on the LC_CTYPE of the database and may
+// leave non ASCII letters unchanged, e.g. with the C locale, whereas strings.ToUpper
+// and strings.ToLower apply the Unicode rules. Pass a closure such as
+// func(s string) string { return strings.ToUpper(s) } to convert in Go instead.
+//
+// Transform panics if fieldName is not a stored field of this model that is neither
+// computed, related, contexted, a relation nor an encrypted field.
+func (rc *RecordCollection) Transform(fieldName FieldName, fn interface{}) {
+	fi := rc.model.fields.MustGet(fieldName.Name())
+	if !fi.isStored() || fi.isComputedField() || fi.isRelatedField() || fi.isContextedField() || fi.isRelationField() ||
+		fi.fieldType == fieldtype.Encrypted {
+		log.Panic("Transform can only be used on stored fields that are neither computed, related, contexted, relations nor encrypted", "model", rc.ModelName(), "field", fieldName)
+	}
+	fnVal := reflect.ValueOf(fn)
+	fType := fi.structField.Type
+	if fnVal.Kind() != reflect.Func || fnVal.Type().NumIn() != 1 || fnVal.Type().NumOut() != 1 ||
+		fnVal.Type().In(0) != fType || fnVal.Type().Out(0) != fType {
+		log.Panic("Transform function must take and return a value of the field type", "model", rc.ModelName(), "field", fieldName, "type", fType)
+	}
+	if rc.IsEmpty() {
+		return
+	}
+	if rc.hasNegIds {
+		log.Panic("Transform cannot be used on records that are not saved in the database", "model", rc.ModelName(), "ids", rc.ids)
+	}
+	if sqlFunc, ok := sqlStringTransforms[fnVal.Pointer()]; ok && fType.Kind() == reflect.String {
+		rc.Call("Write", NewModelData(rc.model).Set(fieldName, fieldSQLFunction{sqlFunc: sqlFunc}))
+		return
+	}
+	ids := rc.Ids()
+	for start := 0; start < len(ids); start += transformBatchSize {
+		end := start + transformBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch := rc.env.Pool(rc.model.name).withIds(ids[start:end]).Load(fieldName)
+		var groups []transformGroup
+		for _, rec := range batch.Records() {
+			oldVal := reflect.Zero(fType)
+			if val := rec.Get(fieldName); val != nil {
+				oldVal = reflect.ValueOf(val)
+			}
+			newVal := fnVal.Call([]reflect.Value{oldVal})[0].Interface()
+			if reflect.DeepEqual(oldVal.Interface(), newVal) {
+				continue
+			}
+			groups = addToTransformGroups(groups, newVal, rec.ids[0])
+		}
+		for _, group := range groups {
+			rc.env.Pool(rc.model.name).withIds(group.ids).Call("Write", NewModelData(rc.model).Set(fieldName, group.value))
+		}
+	}
+}
+
 // InvalidateCache clears the cache for this RecordSet data, and immediately reloads the data from the DB.
 func (rc *RecordCollection) InvalidateCache() {
 	for _, rec := range rc.Records() {
@@ -1020,6 +1981,36 @@ func (rc *RecordCollection) InvalidateCache() {
 	rc.Load()
 }
 
+// GetForUpdate re-reads the records of this RecordCollection from the database
+// and locks their rows until the end of the transaction, so that they can be
+// safely read, modified and written back. Concurrent transactions calling
+// GetForUpdate on the same records block until this transaction ends.
+//
+// The cache of the records is refreshed and records that have been deleted
+// in the meantime are not included in the returned RecordCollection.
+//
+// It panics if the Environment has no transaction.
+func (rc *RecordCollection) GetForUpdate() *RecordCollection {
+	if rc.env.cr == nil || rc.env.cr.tx == nil {
+		log.Panic("GetForUpdate must be called inside a transaction", "model", rc.model.name)
+	}
+	if rc.IsEmpty() {
+		return rc
+	}
+	if rc.hasNegIds {
+		log.Panic("Unable to lock records that are not yet in the database", "model", rc.model.name, "ids", rc.ids)
+	}
+	query := fmt.Sprintf(`SELECT id FROM %s WHERE id IN (?) ORDER BY id FOR UPDATE`, adapters[db.DriverName()].quoteTableName(rc.model.tableName))
+	var ids []int64
+	// Rows are locked on the main database, so that following reads must not go to the replica
+	rc.env.cr.written = true
+	rc.env.cr.Select(&ids, query, rc.ids)
+	for _, id := range rc.ids {
+		rc.env.cache.invalidateRecord(rc.model, id)
+	}
+	return rc.withIds(ids).ForceLoad()
+}
+
 // First returns the values of the first Record of the RecordCollection as a ModelData.
 //
 // If this RecordCollection is empty, it returns an empty ModelData.
@@ -1048,6 +2039,196 @@ func (rc *RecordCollection) All() []*ModelData {
 	return res
 }
 
+// RawValue returns the value of the given stored computed field as it is persisted
+// in the database for this record, bypassing the cache and without triggering any
+// recomputation, even if one is pending. The value is nil if the column is NULL.
+//
+// This is a diagnostic tool. Use Get to read a field's actual value.
+// RawValue panics if rc is not a singleton.
+func (rc *RecordCollection) RawValue(field FieldName) interface{} {
+	rc.EnsureOne()
+	fi := rc.model.getRelatedFieldInfo(field)
+	if fi.model != rc.model || !fi.isComputedField() || !fi.isStored() {
+		log.Panic("RawValue can only be used on stored computed fields", "model", rc.model.name, "field", field)
+	}
+	rSet := newRecordCollection(rc.Env(), rc.model.name).withIds(rc.Ids())
+	rSet, _ = rSet.prepareLoadQuery([]FieldName{fi.model.FieldName(fi.name)})
+	query, args, substs := rSet.query.selectQuery([]FieldName{ID, fi.model.FieldName(fi.name)})
+	rows := rSet.env.cr.readQuery(rSet.env.readOnly, query, args...)
+	defer rows.Close()
+	line := make(FieldMap)
+	if rows.Next() {
+		if err := rSet.model.scanToFieldMap(rows, &line, substs); err != nil {
+			log.Panic(err.Error(), "model", rc.model.name, "field", field)
+		}
+	}
+	return line[fi.json]
+}
+
+// Iterate returns an iterator over the values of the records of this RecordCollection's
+// model matching cond. Each call of the returned function gives the values of the next
+// record and true, or nil and false when all records have been returned.
+//
+// Records are fetched by batches of batchSize records in ID order. Each batch is read
+// in a copy of this Environment with its own cache, so that memory usage stays bounded
+// whatever the number of matching records.
+func (rc *RecordCollection) Iterate(cond Conditioner, batchSize int) func() (*ModelData, bool) {
+	if batchSize <= 0 {
+		log.Panic("Iterate batch size must be positive", "model", rc.model.name, "batchSize", batchSize)
+	}
+	if !rc.env.readOnly {
+		rc.env.Flush()
+	}
+	var (
+		lastID int64
+		batch  []*ModelData
+		done   bool
+	)
+	return func() (*ModelData, bool) {
+		if len(batch) == 0 && !done {
+			batchEnv := *rc.env
+			batchEnv.cache = newCache()
+			c := rc.model.Field(ID).Greater(lastID)
+			if !cond.Underlying().IsEmpty() {
+				c = c.AndCond(cond.Underlying())
+			}
+			batch = batchEnv.Pool(rc.model.name).Search(c).OrderBy("ID").Limit(batchSize).All()
+			if len(batch) < batchSize {
+				done = true
+			}
+			if len(batch) > 0 {
+				lastID = batch[len(batch)-1].Get(ID).(int64)
+			}
+		}
+		if len(batch) == 0 {
+			return nil, false
+		}
+		res := batch[0]
+		batch = batch[1:]
+		return res, true
+	}
+}
+
+// RelationNames returns the display name of the record referenced by the given
+// many2one field for each record of this RecordCollection, mapped by record ID.
+// Records with an empty field are omitted.
+//
+// The field and the Name field of the referenced records are loaded in a single
+// joined query, so that the number of queries does not depend on the size of
+// this RecordCollection, as long as NameGet only uses the Name field.
+func (rc *RecordCollection) RelationNames(field FieldName) map[int64]string {
+	fi := rc.model.getRelatedFieldInfo(field)
+	if fi.fieldType != fieldtype.Many2One {
+		log.Panic("RelationNames can only be used on many2one fields", "model", rc.model.name, "field", field)
+	}
+	res := make(map[int64]string, len(rc.ids))
+	if rc.IsEmpty() {
+		return res
+	}
+	if !rc.hasNegIds {
+		fields := []FieldName{field}
+		if nameFI, ok := fi.relatedModel.fields.Get("Name"); ok && nameFI.isStored() {
+			fields = append(fields, joinFieldNames([]FieldName{field, fi.relatedModel.FieldName("Name")}, ExprSep))
+		}
+		rc.Load(fields...)
+	}
+	for _, rec := range rc.Records() {
+		target := rec.Get(field).(RecordSet).Collection()
+		if target.IsEmpty() {
+			continue
+		}
+		res[rec.ids[0]] = target.Call("NameGet").(string)
+	}
+	return res
+}
+
+// DistinctValues returns the distinct values of the given field among the records
+// of this RecordCollection, in ascending order. Null values are omitted and record
+// rules apply as for a search.
+//
+// The field must be stored or related and cannot be a one2many or many2many field.
+func (rc *RecordCollection) DistinctValues(field FieldName) []interface{} {
+	fi := rc.model.getRelatedFieldInfo(field)
+	if (!fi.isStored() && !fi.isRelatedField()) || fi.fieldType.IsNonStoredRelationType() || fi.fieldType == fieldtype.Encrypted {
+		log.Panic("DistinctValues can only be used on stored fields that are not encrypted", "model", rc.model.name, "field", field)
+	}
+	if rc.query.isEmpty() {
+		return nil
+	}
+	rc.flushIfPending(append(rc.query.getAllExpressions(), splitFieldNames(field, ExprSep))...)
+	rSet, subFields := rc.prepareLoadQuery([]FieldName{field})
+	query, args, substs := rSet.query.distinctQuery(subFields[0])
+	rows := rSet.env.cr.readQuery(rSet.env.readOnly, query, args...)
+	defer rows.Close()
+	var res []interface{}
+	for rows.Next() {
+		line := make(FieldMap)
+		if err := rSet.model.scanToFieldMap(rows, &line, substs); err != nil {
+			log.Panic(err.Error(), "model", rc.model.name, "field", field)
+		}
+		res = append(res, line[subFields[0].JSON()])
+	}
+	return res
+}
+
+// Totals returns the sums of the given numeric fields over the records of this
+// RecordCollection, by field name, computed in a single query. Record rules
+// apply and NULL values are taken as 0. All the totals are 0 if this
+// RecordCollection is empty.
+//
+// Totals panics if a field is not a stored integer or float field.
+func (rc *RecordCollection) Totals(fields ...FieldName) map[string]float64 {
+	for _, field := range fields {
+		fi := rc.model.getRelatedFieldInfo(field)
+		if (!fi.isStored() && !fi.isRelatedField()) || (fi.fieldType != fieldtype.Integer && fi.fieldType != fieldtype.Float) {
+			log.Panic("Totals can only be computed on stored integer and float fields", "model", rc.model.name, "field", field)
+		}
+	}
+	res := make(map[string]float64, len(fields))
+	for _, field := range fields {
+		res[field.Name()] = 0
+	}
+	if len(fields) == 0 || rc.query.isEmpty() {
+		return res
+	}
+	var exprs [][]FieldName
+	for _, field := range fields {
+		exprs = append(exprs, splitFieldNames(field, ExprSep))
+	}
+	rc.flushIfPending(append(rc.query.getAllExpressions(), exprs...)...)
+	rSet, subFields := rc.prepareLoadQuery(fields)
+	query, args := rSet.query.totalsQuery(subFields)
+	totals := make([]float64, len(fields))
+	dests := make([]interface{}, len(fields))
+	for i := range totals {
+		dests[i] = &totals[i]
+	}
+	rows := rSet.env.cr.readQuery(rSet.env.readOnly, query, args...)
+	defer rows.Close()
+	if rows.Next() {
+		if err := rows.Scan(dests...); err != nil {
+			log.Panic(err.Error(), "model", rc.model.name, "fields", fields)
+		}
+	}
+	for i, field := range fields {
+		res[field.Name()] = totals[i]
+	}
+	return res
+}
+
+// TotalsData returns a ModelData with the sums of the given numeric fields over
+// the records of this RecordCollection, as returned by Totals, converted to the
+// Go type of each field. This is typically used for the footer of a list.
+func (rc *RecordCollection) TotalsData(fields ...FieldName) *ModelData {
+	totals := rc.Totals(fields...)
+	fMap := make(FieldMap)
+	for _, field := range fields {
+		fi := rc.model.getRelatedFieldInfo(field)
+		fMap[field.JSON()] = reflect.ValueOf(totals[field.Name()]).Convert(fi.structField.Type).Interface()
+	}
+	return NewModelDataFromRS(rc, fMap)
+}
+
 // Aggregates returns the result of this RecordCollection query, which must by a grouped query.
 func (rc *RecordCollection) Aggregates(fieldNames ...FieldName) []GroupAggregateRow {
 	if len(rc.query.groups) == 0 {
@@ -1067,7 +2248,7 @@ func (rc *RecordCollection) Aggregates(fieldNames ...FieldName) []GroupAggregate
 
 	query, args := rSet.query.selectGroupQuery(rSet.fieldsGroupOperators(dbFields))
 	var res []GroupAggregateRow
-	rows := dbQuery(rSet.env.cr.tx, query, args...)
+	rows := rSet.env.cr.readQuery(rSet.env.readOnly, query, args...)
 	defer rows.Close()
 
 	for rows.Next() {
@@ -1158,6 +2339,31 @@ func (rc *RecordCollection) Condition() *Condition {
 	return rc.query.cond
 }
 
+// IdsCondition returns a condition matching the records of this RecordCollection
+// by their ids. The returned condition matches no records if this RecordCollection
+// is empty.
+func (rc *RecordCollection) IdsCondition() *Condition {
+	return rc.model.Field(ID).In(rc.Ids())
+}
+
+// RelationFilter returns the condition that records of the related model must
+// satisfy to be set in the given relation field. It is the Filter of the field
+// combined with the result of its DynamicFilter method called on this RecordCollection.
+func (rc *RecordCollection) RelationFilter(field FieldName) *Condition {
+	fi := rc.model.fields.MustGet(field.Name())
+	if !fi.fieldType.IsRelationType() {
+		log.Panic("RelationFilter can only be called on relation fields", "model", rc.model.name, "field", field)
+	}
+	res := newCondition()
+	if fi.filter != nil {
+		res = res.AndCond(fi.filter)
+	}
+	if fi.dynamicFilter != "" {
+		res = res.AndCond(rc.Call(fi.dynamicFilter).(Conditioner).Underlying())
+	}
+	return res
+}
+
 // SQLFromCondition returns the WHERE clause sql and arguments corresponding to
 // the given condition.
 func (rc *RecordCollection) SQLFromCondition(c *Condition) (string, SQLParams) {
@@ -1172,6 +2378,7 @@ func (rc *RecordCollection) Records() []*RecordCollection {
 		newRC := newRecordCollection(rc.Env(), rc.ModelName())
 		res[i] = newRC.withIds([]int64{id})
 		res[i].prefetchRC = rc
+		res[i].withFields = rc.withFields
 	}
 	return res
 }
@@ -1225,7 +2432,7 @@ func (rc *RecordCollection) Model() *Model {
 func (rc *RecordCollection) GetRecord(externalID string) *RecordCollection {
 	res := rc.Search(rc.model.Field(rc.model.FieldName("HexyaExternalID")).Equals(externalID))
 	if res.IsEmpty() {
-		log.Panic("Unknown external ID", "model", rc.model.name, "externalID", externalID)
+		raise(exceptions.MissingError{Message: "Unknown external ID"}, "model", rc.model.name, "externalID", externalID)
 	}
 	return res
 }
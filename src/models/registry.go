@@ -45,6 +45,9 @@ type modelCollection struct {
 	registryByName      map[string]*Model
 	registryByTableName map[string]*Model
 	sequences           map[string]*Sequence
+	dataFixes           map[string]*DataFix
+
+	computedInvalidationHooks []ComputedInvalidationHook
 }
 
 // Get the given Model by name or by table name
@@ -117,6 +120,7 @@ func newModelCollection() *modelCollection {
 		registryByName:      make(map[string]*Model),
 		registryByTableName: make(map[string]*Model),
 		sequences:           make(map[string]*Sequence),
+		dataFixes:           make(map[string]*DataFix),
 	}
 }
 
@@ -132,8 +136,13 @@ type Model struct {
 	mixins          []*Model
 	sqlConstraints  map[string]sqlConstraint
 	sqlErrors       map[string]string
+	partialUniques  map[string]partialUniqueIndex
+	accessRights    map[*security.Group]security.Permission
+	viewStructs     map[string][]FieldName
 	defaultOrderStr []string
 	defaultOrder    []orderPredicate
+	cascadeFields   []*Field
+	afterWriteHooks []AfterWriteHook
 	created         bool
 }
 
@@ -144,6 +153,15 @@ type sqlConstraint struct {
 	errorString string
 }
 
+// A partialUniqueIndex holds the data needed to create a unique index
+// restricted to the rows matching a condition
+type partialUniqueIndex struct {
+	name        string
+	fields      []FieldName
+	cond        *Condition
+	errorString string
+}
+
 // Name returns the name of this model
 func (m *Model) Name() string {
 	return m.name
@@ -227,8 +245,9 @@ func (m *Model) scanToFieldMap(r sqlx.ColScanner, dest *FieldMap, substs map[str
 		(*dest)[colName] = dbVal
 	}
 
-	// Step 3: We convert values with the type of the corresponding Field
-	// if the value is not nil.
+	// Step 3: We decrypt the values of encrypted fields and convert values
+	// with the type of the corresponding Field if the value is not nil.
+	m.decryptFieldMap(dest)
 	m.convertValuesToFieldType(dest, false)
 	return r.Err()
 }
@@ -246,7 +265,21 @@ func (m *Model) convertValuesToFieldType(fMap *FieldMap, writeDB bool) {
 			fMapValue = nil
 		}
 		fi := m.getRelatedFieldInfo(m.FieldName(colName))
+		if fi.fieldType == fieldtype.Reference {
+			fMapValue = referenceValue(fMapValue)
+		}
 		fType := fi.structField.Type
+		if _, ok := fMapValue.(fieldSQLFunction); ok {
+			continue
+		}
+		if inc, ok := fMapValue.(fieldIncrement); ok {
+			typedDelta := reflect.New(fType).Interface()
+			if err := typesutils.Convert(inc.delta, typedDelta, false); err != nil {
+				log.Panic(err.Error(), "model", m.name, "field", colName, "type", fType, "value", inc.delta)
+			}
+			destVals.SetMapIndex(reflect.ValueOf(colName), reflect.ValueOf(fieldIncrement{delta: reflect.ValueOf(typedDelta).Elem().Interface()}))
+			continue
+		}
 		typedValue := reflect.New(fType).Interface()
 		err := typesutils.Convert(fMapValue, typedValue, fi.isRelationField())
 		if err != nil {
@@ -404,7 +437,10 @@ func (m *Model) Field(name FieldName) *ConditionField {
 // The result map is indexed by the fields JSON names.
 func (m *Model) FieldsGet(fields ...FieldName) map[string]*FieldInfo {
 	if len(fields) == 0 {
-		for n := range m.fields.registryByName {
+		for n, fi := range m.fields.registryByName {
+			if fi.shadowOf != nil || fi.versionOf != nil || fi.lazyMarkerOf != nil {
+				continue
+			}
 			fields = append(fields, m.FieldName(n))
 		}
 	}
@@ -424,6 +460,8 @@ func (m *Model) FieldsGet(fields ...FieldName) map[string]*FieldInfo {
 			Name:          fInfo.name,
 			JSON:          fInfo.json,
 			Help:          fInfo.help,
+			Placeholder:   fInfo.placeholder,
+			Section:       fInfo.section,
 			Searchable:    true,
 			Depends:       fInfo.depends,
 			Sortable:      true,
@@ -434,7 +472,7 @@ func (m *Model) FieldsGet(fields ...FieldName) map[string]*FieldInfo {
 			Selection:     fInfo.selection,
 			Domain:        filter,
 			ReverseFK:     fInfo.jsonReverseFK,
-			OnChange:      fInfo.onChange != "",
+			OnChange:      fInfo.onChange != "" || len(fInfo.filterTriggers) > 0,
 			Translate:     translate,
 			InvisibleFunc: fInfo.invisibleFunc,
 			ReadOnly:      fInfo.isReadOnly(),
@@ -463,21 +501,187 @@ func (m *Model) FilteredOn(field FieldName, condition *Condition) *Condition {
 }
 
 // Create creates a new record in this model with the given data.
-func (m *Model) Create(env Environment, data interface{}) *RecordCollection {
+//
+// It panics if data is nil or if it holds the data of another model.
+func (m *Model) Create(env Environment, data RecordData) *RecordCollection {
+	if data == nil || (reflect.ValueOf(data).Kind() == reflect.Ptr && reflect.ValueOf(data).IsNil()) || data.Underlying() == nil {
+		log.Panic("Create data must not be nil", "model", m.name)
+	}
+	if dataModel := data.Underlying().Model; dataModel != nil && dataModel != m {
+		log.Panic("Create data must be of the model of the created record", "model", m.name, "dataModel", dataModel.name)
+	}
 	return env.Pool(m.name).Call("Create", data).(RecordSet).Collection()
 }
 
+// Upsert inserts the given data in the database in a single query, or updates the
+// existing records that have the same values for conflictFields. conflictFields must
+// be the fields of a unique constraint of this model. It returns the inserted and
+// updated records.
+//
+// Only the stored fields of the model are written. On existing records, only the
+// fields that are given in every data are updated.
+//
+// Upsert does not call the Create and Write methods of the model, so that their
+// overrides are not executed, and does not check record rules. Constraints are
+// checked and computed fields are updated. For this reason, Upsert panics if the
+// user of env is not the superuser: call it on a Sudo environment.
+func (m *Model) Upsert(env Environment, data []RecordData, conflictFields []FieldName) *RecordCollection {
+	for _, d := range data {
+		if dataModel := d.Underlying().Model; dataModel != nil && dataModel != m {
+			log.Panic("Upsert data must be of the model of the upserted records", "model", m.name, "dataModel", dataModel.name)
+		}
+	}
+	return env.Pool(m.name).upsert(data, conflictFields)
+}
+
+// GetOrCreate returns the records of this model matching the given condition.
+// If there are none, a new record is created from defaults and the values
+// of the fields searched with Equals in cond.
+//
+// Transactions are serializable, so that if a concurrent transaction creates
+// the record first, this transaction fails with a serialization error instead
+// of creating a duplicate. When GetOrCreate is called inside ExecuteInNewEnvironment,
+// the transaction is then retried and the search returns the created record.
+func (m *Model) GetOrCreate(env Environment, cond Conditioner, defaults RecordData) *RecordCollection {
+	if rs := m.Search(env, cond); !rs.IsEmpty() {
+		return rs
+	}
+	data := NewModelData(m)
+	if defaults != nil && !(reflect.ValueOf(defaults).Kind() == reflect.Ptr && reflect.ValueOf(defaults).IsNil()) {
+		if dataModel := defaults.Underlying().Model; dataModel != nil && dataModel != m {
+			log.Panic("GetOrCreate defaults must be of the model of the created record", "model", m.name, "dataModel", dataModel.name)
+		}
+		data = defaults.Underlying().Copy()
+		data.Model = m
+	}
+	for field, value := range cond.Underlying().equalityValues() {
+		data.Set(m.FieldName(field), value)
+	}
+	return m.Create(env, data)
+}
+
+// upsertConflictColumns returns the columns of the given fields after checking
+// that they are the target of a unique constraint of this model.
+func (m *Model) upsertConflictColumns(fields []FieldName) []string {
+	if len(fields) == 0 {
+		log.Panic("No conflict fields given for upsert", "model", m.name)
+	}
+	cols := make([]string, len(fields))
+	for i, f := range fields {
+		fi := m.fields.MustGet(f.Name())
+		if !fi.isStored() {
+			log.Panic("Upsert conflict fields must be stored fields", "model", m.name, "field", f.Name())
+		}
+		cols[i] = fi.json
+	}
+	if len(fields) == 1 {
+		if fi := m.fields.MustGet(fields[0].Name()); fi.unique || fi.json == "id" {
+			return cols
+		}
+	}
+	for _, constraint := range m.sqlConstraints {
+		if sameColumns(uniqueConstraintColumns(constraint.sql), cols) {
+			return cols
+		}
+	}
+	log.Panic("Upsert conflict fields must be the fields of a unique constraint", "model", m.name, "fields", cols)
+	return nil
+}
+
+// uniqueConstraintColumns returns the columns of the given SQL constraint if it
+// is a UNIQUE constraint, or nil otherwise.
+func uniqueConstraintColumns(sql string) []string {
+	def := strings.TrimSpace(sql)
+	if len(def) < 6 || !strings.EqualFold(def[:6], "unique") {
+		return nil
+	}
+	def = strings.TrimSpace(def[6:])
+	if !strings.HasPrefix(def, "(") || !strings.HasSuffix(def, ")") {
+		return nil
+	}
+	var res []string
+	for _, col := range strings.Split(def[1:len(def)-1], ",") {
+		res = append(res, strings.Trim(strings.TrimSpace(col), `"`))
+	}
+	return res
+}
+
+// sameColumns returns true if the given lists hold the same columns in any order.
+func sameColumns(cols1, cols2 []string) bool {
+	if len(cols1) != len(cols2) {
+		return false
+	}
+	for _, col := range cols1 {
+		if !strutils.IsIn(col, cols2...) {
+			return false
+		}
+	}
+	return true
+}
+
 // Search searches the database and returns records matching the given condition.
 func (m *Model) Search(env Environment, cond Conditioner) *RecordCollection {
 	return env.Pool(m.name).Call("Search", cond).(RecordSet).Collection()
 }
 
+// MultiSearch searches the database with a single query and returns for each
+// given condition the records matching it. See RecordCollection.MultiSearch.
+func (m *Model) MultiSearch(env Environment, conds ...Conditioner) []*RecordCollection {
+	underlyings := make([]*Condition, len(conds))
+	for i, cond := range conds {
+		underlyings[i] = cond.Underlying()
+	}
+	return env.Pool(m.name).MultiSearch(underlyings...)
+}
+
+// DistinctValues returns the distinct values of the given field among the records
+// of this model matching the given condition, in ascending order and without nulls.
+// All the records are considered if cond is empty. Record rules apply.
+func (m *Model) DistinctValues(env Environment, field FieldName, cond Conditioner) []interface{} {
+	rc := env.Pool(m.name).SearchAll()
+	if !cond.Underlying().IsEmpty() {
+		rc = rc.Search(cond.Underlying())
+	}
+	return rc.DistinctValues(field)
+}
+
+// SubqueryIds returns a Subquery selecting the ids of the records of this model
+// that match the given condition.
+//
+// The result is meant to be given to the In or NotIn operators of a relation field
+// pointing to this model, e.g. to search the posts of users of a given profile.
+func (m *Model) SubqueryIds(cond Conditioner) Subquery {
+	return Subquery{
+		model: m,
+		cond:  cond.Underlying(),
+	}
+}
+
 // Browse returns a new RecordSet with the records with the given ids.
 // Note that this function is just a shorcut for Search on a list of ids.
 func (m *Model) Browse(env Environment, ids []int64) *RecordCollection {
 	return env.Pool(m.name).Call("Browse", ids).(RecordSet).Collection()
 }
 
+// BrowseStrict returns a new RecordSet with the records with the given ids.
+// It panics with the list of missing ids if some of the records do not exist.
+func (m *Model) BrowseStrict(env Environment, ids []int64) *RecordCollection {
+	return env.Pool(m.name).Call("BrowseStrict", ids).(RecordSet).Collection()
+}
+
+// BrowseExternal returns a new RecordSet with the records with the given external IDs,
+// in the given order. It panics with the list of unresolved external IDs if some of
+// the records do not exist.
+func (m *Model) BrowseExternal(env Environment, externalIDs ...string) *RecordCollection {
+	return env.Pool(m.name).Call("BrowseExternal", externalIDs).(RecordSet).Collection()
+}
+
+// BrowseOrdered returns a new RecordSet with the records with the given ids, in the
+// given order. Ids of records that do not exist are skipped.
+func (m *Model) BrowseOrdered(env Environment, ids []int64) *RecordCollection {
+	return env.Pool(m.name).Call("BrowseOrdered", ids).(RecordSet).Collection()
+}
+
 // BrowseOne returns a new RecordSet with the record with the given id.
 // Note that this function is just a shorcut for Search the given id.
 func (m *Model) BrowseOne(env Environment, id int64) *RecordCollection {
@@ -504,11 +708,126 @@ func (m *Model) RemoveSQLConstraint(name string) {
 	delete(m.sqlConstraints, fmt.Sprintf("%s_mancon", name))
 }
 
+// AddAccessRights grants the given group the given permissions on the records of this model.
+//
+// Each permission gives the group the execution permission on a CRUD method:
+// Create on "Create", Read on "Load", Write on "Write" and Unlink on "Unlink".
+// CRUD methods are denied to all groups but the admin group by default, so that
+// all access rights of a model can be declared with this method in one place.
+func (m *Model) AddAccessRights(group *security.Group, perms security.Permission) {
+	m.accessRights[group] |= perms
+	if Registry.bootstrapped {
+		m.applyAccessRights()
+	}
+}
+
+// RemoveAccessRights revokes the given permissions on the records of this
+// model from the given group.
+func (m *Model) RemoveAccessRights(group *security.Group, perms security.Permission) {
+	m.accessRights[group] &^= perms
+	for perm, methName := range accessRightsMethods {
+		if perms&perm == 0 {
+			continue
+		}
+		if meth, ok := m.methods.Get(methName); ok {
+			meth.RevokeGroup(group)
+		}
+	}
+	if m.accessRights[group] == 0 {
+		delete(m.accessRights, group)
+	}
+}
+
+// AccessRights returns the permissions of the given group on the records of this
+// model, as declared with AddAccessRights.
+func (m *Model) AccessRights(group *security.Group) security.Permission {
+	return m.accessRights[group]
+}
+
+// accessRightsMethods maps each access right permission to the CRUD method it allows
+var accessRightsMethods = map[security.Permission]string{
+	security.Create: "Create",
+	security.Read:   "Load",
+	security.Write:  "Write",
+	security.Unlink: "Unlink",
+}
+
+// applyAccessRights grants the execution permission on CRUD methods to the
+// groups for which access rights have been declared on this model.
+func (m *Model) applyAccessRights() {
+	for group, perms := range m.accessRights {
+		for perm, methName := range accessRightsMethods {
+			if perms&perm == 0 {
+				continue
+			}
+			m.methods.MustGet(methName).AllowGroup(group)
+		}
+	}
+}
+
+// AddPartialUniqueConstraint adds a unique index in the database on the given fields
+// that only applies to the records matching cond. This is typically used to ensure
+// the uniqueness of a field among active records only.
+//    - name is an arbitrary name to reference this constraint, unique in this model.
+//    - fields are the stored fields of this model whose values must be unique.
+//    - cond restricts the constraint to the matching records. It can only hold
+//      predicates on the fields of this model with static values.
+//    - errorString is the text to display to the user when the constraint is violated
+func (m *Model) AddPartialUniqueConstraint(name string, fields []FieldName, cond Conditioner, errorString string) {
+	if len(fields) == 0 {
+		log.Panic("Partial unique constraints must have at least one field", "model", m.name, "constraint", name)
+	}
+	indexName := fmt.Sprintf("%s_%s_uniqidx", name, m.tableName)
+	m.partialUniques[indexName] = partialUniqueIndex{
+		name:        indexName,
+		fields:      fields,
+		cond:        cond.Underlying(),
+		errorString: errorString,
+	}
+}
+
+// RemovePartialUniqueConstraint removes the partial unique constraint with the given name from the database.
+func (m *Model) RemovePartialUniqueConstraint(name string) {
+	delete(m.partialUniques, fmt.Sprintf("%s_%s_uniqidx", name, m.tableName))
+}
+
 // TableName return the db table name
 func (m *Model) TableName() string {
 	return m.tableName
 }
 
+// SetTableName sets the name of the database table of this model,
+// instead of the snake cased model name. This allows mapping a model
+// onto an existing table. It must be called before bootstrap.
+//
+// The column names of the fields can be set in the same way with
+// the JSON parameter of the field definitions.
+func (m *Model) SetTableName(name string) {
+	if Registry.bootstrapped {
+		log.Panic("Table names cannot be changed after bootstrap", "model", m.name, "table", name)
+	}
+	if om, exists := Registry.registryByTableName[name]; exists && om != m {
+		log.Panic("Table name is already used by another model", "model", m.name, "table", name, "other", om.name)
+	}
+	delete(Registry.registryByTableName, m.tableName)
+	constraints := make(map[string]sqlConstraint)
+	for cName, constraint := range m.sqlConstraints {
+		cName = fmt.Sprintf("%s_%s_mancon", strings.TrimSuffix(cName, fmt.Sprintf("_%s_mancon", m.tableName)), name)
+		constraint.name = cName
+		constraints[cName] = constraint
+	}
+	m.sqlConstraints = constraints
+	indexes := make(map[string]partialUniqueIndex)
+	for iName, index := range m.partialUniques {
+		iName = fmt.Sprintf("%s_%s_uniqidx", strings.TrimSuffix(iName, fmt.Sprintf("_%s_uniqidx", m.tableName)), name)
+		index.name = iName
+		indexes[iName] = index
+	}
+	m.partialUniques = indexes
+	m.tableName = name
+	Registry.registryByTableName[name] = m
+}
+
 // Underlying returns the underlying Model data object, i.e. itself
 func (m *Model) Underlying() *Model {
 	return m
@@ -577,6 +896,9 @@ func CreateModel(name string, options Option) *Model {
 		methods:         newMethodsCollection(),
 		sqlConstraints:  make(map[string]sqlConstraint),
 		sqlErrors:       make(map[string]string),
+		partialUniques:  make(map[string]partialUniqueIndex),
+		accessRights:    make(map[*security.Group]security.Permission),
+		viewStructs:     make(map[string][]FieldName),
 		defaultOrderStr: []string{"ID"},
 	}
 	pk := &Field{
@@ -0,0 +1,163 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"fmt"
+
+	"github.com/hexya-erp/hexya/src/models/fieldtype"
+	"github.com/hexya-erp/hexya/src/models/security"
+	"github.com/hexya-erp/hexya/src/models/types"
+	"github.com/hexya-erp/hexya/src/tools/exceptions"
+)
+
+// An m2mLink is a row of the relation table of a many2many field
+type m2mLink struct {
+	Our   int64 `db:"our"`
+	Their int64 `db:"their"`
+}
+
+// AddRelationIds links all the records of this RecordCollection to the records
+// with the given ids through the given many2many field, keeping the existing links.
+//
+// Links are inserted in the relation table from the ids in a single query, without
+// loading the related records. Ids that are already linked are skipped, and so are
+// ids of records that do not exist, unless the 'hexya_strict_relation_ids' context
+// key is set, in which case a MissingError listing them is raised.
+//
+// Write is not called, but write record rules apply, and stored computed fields
+// and constraints depending on the field are processed. As for Write, the
+// WriteDate and WriteUID fields of the records whose links have changed are
+// updated and the AfterWrite hooks of the model are called.
+func (rc *RecordCollection) AddRelationIds(fieldName FieldName, ids []int64) *RecordCollection {
+	return rc.updateRelationIds(fieldName, ids, false)
+}
+
+// RemoveRelationIds removes the links between all the records of this
+// RecordCollection and the records with the given ids through the given
+// many2many field in a single query. Ids that are not linked are ignored.
+//
+// As for AddRelationIds, Write is not called.
+func (rc *RecordCollection) RemoveRelationIds(fieldName FieldName, ids []int64) *RecordCollection {
+	return rc.updateRelationIds(fieldName, ids, true)
+}
+
+// updateRelationIds adds or removes links to the given ids through the given
+// many2many field of all the records of this RecordCollection.
+func (rc *RecordCollection) updateRelationIds(fieldName FieldName, ids []int64, remove bool) *RecordCollection {
+	fi := rc.model.fields.MustGet(fieldName.Name())
+	if fi.fieldType != fieldtype.Many2Many || fi.isComputedField() || fi.isRelatedField() {
+		log.Panic("Relation ids can only be added or removed on many2many fields that are neither computed nor related", "model", rc.ModelName(), "field", fieldName)
+	}
+	if rc.IsEmpty() || len(ids) == 0 {
+		return rc
+	}
+	if rc.hasNegIds {
+		log.Panic("Relation ids cannot be added or removed on records that are not saved in the database", "model", rc.ModelName(), "ids", rc.ids)
+	}
+	rc.CheckExecutionPermission(rc.model.methods.MustGet("Write"))
+	rc.checkNoWriteFields(FieldNames{fieldName})
+	rSet := rc.env.Pool(rc.model.name).Search(rc.model.Field(ID).In(rc.ids)).
+		addRecordRuleConditions(rc.env.uid, security.Write).Fetch()
+	if rSet.IsEmpty() {
+		return rc
+	}
+	changesetFields := rSet.changesetFields(FieldMap{fi.json: nil})
+	oldValues := rSet.readChangesetValues(changesetFields)
+	ours, theirs := rSet.updateM2MLinks(fi, ids, remove)
+	if len(ours) > 0 {
+		rc.env.Pool(rc.model.name).withIds(ours).updateAccessFields()
+	}
+	rSet.processInverseM2MTriggers(fi, theirs)
+	rSet.processTriggers(FieldNames{fieldName})
+	rSet.CheckConstraints(FieldNames{fieldName})
+	rSet.callAfterWriteHooks(changesetFields, oldValues)
+	return rc
+}
+
+// updateAccessFields sets the WriteDate and WriteUID fields of the records
+// of this RecordCollection in the database and in the cache, as Write does.
+func (rc *RecordCollection) updateAccessFields() {
+	fMap := make(FieldMap)
+	rc.addAccessFieldsUpdateData(&fMap)
+	if len(fMap) == 0 {
+		return
+	}
+	rc.model.convertValuesToFieldType(&fMap, true)
+	fMap = rc.filterMapOnStoredFields(fMap)
+	query, args := rc.query.updateQuery(fMap)
+	rc.env.cr.Execute(query, args...)
+	for _, id := range rc.ids {
+		for k, v := range fMap {
+			rc.env.cache.updateEntry(rc.model, id, k, v, rc.query.ctxArgsSlug())
+		}
+	}
+}
+
+// updateM2MLinks inserts the rows of the relation table of the given many2many
+// field between the records of this RecordCollection and the given ids, or deletes
+// them if remove is true, and updates the cache accordingly. Other links of the
+// field are left untouched. It returns the ids of the records of this
+// RecordCollection and the ids of the related records whose links have changed.
+func (rc *RecordCollection) updateM2MLinks(fi *Field, ids []int64, remove bool) ([]int64, []int64) {
+	adapter := adapters[db.DriverName()]
+	relTable := adapter.quoteTableName(fi.m2mRelModel.tableName)
+	var links []m2mLink
+	if remove {
+		query := fmt.Sprintf(`DELETE FROM %[1]s WHERE %[2]s = ANY(?::bigint[]) AND %[3]s = ANY(?::bigint[]) RETURNING %[2]s AS our, %[3]s AS their`,
+			relTable, fi.m2mOurField.json, fi.m2mTheirField.json)
+		rc.env.cr.Select(&links, query, types.IntegerArray(rc.ids), types.IntegerArray(ids))
+		for _, link := range links {
+			rc.env.cache.removeM2MLink(fi, link.Our, link.Their)
+		}
+	} else {
+		relatedTable := adapter.quoteTableName(fi.relatedModel.tableName)
+		if rc.env.context.GetBool("hexya_strict_relation_ids") {
+			rc.checkRelationIdsExist(fi, relatedTable, ids)
+		}
+		query := fmt.Sprintf(`INSERT INTO %[1]s (%[2]s, %[3]s)
+SELECT o.id, t.id FROM unnest(?::bigint[]) o(id) CROSS JOIN %[4]s t
+WHERE t.id = ANY(?::bigint[])
+	AND NOT EXISTS (SELECT 1 FROM %[1]s r WHERE r.%[2]s = o.id AND r.%[3]s = t.id)
+RETURNING %[2]s AS our, %[3]s AS their`, relTable, fi.m2mOurField.json, fi.m2mTheirField.json, relatedTable)
+		rc.env.cr.Select(&links, query, types.IntegerArray(rc.ids), types.IntegerArray(ids))
+		for _, link := range links {
+			rc.env.cache.addM2MLink(fi, link.Our, []int64{link.Their})
+		}
+	}
+	var ours, theirs []int64
+	seenOurs := make(map[int64]bool)
+	seenTheirs := make(map[int64]bool)
+	for _, link := range links {
+		if !seenOurs[link.Our] {
+			ours = append(ours, link.Our)
+			seenOurs[link.Our] = true
+		}
+		if !seenTheirs[link.Their] {
+			theirs = append(theirs, link.Their)
+			seenTheirs[link.Their] = true
+		}
+	}
+	return ours, theirs
+}
+
+// checkRelationIdsExist raises a MissingError if some of the given
+// ids are not ids of records of the related model of fi.
+func (rc *RecordCollection) checkRelationIdsExist(fi *Field, relatedTable string, ids []int64) {
+	var existingIds []int64
+	rc.env.cr.Select(&existingIds, fmt.Sprintf(`SELECT id FROM %s WHERE id = ANY(?::bigint[])`, relatedTable), types.IntegerArray(ids))
+	existing := make(map[int64]bool, len(existingIds))
+	for _, id := range existingIds {
+		existing[id] = true
+	}
+	var missing []int64
+	for _, id := range ids {
+		if !existing[id] {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		raise(exceptions.MissingError{Message: "Some related records do not exist"}, "model", rc.model.name, "field", fi.name, "missingIDs", missing)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+// SearchReadStream returns an iterator over the values of the given fields of
+// the records of this model matching cond. Each call of the returned function
+// gives the values of the next batch of at most batchSize records and true, or
+// nil and false when all records have been returned. All the records are
+// considered if cond is empty.
+//
+// Each record is given as a map of its values indexed by the JSON names of
+// the fields, the "id" field being always included. Many2one and one2one
+// fields are given by the ID of the related record or nil, and one2many and
+// many2many fields by the slice of the related ids.
+//
+// As for Iterate, records are fetched in ID order and each batch is read in
+// a copy of env with its own cache, so that memory usage stays bounded
+// whatever the number of matching records. Only the requested fields are read
+// from the database. This makes SearchReadStream suitable for large exports.
+func (m *Model) SearchReadStream(env Environment, cond Conditioner, fields []FieldName, batchSize int) func() ([]map[string]interface{}, bool) {
+	if batchSize <= 0 {
+		log.Panic("SearchReadStream batch size must be positive", "model", m.name, "batchSize", batchSize)
+	}
+	fields = addIDIfNotPresent(fields)
+	fInfos := make([]*Field, len(fields))
+	for i, f := range fields {
+		fInfos[i] = m.getRelatedFieldInfo(f)
+	}
+	if !env.readOnly {
+		env.Flush()
+	}
+	var (
+		lastID int64
+		done   bool
+	)
+	return func() ([]map[string]interface{}, bool) {
+		if done {
+			return nil, false
+		}
+		batchEnv := env
+		batchEnv.cache = newCache()
+		c := m.Field(ID).Greater(lastID)
+		if !cond.Underlying().IsEmpty() {
+			c = c.AndCond(cond.Underlying())
+		}
+		rs := batchEnv.Pool(m.name).Search(c).OrderBy("ID").Limit(batchSize).Load(fields...)
+		if rs.Len() < batchSize {
+			done = true
+		}
+		if rs.IsEmpty() {
+			return nil, false
+		}
+		lastID = rs.ids[len(rs.ids)-1]
+		res := make([]map[string]interface{}, rs.Len())
+		for i, rec := range rs.Records() {
+			record := make(map[string]interface{}, len(fields))
+			for j, f := range fields {
+				record[f.JSON()] = searchReadValue(fInfos[j], rec.Get(f))
+			}
+			res[i] = record
+		}
+		return res, true
+	}
+}
+
+// searchReadValue returns the given value of fi as returned by SearchReadStream,
+// i.e. with relation fields given by ids.
+func searchReadValue(fi *Field, value interface{}) interface{} {
+	rs, ok := value.(RecordSet)
+	if !ok {
+		return value
+	}
+	if fi.fieldType.Is2ManyRelationType() {
+		return append([]int64{}, rs.Ids()...)
+	}
+	if rs.IsEmpty() {
+		return nil
+	}
+	return rs.Ids()[0]
+}
@@ -14,13 +14,17 @@
 
 package security
 
-// A Permission defines which of the read, write or unlink rights apply.
+// A Permission defines which of the read, write, unlink or create rights apply.
 type Permission uint8
 
-// The four Permissions are Read, Write, Unlink and All.
+// The five Permissions are Read, Write, Unlink, Create and All.
+//
+// Create only applies to model access rights, since record rules
+// cannot filter records that do not exist yet.
 const (
 	Read = 1 << Permission(iota)
 	Write
 	Unlink
-	All = Read | Write | Unlink
+	Create
+	All = Read | Write | Unlink | Create
 )
@@ -15,6 +15,8 @@
 package models
 
 import (
+	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/hexya-erp/hexya/src/models/security"
@@ -33,13 +35,21 @@ type RecordRule struct {
 	Perms     security.Permission
 }
 
+// A SearchRestriction is a function returning the condition that the records
+// of a model must match to be accessed in the given Environment. Contrary to
+// the Condition of a RecordRule, it can be built from the user, the company or
+// the context of the Environment.
+type SearchRestriction func(env Environment) Conditioner
+
 // A RecordRuleRegistry keeps a list of RecordRule. It is meant
 // to be attached to a model.
 type recordRuleRegistry struct {
 	sync.RWMutex
-	rulesByName  map[string]*RecordRule
-	rulesByGroup map[string][]*RecordRule
-	globalRules  map[string]*RecordRule
+	rulesByName      map[string]*RecordRule
+	rulesByGroup     map[string][]*RecordRule
+	globalRules      map[string]*RecordRule
+	restrictions     map[string]SearchRestriction
+	restrictionNames []string
 }
 
 // AddRule registers the given RecordRule to the registry with the given name.
@@ -87,6 +97,35 @@ func newRecordRuleRegistry() *recordRuleRegistry {
 		rulesByName:  make(map[string]*RecordRule),
 		rulesByGroup: make(map[string][]*RecordRule),
 		globalRules:  make(map[string]*RecordRule),
+		restrictions: make(map[string]SearchRestriction),
+	}
+}
+
+// addRestriction registers the given SearchRestriction with the given name.
+func (rrr *recordRuleRegistry) addRestriction(name string, restriction SearchRestriction) {
+	rrr.Lock()
+	defer rrr.Unlock()
+	if _, exists := rrr.restrictions[name]; !exists {
+		rrr.restrictionNames = append(rrr.restrictionNames, name)
+		sort.Strings(rrr.restrictionNames)
+	}
+	rrr.restrictions[name] = restriction
+}
+
+// removeRestriction removes the SearchRestriction with the given name.
+func (rrr *recordRuleRegistry) removeRestriction(name string) {
+	rrr.Lock()
+	defer rrr.Unlock()
+	if _, exists := rrr.restrictions[name]; !exists {
+		log.Warn("Trying to remove non-existent search restriction", "name", name)
+		return
+	}
+	delete(rrr.restrictions, name)
+	for i, n := range rrr.restrictionNames {
+		if n == name {
+			rrr.restrictionNames = append(rrr.restrictionNames[:i:i], rrr.restrictionNames[i+1:]...)
+			break
+		}
 	}
 }
 
@@ -101,3 +140,48 @@ func (m *Model) AddRecordRule(rule *RecordRule) {
 func (m *Model) RemoveRecordRule(name string) {
 	m.rulesRegistry.removeRule(name)
 }
+
+// AddSearchRestriction registers the given SearchRestriction with the given name
+// for this model. The condition it returns is added to all queries on the model,
+// like a global RecordRule for all permissions, except for the superuser, so that
+// Sudo bypasses it. If a restriction with the same name exists, it is overwritten.
+//
+// The condition is computed once per Environment, user and context, until the
+// next write in the Environment.
+func (m *Model) AddSearchRestriction(name string, restriction SearchRestriction) {
+	m.rulesRegistry.addRestriction(name, restriction)
+}
+
+// RemoveSearchRestriction removes the SearchRestriction with the given
+// name from this model.
+func (m *Model) RemoveSearchRestriction(name string) {
+	m.rulesRegistry.removeRestriction(name)
+}
+
+// searchRestrictionConditions returns the conditions of the SearchRestriction
+// functions of the model of this RecordCollection in its Environment.
+func (rc *RecordCollection) searchRestrictionConditions() []*Condition {
+	rrr := rc.model.rulesRegistry
+	rrr.RLock()
+	names := rrr.restrictionNames
+	restrictions := make([]SearchRestriction, len(names))
+	for i, name := range names {
+		restrictions[i] = rrr.restrictions[name]
+	}
+	rrr.RUnlock()
+	var res []*Condition
+	for i, restriction := range restrictions {
+		memoKey := fmt.Sprintf("%s.searchRestriction.%s|%d|%v", rc.model.name, names[i], rc.env.uid, rc.env.context)
+		if memo, ok := rc.env.cache.getMemo(memoKey); ok {
+			res = append(res, memo[0].(*Condition))
+			continue
+		}
+		var cond *Condition
+		if c := restriction(*rc.env); c != nil {
+			cond = c.Underlying()
+		}
+		rc.env.cache.setMemo(memoKey, []interface{}{cond})
+		res = append(res, cond)
+	}
+	return res
+}
@@ -84,6 +84,7 @@ func initializeTests() {
 		Password: dbArgs.Password,
 		SSLMode:  "disable",
 	})
+	SetEncryptionKey([]byte("hexya-models-tests-encryption-k!"))
 	TestAdapter = adapters[db.DriverName()]
 }
 
@@ -26,6 +26,27 @@ import (
 	. "github.com/smartystreets/goconvey/convey"
 )
 
+// precomputeWriterAgeCalls counts the calls to the PrecomputeWriterAge method
+var precomputeWriterAgeCalls int
+
+// computeWriterSummaryCalls counts the calls to the ComputeWriterSummary method
+var computeWriterSummaryCalls int
+
+// computePremiumNumsCalls counts the calls to the ComputePremiumNums method
+var computePremiumNumsCalls int
+
+// rateAtCalls counts the calls to the memoized RateAt method
+var rateAtCalls int
+
+// localizedRateCalls counts the calls to the LocalizedRate method memoized on the lang context key
+var localizedRateCalls int
+
+// profileUnlinkCalls counts the calls to the Unlink method of the Profile model
+var profileUnlinkCalls int
+
+// postWriteCalls counts the calls to the Write method of the Post model
+var postWriteCalls int
+
 func testPrefixdUser(rc *RecordCollection, prefix string) []string {
 	var res []string
 	for _, u := range rc.Records() {
@@ -42,6 +63,7 @@ func TestModelDeclaration(t *testing.T) {
 		tag := NewModel("Tag")
 		cv := NewModel("Resume")
 		comment := NewModel("Comment")
+		company := NewModel("Company")
 		addressMI := NewMixinModel("AddressMixIn")
 		activeMI := NewMixinModel("ActiveMixIn")
 		viewModel := NewManualModel("UserView")
@@ -165,6 +187,13 @@ func TestModelDeclaration(t *testing.T) {
 				return NewModelData(rc.Model())
 			})
 
+		userModel.NewMethod("ComputePremiumNums",
+			func(rc *RecordCollection) *ModelData {
+				computePremiumNumsCalls++
+				return NewModelData(rc.Model()).
+					Set(rc.Model().FieldName("PremiumNums"), 10*rc.Get(rc.Model().FieldName("Nums")).(int))
+			})
+
 		userModel.NewMethod("EndlessRecursion",
 			func(rc *RecordCollection) string {
 				return rc.Call("EndlessRecursion2").(string)
@@ -284,12 +313,39 @@ func TestModelDeclaration(t *testing.T) {
 				return NewModelData(rc.Model()).Set(rc.Model().FieldName("Read"), read)
 			})
 
+		post.NewMethod("ComputeCheckedAt",
+			func(rc *RecordCollection) *ModelData {
+				return NewModelData(rc.Model()).Set(rc.Model().FieldName("CheckedAt"), dates.Now())
+			})
+
+		post.NewMethod("CheckedAtNanos",
+			func(rc *RecordCollection) int64 {
+				return rc.Get(rc.Model().FieldName("CheckedAt")).(dates.DateTime).UnixNano()
+			}).Memoize()
+
+		post.NewMethod("ComputeOriginalTitle",
+			func(rc *RecordCollection) *ModelData {
+				return NewModelData(rc.Model()).Set(rc.Model().FieldName("OriginalTitle"), rc.Get(rc.Model().FieldName("Title")))
+			})
+
 		post.Methods().MustGet("Create").Extend(
 			func(rc *RecordCollection, data RecordData) *RecordCollection {
 				res := rc.Super().Call("Create", data).(RecordSet).Collection()
 				return res
 			})
 
+		profileModel.Methods().MustGet("Unlink").Extend(
+			func(rc *RecordCollection) int64 {
+				profileUnlinkCalls++
+				return rc.Super().Call("Unlink").(int64)
+			})
+
+		post.Methods().MustGet("Write").Extend(
+			func(rc *RecordCollection, data RecordData) bool {
+				postWriteCalls++
+				return rc.Super().Call("Write", data).(bool)
+			})
+
 		post.Methods().MustGet("Search").Extend(
 			func(rc *RecordCollection, cond Conditioner) *RecordCollection {
 				res := rc.Super().Call("Search", cond).(RecordSet).Collection()
@@ -319,9 +375,53 @@ func TestModelDeclaration(t *testing.T) {
 						rc.Get(rc.Model().FieldName("User")).(RecordSet).Collection().Get(Registry.MustGet("User").FieldName("Age")).(int16))
 			})
 
+		post.NewMethod("ComputeWriterSummary",
+			func(rc *RecordCollection) *ModelData {
+				computeWriterSummaryCalls++
+				writer := rc.Get(rc.Model().FieldName("User")).(RecordSet).Collection()
+				return NewModelData(rc.Model()).
+					Set(rc.Model().FieldName("WriterSummary"),
+						fmt.Sprintf("%s by %s", rc.Get(rc.Model().FieldName("Title")), writer.Get(Registry.MustGet("User").FieldName("Name"))))
+			})
+
+		post.NewMethod("PrecomputeWriterAge",
+			func(rc *RecordCollection) *types.Context {
+				precomputeWriterAgeCalls++
+				return types.NewContext().WithKey("writer_age_precomputed", true)
+			})
+
 		post.NewMethod("Init",
 			func(rc *RecordCollection) {})
 
+		tag.NewMethod("ComputeFailing",
+			func(rc *RecordCollection) *ModelData {
+				log.Panic("Failing compute method")
+				return nil
+			})
+
+		tag.NewMethod("ComputeFromMissingTable",
+			func(rc *RecordCollection) *ModelData {
+				rc.env.cr.Execute(`SELECT 1 FROM hexya_missing_table`)
+				return NewModelData(rc.Model())
+			})
+
+		tag.NewMethod("RateAt",
+			func(rc *RecordCollection, factor float64) float64 {
+				rateAtCalls++
+				return float64(rc.Get(rc.Model().FieldName("Rate")).(float32)) * factor
+			}).Memoize()
+
+		tag.NewMethod("LocalizedRate",
+			func(rc *RecordCollection) string {
+				localizedRateCalls++
+				return fmt.Sprintf("%s:%.2f", rc.Env().Context().GetString("lang"), rc.Get(rc.Model().FieldName("Rate")).(float32))
+			}).MemoizeOn("lang")
+
+		tag.NewMethod("LogMessage",
+			func(rc *RecordCollection) {
+				rc.Env().Logger().Info("Logging from method", "name", rc.Get(rc.Model().FieldName("Name")))
+			})
+
 		tag.NewMethod("CheckRate",
 			func(rc *RecordCollection) {
 				if rc.Get(rc.Model().FieldName("Rate")).(float32) < 0 || rc.Get(rc.Model().FieldName("Rate")).(float32) > 10 {
@@ -345,6 +445,16 @@ func TestModelDeclaration(t *testing.T) {
 				return NewModelData(rc.Model()).Set(rc.Model().FieldName("Other"), "Other information")
 			})
 
+		comment.NewMethod("PostFilter",
+			func(rc *RecordCollection) *Condition {
+				company := rc.Get(rc.Model().FieldName("Company")).(RecordSet).Collection()
+				if company.IsEmpty() {
+					return newCondition()
+				}
+				postModel := Registry.MustGet("Post")
+				return postModel.Field(postModel.FieldName("Company")).Equals(company)
+			})
+
 		userModel.fields.add(&Field{
 			model:           userModel,
 			name:            "Name",
@@ -353,6 +463,7 @@ func TestModelDeclaration(t *testing.T) {
 			fieldType:       fieldtype.Char,
 			structField:     reflect.StructField{Type: reflect.TypeOf("")},
 			help:            "The user's username",
+			placeholder:     "e.g. John Smith",
 			unique:          true,
 			noCopy:          true,
 			onChange:        "OnChangeName",
@@ -516,6 +627,17 @@ func TestModelDeclaration(t *testing.T) {
 			structField: reflect.StructField{Type: reflect.TypeOf(0)},
 			defaultFunc: DefaultValue(0),
 		})
+		userModel.fields.add(&Field{
+			model:        userModel,
+			name:         "PremiumNums",
+			json:         "premium_nums",
+			fieldType:    fieldtype.Integer,
+			structField:  reflect.StructField{Type: reflect.TypeOf(0)},
+			compute:      "ComputePremiumNums",
+			depends:      []string{"Nums"},
+			computeGuard: "IsPremium",
+			stored:       true,
+		})
 		userModel.fields.add(&Field{
 			model:       userModel,
 			name:        "Size",
@@ -553,6 +675,7 @@ func TestModelDeclaration(t *testing.T) {
 		})
 		userModel.AddSQLConstraint("nums_premium", "CHECK((is_premium = TRUE AND nums IS NOT NULL AND nums > 0) OR (IS_PREMIUM = false))",
 			"Premium users must have positive nums")
+		userModel.AddViewStruct("Contact", "Name", "Email", "Profile")
 
 		profileModel.fields.add(&Field{
 			model:       profileModel,
@@ -611,6 +734,21 @@ func TestModelDeclaration(t *testing.T) {
 			fieldType:   fieldtype.Char,
 			structField: reflect.StructField{Type: reflect.TypeOf("")},
 		})
+		profileModel.fields.add(&Field{
+			model:       profileModel,
+			name:        "SSN",
+			json:        "ssn",
+			fieldType:   fieldtype.Encrypted,
+			structField: reflect.StructField{Type: reflect.TypeOf("")},
+			blindIndex:  true,
+		})
+		profileModel.fields.add(&Field{
+			model:       profileModel,
+			name:        "APIKey",
+			json:        "api_key",
+			fieldType:   fieldtype.Encrypted,
+			structField: reflect.StructField{Type: reflect.TypeOf("")},
+		})
 		profileModel.fields.add(&Field{
 			model:          profileModel,
 			name:           "UserName",
@@ -619,6 +757,15 @@ func TestModelDeclaration(t *testing.T) {
 			structField:    reflect.StructField{Type: reflect.TypeOf("")},
 			relatedPathStr: "User.Name",
 		})
+		post.fields.add(&Field{
+			model:            post,
+			name:             "Company",
+			json:             "company_id",
+			fieldType:        fieldtype.Many2One,
+			structField:      reflect.StructField{Type: reflect.TypeOf(int64(0))},
+			onDelete:         SetNull,
+			relatedModelName: "Company",
+		})
 		post.fields.add(&Field{
 			model:            post,
 			name:             "User",
@@ -635,6 +782,18 @@ func TestModelDeclaration(t *testing.T) {
 			fieldType:   fieldtype.Char,
 			structField: reflect.StructField{Type: reflect.TypeOf("")},
 			required:    true,
+			searchType:  TrigramSearch,
+		})
+		post.fields.add(&Field{
+			model:           post,
+			name:            "OriginalTitle",
+			json:            "original_title",
+			fieldType:       fieldtype.Char,
+			structField:     reflect.StructField{Type: reflect.TypeOf("")},
+			compute:         "ComputeOriginalTitle",
+			depends:         []string{"Title"},
+			stored:          true,
+			computeOnCreate: true,
 		})
 		post.fields.add(&Field{
 			model:       post,
@@ -671,13 +830,24 @@ func TestModelDeclaration(t *testing.T) {
 			structField: reflect.StructField{Type: reflect.TypeOf("")},
 		})
 		post.fields.add(&Field{
-			model:       post,
-			name:        "Read",
-			json:        "read",
-			fieldType:   fieldtype.Boolean,
-			structField: reflect.StructField{Type: reflect.TypeOf(false)},
-			compute:     "ComputeRead",
-			defaultFunc: DefaultValue(false),
+			model:        post,
+			name:         "Read",
+			json:         "read",
+			fieldType:    fieldtype.Boolean,
+			structField:  reflect.StructField{Type: reflect.TypeOf(false)},
+			compute:      "ComputeRead",
+			depends:      []string{"LastRead"},
+			searchShadow: true,
+			defaultFunc:  DefaultValue(false),
+		})
+		post.fields.add(&Field{
+			model:         post,
+			name:          "CheckedAt",
+			json:          "checked_at",
+			fieldType:     fieldtype.DateTime,
+			structField:   reflect.StructField{Type: reflect.TypeOf(dates.DateTime{})},
+			compute:       "ComputeCheckedAt",
+			timeDependent: true,
 		})
 		post.fields.add(&Field{
 			model:       post,
@@ -686,6 +856,13 @@ func TestModelDeclaration(t *testing.T) {
 			fieldType:   fieldtype.Date,
 			structField: reflect.StructField{Type: reflect.TypeOf(dates.Date{})},
 		})
+		post.fields.add(&Field{
+			model:       post,
+			name:        "Keywords",
+			json:        "keywords",
+			fieldType:   fieldtype.Array,
+			structField: reflect.StructField{Type: reflect.TypeOf(types.StringArray{})},
+		})
 		post.fields.add(&Field{
 			model:       post,
 			name:        "Visibility",
@@ -738,10 +915,22 @@ func TestModelDeclaration(t *testing.T) {
 			fieldType:   fieldtype.Integer,
 			structField: reflect.StructField{Type: reflect.TypeOf(int16(0))},
 			compute:     "ComputeWriterAge",
+			precompute:  "PrecomputeWriterAge",
 			depends:     []string{"User.Age"},
 			stored:      true,
 			defaultFunc: DefaultValue(0),
 		})
+		post.fields.add(&Field{
+			model:          post,
+			name:           "WriterSummary",
+			json:           "writer_summary",
+			fieldType:      fieldtype.Char,
+			structField:    reflect.StructField{Type: reflect.TypeOf("")},
+			compute:        "ComputeWriterSummary",
+			depends:        []string{"Title", "User.Name"},
+			stored:         true,
+			versionedCache: true,
+		})
 		post.fields.add(&Field{
 			model:          post,
 			name:           "WriterMoney",
@@ -761,6 +950,18 @@ func TestModelDeclaration(t *testing.T) {
 			structField:      reflect.StructField{Type: reflect.TypeOf(int64(0))},
 			onDelete:         SetNull,
 			relatedModelName: "Post",
+			checkCompany:     true,
+			dynamicFilter:    "PostFilter",
+			filterDepends:    []string{"Company"},
+		})
+		comment.fields.add(&Field{
+			model:            comment,
+			name:             "Company",
+			json:             "company_id",
+			fieldType:        fieldtype.Many2One,
+			structField:      reflect.StructField{Type: reflect.TypeOf(int64(0))},
+			onDelete:         SetNull,
+			relatedModelName: "Company",
 		})
 		comment.fields.add(&Field{
 			model:            comment,
@@ -781,6 +982,13 @@ func TestModelDeclaration(t *testing.T) {
 			relatedPathStr: "PostWriter.PMoney",
 			defaultFunc:    DefaultValue(0),
 		})
+		comment.fields.add(&Field{
+			model:       comment,
+			name:        "Document",
+			json:        "document",
+			fieldType:   fieldtype.Reference,
+			structField: reflect.StructField{Type: reflect.TypeOf("")},
+		})
 		comment.fields.add(&Field{
 			model:       comment,
 			name:        "Text",
@@ -789,6 +997,17 @@ func TestModelDeclaration(t *testing.T) {
 			structField: reflect.StructField{Type: reflect.TypeOf("")},
 		})
 
+		company.SetTableName("res_company")
+		company.fields.add(&Field{
+			model:       company,
+			name:        "Name",
+			json:        "name",
+			fieldType:   fieldtype.Char,
+			structField: reflect.StructField{Type: reflect.TypeOf("")},
+		})
+		company.AddPartialUniqueConstraint("name_active", []FieldName{Name}, company.Field(active).Equals(true),
+			"Active companies must have a unique name")
+
 		tag.fields.add(&Field{
 			model:       tag,
 			name:        "Name",
@@ -135,6 +135,10 @@ func TestFieldModification(t *testing.T) {
 		checkUpdates(nameField, "translate", true)
 		nameField.SetTranslate(false)
 		checkUpdates(nameField, "translate", false)
+		nameField.SetSearchType(TrigramSearch)
+		checkUpdates(nameField, "searchType", TrigramSearch)
+		nameField.SetSearchType(DefaultSearch)
+		checkUpdates(nameField, "searchType", DefaultSearch)
 		nameField.SetContexts(companyDependent)
 		lastUpdateShouldResemble(nameField, "contexts", companyDependent)
 		nameField.AddContexts(userDependent)
@@ -367,6 +371,16 @@ func TestBootStrap(t *testing.T) {
 	// Creating a manual sequence that must be loaded in the registry
 	dbExecuteNoTx(`CREATE SEQUENCE test_manseq INCREMENT BY 5 START WITH 1`)
 
+	// Registering data fixes that must be run only once, ordered by version
+	var dataFixRuns []string
+	for _, v := range []string{"0.10.0", "0.9.1", "0.10.0-rc10", "0.10.0-rc9"} {
+		version := v
+		RegisterDataFix("fix_"+version, version, func(env Environment) error {
+			dataFixRuns = append(dataFixRuns, version)
+			return nil
+		})
+	}
+
 	Convey("Database creation should run fine", t, func() {
 		Convey("Dummy table should exist", func() {
 			So(TestAdapter.tables(), ShouldContainKey, "shouldbedeleted")
@@ -405,6 +419,9 @@ func TestBootStrap(t *testing.T) {
 		})
 		Convey("All DB tables should have a model", func() {
 			for dbTable := range TestAdapter.tables() {
+				if dbTable == dataFixLogTable {
+					continue
+				}
 				So(Registry.registryByTableName, ShouldContainKey, dbTable)
 			}
 		})
@@ -412,6 +429,10 @@ func TestBootStrap(t *testing.T) {
 			So(TestAdapter.constraints("%_mancon"), ShouldHaveLength, 1)
 			So(TestAdapter.constraints("%_mancon")[0], ShouldEqual, "nums_premium_user_mancon")
 		})
+		Convey("Trigram indexes should have been created", func() {
+			So(TestAdapter.indexExists("post", "post_title_trgm_index"), ShouldBeTrue)
+			So(TestAdapter.indexExists("post", "post_content_trgm_index"), ShouldBeFalse)
+		})
 		Convey("Boot Sequence should be created", func() {
 			So(TestAdapter.sequences("%_bootseq"), ShouldHaveLength, 1)
 			So(TestAdapter.sequences("%_bootseq")[0].Name, ShouldEqual, "test_sequence_bootseq")
@@ -425,6 +446,26 @@ func TestBootStrap(t *testing.T) {
 			So(seq.Increment, ShouldEqual, 5)
 			So(seq.Start, ShouldEqual, 1)
 		})
+		Convey("Data fixes should have been run in version order", func() {
+			So(dataFixRuns, ShouldResemble, []string{"0.9.1", "0.10.0-rc9", "0.10.0-rc10", "0.10.0"})
+			var count int
+			dbGetNoTx(&count, fmt.Sprintf("SELECT COUNT(*) FROM %s", dataFixLogTable))
+			So(count, ShouldEqual, 4)
+		})
+		Convey("Pre-release versions should be compared semver-style", func() {
+			ordered := []string{"1.0.0-1", "1.0.0-2", "1.0.0-10", "1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.2",
+				"1.0.0-alpha.10", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-rc", "1.0.0-rc2", "1.0.0-rc10", "1.0.0"}
+			for i := 1; i < len(ordered); i++ {
+				v1, _ := parseSemVer(ordered[i-1])
+				v2, _ := parseSemVer(ordered[i])
+				So(v1.compare(v2), ShouldEqual, -1)
+				So(v2.compare(v1), ShouldEqual, 1)
+				So(v2.compare(v2), ShouldEqual, 0)
+			}
+		})
+		Convey("Registering a data fix with an invalid version should panic", func() {
+			So(func() { RegisterDataFix("invalid_fix", "1.a", func(env Environment) error { return nil }) }, ShouldPanic)
+		})
 		Convey("Applying DB modifications", func() {
 			UnBootStrap()
 			contentField := Registry.MustGet("Post").Fields().MustGet("Content")
@@ -445,11 +486,15 @@ func TestBootStrap(t *testing.T) {
 			})
 			textField := Registry.MustGet("Comment").Fields().MustGet("Text")
 			textField.SetFieldType(fieldtype.Text)
+			titleField := Registry.MustGet("Post").Fields().MustGet("Title")
+			titleField.SetSearchType(DefaultSearch)
 			So(BootStrap, ShouldNotPanic)
 			So(contentField.required, ShouldBeFalse)
 			So(profileField.required, ShouldBeFalse)
 			So(numsField.index, ShouldBeFalse)
 			So(SyncDatabase, ShouldNotPanic)
+			So(TestAdapter.indexExists("post", "post_title_trgm_index"), ShouldBeFalse)
+			So(dataFixRuns, ShouldHaveLength, 3)
 		})
 	})
 
@@ -15,10 +15,16 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/hexya-erp/hexya/src/models/operator"
 	"github.com/hexya-erp/hexya/src/models/security"
+	"github.com/hexya-erp/hexya/src/models/types"
+	"github.com/hexya-erp/hexya/src/models/types/dates"
+	"github.com/lib/pq"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -39,6 +45,7 @@ var (
 	active                   = fieldName{name: "Active", json: "active"}
 	isActive                 = fieldName{name: "IsActive", json: "is_active"}
 	isPremium                = fieldName{name: "IsPremium", json: "is_premium"}
+	premiumNums              = fieldName{name: "PremiumNums", json: "premium_nums"}
 	decoratedName            = fieldName{name: "DecoratedName", json: "decorated_name"}
 	displayName              = fieldName{name: "DisplayName", json: "display_name"}
 	writerAge                = fieldName{name: "WriterAge", json: "writer_age"}
@@ -78,6 +85,11 @@ var (
 	descriptionHexyaContexts = fieldName{name: "DescriptionHexyaContexts", json: "description_hexya_contexts"}
 	lastupdate               = fieldName{name: "LastUpdate", json: "__last_update"}
 	createDate               = fieldName{name: "CreateDate", json: "create_date"}
+	checkedAt                = fieldName{name: "CheckedAt", json: "checked_at"}
+	read                     = fieldName{name: "Read", json: "read"}
+	lastRead                 = fieldName{name: "LastRead", json: "last_read"}
+	keywords                 = fieldName{name: "Keywords", json: "keywords"}
+	originalTitle            = fieldName{name: "OriginalTitle", json: "original_title"}
 	writeDate                = fieldName{name: "WriteDate", json: "write_date"}
 	parent                   = fieldName{name: "Parent", json: "parent_id"}
 	value                    = fieldName{name: "Value", json: "value"}
@@ -85,6 +97,9 @@ var (
 	size                     = fieldName{name: "Size", json: "size"}
 	hexyaVersion             = fieldName{name: "HexyaVersion", json: "hexya_version"}
 	hexyaExternalID          = fieldName{name: "HexyaExternalID", json: "hexya_external_id"}
+	document                 = fieldName{name: "Document", json: "document"}
+	company                  = fieldName{name: "Company", json: "company_id"}
+	commentPost              = fieldName{name: "Post", json: "post_id"}
 )
 
 func TestConditions(t *testing.T) {
@@ -222,12 +237,31 @@ func TestConditions(t *testing.T) {
 					So(sql, ShouldEqual, `"user".name = ?`)
 					So(args, ShouldContain, "John")
 				})
+				Convey("In with subquery", func() {
+					profileModel := env.Pool("Profile").Model()
+					rs = rs.Search(rs.Model().Field(profile).In(profileModel.SubqueryIds(profileModel.Field(age).Greater(12))))
+					sql, args := rs.query.sqlWhereClause(true)
+					So(sql, ShouldEqual, `WHERE "user".profile_id IN (SELECT DISTINCT ON ("profile".id) "profile".id AS id FROM "profile" "profile"  WHERE "profile".age > ? ORDER BY "profile".id )`)
+					So(args, ShouldContain, 12)
+				})
 				Convey("NotEquals", func() {
 					rs = rs.Search(rs.Model().Field(Name).NotEquals("John"))
 					sql, args := rs.query.sqlWhereClause(true)
 					So(sql, ShouldEqual, `WHERE ("user".name IS NULL OR "user".name != ?)`)
 					So(args, ShouldContain, "John")
 				})
+				Convey("NotEquals with strict NULL comparison", func() {
+					rs = rs.WithContext("hexya_strict_null_comparison", true).Search(rs.Model().Field(Name).NotEquals("John"))
+					sql, args := rs.query.sqlWhereClause(true)
+					So(sql, ShouldEqual, `WHERE "user".name != ?`)
+					So(args, ShouldContain, "John")
+				})
+				Convey("NotEquals without environment", func() {
+					cond := rs.Model().Field(Name).NotEquals("John")
+					sql, args := newQuery(InvalidRecordCollection("User")).conditionSQLClause(cond)
+					So(sql, ShouldContainSubstring, `"user".name IS NULL OR "user".name != ?`)
+					So(args, ShouldContain, "John")
+				})
 				Convey("Greater", func() {
 					rs = rs.Search(rs.Model().Field(nums).Greater(12))
 					sql, args := rs.query.sqlWhereClause(true)
@@ -330,9 +364,113 @@ func TestConditions(t *testing.T) {
 					So(sql, ShouldEqual, `SELECT * FROM (SELECT DISTINCT ON ("user".id) "user".name AS name FROM "user" "user"  WHERE "user".id = ? ORDER BY "user".id ) foo  `)
 					So(args, ShouldContain, 101)
 				})
+				Convey("In ids or child of without parent field", func() {
+					rs = rs.Search(rs.Model().Field(ID).InIdsOrChildOf([]int64{101, 102}))
+					sql, args, _ := rs.query.selectQuery([]FieldName{Name})
+					So(sql, ShouldEqual, `SELECT * FROM (SELECT DISTINCT ON ("user".id) "user".name AS name FROM "user" "user"  WHERE "user".id IN (?) ORDER BY "user".id ) foo  `)
+					So(args, ShouldContain, []int64{101, 102})
+				})
+				Convey("Array contains", func() {
+					posts := env.Pool("Post")
+					posts = posts.Search(posts.Model().Field(keywords).Contains("go"))
+					sql, args := posts.query.sqlWhereClause(true)
+					So(sql, ShouldEqual, `WHERE "post".keywords @> ?`)
+					So(args, ShouldContain, types.StringArray{"go"})
+				})
+				Convey("Array contains all", func() {
+					posts := env.Pool("Post")
+					posts = posts.Search(posts.Model().Field(keywords).ContainsAll([]string{"go", "sql"}))
+					sql, args := posts.query.sqlWhereClause(true)
+					So(sql, ShouldEqual, `WHERE "post".keywords @> ?`)
+					So(args, ShouldContain, types.StringArray{"go", "sql"})
+				})
+				Convey("Array overlaps", func() {
+					posts := env.Pool("Post")
+					posts = posts.Search(posts.Model().Field(keywords).Overlaps(types.StringArray{"go", "sql"}))
+					sql, args := posts.query.sqlWhereClause(true)
+					So(sql, ShouldEqual, `WHERE "post".keywords && ?`)
+					So(args, ShouldContain, types.StringArray{"go", "sql"})
+				})
+				Convey("Array operators on other fields should panic", func() {
+					rs = rs.Search(rs.Model().Field(Name).Overlaps([]string{"John"}))
+					So(func() { rs.query.sqlWhereClause(true) }, ShouldPanic)
+				})
+				Convey("Custom operator", func() {
+					if !operator.Operator("~*").IsValid() {
+						RegisterOperator("~*", "~* ?", false)
+					}
+					rs = rs.Search(rs.Model().Field(Name).AddOperator("~*", "^jo"))
+					sql, args := rs.query.sqlWhereClause(true)
+					So(sql, ShouldEqual, `WHERE "user".name ~* ?`)
+					So(args, ShouldContain, "^jo")
+				})
+				Convey("Custom multi operator", func() {
+					if !operator.Operator("= ANY").IsValid() {
+						RegisterOperator("= ANY", "= ANY(?)", true)
+					}
+					rs = rs.Search(rs.Model().Field(Name).AddOperator("= ANY", []string{"John", "Jane"}))
+					sql, args := rs.query.sqlWhereClause(true)
+					So(sql, ShouldEqual, `WHERE "user".name = ANY(?)`)
+					So(args, ShouldHaveLength, 1)
+					So(args, ShouldContain, pq.Array([]string{"John", "Jane"}))
+				})
+				Convey("Condition tree", func() {
+					ct := env.Pool("User").Model().NewConditionTree()
+					root := ct.Group(And,
+						ct.Leaf(Name, operator.Equals, "John"),
+						ct.Group(Or,
+							ct.Leaf(age, operator.Greater, 12),
+							ct.Group(And,
+								ct.Leaf(email, operator.IContains, "example.com"),
+								ct.Leaf(profileAge, operator.GreaterOrEqual, 18))))
+					rs = env.Pool("User").Search(ct.Compile(root))
+					sql, args := rs.query.sqlWhereClause(true)
+					So(sql, ShouldEqual, `WHERE ("user".name = ?) AND (("user".age > ?) OR (("user".email ILIKE ?) AND ("user__profile".age >= ?)))`)
+					So(args, ShouldHaveLength, 4)
+					So(args, ShouldContain, "John")
+					So(args, ShouldContain, "%example.com%")
+					So(func() { ct.Compile(ct.Group("XOR", ct.Leaf(Name, operator.Equals, "John"))) }, ShouldPanic)
+					So(func() { ct.Compile(ct.Leaf(title, operator.Equals, "foo")) }, ShouldPanic)
+					So(func() { ct.Compile(ct.Leaf(Name, operator.ContainsAll, []string{"John"})) }, ShouldPanic)
+					So(func() { ct.Compile(ct.Leaf(age, operator.Equals, "twelve")) }, ShouldPanic)
+					So(func() { ct.Compile(ct.Leaf(age, operator.In, 12)) }, ShouldPanic)
+				})
+				Convey("Relative date ranges", func() {
+					posts := env.Pool("Post").WithContext("tz", "UTC")
+					posts = posts.Search(posts.Model().Field(lastRead).Today())
+					sql, args := posts.query.sqlWhereClause(true)
+					So(sql, ShouldEqual, `WHERE "post".last_read >= ? AND "post".last_read < ?`)
+					now := time.Now().UTC()
+					today := dates.Date{Time: time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)}
+					So(args, ShouldHaveLength, 2)
+					So(args[0], ShouldResemble, today)
+					So(args[1], ShouldResemble, today.AddDate(0, 0, 1))
+				})
 			}), ShouldBeNil)
 		}
 	})
+	Convey("Testing relative date bounds across timezones", t, func() {
+		now := time.Date(2019, 12, 31, 23, 30, 0, 0, time.UTC)
+		Convey("Date fields should use the current day of the timezone", func() {
+			start, end := dateRangeBounds(now, "UTC", todayRange, false)
+			So(start, ShouldResemble, dates.ParseDate("2019-12-31"))
+			So(end, ShouldResemble, dates.ParseDate("2020-01-01"))
+			start, end = dateRangeBounds(now, "Europe/Paris", todayRange, false)
+			So(start, ShouldResemble, dates.ParseDate("2020-01-01"))
+			So(end, ShouldResemble, dates.ParseDate("2020-01-02"))
+			start, end = dateRangeBounds(now, "UTC", lastNDaysRange(7), false)
+			So(start, ShouldResemble, dates.ParseDate("2019-12-25"))
+			So(end, ShouldResemble, dates.ParseDate("2020-01-01"))
+		})
+		Convey("Datetime fields should be bounded by midnight in the timezone", func() {
+			start, end := dateRangeBounds(now, "Europe/Paris", thisYearRange, true)
+			So(start.(dates.DateTime).Equal(dates.ParseDateTime("2019-12-31 23:00:00")), ShouldBeTrue)
+			So(end.(dates.DateTime).Equal(dates.ParseDateTime("2020-12-31 23:00:00")), ShouldBeTrue)
+			start, end = dateRangeBounds(now, "America/New_York", thisMonthRange, true)
+			So(start.(dates.DateTime).Equal(dates.ParseDateTime("2019-12-01 05:00:00")), ShouldBeTrue)
+			So(end.(dates.DateTime).Equal(dates.ParseDateTime("2020-01-01 05:00:00")), ShouldBeTrue)
+		})
+	})
 	Convey("Testing Condition Methods", t, func() {
 		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
 			cond := env.Pool("User").Model().Field(Name).IContains("Jane")
@@ -394,5 +532,45 @@ func TestConditionSerialization(t *testing.T) {
 			dom := cond.Serialize()
 			So(fmt.Sprint(dom), ShouldEqual, "[& | [C = C Value] | [B = B Value] [A = A Value] [D = D Value]]")
 		})
+		Convey("Testing existence conditions on to-many fields", func() {
+			cond := newCondition().And().Any(posts, newCondition().And().Field(title).Equals("1st Post"))
+			So(fmt.Sprint(cond.Serialize()), ShouldEqual, "[[posts_ids any [[title = 1st Post]]]]")
+			cond = newCondition().And().None(joinFieldNames([]FieldName{profile, posts}, ExprSep), nil).
+				Or().Field(Name).Equals("John")
+			So(fmt.Sprint(cond.Serialize()), ShouldEqual, "[| [name = John] [profile_id.posts_ids not any []]]")
+			data, err := json.Marshal(newCondition().And().Any(tags, nil).Serialize())
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, `[["tags_ids","any",[]]]`)
+		})
+	})
+	Convey("Testing condition walking", t, func() {
+		aOrB := newCondition().And().Field(a).Equals("A Value").Or().Field(b).Equals("B Value")
+		cOrD := newCondition().And().Field(c).Equals("C Value").OrNot().Field(d).Equals("D Value")
+		cond := newCondition().AndCond(aOrB).AndNotCond(newCondition().AndCond(cOrD)).Or().Field(f).In([]int64{1, 2})
+		var preds []Predicate
+		cond.Walk(func(p Predicate) {
+			preds = append(preds, p)
+		})
+		So(preds, ShouldHaveLength, 5)
+		var fields []string
+		for _, p := range preds {
+			fields = append(fields, p.Field().Name())
+		}
+		So(fields, ShouldResemble, []string{"A", "B", "C", "D", "F"})
+		So(preds[1].Operator(), ShouldEqual, operator.Equals)
+		So(preds[1].Argument(), ShouldEqual, "B Value")
+		So(preds[1].IsOr(), ShouldBeTrue)
+		So(preds[1].Depth(), ShouldEqual, 1)
+		So(preds[1].Parent().IsGroup(), ShouldBeTrue)
+		So(preds[1].Parent().IsNot(), ShouldBeFalse)
+		So(preds[3].IsOr(), ShouldBeTrue)
+		So(preds[3].IsNot(), ShouldBeTrue)
+		So(preds[3].Depth(), ShouldEqual, 2)
+		So(preds[3].Parent().Parent().IsNot(), ShouldBeTrue)
+		So(preds[4].Operator(), ShouldEqual, operator.In)
+		So(preds[4].Argument(), ShouldResemble, []int64{1, 2})
+		So(preds[4].IsOr(), ShouldBeTrue)
+		So(preds[4].Depth(), ShouldEqual, 0)
+		So(preds[4].Parent(), ShouldBeNil)
 	})
 }
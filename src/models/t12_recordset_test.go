@@ -15,10 +15,17 @@
 package models
 
 import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/hexya-erp/hexya/src/models/security"
+	"github.com/hexya-erp/hexya/src/models/types"
+	"github.com/hexya-erp/hexya/src/models/types/dates"
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/ugorji/go/codec"
 )
 
 func TestCreateRecordSet(t *testing.T) {
@@ -40,6 +47,14 @@ func TestCreateRecordSet(t *testing.T) {
 				So(users.Get(ID), ShouldBeGreaterThan, 0)
 				So(users.Get(resume).(RecordSet).IsEmpty(), ShouldBeFalse)
 			})
+			Convey("Creating a user with Model.Create and invalid data should panic", func() {
+				So(func() { userModel.Create(env, nil) }, ShouldPanic)
+				So(func() { userModel.Create(env, (*ModelData)(nil)) }, ShouldPanic)
+				So(func() { userModel.Create(env, NewModelData(tagModel).Set(Name, "Wrong")) }, ShouldPanic)
+				users := userModel.Create(env, NewModelData(userModel).Set(Name, "Typed User").Set(email, "typed@example.com"))
+				So(users.Len(), ShouldEqual, 1)
+				So(users.Get(Name), ShouldEqual, "Typed User")
+			})
 			Convey("Creating user Jane with related Profile and Posts and Tags and Comments", func() {
 				tag1 := env.Pool("Tag").Call("Create", NewModelData(tagModel, FieldMap{
 					"Name": "Trending",
@@ -260,6 +275,38 @@ func TestCreateRecordSet(t *testing.T) {
 		}), ShouldBeNil)
 	})
 	security.Registry.UnregisterGroup(group1)
+	groupACL := security.Registry.NewGroup("group_acl", "Group ACL")
+	Convey("Testing declared model access rights", t, func() {
+		So(SimulateInNewEnvironment(2, func(env Environment) {
+			security.Registry.AddMembership(2, groupACL)
+			commentModel := Registry.MustGet("Comment")
+			commentData := NewModelData(commentModel, FieldMap{"Text": "ACL comment"})
+			Convey("CRUD methods should be denied by default", func() {
+				So(env.Pool("Comment").CheckAccessRights(security.Create, true), ShouldBeFalse)
+				So(func() { env.Pool("Comment").CheckAccessRights(security.Create) }, ShouldPanic)
+				So(func() { env.Pool("Comment").Call("Create", commentData) }, ShouldPanic)
+			})
+			Convey("A user without create access should be blocked from Create", func() {
+				commentModel.AddAccessRights(groupACL, security.Read|security.Write)
+				So(commentModel.AccessRights(groupACL), ShouldEqual, security.Read|security.Write)
+				So(env.Pool("Comment").CheckAccessRights(security.Read|security.Write, true), ShouldBeTrue)
+				So(env.Pool("Comment").CheckAccessRights(security.Create, true), ShouldBeFalse)
+				So(func() { env.Pool("Comment").Call("Create", commentData) }, ShouldPanic)
+			})
+			Convey("Granting create access should allow Create", func() {
+				commentModel.AddAccessRights(groupACL, security.Create)
+				So(env.Pool("Comment").CheckAccessRights(security.Create|security.Read, true), ShouldBeTrue)
+				comment := env.Pool("Comment").Call("Create", commentData).(RecordSet).Collection()
+				So(comment.Get(commentModel.FieldName("Text")), ShouldEqual, "ACL comment")
+			})
+			Convey("Removing access rights should deny methods again", func() {
+				commentModel.RemoveAccessRights(groupACL, security.All)
+				So(commentModel.AccessRights(groupACL), ShouldEqual, 0)
+				So(env.Pool("Comment").CheckAccessRights(security.Read, true), ShouldBeFalse)
+			})
+		}), ShouldBeNil)
+	})
+	security.Registry.UnregisterGroup(groupACL)
 }
 
 func TestSearchRecordSet(t *testing.T) {
@@ -341,11 +388,96 @@ func TestSearchRecordSet(t *testing.T) {
 				So(recs[1].Get(city), ShouldEqual, "")
 				So(recs[2].Get(city), ShouldEqual, "")
 			})
+			Convey("Testing eager loading of related fields with With", func() {
+				postModel := Registry.MustGet("Post")
+				userModel := Registry.MustGet("User")
+				posts := env.Pool("Post").SearchAll().With(user, Name, email)
+				posts.Fetch()
+				So(posts.Len(), ShouldBeGreaterThan, 0)
+				So(env.cache.checkIfInCache(postModel, posts.Ids(), []string{"user_id"}, "", true), ShouldBeTrue)
+				var userIds []int64
+				for _, id := range posts.Ids() {
+					if uid, ok := env.cache.get(postModel, id, "user_id", "").(int64); ok && uid != 0 {
+						userIds = append(userIds, uid)
+					}
+				}
+				So(userIds, ShouldNotBeEmpty)
+				So(env.cache.checkIfInCache(userModel, userIds, []string{"name", "email"}, "", true), ShouldBeTrue)
+				recs := posts.Records()
+				So(recs[0].Get(user).(RecordSet).Collection().Get(Name), ShouldNotBeBlank)
+				So(func() { env.Pool("Post").With(title) }, ShouldPanic)
+				So(func() { env.Pool("Post").With(tags, Name) }, ShouldPanic)
+				So(func() { env.Pool("Post").With(user, NewFieldName("Unknown", "unknown")) }, ShouldPanic)
+				So(func() { env.Pool("Post").With(user, decoratedName) }, ShouldPanic)
+			})
+			Convey("Testing that With avoids one query per related record", func() {
+				readWriterNames := func(env Environment, posts *RecordCollection) int {
+					before := env.QueryStats().Count
+					for _, rec := range posts.Records() {
+						rec.Get(user).(RecordSet).Collection().Get(Name)
+					}
+					return env.QueryStats().Count - before
+				}
+				lazyEnv := env
+				lazyEnv.cache = newCache()
+				before := lazyEnv.QueryStats().Count
+				lazyPosts := lazyEnv.Pool("Post").SearchAll().Load(ID, user)
+				So(lazyPosts.Len(), ShouldBeGreaterThan, 1)
+				lazyQueries := lazyEnv.QueryStats().Count - before + readWriterNames(lazyEnv, lazyPosts)
+				eagerEnv := env
+				eagerEnv.cache = newCache()
+				eagerPosts := eagerEnv.Pool("Post").SearchAll().With(user, Name)
+				before = eagerEnv.QueryStats().Count
+				eagerPosts.Fetch()
+				eagerQueries := eagerEnv.QueryStats().Count - before + readWriterNames(eagerEnv, eagerPosts)
+				So(eagerQueries, ShouldEqual, 1)
+				So(eagerQueries, ShouldBeLessThan, lazyQueries)
+			})
 			Convey("Testing browse with empty ids", func() {
 				var ids []int64
 				users := env.Pool("User").Model().Browse(env, ids)
 				So(users.Len(), ShouldEqual, 0)
 			})
+			Convey("Testing NULL rows with negative operators", func() {
+				userModel := Registry.MustGet("User")
+				noName := env.Pool("User").Call("Create", NewModelData(userModel, FieldMap{
+					"Email": "noname@example.com",
+				})).(RecordSet).Collection()
+				users := env.Pool("User").Search(userModel.Field(Name).NotEquals("John Smith"))
+				So(users.Len(), ShouldEqual, 3)
+				So(users.Intersect(noName).Len(), ShouldEqual, 1)
+				users = env.Pool("User").WithContext("hexya_strict_null_comparison", true).
+					Search(userModel.Field(Name).NotEquals("John Smith"))
+				So(users.Len(), ShouldEqual, 2)
+				So(users.Intersect(noName).Len(), ShouldEqual, 0)
+			})
+			Convey("Testing view structs", func() {
+				type userContact struct {
+					ID      int64
+					Name    string
+					Email   string
+					Profile int64
+				}
+				userJane := env.Pool("User").Search(env.Pool("User").Model().Field(Name).Equals("Jane Smith"))
+				query, _, _ := userJane.viewStructQuery(userJane.model.viewStructs["Contact"])
+				So(query, ShouldContainSubstring, `"user".name AS name`)
+				So(query, ShouldContainSubstring, `"user".email AS email`)
+				So(query, ShouldContainSubstring, `"user".profile_id AS profile_id`)
+				So(query, ShouldNotContainSubstring, `"user".education`)
+				So(query, ShouldNotContainSubstring, `"user".nums`)
+				var res []userContact
+				userJane.ReadViewStruct("Contact", &res)
+				So(res, ShouldHaveLength, 1)
+				So(res[0].ID, ShouldEqual, userJane.ids[0])
+				So(res[0].Name, ShouldEqual, "Jane Smith")
+				So(res[0].Email, ShouldEqual, "jane.smith@example.com")
+				So(res[0].Profile, ShouldEqual, userJane.Get(profile).(RecordSet).Collection().ids[0])
+				var empty []userContact
+				env.Pool("User").ReadViewStruct("Contact", &empty)
+				So(empty, ShouldBeEmpty)
+				So(func() { userJane.ReadViewStruct("Unknown", &res) }, ShouldPanic)
+				So(func() { userJane.ReadViewStruct("Contact", res) }, ShouldPanic)
+			})
 		}), ShouldBeNil)
 	})
 	group1 := security.Registry.NewGroup("group1", "Group 1")
@@ -457,6 +589,20 @@ func TestAdvancedQueries(t *testing.T) {
 						And().Field(isStaff).Equals(false))
 				So(users.Len(), ShouldEqual, 0)
 			})
+			Convey("Condition on m2o relation fields with subquery", func() {
+				profileModel := env.Pool("Profile").Model()
+				profileID := jane.Get(profile).(RecordSet).Collection().Get(ID).(int64)
+				sq := profileModel.SubqueryIds(profileModel.Field(ID).Equals(profileID))
+				users := env.Pool("User").Search(env.Pool("User").Model().Field(profile).In(sq))
+				So(users.Len(), ShouldEqual, 1)
+				So(users.Get(ID).(int64), ShouldEqual, jane.Get(ID).(int64))
+				users = env.Pool("User").Search(env.Pool("User").Model().Field(profile).NotIn(sq))
+				So(users.Len(), ShouldEqual, 2)
+				postModel := env.Pool("Post").Model()
+				So(func() {
+					env.Pool("User").Search(env.Pool("User").Model().Field(profile).In(postModel.SubqueryIds(postModel.Field(title).Equals("1st Post")))).Fetch()
+				}, ShouldPanic)
+			})
 			Convey("M2O chain", func() {
 				users := env.Pool("User").Search(env.Pool("User").Model().Field(profileBestPostTitle).Equals("1st Post"))
 				So(users.Len(), ShouldEqual, 1)
@@ -493,6 +639,13 @@ func TestAdvancedQueries(t *testing.T) {
 				So(users.Len(), ShouldEqual, 1)
 				So(users.Get(ID).(int64), ShouldEqual, jane.Get(ID).(int64))
 			})
+			Convey("Condition on o2m relation with IN operator and subquery", func() {
+				postModel := env.Pool("Post").Model()
+				users := env.Pool("User").Search(env.Pool("User").Model().Field(posts).In(
+					postModel.SubqueryIds(postModel.Field(title).Equals("1st Post"))))
+				So(users.Len(), ShouldEqual, 1)
+				So(users.Get(ID).(int64), ShouldEqual, jane.Get(ID).(int64))
+			})
 			Convey("Conditions on o2m relation with IN operator and recordset", func() {
 				janePosts := jane.Get(posts).(RecordSet).Collection()
 				users := env.Pool("User").Search(env.Pool("User").Model().Field(posts).In(janePosts))
@@ -554,6 +707,23 @@ func TestAdvancedQueries(t *testing.T) {
 				So(rPosts.Len(), ShouldEqual, 1)
 				So(rPosts.Get(ID).(int64), ShouldEqual, post1.Get(ID).(int64))
 			})
+			Convey("Reading a m2m relation with archived members and active_test disabled", func() {
+				tag2.Set(active, false)
+				post2Tags := post2.WithContext("active_test", false).Get(tags).(RecordSet).Collection()
+				So(post2Tags.Len(), ShouldEqual, 2)
+				So(post2Tags.Intersect(tag2).Len(), ShouldEqual, 1)
+				So(post2Tags.Env().Context().HasKey("active_test"), ShouldBeTrue)
+			})
+			Convey("Reading a m2m relation with a context for the relation only", func() {
+				tag2.Set(active, false)
+				post2Tags := post2.RelationWithContext(tags, map[string]interface{}{"active_test": false})
+				So(post2Tags.Len(), ShouldEqual, 2)
+				So(post2Tags.Intersect(tag2).Len(), ShouldEqual, 1)
+				So(post2Tags.Env().Context().GetBool("active_test"), ShouldBeFalse)
+				So(post2Tags.Env().Context().HasKey("active_test"), ShouldBeTrue)
+				So(post2.Env().Context().HasKey("active_test"), ShouldBeFalse)
+				So(func() { post2.RelationWithContext(title, nil) }, ShouldPanic)
+			})
 		}), ShouldBeNil)
 	})
 	Convey("Testing advanced queries with multiple joins", t, func() {
@@ -572,6 +742,679 @@ func TestAdvancedQueries(t *testing.T) {
 			})
 		}), ShouldBeNil)
 	})
+	Convey("Testing conditions built from record ids", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("User")
+			smiths := users.Search(users.Model().Field(Name).Contains("Smith"))
+			So(users.Search(smiths.IdsCondition()).Equals(smiths), ShouldBeTrue)
+			jane := users.Search(smiths.IdsCondition().And().Field(email).Equals("jane.smith@example.com"))
+			So(jane.Len(), ShouldEqual, 1)
+			So(jane.Get(Name), ShouldEqual, "Jane Smith")
+			So(users.Search(users.IdsCondition()).IsEmpty(), ShouldBeTrue)
+		}), ShouldBeNil)
+	})
+	Convey("Testing company consistency of relations", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			companyModel := Registry.MustGet("Company")
+			commentModel := Registry.MustGet("Comment")
+			companyA := env.Pool("Company").Call("Create", NewModelData(companyModel).Set(Name, "Company A")).(RecordSet).Collection()
+			companyB := env.Pool("Company").Call("Create", NewModelData(companyModel).Set(Name, "Company B")).(RecordSet).Collection()
+			post := env.Pool("Post").Search(env.Pool("Post").Model().Field(title).Equals("1st Post"))
+			So(post.Len(), ShouldEqual, 1)
+			Convey("Linking a record without company should always work", func() {
+				comment := env.Pool("Comment").Call("Create", NewModelData(commentModel).
+					Set(text, "Shared post comment").
+					Set(company, companyB).
+					Set(commentPost, post)).(RecordSet).Collection()
+				So(comment.Get(commentPost).(RecordSet).Collection().Equals(post), ShouldBeTrue)
+			})
+			Convey("Linking a record of the same company should work", func() {
+				post.Set(company, companyA)
+				comment := env.Pool("Comment").Call("Create", NewModelData(commentModel).
+					Set(text, "Same company comment").
+					Set(company, companyA).
+					Set(commentPost, post)).(RecordSet).Collection()
+				So(comment.Get(commentPost).(RecordSet).Collection().Equals(post), ShouldBeTrue)
+				Convey("Changing the company of the record should be checked", func() {
+					So(func() { comment.Set(company, companyB) }, ShouldPanic)
+				})
+			})
+			Convey("Linking a record of another company should panic", func() {
+				post.Set(company, companyA)
+				So(func() {
+					env.Pool("Comment").Call("Create", NewModelData(commentModel).
+						Set(text, "Cross company comment").
+						Set(company, companyB).
+						Set(commentPost, post))
+				}, ShouldPanic)
+				So(func() {
+					env.Pool("Comment").Call("Create", NewModelData(commentModel).
+						Set(text, "No company comment").
+						Set(commentPost, post))
+				}, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing models mapped on a custom table name", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			companyModel := Registry.MustGet("Company")
+			So(companyModel.TableName(), ShouldEqual, "res_company")
+			So(Registry.MustGet("res_company"), ShouldEqual, companyModel)
+			env.Pool("Company").Call("Create", NewModelData(companyModel).Set(Name, "Legacy Company"))
+			var count int
+			env.Cr().Get(&count, `SELECT COUNT(*) FROM res_company WHERE name = ?`, "Legacy Company")
+			So(count, ShouldEqual, 1)
+			legacy := env.Pool("Company").Search(companyModel.Field(Name).Equals("Legacy Company"))
+			So(legacy.Len(), ShouldEqual, 1)
+			So(legacy.Get(Name), ShouldEqual, "Legacy Company")
+			So(func() { companyModel.SetTableName("company") }, ShouldPanic)
+		}), ShouldBeNil)
+	})
+	Convey("Testing partial unique constraints", t, func() {
+		companyModel := Registry.MustGet("Company")
+		Convey("Archived companies may share the name of an active one", func() {
+			So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				env.Pool("Company").Call("Create", NewModelData(companyModel).Set(Name, "Unique Company"))
+				env.Pool("Company").Call("Create", NewModelData(companyModel).Set(Name, "Unique Company").Set(active, false))
+				env.Pool("Company").Call("Create", NewModelData(companyModel).Set(Name, "Unique Company").Set(active, false))
+				archived := env.Pool("Company").WithContext("active_test", false).Search(
+					companyModel.Field(Name).Equals("Unique Company"))
+				So(archived.Len(), ShouldEqual, 3)
+			}), ShouldBeNil)
+		})
+		Convey("Active companies must have a unique name", func() {
+			err := SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				env.Pool("Company").Call("Create", NewModelData(companyModel).Set(Name, "Unique Company"))
+				env.Pool("Company").Call("Create", NewModelData(companyModel).Set(Name, "Unique Company"))
+			})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "pq: Active companies must have a unique name")
+		})
+		Convey("Changed partial unique constraints should be recreated", func() {
+			indexName := "name_active_company_uniqidx"
+			index := companyModel.partialUniques[indexName]
+			So(TestAdapter.indexComment(indexName), ShouldEqual, partialUniqueIndexSQL(companyModel, index))
+			changed := index
+			changed.cond = companyModel.Field(active).Equals(true).And().Field(Name).NotEquals("Shared Company")
+			companyModel.partialUniques[indexName] = changed
+			updateDBPartialUniqueIndexes(companyModel)
+			So(TestAdapter.indexComment(indexName), ShouldEqual, partialUniqueIndexSQL(companyModel, changed))
+			companyModel.partialUniques[indexName] = index
+			updateDBPartialUniqueIndexes(companyModel)
+			So(TestAdapter.indexComment(indexName), ShouldEqual, partialUniqueIndexSQL(companyModel, index))
+		})
+	})
+	Convey("Testing navigation to the next and previous records", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("User").SearchAll().OrderBy("Name", "ID").Records()
+			So(len(users), ShouldBeGreaterThan, 2)
+			Convey("Next and Previous should follow the given order", func() {
+				for i, user := range users {
+					if i < len(users)-1 {
+						So(user.Next("Name").Equals(users[i+1]), ShouldBeTrue)
+					}
+					if i > 0 {
+						So(user.Previous("Name").Equals(users[i-1]), ShouldBeTrue)
+					}
+				}
+			})
+			Convey("Descending orders should be reversed", func() {
+				So(users[1].Next("Name desc, ID desc").Equals(users[0]), ShouldBeTrue)
+				So(users[0].Previous("Name desc, ID desc").Equals(users[1]), ShouldBeTrue)
+			})
+			Convey("Next and Previous should be empty at the boundaries", func() {
+				So(users[len(users)-1].Next("Name").IsEmpty(), ShouldBeTrue)
+				So(users[0].Previous("Name").IsEmpty(), ShouldBeTrue)
+				So(users[0].Next("Name desc, ID desc").IsEmpty(), ShouldBeTrue)
+			})
+			Convey("Next should panic on non singletons", func() {
+				So(func() { env.Pool("User").SearchAll().Next("Name") }, ShouldPanic)
+			})
+			Convey("Next and Previous should stay in the RecordSet the record comes from", func() {
+				subset := env.Pool("User").Search(env.Pool("User").Model().Field(ID).In([]int64{users[0].Ids()[0], users[2].Ids()[0]})).OrderBy("Name", "ID").Records()
+				So(subset, ShouldHaveLength, 2)
+				So(subset[0].Next("Name").Equals(users[2]), ShouldBeTrue)
+				So(subset[1].Previous("Name").Equals(users[0]), ShouldBeTrue)
+				So(subset[1].Next("Name").IsEmpty(), ShouldBeTrue)
+			})
+			Convey("Next and Previous should follow the database order with NULL values", func() {
+				env.cr.Execute(`UPDATE "user" SET email2 = NULL`)
+				env.cr.Execute(`UPDATE "user" SET email2 = 'a' WHERE id = ?`, users[2].Ids()[0])
+				env.cr.Execute(`UPDATE "user" SET email2 = '' WHERE id = ?`, users[1].Ids()[0])
+				for _, user := range users {
+					env.cache.invalidateRecord(user.model, user.Ids()[0])
+				}
+				ordered := env.Pool("User").SearchAll().OrderBy("Email2", "ID").Records()
+				So(ordered[0].Equals(users[1]), ShouldBeTrue)
+				So(ordered[1].Equals(users[2]), ShouldBeTrue)
+				for i, user := range ordered {
+					if i < len(ordered)-1 {
+						So(user.Next("Email2").Equals(ordered[i+1]), ShouldBeTrue)
+					} else {
+						So(user.Next("Email2").IsEmpty(), ShouldBeTrue)
+					}
+					if i > 0 {
+						So(user.Previous("Email2").Equals(ordered[i-1]), ShouldBeTrue)
+					} else {
+						So(user.Previous("Email2").IsEmpty(), ShouldBeTrue)
+					}
+				}
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing iteration over records by batches", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("User")
+			all := users.SearchAll().OrderBy("ID")
+			So(all.Len(), ShouldBeGreaterThan, 2)
+			Convey("Iterate should return all matching records in ID order", func() {
+				next := users.Iterate(newCondition(), 2)
+				var ids []int64
+				for data, ok := next(); ok; data, ok = next() {
+					ids = append(ids, data.Get(ID).(int64))
+					So(data.Get(Name), ShouldNotBeBlank)
+				}
+				So(ids, ShouldResemble, all.Ids())
+				_, ok := next()
+				So(ok, ShouldBeFalse)
+			})
+			Convey("Iterate should not fill the cache of the environment", func() {
+				tags := env.Pool("Tag")
+				cond := tags.Model().Field(Name).IsNotNull()
+				next := tags.Iterate(cond, 1)
+				var count int
+				for _, ok := next(); ok; _, ok = next() {
+					count++
+				}
+				So(count, ShouldEqual, tags.Search(cond).SearchCount())
+				So(env.cache.data["Tag"], ShouldBeEmpty)
+			})
+			Convey("Iterating a large table should stay within a memory budget", func() {
+				tags := env.Pool("Tag")
+				tagModel := Registry.MustGet("Tag")
+				payload := strings.Repeat("x", 8192)
+				for i := 0; i < 500; i++ {
+					tags.Call("Create", NewModelData(tagModel).
+						Set(Name, fmt.Sprintf("Bulk Tag %d", i)).
+						Set(description, fmt.Sprintf("%s %d", payload, i)))
+				}
+				env.Flush()
+				heapAlloc := func() uint64 {
+					var stats runtime.MemStats
+					runtime.GC()
+					runtime.ReadMemStats(&stats)
+					return stats.HeapAlloc
+				}
+				base := heapAlloc()
+				var count int
+				var peak uint64
+				next := tags.Iterate(tags.Model().Field(Name).Like("Bulk Tag %"), 20)
+				for data, ok := next(); ok; data, ok = next() {
+					count++
+					So(len(data.Get(description).(string)), ShouldBeGreaterThan, len(payload))
+					if count%20 == 0 {
+						if used := heapAlloc(); used > base && used-base > peak {
+							peak = used - base
+						}
+					}
+				}
+				So(count, ShouldEqual, 500)
+				// The whole result set holds 4MB of descriptions,
+				// whereas only one batch of 20 should be in memory at once.
+				So(peak, ShouldBeLessThan, 1<<20)
+			})
+			Convey("Iterate should panic with a non positive batch size", func() {
+				So(func() { users.Iterate(newCondition(), 0) }, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing streamed search read by batches", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			tagModel := Registry.MustGet("Tag")
+			root := env.Pool("Tag").Call("Create", NewModelData(tagModel).Set(Name, "Export Root")).(RecordSet).Collection()
+			var created []int64
+			for i := 0; i < 25; i++ {
+				tag := env.Pool("Tag").Call("Create", NewModelData(tagModel).
+					Set(Name, fmt.Sprintf("Export Tag %02d", i)).
+					Set(description, "Not exported").
+					Set(parent, root)).(RecordSet).Collection()
+				created = append(created, tag.Ids()[0])
+			}
+			cond := tagModel.Field(Name).Contains("Export Tag")
+			Convey("SearchReadStream should return the requested fields of all records by batches", func() {
+				next := tagModel.SearchReadStream(env, cond, []FieldName{Name, parent}, 10)
+				var (
+					ids   []int64
+					sizes []int
+				)
+				for batch, ok := next(); ok; batch, ok = next() {
+					sizes = append(sizes, len(batch))
+					for _, record := range batch {
+						So(record, ShouldHaveLength, 3)
+						So(record["name"], ShouldStartWith, "Export Tag")
+						So(record["parent_id"], ShouldEqual, root.Ids()[0])
+						So(record, ShouldNotContainKey, "description")
+						ids = append(ids, record["id"].(int64))
+					}
+				}
+				So(sizes, ShouldResemble, []int{10, 10, 5})
+				So(ids, ShouldResemble, created)
+				_, ok := next()
+				So(ok, ShouldBeFalse)
+				So(env.cache.data["Tag"], ShouldBeEmpty)
+			})
+			Convey("SearchReadStream should give relation fields by ids", func() {
+				users := env.Pool("User")
+				jane := users.Search(users.Model().Field(email).Equals("jane.smith@example.com"))
+				next := users.Model().SearchReadStream(env, users.Model().Field(email).Equals("jane.smith@example.com"), []FieldName{profile, posts}, 5)
+				batch, ok := next()
+				So(ok, ShouldBeTrue)
+				So(batch, ShouldHaveLength, 1)
+				So(batch[0]["profile_id"], ShouldEqual, jane.Get(profile).(RecordSet).Ids()[0])
+				So(batch[0]["posts_ids"], ShouldResemble, jane.Get(posts).(RecordSet).Ids())
+				next = tagModel.SearchReadStream(env, tagModel.Field(ID).Equals(root.Ids()[0]), []FieldName{parent}, 5)
+				batch, ok = next()
+				So(ok, ShouldBeTrue)
+				So(batch[0]["parent_id"], ShouldBeNil)
+				_, ok = next()
+				So(ok, ShouldBeFalse)
+			})
+			Convey("SearchReadStream should panic with a non positive batch size or an unknown field", func() {
+				So(func() { tagModel.SearchReadStream(env, cond, []FieldName{Name}, 0) }, ShouldPanic)
+				So(func() { tagModel.SearchReadStream(env, cond, []FieldName{tagModel.FieldName("NoField")}, 5) }, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing estimated counts", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			tagModel := Registry.MustGet("Tag")
+			for i := 0; i < 5; i++ {
+				env.Pool("Tag").Call("Create", NewModelData(tagModel).Set(Name, fmt.Sprintf("Estimated Tag %d", i)))
+			}
+			env.cr.Execute(`ANALYZE "tag"`)
+			defer SetCountEstimateThreshold(countEstimateThreshold)
+			Convey("Unfiltered counts on large tables should be estimated", func() {
+				SetCountEstimateThreshold(1)
+				count, estimated := env.Pool("Tag").SearchAll().SearchCountEstimate()
+				So(estimated, ShouldBeTrue)
+				So(count, ShouldEqual, env.Pool("Tag").SearchAll().SearchCount())
+			})
+			Convey("Filtered counts should be exact", func() {
+				SetCountEstimateThreshold(1)
+				count, estimated := env.Pool("Tag").Search(tagModel.Field(Name).Contains("Estimated Tag")).SearchCountEstimate()
+				So(estimated, ShouldBeFalse)
+				So(count, ShouldEqual, 5)
+			})
+			Convey("Counts on tables smaller than the threshold should be exact", func() {
+				count, estimated := env.Pool("Tag").SearchAll().SearchCountEstimate()
+				So(estimated, ShouldBeFalse)
+				So(count, ShouldEqual, env.Pool("Tag").SearchAll().SearchCount())
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing linking many2many fields by ids", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			postModel := Registry.MustGet("Post")
+			post := env.Pool("Post").Call("Create", NewModelData(postModel).
+				Set(title, "Bulk Linked Post").
+				Set(content, "Content of bulk linked post")).(RecordSet).Collection()
+			var tagIds []int64
+			env.cr.Select(&tagIds, `INSERT INTO tag (name, hexya_external_id) SELECT 'Bulk Tag ' || i, 'bulk_tag_' || i FROM generate_series(1, 2000) i RETURNING id`)
+			So(tagIds, ShouldHaveLength, 2000)
+			So(post.Get(tags).(RecordSet).IsEmpty(), ShouldBeTrue)
+			Convey("Linking thousands of ids should take a constant number of queries", func() {
+				before := env.QueryStats().Count
+				post.AddRelationIds(tags, tagIds)
+				So(env.QueryStats().Count-before, ShouldBeLessThan, 20)
+				So(post.Get(tags).(RecordSet).Len(), ShouldEqual, 2000)
+				tag := env.Pool("Tag").Call("Browse", []int64{tagIds[1500]}).(RecordSet).Collection()
+				So(tag.Get(posts).(RecordSet).Ids(), ShouldContain, post.Ids()[0])
+				Convey("Already linked ids should not be linked twice", func() {
+					post.AddRelationIds(tags, tagIds[:10])
+					var count int
+					env.cr.Get(&count, `SELECT COUNT(*) FROM post_tag_rel WHERE post_id = ?`, post.Ids()[0])
+					So(count, ShouldEqual, 2000)
+				})
+				Convey("Removing ids should delete their links only", func() {
+					before := env.QueryStats().Count
+					post.RemoveRelationIds(tags, tagIds[:1500])
+					So(env.QueryStats().Count-before, ShouldBeLessThan, 20)
+					So(post.Get(tags).(RecordSet).Ids(), ShouldHaveLength, 500)
+					So(post.Get(tags).(RecordSet).Ids(), ShouldNotContain, tagIds[0])
+					So(post.Get(tags).(RecordSet).Ids(), ShouldContain, tagIds[1999])
+					post.RemoveRelationIds(tags, tagIds[:10])
+					So(post.Get(tags).(RecordSet).Len(), ShouldEqual, 500)
+				})
+			})
+			Convey("Ids of records that do not exist should be skipped unless in strict mode", func() {
+				missingID := tagIds[1999] + 1000
+				post.AddRelationIds(tags, []int64{tagIds[0], missingID})
+				So(post.Get(tags).(RecordSet).Ids(), ShouldResemble, []int64{tagIds[0]})
+				So(func() {
+					post.WithContext("hexya_strict_relation_ids", true).AddRelationIds(tags, []int64{tagIds[1], missingID})
+				}, ShouldPanic)
+				post.WithContext("hexya_strict_relation_ids", true).AddRelationIds(tags, tagIds[1:3])
+				So(post.Get(tags).(RecordSet).Len(), ShouldEqual, 3)
+			})
+			Convey("Linking ids should not call Write", func() {
+				calls := postWriteCalls
+				post.AddRelationIds(tags, tagIds[:10])
+				post.RemoveRelationIds(tags, tagIds[:5])
+				So(postWriteCalls, ShouldEqual, calls)
+				So(post.Get(tags).(RecordSet).Ids(), ShouldHaveLength, 5)
+				So(post.Get(tags).(RecordSet).Ids(), ShouldNotContain, tagIds[0])
+			})
+			Convey("Linking ids should update the write date and call AfterWrite hooks", func() {
+				var changes []map[int64]Changeset
+				hooks := postModel.afterWriteHooks
+				postModel.AfterWrite(func(rc *RecordCollection, c map[int64]Changeset) {
+					changes = append(changes, c)
+				})
+				env.cr.Execute(`UPDATE post SET write_date = '2000-01-01' WHERE id = ?`, post.Ids()[0])
+				post.InvalidateCache()
+				post.AddRelationIds(tags, tagIds[:2])
+				post.AddRelationIds(tags, tagIds[:2])
+				postModel.afterWriteHooks = hooks
+				So(post.Get(writeDate).(dates.DateTime).Year(), ShouldBeGreaterThan, 2000)
+				So(changes, ShouldHaveLength, 1)
+				So(changes[0], ShouldContainKey, post.Ids()[0])
+				So(changes[0][post.Ids()[0]], ShouldContainKey, "Tags")
+			})
+			Convey("Linking ids should panic on other fields than many2many", func() {
+				So(func() { post.AddRelationIds(title, tagIds) }, ShouldPanic)
+				So(func() { post.RemoveRelationIds(user, tagIds) }, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing in place edits of tracked data", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			userModel := Registry.MustGet("User")
+			users := env.Pool("User").SearchAll().OrderBy("ID")
+			So(users.Len(), ShouldBeGreaterThan, 2)
+			data := users.AllTracked()
+			So(data, ShouldHaveLength, users.Len())
+			for _, d := range data {
+				So(d.IsTracked(), ShouldBeTrue)
+				So(d.DirtyFields(), ShouldBeEmpty)
+			}
+			So(users.All()[0].IsTracked(), ShouldBeFalse)
+			So(data[0].Copy().IsTracked(), ShouldBeFalse)
+			Convey("Only modified fields should be dirty", func() {
+				data[0].Set(nums, data[0].Get(nums))
+				So(data[0].DirtyFields(), ShouldBeEmpty)
+				data[0].Set(nums, 1001).Set(isStaff, !data[0].Get(isStaff).(bool))
+				So(data[0].DirtyFields(), ShouldResemble, FieldNames{isStaff, nums})
+				data[1].Set(profile, data[1].Get(profile))
+				So(data[1].DirtyFields(), ShouldBeEmpty)
+			})
+			Convey("WriteDirty should write only the dirty fields of modified records", func() {
+				id0, id1, id2 := data[0].Get(ID).(int64), data[1].Get(ID).(int64), data[2].Get(ID).(int64)
+				env.cr.Execute(`UPDATE "user" SET size = 123.5 WHERE id = ?`, id0)
+				data[0].Set(nums, 1002)
+				data[1].Set(nums, 1002)
+				data[2].Set(nums, 1003)
+				So(users.WriteDirty(data), ShouldEqual, 3)
+				for _, d := range data {
+					So(d.DirtyFields(), ShouldBeEmpty)
+				}
+				for _, id := range []int64{id0, id1, id2} {
+					env.cache.invalidateRecord(userModel, id)
+				}
+				So(env.Pool("User").withIds([]int64{id0}).Get(nums), ShouldEqual, 1002)
+				So(env.Pool("User").withIds([]int64{id0}).Get(size), ShouldEqual, 123.5)
+				So(env.Pool("User").withIds([]int64{id1}).Get(nums), ShouldEqual, 1002)
+				So(env.Pool("User").withIds([]int64{id2}).Get(nums), ShouldEqual, 1003)
+				So(users.WriteDirty(data), ShouldEqual, 0)
+			})
+			Convey("WriteDirty should panic with untracked data", func() {
+				So(func() { users.WriteDirty([]*ModelData{NewModelData(userModel).Set(nums, 3)}) }, ShouldPanic)
+				So(func() { users.WriteDirty(env.Pool("Tag").SearchAll().AllTracked()) }, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing recursive hierarchy traversal", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			tagModel := Registry.MustGet("Tag")
+			newTag := func(name string, parentTag *RecordCollection) *RecordCollection {
+				return env.Pool("Tag").Call("Create", NewModelData(tagModel, FieldMap{
+					"Name":        name,
+					"Description": name + " Description",
+					"Parent":      parentTag,
+				})).(RecordSet).Collection()
+			}
+			root := newTag("Root", env.Pool("Tag"))
+			child1 := newTag("Child 1", root)
+			child2 := newTag("Child 2", root)
+			grandChild := newTag("Grand Child", child1)
+			greatGrandChild := newTag("Great Grand Child", grandChild)
+			Convey("RecursiveChildren should return all descendants", func() {
+				So(root.RecursiveChildren(parent).Ids(), ShouldHaveLength, 4)
+				So(root.RecursiveChildren(parent).Equals(child1.Union(child2).Union(grandChild).Union(greatGrandChild)), ShouldBeTrue)
+				So(child1.RecursiveChildren(parent).Equals(grandChild.Union(greatGrandChild)), ShouldBeTrue)
+				So(child1.Union(child2).RecursiveChildren(parent).Equals(grandChild.Union(greatGrandChild)), ShouldBeTrue)
+				So(greatGrandChild.RecursiveChildren(parent).IsEmpty(), ShouldBeTrue)
+			})
+			Convey("RecursiveParents should return all ancestors", func() {
+				So(greatGrandChild.RecursiveParents(parent).Equals(grandChild.Union(child1).Union(root)), ShouldBeTrue)
+				So(child2.RecursiveParents(parent).Equals(root), ShouldBeTrue)
+				So(root.RecursiveParents(parent).IsEmpty(), ShouldBeTrue)
+				So(env.Pool("Tag").RecursiveParents(parent).IsEmpty(), ShouldBeTrue)
+			})
+			Convey("InIdsOrChildOf should match direct and descendant records", func() {
+				tags := env.Pool("Tag").Search(tagModel.Field(parent).InIdsOrChildOf([]int64{child1.Ids()[0], child2.Ids()[0]}))
+				So(tags.Equals(grandChild.Union(greatGrandChild)), ShouldBeTrue)
+				tags = env.Pool("Tag").Search(tagModel.Field(ID).InIdsOrChildOf([]int64{child1.Ids()[0], child2.Ids()[0]}))
+				So(tags.Equals(child1.Union(child2).Union(grandChild).Union(greatGrandChild)), ShouldBeTrue)
+				tags = env.Pool("Tag").Search(tagModel.Field(ID).InIdsOrChildOf([]int64{grandChild.Ids()[0], greatGrandChild.Ids()[0]}))
+				So(tags.Equals(grandChild.Union(greatGrandChild)), ShouldBeTrue)
+			})
+			Convey("Cycles should not loop forever", func() {
+				root.Set(parent, greatGrandChild)
+				all := root.Union(child1).Union(child2).Union(grandChild).Union(greatGrandChild)
+				So(root.RecursiveChildren(parent).Equals(all), ShouldBeTrue)
+				So(child2.RecursiveParents(parent).Equals(all.Subtract(child2)), ShouldBeTrue)
+			})
+			Convey("Non hierarchy fields should panic", func() {
+				So(func() { root.RecursiveChildren(Name) }, ShouldPanic)
+				So(func() { root.RecursiveParents(posts) }, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing bulk field transforms", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			userModel := Registry.MustGet("User")
+			users := env.Pool("User").SearchAll()
+			So(users.Len(), ShouldBeGreaterThan, 1)
+			emails := make(map[int64]string)
+			for _, user := range users.Records() {
+				emails[user.ids[0]] = user.Get(email).(string)
+				user.Set(email, fmt.Sprintf(" \t\u00a0%s\u3000 ", emails[user.ids[0]]))
+			}
+			Convey("Known string functions should be executed by the database", func() {
+				users.Transform(email, strings.TrimSpace)
+				So(env.cache.checkIfInCache(userModel, users.Ids(), []string{"email"}, "", true), ShouldBeFalse)
+				for _, user := range users.Records() {
+					So(user.Get(email), ShouldEqual, emails[user.ids[0]])
+				}
+				users.Transform(email, strings.ToUpper)
+				for _, user := range users.Records() {
+					So(user.Get(email), ShouldEqual, strings.ToUpper(emails[user.ids[0]]))
+				}
+			})
+			Convey("Other functions should be applied in Go", func() {
+				users.Transform(email, func(val string) string {
+					return strings.TrimPrefix(strings.TrimSpace(val), "j")
+				})
+				So(env.cache.checkIfInCache(userModel, users.Ids(), []string{"email"}, "", true), ShouldBeTrue)
+				for _, user := range users.Records() {
+					So(user.Get(email), ShouldEqual, strings.TrimPrefix(emails[user.ids[0]], "j"))
+				}
+				users.InvalidateCache()
+				for _, user := range users.Records() {
+					So(user.Get(email), ShouldEqual, strings.TrimPrefix(emails[user.ids[0]], "j"))
+				}
+			})
+			Convey("Database and Go trimming should give the same result", func() {
+				users.Transform(email, strings.TrimSpace)
+				for _, user := range users.Records() {
+					So(user.Get(email), ShouldEqual, emails[user.ids[0]])
+				}
+			})
+			Convey("Values of non comparable types should be grouped in Go", func() {
+				posts := env.Pool("Post").SearchAll()
+				So(posts.Len(), ShouldBeGreaterThan, 1)
+				posts.Transform(keywords, func(val types.StringArray) types.StringArray {
+					return types.StringArray{"go", "orm"}
+				})
+				posts.InvalidateCache()
+				for _, post := range posts.Records() {
+					So(post.Get(keywords), ShouldResemble, types.StringArray{"go", "orm"})
+				}
+			})
+			Convey("Invalid transforms should panic", func() {
+				So(func() { users.Transform(email, func(val int) int { return val }) }, ShouldPanic)
+				So(func() { users.Transform(email, "upper") }, ShouldPanic)
+				So(func() { users.Transform(profile, func(val int64) int64 { return val }) }, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing records marshaling", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			postModel := Registry.MustGet("Post")
+			posts := env.Pool("Post").SearchAll()
+			So(posts.Len(), ShouldBeGreaterThan, 1)
+			posts.Records()[0].Set(lastRead, dates.ParseDate("2019-06-23"))
+			titles := make(map[int64]string)
+			users := make(map[int64]interface{})
+			for _, post := range posts.Records() {
+				titles[post.ids[0]] = post.Get(title).(string)
+				users[post.ids[0]] = post.Get(user).(RecordSet).Collection().Get(ID)
+			}
+			data, err := posts.Marshal()
+			So(err, ShouldBeNil)
+			Convey("Unmarshal should restore the records in the cache", func() {
+				for _, id := range posts.Ids() {
+					env.cache.invalidateRecord(postModel, id)
+				}
+				res := postModel.Unmarshal(env, data)
+				So(res.Equals(posts), ShouldBeTrue)
+				So(env.cache.checkIfInCache(postModel, res.Ids(), []string{"title", "last_read", "user_id"}, "", true), ShouldBeTrue)
+				for _, post := range res.Records() {
+					So(post.Get(title), ShouldEqual, titles[post.ids[0]])
+					So(post.Get(user).(RecordSet).Collection().Get(ID), ShouldEqual, users[post.ids[0]])
+				}
+				So(res.Records()[0].Get(lastRead).(dates.Date).Equal(dates.ParseDate("2019-06-23")), ShouldBeTrue)
+			})
+			Convey("Data of another model version should be fetched from the database", func() {
+				var records marshaledRecords
+				So(codec.NewDecoderBytes(data, msgpackHandle).Decode(&records), ShouldBeNil)
+				records.Version = "old"
+				records.Records[0]["title"] = "Stale Title"
+				var oldData []byte
+				So(codec.NewEncoderBytes(&oldData, msgpackHandle).Encode(records), ShouldBeNil)
+				for _, id := range posts.Ids() {
+					env.cache.invalidateRecord(postModel, id)
+				}
+				res := postModel.Unmarshal(env, oldData)
+				So(res.Equals(posts), ShouldBeTrue)
+				So(env.cache.checkIfInCache(postModel, res.Ids(), []string{"title"}, "", true), ShouldBeFalse)
+				So(res.Records()[0].Get(title), ShouldEqual, titles[res.ids[0]])
+			})
+			Convey("Invalid data should give an empty RecordSet", func() {
+				So(postModel.Unmarshal(env, []byte("invalid")).IsEmpty(), ShouldBeTrue)
+				So(Registry.MustGet("User").Unmarshal(env, data).IsEmpty(), ShouldBeTrue)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing encrypted fields", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			profiles := env.Pool("Profile")
+			ssn := profiles.Model().FieldName("SSN")
+			apiKey := profiles.Model().FieldName("APIKey")
+			prof := profiles.Call("Create", NewModelData(profiles.Model()).
+				Set(ssn, "123-45-6789").
+				Set(apiKey, "secret-key")).(RecordSet).Collection()
+			Convey("Encrypted values should be read back in plain text", func() {
+				prof.InvalidateCache()
+				So(prof.Get(ssn), ShouldEqual, "123-45-6789")
+				So(prof.Get(apiKey), ShouldEqual, "secret-key")
+			})
+			Convey("Only ciphertext should be stored in the database", func() {
+				var dbSSN, dbAPIKey string
+				env.cr.Get(&dbSSN, `SELECT ssn FROM profile WHERE id = ?`, prof.ids[0])
+				env.cr.Get(&dbAPIKey, `SELECT api_key FROM profile WHERE id = ?`, prof.ids[0])
+				So(dbSSN, ShouldNotBeEmpty)
+				So(dbSSN, ShouldNotContainSubstring, "123-45-6789")
+				So(dbAPIKey, ShouldNotContainSubstring, "secret-key")
+				So(encryptValue("123-45-6789"), ShouldNotEqual, dbSSN)
+				plainText, err := decryptValue(dbSSN)
+				So(err, ShouldBeNil)
+				So(plainText, ShouldEqual, "123-45-6789")
+			})
+			Convey("Encrypted fields with a blind index should be searchable for exact matches", func() {
+				res := profiles.Search(profiles.Model().Field(ssn).Equals("123-45-6789"))
+				So(res.Ids(), ShouldResemble, prof.Ids())
+				res = profiles.Search(profiles.Model().Field(ssn).In([]string{"000-00-0000", "123-45-6789"}))
+				So(res.Ids(), ShouldResemble, prof.Ids())
+				So(profiles.Search(profiles.Model().Field(ssn).Equals("123-45-678")).IsEmpty(), ShouldBeTrue)
+				So(func() { profiles.Search(profiles.Model().Field(ssn).Contains("123")).Fetch() }, ShouldPanic)
+				So(func() { profiles.Search(profiles.Model().Field(apiKey).Equals("secret-key")).Fetch() }, ShouldPanic)
+			})
+			Convey("Writing an encrypted field should update its blind index", func() {
+				prof.Set(ssn, "987-65-4321")
+				So(profiles.Search(profiles.Model().Field(ssn).Equals("123-45-6789")).IsEmpty(), ShouldBeTrue)
+				So(profiles.Search(profiles.Model().Field(ssn).Equals("987-65-4321")).Ids(), ShouldResemble, prof.Ids())
+				prof.InvalidateCache()
+				So(prof.Get(ssn), ShouldEqual, "987-65-4321")
+			})
+			Convey("Database side updates of encrypted fields should panic", func() {
+				So(func() { prof.Transform(ssn, strings.ToUpper) }, ShouldPanic)
+				So(func() {
+					profiles.Model().UpdateExpr(env, profiles.Model().Field(ID).Equals(prof.ids[0]), map[string]Expr{"SSN": Val("000-00-0000")})
+				}, ShouldPanic)
+				So(func() {
+					profiles.Model().UpdateExpr(env, profiles.Model().Field(ID).Equals(prof.ids[0]), map[string]Expr{"Country": Col("APIKey")})
+				}, ShouldPanic)
+				prof.InvalidateCache()
+				So(prof.Get(ssn), ShouldEqual, "123-45-6789")
+				So(prof.Get(apiKey), ShouldEqual, "secret-key")
+			})
+			Convey("Encrypted values should not be marshaled", func() {
+				data, err := prof.Marshal()
+				So(err, ShouldBeNil)
+				So(string(data), ShouldNotContainSubstring, "123-45-6789")
+				So(string(data), ShouldNotContainSubstring, "secret-key")
+				env.cache.invalidateRecord(profiles.Model(), prof.ids[0])
+				res := profiles.Model().Unmarshal(env, data)
+				So(res.Ids(), ShouldResemble, prof.Ids())
+				So(res.Get(ssn), ShouldEqual, "123-45-6789")
+			})
+			Convey("Encrypted fields should not be used for distinct values, ordering or grouping", func() {
+				So(func() { profiles.SearchAll().DistinctValues(ssn) }, ShouldPanic)
+				So(func() { profiles.SearchAll().OrderBy("SSN") }, ShouldPanic)
+				So(func() { profiles.SearchAll().OrderBy("APIKey desc") }, ShouldPanic)
+				So(func() { profiles.SearchAll().GroupBy(apiKey) }, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing query plans with Explain", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("User")
+			cond := users.Model().Field(Name).Equals("Jane Smith")
+			debug := debugMode
+			defer SetDebugMode(debug)
+			Convey("Explain should panic when not in debug mode", func() {
+				SetDebugMode(false)
+				So(func() { users.Explain(cond) }, ShouldPanic)
+			})
+			Convey("Explain should return the query plan in debug mode", func() {
+				SetDebugMode(true)
+				plan := users.Explain(cond)
+				So(plan, ShouldContainSubstring, "Scan")
+				So(plan, ShouldContainSubstring, "Execution Time")
+			})
+		}), ShouldBeNil)
+	})
 }
 
 func TestGroupedQueries(t *testing.T) {
@@ -754,7 +1597,243 @@ func TestUpdateRecordSet(t *testing.T) {
 			userWill.Call("Write", NewModelData(userModel).Set(nums, 0).Set(isPremium, true))
 		}).Error(), ShouldStartWith, "pq: Premium users must have positive nums")
 	})
+	Convey("Testing conditional updates with CompareAndSet", t, func() {
+		userModel := Registry.MustGet("User")
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			userWill := env.Pool("User").Search(userModel.Field(email).Equals("will.smith@example.com"))
+			curNums := userWill.Get(nums).(int)
+			Convey("CompareAndSet should update when the value is the expected one", func() {
+				So(userWill.CompareAndSet(nums, curNums, curNums+1), ShouldBeTrue)
+				So(userWill.Get(nums), ShouldEqual, curNums+1)
+			})
+			Convey("CompareAndSet should not update when the value is not the expected one", func() {
+				So(userWill.CompareAndSet(nums, curNums+1, curNums+2), ShouldBeFalse)
+				So(userWill.Get(nums), ShouldEqual, curNums)
+			})
+			Convey("CompareAndSet should panic on several records or on computed fields", func() {
+				So(func() { env.Pool("User").SearchAll().CompareAndSet(nums, 0, 1) }, ShouldPanic)
+				So(func() { userWill.CompareAndSet(decoratedName, "", "Will") }, ShouldPanic)
+			})
+			Convey("CompareAndSet should panic on contexted fields", func() {
+				tagModel := Registry.MustGet("Tag")
+				tag := tagModel.Create(env, NewModelData(tagModel).Set(Name, "CAS Tag"))
+				So(func() { tag.CompareAndSet(description, "", "Contexted") }, ShouldPanic)
+			})
+			Convey("CompareAndSet should not empty required fields", func() {
+				postModel := Registry.MustGet("Post")
+				post := postModel.Create(env, NewModelData(postModel).Set(title, "CAS Post").Set(content, "CAS Content"))
+				So(func() { post.CompareAndSet(title, "CAS Post", "") }, ShouldPanic)
+				So(post.Get(title), ShouldEqual, "CAS Post")
+			})
+			Convey("CompareAndSet should call AfterWrite hooks", func() {
+				var changes map[int64]Changeset
+				hooks := userModel.afterWriteHooks
+				userModel.AfterWrite(func(rc *RecordCollection, c map[int64]Changeset) {
+					changes = c
+				})
+				ok := userWill.CompareAndSet(nums, curNums, curNums+1)
+				userModel.afterWriteHooks = hooks
+				So(ok, ShouldBeTrue)
+				So(changes, ShouldContainKey, userWill.Ids()[0])
+				So(changes[userWill.Ids()[0]]["Nums"].Old, ShouldEqual, curNums)
+				So(changes[userWill.Ids()[0]]["Nums"].New, ShouldEqual, curNums+1)
+			})
+		}), ShouldBeNil)
+		Convey("Concurrent increments with CompareAndSet should not be lost", func() {
+			var (
+				willID    int64
+				startNums int
+			)
+			So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				userWill := env.Pool("User").Search(userModel.Field(email).Equals("will.smith@example.com"))
+				willID = userWill.Ids()[0]
+				startNums = userWill.Get(nums).(int)
+			}), ShouldBeNil)
+			var wg sync.WaitGroup
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					var done bool
+					for !done {
+						var ok bool
+						err := ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+							userWill := userModel.BrowseOne(env, willID)
+							n := userWill.Get(nums).(int)
+							ok = userWill.CompareAndSet(nums, n, n+1)
+						})
+						done = ok && err == nil
+					}
+				}()
+			}
+			wg.Wait()
+			So(ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				userWill := userModel.BrowseOne(env, willID)
+				So(userWill.Get(nums), ShouldEqual, startNums+5)
+				userWill.Set(nums, startNums)
+			}), ShouldBeNil)
+		})
+	})
+
+	Convey("Testing boolean toggles", t, func() {
+		userModel := Registry.MustGet("User")
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("User").SearchAll()
+			So(users.Len(), ShouldBeGreaterThan, 1)
+			staff := make(map[int64]bool)
+			for _, user := range users.Records() {
+				staff[user.Ids()[0]] = user.Get(isStaff).(bool)
+			}
+			Convey("Toggle should invert the value of each record", func() {
+				So(users.Toggle(isStaff).Equals(users), ShouldBeTrue)
+				for _, user := range users.Records() {
+					So(user.Get(isStaff), ShouldEqual, !staff[user.Ids()[0]])
+				}
+				users.Toggle(isStaff)
+				for _, user := range userModel.Browse(env, users.Ids()).Records() {
+					So(user.Get(isStaff), ShouldEqual, staff[user.Ids()[0]])
+				}
+			})
+			Convey("Toggle should panic on non boolean or computed fields", func() {
+				So(func() { users.Toggle(nums) }, ShouldPanic)
+				So(func() { env.Pool("Post").SearchAll().Toggle(read) }, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+
+	Convey("Testing atomic increments", t, func() {
+		userModel := Registry.MustGet("User")
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("User").SearchAll()
+			values := make(map[int64]int)
+			for _, user := range users.Records() {
+				values[user.Ids()[0]] = user.Get(nums).(int)
+			}
+			Convey("Increment should add delta to each record", func() {
+				users.Increment(nums, 3)
+				for _, user := range users.Records() {
+					So(user.Get(nums), ShouldEqual, values[user.Ids()[0]]+3)
+				}
+				users.Increment(nums, -3)
+				for _, user := range userModel.Browse(env, users.Ids()).Records() {
+					So(user.Get(nums), ShouldEqual, values[user.Ids()[0]])
+				}
+			})
+			Convey("Increment should panic on non numeric or computed fields", func() {
+				So(func() { users.Increment(isStaff, 1) }, ShouldPanic)
+				So(func() { users.Increment(age, 1) }, ShouldPanic)
+			})
+		}), ShouldBeNil)
+		Convey("Concurrent increments should not be lost", func() {
+			var (
+				willID    int64
+				startNums int
+			)
+			So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				userWill := env.Pool("User").Search(userModel.Field(email).Equals("will.smith@example.com"))
+				willID = userWill.Ids()[0]
+				startNums = userWill.Get(nums).(int)
+			}), ShouldBeNil)
+			var wg sync.WaitGroup
+			errs := make(chan error, 10)
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					delta := 2
+					if i%2 == 1 {
+						delta = -1
+					}
+					errs <- ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+						userModel.BrowseOne(env, willID).Increment(nums, delta)
+					})
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				So(err, ShouldBeNil)
+			}
+			So(ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				userWill := userModel.BrowseOne(env, willID)
+				So(userWill.Get(nums), ShouldEqual, startNums+5)
+				userWill.Set(nums, startNums)
+			}), ShouldBeNil)
+		})
+	})
+
+	Convey("Testing mapped fields across x2many relations", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("User").SearchAll()
+			allPosts := env.Pool("Post")
+			allTags := env.Pool("Tag")
+			for _, user := range users.Records() {
+				userPosts := user.Get(posts).(RecordSet).Collection()
+				allPosts = allPosts.Union(userPosts)
+				for _, post := range userPosts.Records() {
+					allTags = allTags.Union(post.Get(tags).(RecordSet))
+				}
+			}
+			So(allTags.IsNotEmpty(), ShouldBeTrue)
+			Convey("Mapped should return a single RecordSet for relation fields", func() {
+				mappedTags := users.Mapped(posts, tags).(*RecordCollection)
+				So(mappedTags.ModelName(), ShouldEqual, "Tag")
+				So(mappedTags.Subtract(allTags).IsEmpty(), ShouldBeTrue)
+				So(allTags.Subtract(mappedTags).IsEmpty(), ShouldBeTrue)
+			})
+			Convey("Mapped should return a slice for other fields", func() {
+				for _, rec := range allPosts.Records() {
+					env.cache.invalidateRecord(rec.model, rec.ids[0])
+				}
+				before := env.QueryStats().Count
+				titles := users.Mapped(posts, title).([]string)
+				So(env.QueryStats().Count-before, ShouldEqual, 1)
+				So(titles, ShouldHaveLength, allPosts.Len())
+				for _, post := range allPosts.Records() {
+					So(titles, ShouldContain, post.Get(title))
+				}
+			})
+			Convey("Mapped should panic on non x2many fields", func() {
+				So(func() { users.Mapped(profile, title) }, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
 
+	Convey("Testing reference fields", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			commentModel := Registry.MustGet("Comment")
+			comment := env.Pool("Comment").Search(commentModel.Field(text).Equals("First Comment"))
+			post := env.Pool("Post").Search(Registry.MustGet("Post").Field(title).Equals("1st Post"))
+			userJane := env.Pool("User").Search(Registry.MustGet("User").Field(Name).Equals("Jane A. Smith"))
+			So(comment.Len(), ShouldEqual, 1)
+			Convey("An unset reference should be nil", func() {
+				So(comment.Get(document), ShouldBeNil)
+				So(env.Pool("Comment").Get(document), ShouldBeNil)
+			})
+			Convey("Setting a reference with a RecordSet", func() {
+				comment.Set(document, post)
+				comment.InvalidateCache()
+				doc := comment.Get(document).(*RecordCollection)
+				So(doc.ModelName(), ShouldEqual, "Post")
+				So(doc.Ids(), ShouldResemble, post.Ids())
+				So(doc.Get(title), ShouldEqual, "1st Post")
+				So(env.Pool("Comment").Search(commentModel.Field(document).Equals(post)).Ids(), ShouldResemble, comment.Ids())
+				comment.Set(document, userJane)
+				So(comment.Get(document).(*RecordCollection).ModelName(), ShouldEqual, "User")
+				comment.Set(document, nil)
+				So(comment.Get(document), ShouldBeNil)
+			})
+			Convey("Setting a reference with a string", func() {
+				comment.Set(document, fmt.Sprintf("User,%d", userJane.Ids()[0]))
+				So(comment.Get(document).(*RecordCollection).Get(Name), ShouldEqual, "Jane A. Smith")
+			})
+			Convey("Setting an invalid reference should panic", func() {
+				So(func() { comment.Set(document, "NonExistentModel,1") }, ShouldPanic)
+				So(func() { comment.Set(document, "Post") }, ShouldPanic)
+				So(func() { comment.Set(document, env.Pool("Post").SearchAll()) }, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
 	group1 := security.Registry.NewGroup("group1", "Group 1")
 	security.Registry.AddMembership(2, group1)
 	Convey("Testing access control list on update (write only)", t, func() {
@@ -831,9 +1910,52 @@ func TestUpdateRecordSet(t *testing.T) {
 				userModel.RemoveRecordRule("jOnly")
 				userModel.RemoveRecordRule("unlinkRule")
 			})
+			Convey("Checking that CompareAndSet enforces write record rules", func() {
+				rule := RecordRule{
+					Name:      "jOnly",
+					Group:     group1,
+					Condition: env.Pool("User").Model().Field(Name).IContains("j"),
+					Perms:     security.Write,
+				}
+				userModel.AddRecordRule(&rule)
+				Reset(func() {
+					userModel.RemoveRecordRule("jOnly")
+				})
+
+				userWill := env.Pool("User").Search(env.Pool("User").Model().Field(Name).Equals("Will Smith"))
+				So(userWill.Len(), ShouldEqual, 1)
+				willNums := userWill.Get(nums).(int)
+				So(userWill.CompareAndSet(nums, willNums, willNums+1), ShouldBeFalse)
+				var dbNums int
+				env.cr.Get(&dbNums, `SELECT nums FROM "user" WHERE id = ?`, userWill.Ids()[0])
+				So(dbNums, ShouldEqual, willNums)
+
+				userJane := env.Pool("User").Search(env.Pool("User").Model().Field(email).Equals("jane.smith@example.com"))
+				janeNums := userJane.Get(nums).(int)
+				So(userJane.CompareAndSet(nums, janeNums, janeNums+1), ShouldBeTrue)
+			})
 		}), ShouldBeNil)
 	})
 	security.Registry.UnregisterGroup(group1)
+
+	Convey("Testing computation of new stored computed fields on database sync", t, func() {
+		ages := make(map[int64]int16)
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			for _, user := range env.Pool("User").SearchAll().Records() {
+				ages[user.Ids()[0]] = user.Get(age).(int16)
+			}
+		}), ShouldBeNil)
+		So(len(ages), ShouldBeGreaterThan, 2)
+		dbExecuteNoTx(`ALTER TABLE "user" DROP COLUMN age`)
+		computeBatchSize = 2
+		So(SyncDatabase, ShouldNotPanic)
+		computeBatchSize = 1000
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			for _, user := range env.Pool("User").SearchAll().Records() {
+				So(user.Get(age), ShouldEqual, ages[user.Ids()[0]])
+			}
+		}), ShouldBeNil)
+	})
 }
 
 func TestDeleteRecordSet(t *testing.T) {
@@ -877,6 +1999,46 @@ func TestDeleteRecordSet(t *testing.T) {
 			})
 		}), ShouldBeNil)
 	})
+	Convey("Checking batched unlink of cascade records", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			postModel := Registry.MustGet("Post")
+			profileModel := Registry.MustGet("Profile")
+			post := postModel.Create(env, NewModelData(postModel).Set(title, "Popular Post"))
+			for i := 0; i < 200; i++ {
+				profileModel.Create(env, NewModelData(profileModel).Set(bestPost, post))
+			}
+			profiles := env.Pool("Profile").Search(profileModel.Field(bestPost).Equals(post))
+			So(profiles.Len(), ShouldEqual, 200)
+			unlinkCalls := profileUnlinkCalls
+			before := env.QueryStats().Count
+			So(post.Call("Unlink"), ShouldEqual, 1)
+			So(env.QueryStats().Count-before, ShouldBeLessThan, 20)
+			So(profileUnlinkCalls-unlinkCalls, ShouldEqual, 1)
+			So(env.Pool("Profile").Search(profileModel.Field(ID).In(profiles.Ids())).SearchCount(), ShouldEqual, 0)
+		}), ShouldBeNil)
+	})
+	Convey("Checking unlink of cascade cycles", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			postModel := Registry.MustGet("Post")
+			profileModel := Registry.MustGet("Profile")
+			userModel := Registry.MustGet("User")
+			// Post -> Profile (BestPost) -> User (Profile) -> Post (User)
+			profileCascades, userCascades := profileModel.cascadeFields, userModel.cascadeFields
+			profileModel.cascadeFields = append(append([]*Field{}, profileCascades...), userModel.fields.MustGet("Profile"))
+			userModel.cascadeFields = append(append([]*Field{}, userCascades...), postModel.fields.MustGet("User"))
+			defer func() {
+				profileModel.cascadeFields, userModel.cascadeFields = profileCascades, userCascades
+			}()
+			post := postModel.Create(env, NewModelData(postModel).Set(title, "Cyclic Post"))
+			prof := profileModel.Create(env, NewModelData(profileModel).Set(bestPost, post))
+			usr := userModel.Create(env, NewModelData(userModel).Set(Name, "Cyclic User").Set(email, "cyclic@example.com").Set(profile, prof))
+			post.Set(user, usr)
+			So(post.Call("Unlink"), ShouldEqual, 1)
+			So(env.Pool("Post").Search(postModel.Field(ID).Equals(post.Ids()[0])).SearchCount(), ShouldEqual, 0)
+			So(env.Pool("Profile").Search(profileModel.Field(ID).Equals(prof.Ids()[0])).SearchCount(), ShouldEqual, 0)
+			So(env.Pool("User").Search(userModel.Field(ID).Equals(usr.Ids()[0])).SearchCount(), ShouldEqual, 0)
+		}), ShouldBeNil)
+	})
 	group1 := security.Registry.NewGroup("group1", "Group 1")
 	security.Registry.AddMembership(2, group1)
 	Convey("Checking unlink access permissions", t, func() {
@@ -931,6 +2093,20 @@ func TestDeleteRecordSet(t *testing.T) {
 				userModel.RemoveRecordRule("jOnly")
 				userModel.RemoveRecordRule("writeRule")
 			})
+			Convey("Checking that cascade records are unlinked as superuser", func() {
+				postModel.methods.MustGet("Load").AllowGroup(group1)
+				postModel.methods.MustGet("Unlink").AllowGroup(group1)
+				Reset(func() {
+					postModel.methods.MustGet("Load").RevokeGroup(group1)
+					postModel.methods.MustGet("Unlink").RevokeGroup(group1)
+				})
+				post := env.Pool("Post").Sudo().Call("Create", NewModelData(postModel).Set(title, "Cascaded Post")).(RecordSet).Collection()
+				prof := env.Pool("Profile").Sudo().Call("Create", NewModelData(profileModel).Set(bestPost, post)).(RecordSet).Collection()
+				userPost := env.Pool("Post").Search(postModel.Field(ID).Equals(post.Ids()[0]))
+				So(userPost.Len(), ShouldEqual, 1)
+				So(userPost.Call("Unlink"), ShouldEqual, 1)
+				So(env.Pool("Profile").Sudo().Search(profileModel.Field(ID).Equals(prof.Ids()[0])).SearchCount(), ShouldEqual, 0)
+			})
 		}), ShouldBeNil)
 	})
 	security.Registry.UnregisterGroup(group1)
@@ -15,13 +15,100 @@
 package models
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/hexya-erp/hexya/src/models/fieldtype"
 	"github.com/hexya-erp/hexya/src/models/security"
+	"github.com/hexya-erp/hexya/src/models/types/dates"
+	"github.com/hexya-erp/hexya/src/tools/logging"
+	"github.com/hexya-erp/hexya/src/tools/strutils"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
+// A capturedLogEntry is a log line recorded by a capturedLogger
+type capturedLogEntry struct {
+	level  string
+	msg    string
+	fields map[string]interface{}
+}
+
+// A capturedLogger is a logging.Logger that records the log lines
+// it emits instead of writing them.
+type capturedLogger struct {
+	ctx     []interface{}
+	entries *[]capturedLogEntry
+}
+
+var _ logging.Logger = capturedLogger{}
+
+func (l capturedLogger) record(level, msg string, ctx ...interface{}) {
+	fields := make(map[string]interface{})
+	kv := append(append([]interface{}{}, l.ctx...), ctx...)
+	for i := 0; i+1 < len(kv); i += 2 {
+		fields[fmt.Sprintf("%v", kv[i])] = kv[i+1]
+	}
+	*l.entries = append(*l.entries, capturedLogEntry{level: level, msg: msg, fields: fields})
+}
+
+func (l capturedLogger) Panic(msg string, ctx ...interface{}) {
+	l.record("panic", msg, ctx...)
+	panic(msg)
+}
+
+func (l capturedLogger) Error(msg string, ctx ...interface{}) { l.record("error", msg, ctx...) }
+func (l capturedLogger) Warn(msg string, ctx ...interface{})  { l.record("warn", msg, ctx...) }
+func (l capturedLogger) Info(msg string, ctx ...interface{})  { l.record("info", msg, ctx...) }
+func (l capturedLogger) Debug(msg string, ctx ...interface{}) { l.record("debug", msg, ctx...) }
+func (l capturedLogger) Sync() error                          { return nil }
+
+func (l capturedLogger) New(ctx ...interface{}) logging.Logger {
+	return capturedLogger{
+		ctx:     append(append([]interface{}{}, l.ctx...), ctx...),
+		entries: l.entries,
+	}
+}
+
+// lastEntry returns the last recorded entry with the given message
+func (l capturedLogger) lastEntry(msg string) *capturedLogEntry {
+	for i := len(*l.entries) - 1; i >= 0; i-- {
+		if (*l.entries)[i].msg == msg {
+			return &(*l.entries)[i]
+		}
+	}
+	return nil
+}
+
+// addTestComputedField adds a non stored computed char field with the given name
+// and compute method to the given model until the end of the current Convey block.
+func addTestComputedField(model *Model, name, compute string) FieldName {
+	fi := &Field{
+		model:       model,
+		name:        name,
+		json:        strutils.SnakeCase(name),
+		fieldType:   fieldtype.Char,
+		structField: reflect.StructField{Type: reflect.TypeOf("")},
+		compute:     compute,
+	}
+	model.fields.add(fi)
+	Reset(func() {
+		model.fields.Lock()
+		defer model.fields.Unlock()
+		delete(model.fields.registryByName, fi.name)
+		delete(model.fields.registryByJSON, fi.json)
+		computed := model.fields.computedFields[:0]
+		for _, f := range model.fields.computedFields {
+			if f != fi {
+				computed = append(computed, f)
+			}
+		}
+		model.fields.computedFields = computed
+	})
+	return model.FieldName(name)
+}
+
 func TestMethods(t *testing.T) {
 	Convey("Testing simple methods", t, func() {
 		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
@@ -57,6 +144,80 @@ func TestMethods(t *testing.T) {
 			})
 		}), ShouldBeNil)
 	})
+	Convey("Testing memoized methods", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			tag := env.Pool("Tag").Call("Create", NewModelData(Registry.MustGet("Tag"), FieldMap{
+				"Name": "Memoized",
+				"Rate": float32(2),
+			})).(RecordSet).Collection()
+			calls := rateAtCalls
+			Convey("Repeated calls with the same arguments should hit the cache", func() {
+				So(tag.Call("RateAt", 1.5), ShouldEqual, 3)
+				So(tag.Call("RateAt", 1.5), ShouldEqual, 3)
+				So(rateAtCalls, ShouldEqual, calls+1)
+				So(tag.Call("RateAt", 2.0), ShouldEqual, 4)
+				So(rateAtCalls, ShouldEqual, calls+2)
+			})
+			Convey("Memoized results should not be returned to users who may not execute the method", func() {
+				rateAt := tag.model.methods.MustGet("RateAt")
+				userTag := tag.Sudo(2)
+				So(userTag.Call("RateAt", 1.5), ShouldEqual, 3)
+				rateAt.RevokeGroup(security.GroupEveryone)
+				defer rateAt.AllowGroup(security.GroupEveryone)
+				So(func() { userTag.Call("RateAt", 1.5) }, ShouldPanic)
+			})
+			Convey("Modifying records should clear the memoized results", func() {
+				So(tag.Call("RateAt", 1.5), ShouldEqual, 3)
+				tag.Set(rate, float32(4))
+				So(tag.Call("RateAt", 1.5), ShouldEqual, 6)
+				So(rateAtCalls, ShouldEqual, calls+2)
+			})
+			Convey("Results memoized on context keys should only depend on these keys", func() {
+				lCalls := localizedRateCalls
+				frTag := tag.WithContext("lang", "fr_FR")
+				So(frTag.Call("LocalizedRate"), ShouldEqual, "fr_FR:2.00")
+				So(frTag.Call("LocalizedRate"), ShouldEqual, "fr_FR:2.00")
+				So(frTag.WithContext("active_test", false).Call("LocalizedRate"), ShouldEqual, "fr_FR:2.00")
+				So(localizedRateCalls, ShouldEqual, lCalls+1)
+				So(tag.WithContext("lang", "en_US").Call("LocalizedRate"), ShouldEqual, "en_US:2.00")
+				So(localizedRateCalls, ShouldEqual, lCalls+2)
+				So(Registry.MustGet("Tag").Methods().MustGet("LocalizedRate").IsMemoized(), ShouldBeTrue)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing contextual logger of method calls", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			tag := env.Pool("Tag").Call("Create", NewModelData(Registry.MustGet("Tag"), FieldMap{
+				"Name": "Logged",
+			})).(RecordSet).Collection()
+			captured := capturedLogger{entries: new([]capturedLogEntry)}
+			baseLog := log
+			log = captured
+			Reset(func() {
+				log = baseLog
+			})
+			Convey("Lines logged inside a method should be tagged with the method call", func() {
+				tag.Call("LogMessage")
+				entry := captured.lastEntry("Logging from method")
+				So(entry, ShouldNotBeNil)
+				So(entry.level, ShouldEqual, "info")
+				So(entry.fields, ShouldResemble, map[string]interface{}{
+					"model":  "Tag",
+					"method": "LogMessage",
+					"ids":    tag.Ids(),
+					"uid":    security.SuperUserID,
+					"name":   "Logged",
+				})
+			})
+			Convey("Lines logged outside a method should only be tagged with the user", func() {
+				tag.Call("LogMessage")
+				tag.Env().Logger().Info("Logging after method")
+				entry := captured.lastEntry("Logging after method")
+				So(entry, ShouldNotBeNil)
+				So(entry.fields, ShouldResemble, map[string]interface{}{"uid": security.SuperUserID})
+			})
+		}), ShouldBeNil)
+	})
 }
 
 func TestComputedNonStoredFields(t *testing.T) {
@@ -86,6 +247,47 @@ func TestComputedNonStoredFields(t *testing.T) {
 				So(jane.Get(other), ShouldEqual, "Other information")
 				So(jane.Get(resume).(RecordSet).Collection().Get(other), ShouldEqual, "Other information")
 			})
+			Convey("Testing time dependent computed field", func() {
+				post := env.Pool("Post").SearchAll().Limit(1)
+				first := post.Get(checkedAt).(dates.DateTime)
+				time.Sleep(10 * time.Millisecond)
+				second := post.Get(checkedAt).(dates.DateTime)
+				So(second.Greater(first), ShouldBeTrue)
+			})
+			Convey("Methods reading a time dependent field should not be memoized", func() {
+				post := env.Pool("Post").SearchAll().Limit(1)
+				first := post.Call("CheckedAtNanos").(int64)
+				time.Sleep(10 * time.Millisecond)
+				So(post.Call("CheckedAtNanos"), ShouldBeGreaterThan, first)
+			})
+			Convey("Testing failing compute method", func() {
+				tags := env.Pool("Tag").SearchAll().Limit(1)
+				So(tags.Len(), ShouldEqual, 1)
+				failing := addTestComputedField(tags.model, "Failing", "ComputeFailing")
+				So(func() { tags.Get(failing) }, ShouldNotPanic)
+				So(tags.Get(failing), ShouldEqual, "")
+				strictTags := tags.WithContext("hexya_strict_compute", true)
+				So(func() { strictTags.Get(failing) }, ShouldPanic)
+			})
+			Convey("Testing compute method failing in the database", func() {
+				tags := env.Pool("Tag").SearchAll().Limit(1)
+				So(tags.Len(), ShouldEqual, 1)
+				failing := addTestComputedField(tags.model, "Failing", "ComputeFromMissingTable")
+				env.cr.Execute("SAVEPOINT hexya_compute_test")
+				So(func() { tags.Get(failing) }, ShouldPanic)
+				env.cr.Execute("ROLLBACK TO SAVEPOINT hexya_compute_test")
+			})
+			Convey("Testing search on a computed field with a search shadow", func() {
+				postModel := Registry.MustGet("Post")
+				post := postModel.Create(env, NewModelData(postModel).Set(title, "Shadowed Post"))
+				readPosts := env.Pool("Post").Search(postModel.Field(title).Equals("Shadowed Post").And().Field(read).Equals(true))
+				So(readPosts.IsEmpty(), ShouldBeTrue)
+				post.Set(lastRead, dates.Today())
+				So(post.Get(read), ShouldBeTrue)
+				readPosts = env.Pool("Post").Search(postModel.Field(title).Equals("Shadowed Post").And().Field(read).Equals(true))
+				So(readPosts.Equals(post), ShouldBeTrue)
+				So(postModel.FieldsGet(), ShouldNotContainKey, "hexya_read_shadow")
+			})
 		}), ShouldBeNil)
 	})
 }
@@ -163,8 +365,347 @@ func TestComputedStoredFields(t *testing.T) {
 				jane.Set(age, int16(24))
 				So(post.Get(writerAge), ShouldEqual, 24)
 			})
+			Convey("Checking that a precompute method is called once per recompute batch", func() {
+				jane := users.Search(users.Model().Field(email).Equals("jane.smith@example.com"))
+				janePosts := jane.Get(posts).(RecordSet).Collection()
+				So(janePosts.Len(), ShouldBeGreaterThan, 1)
+				calls := precomputeWriterAgeCalls
+				jane.Get(profile).(RecordSet).Collection().Set(age, 26)
+				So(precomputeWriterAgeCalls, ShouldEqual, calls+1)
+				for _, post := range janePosts.Records() {
+					So(post.Get(writerAge), ShouldEqual, 26)
+				}
+				jane.Set(age, int16(24))
+			})
+			Convey("Checking that computed values are not written with the precompute context", func() {
+				jane := users.Search(users.Model().Field(email).Equals("jane.smith@example.com"))
+				postModel := Registry.MustGet("Post")
+				hooks := postModel.afterWriteHooks
+				var writes, precomputedWrites int
+				postModel.AfterWrite(func(rc *RecordCollection, changes map[int64]Changeset) {
+					writes++
+					if rc.Env().Context().HasKey("writer_age_precomputed") {
+						precomputedWrites++
+					}
+				})
+				jane.Get(profile).(RecordSet).Collection().Set(age, 27)
+				postModel.afterWriteHooks = hooks
+				So(writes, ShouldBeGreaterThan, 0)
+				So(precomputedWrites, ShouldEqual, 0)
+				jane.Set(age, int16(24))
+			})
+			Convey("Checking that a field computed on create only is not recomputed", func() {
+				jane := users.Search(users.Model().Field(email).Equals("jane.smith@example.com"))
+				post := env.Pool("Post").Call("Create", NewModelData(Registry.MustGet("Post")).
+					Set(title, "Snapshot Post").
+					Set(user, jane)).(RecordSet).Collection()
+				So(post.Get(originalTitle), ShouldEqual, "Snapshot Post")
+				post.Set(title, "Renamed Post")
+				So(post.Get(title), ShouldEqual, "Renamed Post")
+				So(post.Get(originalTitle), ShouldEqual, "Snapshot Post")
+				post.Load()
+				So(post.Get(originalTitle), ShouldEqual, "Snapshot Post")
+			})
+			Convey("Checking that a field computed on create only keeps its given value", func() {
+				jane := users.Search(users.Model().Field(email).Equals("jane.smith@example.com"))
+				post := env.Pool("Post").Call("Create", NewModelData(Registry.MustGet("Post")).
+					Set(title, "Imported Post").
+					Set(originalTitle, "Original Imported Post").
+					Set(user, jane)).(RecordSet).Collection()
+				So(post.Get(originalTitle), ShouldEqual, "Original Imported Post")
+				post.Load()
+				So(post.Get(originalTitle), ShouldEqual, "Original Imported Post")
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing stored computed fields with a versioned cache", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("User")
+			postModel := Registry.MustGet("Post")
+			writerSummary := postModel.FieldName("WriterSummary")
+			writerSummaryVersion := postModel.FieldName("HexyaWriterSummaryVersion")
+			jane := users.Search(users.Model().Field(email).Equals("jane.smith@example.com"))
+			post := env.Pool("Post").Call("Create", NewModelData(postModel).
+				Set(title, "Versioned Post").
+				Set(content, "Some content").
+				Set(user, jane)).(RecordSet).Collection()
+			Convey("The field should be computed on creation and stored with its version", func() {
+				calls := computeWriterSummaryCalls
+				So(post.Get(writerSummaryVersion), ShouldHaveLength, versionSize)
+				So(post.RawValue(writerSummary), ShouldEqual, "Versioned Post by Jane A. Smith")
+				So(post.Get(writerSummary), ShouldEqual, "Versioned Post by Jane A. Smith")
+				So(computeWriterSummaryCalls, ShouldEqual, calls)
+				_, exists := postModel.FieldsGet()["hexya_writer_summary_version"]
+				So(exists, ShouldBeFalse)
+			})
+			Convey("Unrelated changes should not trigger a recomputation", func() {
+				So(post.Get(writerSummary), ShouldEqual, "Versioned Post by Jane A. Smith")
+				version := post.Get(writerSummaryVersion)
+				calls := computeWriterSummaryCalls
+				post.Set(content, "Other content")
+				jane.Set(email2, "jane@example.com")
+				So(post.Get(writerSummary), ShouldEqual, "Versioned Post by Jane A. Smith")
+				So(post.Get(writerSummaryVersion), ShouldEqual, version)
+				So(computeWriterSummaryCalls, ShouldEqual, calls)
+			})
+			Convey("Changing a dependency should store the recomputed field with a new version", func() {
+				version := post.Get(writerSummaryVersion)
+				post.Set(title, "Renamed Versioned Post")
+				So(post.RawValue(writerSummary), ShouldEqual, "Renamed Versioned Post by Jane A. Smith")
+				newVersion := post.Get(writerSummaryVersion)
+				So(newVersion, ShouldNotEqual, version)
+				jane.Set(Name, "Jane B. Smith")
+				So(post.RawValue(writerSummary), ShouldEqual, "Renamed Versioned Post by Jane B. Smith")
+				So(post.Get(writerSummary), ShouldEqual, "Renamed Versioned Post by Jane B. Smith")
+				So(post.Get(writerSummaryVersion), ShouldNotEqual, newVersion)
+			})
+			Convey("A stale value written in the database should be detected and stored with its version", func() {
+				version := post.Get(writerSummaryVersion)
+				calls := computeWriterSummaryCalls
+				env.Cr().Execute(`UPDATE post SET title = ? WHERE id = ?`, "Changed Elsewhere", post.Ids()[0])
+				env.cache.invalidateRecord(postModel, post.Ids()[0])
+				So(post.Get(writerSummary), ShouldEqual, "Changed Elsewhere by Jane A. Smith")
+				So(computeWriterSummaryCalls, ShouldEqual, calls+1)
+				So(post.Get(writerSummary), ShouldEqual, "Changed Elsewhere by Jane A. Smith")
+				So(computeWriterSummaryCalls, ShouldEqual, calls+1)
+				So(post.RawValue(writerSummary), ShouldEqual, "Changed Elsewhere by Jane A. Smith")
+				So(post.Get(writerSummaryVersion), ShouldNotEqual, version)
+				env.cache.invalidateRecord(postModel, post.Ids()[0])
+				So(post.Get(writerSummary), ShouldEqual, "Changed Elsewhere by Jane A. Smith")
+				So(computeWriterSummaryCalls, ShouldEqual, calls+1)
+			})
+			Convey("A stale value should not be stored from a read only environment", func() {
+				calls := computeWriterSummaryCalls
+				env.Cr().Execute(`UPDATE post SET title = ? WHERE id = ?`, "Changed Elsewhere", post.Ids()[0])
+				env.cache.invalidateRecord(postModel, post.Ids()[0])
+				roPost := post.WithEnv(env.ReadOnly())
+				So(roPost.Get(writerSummary), ShouldEqual, "Changed Elsewhere by Jane A. Smith")
+				So(computeWriterSummaryCalls, ShouldEqual, calls+1)
+				So(post.RawValue(writerSummary), ShouldEqual, "Versioned Post by Jane A. Smith")
+			})
+			Convey("Versions should be checked for all the loaded records at once", func() {
+				ids := post.Ids()
+				for i := 0; i < 4; i++ {
+					ids = append(ids, env.Pool("Post").Call("Create", NewModelData(postModel).
+						Set(title, fmt.Sprintf("Versioned Post %d", i)).
+						Set(content, "Some content").
+						Set(user, jane)).(RecordSet).Collection().ids[0])
+				}
+				env.Cr().Execute(`UPDATE post SET title = 'Changed Elsewhere' WHERE id IN (?)`, ids)
+				for _, id := range ids {
+					env.cache.invalidateRecord(postModel, id)
+				}
+				posts := env.ReadOnly().Pool("Post").withIds(ids)
+				calls := computeWriterSummaryCalls
+				before := env.QueryStats().Count
+				for _, rec := range posts.Records() {
+					So(rec.Get(writerSummary), ShouldEqual, "Changed Elsewhere by Jane A. Smith")
+				}
+				So(computeWriterSummaryCalls, ShouldEqual, calls+len(ids))
+				So(env.QueryStats().Count-before, ShouldBeLessThan, len(ids))
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing deferred recomputation of stored fields", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("User")
+			jane := users.Search(users.Model().Field(email).Equals("jane.smith@example.com"))
+			janePosts := jane.Get(posts).(RecordSet).Collection()
+			janeProfile := jane.Get(profile).(RecordSet).Collection().WithContext("hexya_defer_recompute", true)
+			calls := precomputeWriterAgeCalls
+			Convey("Recomputation should be deferred until a dirty field is read", func() {
+				janeProfile.Set(age, 27)
+				So(precomputeWriterAgeCalls, ShouldEqual, calls)
+				So(env.recomputeQueue.keys, ShouldNotBeEmpty)
+				So(janePosts.Records()[0].Get(writerAge), ShouldEqual, 27)
+				So(precomputeWriterAgeCalls, ShouldEqual, calls+1)
+				So(env.recomputeQueue.keys, ShouldBeEmpty)
+			})
+			Convey("Several writes should trigger only one recomputation", func() {
+				for i := 28; i <= 30; i++ {
+					janeProfile.Set(age, int16(i))
+				}
+				So(precomputeWriterAgeCalls, ShouldEqual, calls)
+				env.Flush()
+				So(precomputeWriterAgeCalls, ShouldEqual, calls+1)
+				So(jane.Get(age), ShouldEqual, 30)
+				for _, post := range janePosts.Records() {
+					So(post.Get(writerAge), ShouldEqual, 30)
+				}
+			})
+			Convey("Reading a dirty field in a read only environment should not write it", func() {
+				janeProfile.Set(age, 32)
+				roPost := janePosts.Records()[0].WithEnv(env.ReadOnly())
+				So(roPost.Get(writerAge), ShouldEqual, 32)
+				So(precomputeWriterAgeCalls, ShouldEqual, calls+1)
+				So(env.recomputeQueue.keys, ShouldNotBeEmpty)
+				env.Flush()
+				So(precomputeWriterAgeCalls, ShouldEqual, calls+2)
+				So(env.recomputeQueue.keys, ShouldBeEmpty)
+				So(janePosts.Records()[0].Get(writerAge), ShouldEqual, 32)
+			})
+			Convey("Flushing should skip the records unlinked in between", func() {
+				janeProfile.Set(age, 34)
+				So(janePosts.Len(), ShouldBeGreaterThan, 1)
+				env.cr.Execute(`DELETE FROM post WHERE id = ?`, janePosts.Ids()[0])
+				So(func() { env.Flush() }, ShouldNotPanic)
+				So(env.recomputeQueue.keys, ShouldBeEmpty)
+				So(janePosts.Records()[1].Get(writerAge), ShouldEqual, 34)
+			})
+			Convey("Searching on a dirty field should recompute it first", func() {
+				janeProfile.Set(age, 31)
+				So(env.Pool("Post").Search(env.Pool("Post").Model().Field(writerAge).Equals(31)).Len(), ShouldEqual, janePosts.Len())
+			})
+			Convey("Searching on a dirty field in a read only environment should recompute it first", func() {
+				janeProfile.Set(age, 33)
+				roPosts := env.ReadOnly().Pool("Post")
+				So(roPosts.Search(roPosts.Model().Field(writerAge).Equals(33)).Len(), ShouldEqual, janePosts.Len())
+				So(roPosts.Search(roPosts.Model().Field(writerAge).Equals(33)).SearchCount(), ShouldEqual, janePosts.Len())
+				So(env.recomputeQueue.keys, ShouldBeEmpty)
+			})
 		}), ShouldBeNil)
 	})
+	Convey("Testing guarded computed fields", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("User")
+			jane := users.Search(users.Model().Field(email).Equals("jane.smith@example.com"))
+			jane.Call("Write", NewModelData(users.Model()).Set(isPremium, false).Set(nums, 2))
+			calls := computePremiumNumsCalls
+			Convey("The compute should be skipped when the guard is false", func() {
+				previous := jane.Get(premiumNums)
+				jane.Set(nums, 3)
+				So(computePremiumNumsCalls, ShouldEqual, calls)
+				So(jane.Get(premiumNums), ShouldEqual, previous)
+			})
+			Convey("Setting the guard should compute the field", func() {
+				jane.Set(isPremium, true)
+				So(computePremiumNumsCalls, ShouldEqual, calls+1)
+				So(jane.Get(premiumNums), ShouldEqual, 20)
+				jane.Set(nums, 4)
+				So(computePremiumNumsCalls, ShouldEqual, calls+2)
+				So(jane.Get(premiumNums), ShouldEqual, 40)
+			})
+			Convey("Unsetting the guard should keep the previous value", func() {
+				jane.Set(isPremium, true)
+				jane.Set(isPremium, false)
+				calls = computePremiumNumsCalls
+				jane.Set(nums, 5)
+				So(computePremiumNumsCalls, ShouldEqual, calls)
+				So(jane.Get(premiumNums), ShouldEqual, 20)
+			})
+			Convey("The guard should be loaded once for all the records", func() {
+				allUsers := users.SearchAll()
+				So(allUsers.Len(), ShouldBeGreaterThan, 1)
+				allUsers.Call("Write", NewModelData(users.Model()).Set(isPremium, false))
+				for _, id := range allUsers.Ids() {
+					env.cache.invalidateRecord(users.Model(), id)
+				}
+				before := env.QueryStats().Count
+				env.Pool("User").withIds(allUsers.Ids()).applyMethod("ComputePremiumNums", "")
+				So(env.QueryStats().Count-before, ShouldEqual, 1)
+				So(computePremiumNumsCalls, ShouldEqual, calls)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing explicit invalidation of computed fields", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("User")
+			userModel := users.Model()
+			jane := users.Search(userModel.Field(email).Equals("jane.smith@example.com"))
+			janeAge := jane.Get(profile).(RecordSet).Collection().Get(age)
+			var invalidated []string
+			Registry.computedInvalidationHooks = []ComputedInvalidationHook{
+				func(model, field string, ids []int64) {
+					invalidated = append(invalidated, fmt.Sprintf("%s.%s%v", model, field, ids))
+				},
+			}
+			Reset(func() {
+				Registry.computedInvalidationHooks = nil
+			})
+			Convey("Non stored fields should be computed again on next read", func() {
+				jane.Get(decoratedName)
+				So(env.cache.checkIfInCache(userModel, jane.Ids(), []string{"decorated_name"}, "", true), ShouldBeTrue)
+				userModel.InvalidateComputed(env, "DecoratedName", jane.Ids()...)
+				So(env.cache.checkIfInCache(userModel, jane.Ids(), []string{"decorated_name"}, "", true), ShouldBeFalse)
+				So(jane.Get(decoratedName), ShouldEqual, "User: Jane A. Smith [<jane.smith@example.com>]")
+			})
+			Convey("Stored fields should be recomputed", func() {
+				So(jane.Get(age), ShouldEqual, janeAge)
+				env.Cr().Execute(`UPDATE "user" SET age = 99 WHERE id = ?`, jane.Ids()[0])
+				userModel.InvalidateComputed(env, "Age")
+				var dbAge int16
+				env.Cr().Get(&dbAge, `SELECT age FROM "user" WHERE id = ?`, jane.Ids()[0])
+				So(dbAge, ShouldEqual, janeAge)
+			})
+			Convey("Hooks should not be called before commit", func() {
+				userModel.InvalidateComputed(env, "DecoratedName", jane.Ids()...)
+				So(invalidated, ShouldBeEmpty)
+			})
+			Convey("Invalidating a non computed field should panic", func() {
+				So(func() { userModel.InvalidateComputed(env, "Name") }, ShouldPanic)
+			})
+			Convey("Applying an invalidation should not call hooks", func() {
+				ApplyComputedInvalidation(env, "User", "DecoratedName", jane.Ids())
+				So(invalidated, ShouldBeEmpty)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing invalidation hooks after commit", t, func() {
+		var invalidated []string
+		Registry.computedInvalidationHooks = []ComputedInvalidationHook{
+			func(model, field string, ids []int64) {
+				invalidated = append(invalidated, fmt.Sprintf("%s.%s%v", model, field, ids))
+			},
+		}
+		Reset(func() {
+			Registry.computedInvalidationHooks = nil
+		})
+		Convey("Hooks should be called once the transaction is committed", func() {
+			var janeIds []int64
+			So(ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				users := env.Pool("User")
+				jane := users.Search(users.Model().Field(email).Equals("jane.smith@example.com"))
+				janeIds = jane.Ids()
+				users.Model().InvalidateComputed(env, "DecoratedName", janeIds...)
+				So(invalidated, ShouldBeEmpty)
+			}), ShouldBeNil)
+			So(invalidated, ShouldResemble, []string{fmt.Sprintf("User.DecoratedName%v", janeIds)})
+		})
+		Convey("Hooks should not be called if the transaction is rolled back", func() {
+			So(ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				users := env.Pool("User")
+				users.Model().InvalidateComputed(env, "DecoratedName")
+				panic("rollback")
+			}), ShouldNotBeNil)
+			So(invalidated, ShouldBeEmpty)
+		})
+	})
+}
+
+// benchmarkRecompute writes n times the age of Jane's profile, deferring
+// the recomputation of the dependent stored fields if deferred is true.
+func benchmarkRecompute(b *testing.B, n int, deferred bool) {
+	for i := 0; i < b.N; i++ {
+		err := SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("User")
+			jane := users.Search(users.Model().Field(email).Equals("jane.smith@example.com"))
+			janeProfile := jane.Get(profile).(RecordSet).Collection().WithContext("hexya_defer_recompute", deferred)
+			for j := 0; j < n; j++ {
+				janeProfile.Set(age, int16(30+j))
+			}
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkImmediateRecompute(b *testing.B) {
+	benchmarkRecompute(b, 20, false)
+}
+
+func BenchmarkDeferredRecompute(b *testing.B) {
+	benchmarkRecompute(b, 20, true)
 }
 
 func TestRelatedNonStoredFields(t *testing.T) {
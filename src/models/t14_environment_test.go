@@ -15,10 +15,15 @@
 package models
 
 import (
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/hexya-erp/hexya/src/models/security"
 	"github.com/hexya-erp/hexya/src/models/types"
+	"github.com/hexya-erp/hexya/src/tools/exceptions"
 	"github.com/lib/pq"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -86,6 +91,25 @@ func TestEnvironment(t *testing.T) {
 				So(posts1.Env().Context().GetString("foo"), ShouldEqual, "bar")
 				So(allPosts.Env().Context().HasKey("foo"), ShouldBeFalse)
 			})
+			Convey("Checking active records from the context", func() {
+				userWill := users.Search(users.Model().Field(email).Equals("will.smith@example.com"))
+				So(env.ActiveId(), ShouldEqual, 0)
+				So(env.ActiveIds(), ShouldBeEmpty)
+				So(env.ActiveModel(), ShouldBeEmpty)
+				So(users.ActiveRecords().IsEmpty(), ShouldBeTrue)
+				users1 := users.WithContext("active_id", userJane.Ids()[0])
+				So(users1.Env().ActiveIds(), ShouldResemble, userJane.Ids())
+				So(users1.ActiveRecords().Equals(userJane), ShouldBeTrue)
+				users2 := users1.
+					WithContext("active_ids", []int64{userJane.Ids()[0], userWill.Ids()[0]}).
+					WithContext("active_model", "User")
+				So(users2.Env().ActiveId(), ShouldEqual, userJane.Ids()[0])
+				So(users2.Env().ActiveModel(), ShouldEqual, "User")
+				So(users2.ActiveRecords().Len(), ShouldEqual, 2)
+				So(users2.ActiveRecords().Equals(userJane.Union(userWill)), ShouldBeTrue)
+				posts := env.Pool("Post").WithNewContext(users2.Env().Context())
+				So(func() { posts.ActiveRecords() }, ShouldPanic)
+			})
 		}), ShouldBeNil)
 	})
 	Convey("Testing cache operation", t, func() {
@@ -264,6 +288,39 @@ X2M Links
 		nepe := new(nonExistentPathError)
 		So(nepe.Error(), ShouldEqual, "requested path is broken")
 	})
+	Convey("Checking ORM exceptions", t, func() {
+		Convey("A failed constraint should return a ValidationError", func() {
+			err := SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				env.Pool("Tag").Call("Create", NewModelData(Registry.MustGet("Tag"), FieldMap{
+					"Name":        "Tag1",
+					"Description": "Tag1",
+				}))
+			})
+			So(err, ShouldHaveSameTypeAs, exceptions.ValidationError{})
+			So(err.(exceptions.ValidationError).Message, ShouldEqual, "Tag name and description must be different")
+		})
+		Convey("Database errors in a constraint method should not be turned into a ValidationError", func() {
+			err := SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				env.Pool("Tag").SearchAll().Limit(1).checkConstraint("ComputeFromMissingTable")
+			})
+			So(err, ShouldHaveSameTypeAs, exceptions.UserError{})
+			So(err.(exceptions.UserError).Message, ShouldContainSubstring, "hexya_missing_table")
+		})
+		Convey("Browsing missing records should return a MissingError", func() {
+			err := SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				Registry.MustGet("User").BrowseStrict(env, []int64{987654})
+			})
+			So(err, ShouldHaveSameTypeAs, exceptions.MissingError{})
+			So(err.(exceptions.MissingError).Message, ShouldEqual, "Some records do not exist or cannot be accessed")
+			So(err.(exceptions.MissingError).Debug, ShouldContainSubstring, "987654")
+		})
+		Convey("Persistent serialization errors should return a ConcurrencyError", func() {
+			err := ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+				panic(&pq.Error{Code: "40001"})
+			})
+			So(err, ShouldHaveSameTypeAs, exceptions.ConcurrencyError{})
+		})
+	})
 	Convey("Testing db error retries", t, func() {
 		Convey("ExecuteInNewEnvironment should retry db errors up to max retries", func() {
 			var retries uint8
@@ -302,4 +359,132 @@ X2M Links
 			So(retries, ShouldEqual, 3)
 		})
 	})
+	Convey("Testing read only environments routing", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			roEnv := env.ReadOnly()
+			So(roEnv.cr.readTx(roEnv.readOnly), ShouldEqual, env.cr.tx)
+			DBConnectReplica(DBParams())
+			defer func() {
+				env.cr.closeReplica()
+				replicaDB.Close()
+				replicaDB = nil
+			}()
+			So(env.cr.readTx(env.readOnly), ShouldEqual, env.cr.tx)
+			So(roEnv.cr.readTx(roEnv.readOnly), ShouldNotEqual, env.cr.tx)
+			So(roEnv.Pool("User").SearchAll().SearchCount(), ShouldEqual, env.Pool("User").SearchAll().SearchCount())
+			So(roEnv.Pool("User").SearchAll().Len(), ShouldEqual, env.Pool("User").SearchAll().Len())
+			env.Pool("Tag").SearchAll().Limit(1).Set(rate, float32(5))
+			So(roEnv.cr.readTx(roEnv.readOnly), ShouldEqual, env.cr.tx)
+		}), ShouldBeNil)
+	})
+	Convey("Testing parallel execution on records", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("User").SearchAll().WithContext("parallel_key", "parallel value")
+			So(users.Len(), ShouldBeGreaterThan, 2)
+			Convey("Records should be processed concurrently in isolated environments", func() {
+				var (
+					mu               sync.Mutex
+					running, maxRuns int32
+				)
+				cursors := make(map[*Cursor]bool)
+				processed := make(map[int64]bool)
+				errs := users.ForEachParallel(2, func(rec *RecordCollection) error {
+					n := atomic.AddInt32(&running, 1)
+					defer atomic.AddInt32(&running, -1)
+					mu.Lock()
+					if n > maxRuns {
+						maxRuns = n
+					}
+					cursors[rec.Env().Cr()] = true
+					processed[rec.ids[0]] = rec.Len() == 1 && rec.Env().Context().GetString("parallel_key") == "parallel value"
+					mu.Unlock()
+					time.Sleep(50 * time.Millisecond)
+					return nil
+				})
+				So(errs, ShouldBeNil)
+				So(maxRuns, ShouldEqual, 2)
+				So(cursors, ShouldHaveLength, users.Len())
+				So(cursors, ShouldNotContainKey, env.Cr())
+				So(processed, ShouldHaveLength, users.Len())
+				for _, ok := range processed {
+					So(ok, ShouldBeTrue)
+				}
+			})
+			Convey("Errors should be collected and roll back their transaction", func() {
+				jane := users.Search(users.Model().Field(email).Equals("jane.smith@example.com"))
+				janeNums := jane.Get(nums)
+				errJane := errors.New("jane failed")
+				errs := users.ForEachParallel(3, func(rec *RecordCollection) error {
+					if rec.Get(email) == "jane.smith@example.com" {
+						rec.Set(nums, 1234)
+						return errJane
+					}
+					return nil
+				})
+				So(errs, ShouldHaveLength, users.Len())
+				for i, id := range users.Ids() {
+					if id == jane.Ids()[0] {
+						So(errs[i], ShouldEqual, errJane)
+						continue
+					}
+					So(errs[i], ShouldBeNil)
+				}
+				So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+					So(env.Pool("User").Search(env.Pool("User").Model().Field(email).Equals("jane.smith@example.com")).Get(nums), ShouldEqual, janeNums)
+				}), ShouldBeNil)
+			})
+			Convey("ForEachParallel should panic with a null concurrency", func() {
+				So(func() { users.ForEachParallel(0, func(rec *RecordCollection) error { return nil }) }, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing independent transactions", t, func() {
+		tagModel := Registry.MustGet("Tag")
+		var (
+			cursor        *Cursor
+			contextValue  string
+			failedErr     error
+			errRollback   = errors.New("rollback side effect")
+			loggedTagCond = tagModel.Field(Name).Equals("Logged In New Transaction")
+			failedTagCond = tagModel.Field(Name).Equals("Failed In New Transaction")
+		)
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			users := env.Pool("User").SearchAll().WithContext("transaction_key", "transaction value")
+			users.Load()
+			err := users.InNewTransaction(func(rec *RecordCollection) error {
+				cursor = rec.Env().Cr()
+				contextValue = rec.Env().Context().GetString("transaction_key")
+				So(rec.Ids(), ShouldResemble, users.Ids())
+				rec.Env().Pool("Tag").Call("Create", NewModelData(tagModel).Set(Name, "Logged In New Transaction"))
+				return nil
+			})
+			So(err, ShouldBeNil)
+			failedErr = users.InNewTransaction(func(rec *RecordCollection) error {
+				rec.Env().Pool("Tag").Call("Create", NewModelData(tagModel).Set(Name, "Failed In New Transaction"))
+				return errRollback
+			})
+			So(cursor, ShouldNotEqual, env.Cr())
+			So(contextValue, ShouldEqual, "transaction value")
+			virtual := env.Pool("User").Call("New", NewModelData(users.model).Set(Name, "Virtual")).(RecordSet).Collection()
+			So(func() { virtual.InNewTransaction(func(rec *RecordCollection) error { return nil }) }, ShouldPanic)
+		}), ShouldBeNil)
+		So(failedErr, ShouldEqual, errRollback)
+		So(ExecuteInNewEnvironment(security.SuperUserID, func(env Environment) {
+			logged := env.Pool("Tag").Search(loggedTagCond)
+			So(logged.Len(), ShouldEqual, 1)
+			So(env.Pool("Tag").Search(failedTagCond).IsEmpty(), ShouldBeTrue)
+			logged.Call("Unlink")
+		}), ShouldBeNil)
+	})
+	Convey("Testing query statistics", t, func() {
+		So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+			before := env.QueryStats()
+			users := env.Pool("User").SearchAll()
+			users.Fetch()
+			after := env.QueryStats()
+			So(after.Count, ShouldBeGreaterThan, before.Count)
+			So(after.TotalTime, ShouldBeGreaterThan, before.TotalTime)
+			So(users.Env().QueryStats(), ShouldResemble, after)
+		}), ShouldBeNil)
+	})
 }
@@ -5,6 +5,7 @@ package models
 
 import (
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -59,6 +60,35 @@ func TestBaseModelMethods(t *testing.T) {
 				j23 := env.Pool("User").Call("BrowseOne", jid).(RecordSet).Collection()
 				So(j23.Equals(userJane), ShouldBeTrue)
 			})
+			Convey("BrowseStrict", func() {
+				jid := userJane.Ids()[0]
+				j2 := userModel.BrowseStrict(env, []int64{jid})
+				So(j2.Equals(userJane), ShouldBeTrue)
+				So(func() { userModel.BrowseStrict(env, []int64{jid, 987654}) }, ShouldPanic)
+				So(func() { env.Pool("User").Call("BrowseStrict", []int64{987654}) }, ShouldPanic)
+			})
+			Convey("BrowseExternal", func() {
+				userJohn := userModel.Search(env, userModel.Field(Name).Equals("John Smith"))
+				janeExtID := userJane.Get(hexyaExternalID).(string)
+				johnExtID := userJohn.Get(hexyaExternalID).(string)
+				users := userModel.BrowseExternal(env, johnExtID, janeExtID)
+				So(users.Ids(), ShouldResemble, []int64{userJohn.Ids()[0], userJane.Ids()[0]})
+				users = userModel.BrowseExternal(env, janeExtID, johnExtID)
+				So(users.Ids(), ShouldResemble, []int64{userJane.Ids()[0], userJohn.Ids()[0]})
+				So(userModel.BrowseExternal(env).IsEmpty(), ShouldBeTrue)
+				So(func() { userModel.BrowseExternal(env, janeExtID, "unknown_user") }, ShouldPanic)
+				So(func() { env.Pool("User").Call("BrowseExternal", []string{"unknown_user"}) }, ShouldPanic)
+			})
+			Convey("BrowseOrdered", func() {
+				userJohn := userModel.Search(env, userModel.Field(Name).Equals("John Smith"))
+				jid, jnid := userJane.Ids()[0], userJohn.Ids()[0]
+				users := userModel.BrowseOrdered(env, []int64{jnid, jid})
+				So(users.Ids(), ShouldResemble, []int64{jnid, jid})
+				So(users.Records()[0].Get(Name), ShouldEqual, "John Smith")
+				users = userModel.BrowseOrdered(env, []int64{jid, 987654, jnid, jid})
+				So(users.Ids(), ShouldResemble, []int64{jid, jnid})
+				So(userModel.BrowseOrdered(env, nil).IsEmpty(), ShouldBeTrue)
+			})
 			Convey("SearchCount", func() {
 				countSingle := userJane.Call("SearchCount").(int)
 				So(countSingle, ShouldEqual, 1)
@@ -93,9 +123,10 @@ func TestBaseModelMethods(t *testing.T) {
 				fInfo := userJane.Call("FieldGet", FieldName(Name)).(*FieldInfo)
 				So(fInfo.String, ShouldEqual, "Name")
 				So(fInfo.Help, ShouldEqual, "The user's username")
+				So(fInfo.Placeholder, ShouldEqual, "e.g. John Smith")
 				So(fInfo.Type, ShouldEqual, fieldtype.Char)
 				fInfos := userJane.Call("FieldsGet", FieldsGetArgs{}).(map[string]*FieldInfo)
-				So(fInfos, ShouldHaveLength, 35)
+				So(fInfos, ShouldHaveLength, 36)
 			})
 			Convey("NameGet", func() {
 				So(userJane.Get(displayName), ShouldEqual, "Jane A. Smith")
@@ -197,6 +228,120 @@ func TestBaseModelMethods(t *testing.T) {
 					So(fMap, ShouldContainKey, "best_profile_post_id")
 					So(fMap["best_profile_post_id"].(RecordSet).Collection().Equals(post), ShouldBeTrue)
 				})
+				Convey("Testing dynamic filters", func() {
+					commentModel := Registry.MustGet("Comment")
+					companyA := env.Pool("Company").Call("Create", NewModelData(Registry.MustGet("Company")).Set(Name, "Company A")).(RecordSet).Collection()
+					post := env.Pool("Post").Search(env.Pool("Post").Model().Field(title).Equals("1st Post"))
+					post.Set(company, companyA)
+					So(commentModel.FieldsGet(company)["company_id"].OnChange, ShouldBeTrue)
+					So(commentModel.FieldsGet(text)["text"].OnChange, ShouldBeFalse)
+					res := env.Pool("Comment").Call("Onchange", OnchangeParams{
+						Fields:   []FieldName{company},
+						Onchange: map[string]string{"Company": "1"},
+						Values:   NewModelData(commentModel, FieldMap{"Text": "", "Company": companyA}),
+					}).(OnchangeResult)
+					So(res.Filters, ShouldHaveLength, 1)
+					So(res.Filters, ShouldContainKey, commentModel.FieldName("Post"))
+					filtered := env.Pool("Post").Search(res.Filters[commentModel.FieldName("Post")].Underlying())
+					So(filtered.Equals(post), ShouldBeTrue)
+					res = env.Pool("Comment").Call("Onchange", OnchangeParams{
+						Fields:   []FieldName{company},
+						Onchange: map[string]string{"Company": "1"},
+						Values:   NewModelData(commentModel, FieldMap{"Text": "", "Company": false}),
+					}).(OnchangeResult)
+					So(res.Filters, ShouldContainKey, commentModel.FieldName("Post"))
+					So(res.Filters[commentModel.FieldName("Post")].Underlying().IsEmpty(), ShouldBeTrue)
+				})
+			})
+			Convey("DisplayNames", func() {
+				tagModel := Registry.MustGet("Tag")
+				for i := 0; i < 30; i++ {
+					env.Pool("Tag").Call("Create", NewModelData(tagModel).Set(Name, fmt.Sprintf("DisplayNames Tag %02d", i)))
+				}
+				countQueries := func(tags *RecordCollection) int {
+					for _, id := range tags.Ids() {
+						env.cache.invalidateRecord(tagModel, id)
+					}
+					before := env.QueryStats().Count
+					names := tags.Call("DisplayNames").(map[int64]string)
+					count := env.QueryStats().Count - before
+					So(names, ShouldHaveLength, tags.Len())
+					for _, tag := range tags.Records() {
+						So(names[tag.Ids()[0]], ShouldEqual, tag.Get(Name))
+					}
+					return count
+				}
+				one := env.Pool("Tag").Search(tagModel.Field(Name).Equals("DisplayNames Tag 00")).Fetch()
+				all := env.Pool("Tag").Search(tagModel.Field(Name).Contains("DisplayNames Tag")).Fetch()
+				So(one.Len(), ShouldEqual, 1)
+				So(all.Len(), ShouldEqual, 30)
+				So(countQueries(all), ShouldEqual, countQueries(one))
+				So(env.Pool("Tag").Call("DisplayNames"), ShouldBeEmpty)
+			})
+			Convey("RelationNames", func() {
+				userJohn := userModel.Search(env, userModel.Field(Name).Equals("John Smith"))
+				So(userJohn.Len(), ShouldEqual, 1)
+				for i := 0; i < 30; i++ {
+					author := userJane
+					if i%2 == 1 {
+						author = userJohn
+					}
+					env.Pool("Post").Call("Create", NewModelData(postModel).
+						Set(title, fmt.Sprintf("RelationNames Post %02d", i)).
+						Set(content, "Content").
+						Set(user, author))
+				}
+				env.Pool("Post").Call("Create", NewModelData(postModel).
+					Set(title, "RelationNames Post Without User").
+					Set(content, "Content"))
+				countQueries := func(posts *RecordCollection) int {
+					for _, id := range posts.Ids() {
+						env.cache.invalidateRecord(postModel, id)
+					}
+					env.cache.invalidateRecord(userModel, userJane.Ids()[0])
+					env.cache.invalidateRecord(userModel, userJohn.Ids()[0])
+					before := env.QueryStats().Count
+					names := posts.RelationNames(user)
+					count := env.QueryStats().Count - before
+					for _, post := range posts.Records() {
+						author := post.Get(user).(RecordSet).Collection()
+						if author.IsEmpty() {
+							So(names, ShouldNotContainKey, post.Ids()[0])
+							continue
+						}
+						So(names[post.Ids()[0]], ShouldEqual, author.Get(Name))
+					}
+					return count
+				}
+				one := env.Pool("Post").Search(postModel.Field(title).Equals("RelationNames Post 00")).Fetch()
+				all := env.Pool("Post").Search(postModel.Field(title).Contains("RelationNames Post")).Fetch()
+				So(one.Len(), ShouldEqual, 1)
+				So(all.Len(), ShouldEqual, 31)
+				So(countQueries(all), ShouldEqual, countQueries(one))
+				So(userJohn.Get(Name), ShouldNotEqual, userJane.Get(Name))
+				names := all.RelationNames(user)
+				So(names, ShouldHaveLength, 30)
+				janePosts := all.Filtered(func(rs RecordSet) bool {
+					return rs.Collection().Get(user).(RecordSet).Collection().Equals(userJane)
+				})
+				johnPosts := all.Filtered(func(rs RecordSet) bool {
+					return rs.Collection().Get(user).(RecordSet).Collection().Equals(userJohn)
+				})
+				So(janePosts.Len(), ShouldEqual, 15)
+				So(johnPosts.Len(), ShouldEqual, 15)
+				for _, id := range janePosts.Ids() {
+					So(names[id], ShouldEqual, userJane.Get(Name))
+				}
+				for _, id := range johnPosts.Ids() {
+					So(names[id], ShouldEqual, userJohn.Get(Name))
+				}
+				janeNames := janePosts.RelationNames(user)
+				So(janeNames, ShouldHaveLength, 15)
+				for _, id := range johnPosts.Ids() {
+					So(janeNames, ShouldNotContainKey, id)
+				}
+				So(env.Pool("Post").RelationNames(user), ShouldBeEmpty)
+				So(func() { all.RelationNames(tags) }, ShouldPanic)
 			})
 			Convey("CheckRecursion", func() {
 				So(userJane.Call("CheckRecursion").(bool), ShouldBeTrue)
@@ -427,6 +572,56 @@ func TestBaseModelMethods(t *testing.T) {
 					So(post.Get(title), ShouldEqual, fmt.Sprintf("Post no %02d", 19-i))
 				}
 			})
+			Convey("Resort", func() {
+				tagModel := Registry.MustGet("Tag")
+				for i := 0; i < 5; i++ {
+					env.Pool("Tag").Call("Create", NewModelData(tagModel).
+						Set(Name, fmt.Sprintf("Resort %d", i)).
+						Set(rate, float32(i)))
+				}
+				rTags := env.Pool("Tag").Search(tagModel.Field(Name).Contains("Resort")).OrderBy("Rate")
+				records := rTags.Records()
+				So(records, ShouldHaveLength, 5)
+				for i, tag := range records {
+					So(tag.Get(Name), ShouldEqual, fmt.Sprintf("Resort %d", i))
+					tag.Set(rate, float32(10-i))
+				}
+				So(rTags.Records()[0].Get(Name), ShouldEqual, "Resort 0")
+				resorted := rTags.Call("Resort").(RecordSet).Collection().Records()
+				So(resorted, ShouldHaveLength, 5)
+				for i, tag := range resorted {
+					So(tag.Get(Name), ShouldEqual, fmt.Sprintf("Resort %d", 4-i))
+				}
+				So(InvalidRecordCollection("Tag").Resort().IsValid(), ShouldBeFalse)
+			})
+			Convey("DiffWith", func() {
+				tagModel := Registry.MustGet("Tag")
+				var tags []*RecordCollection
+				for i := 0; i < 3; i++ {
+					tags = append(tags, env.Pool("Tag").Call("Create", NewModelData(tagModel).
+						Set(Name, fmt.Sprintf("Diff %d", i)).
+						Set(description, "Description")).(RecordSet).Collection())
+				}
+				tags[1].WithContext("lang", "fr_FR").Set(description, "Description traduite")
+				tags01 := tags[0].Union(tags[1])
+				tags12 := tags[1].Union(tags[2]).WithContext("lang", "fr_FR")
+				Convey("Overlapping sets should report differing fields and records in one set only", func() {
+					diff := tags01.Call("DiffWith", tags12, []FieldName{Name, description}).(*RecordsDiff)
+					So(diff.Fields, ShouldHaveLength, 1)
+					So(diff.Fields[tags[1].ids[0]], ShouldResemble, []string{"Description"})
+					So(diff.OnlyInRecords, ShouldResemble, []int64{tags[0].ids[0]})
+					So(diff.OnlyInOther, ShouldResemble, []int64{tags[2].ids[0]})
+					So(tags01.DiffWith(tags12).Fields[tags[1].ids[0]], ShouldResemble, []string{"Description"})
+					So(tags01.DiffWith(tags12.WithContext("lang", ""), Name, description).Fields, ShouldBeEmpty)
+				})
+				Convey("Disjoint sets should have no common records", func() {
+					diff := tags[0].DiffWith(tags[2])
+					So(diff.Fields, ShouldBeEmpty)
+					So(diff.OnlyInRecords, ShouldResemble, []int64{tags[0].ids[0]})
+					So(diff.OnlyInOther, ShouldResemble, []int64{tags[2].ids[0]})
+					So(func() { tags[0].DiffWith(env.Pool("User")) }, ShouldPanic)
+				})
+			})
 			Convey("Testing one2many sets keep the default order", func() {
 				userJane.Get(posts).(RecordSet).Collection().Call("Unlink")
 				for i := 0; i < 20; i++ {
@@ -528,6 +723,59 @@ func TestPostBootSequences(t *testing.T) {
 		seq.Drop()
 		So(TestAdapter.sequences("%_manseq"), ShouldHaveLength, 0)
 	})
+	Convey("Testing default values from sequences", t, func() {
+		seq := CreateSequence("WizardNumber", 1, 100)
+		valueField := Registry.MustGet("Wizard").fields.MustGet("Value")
+		nameField := Registry.MustGet("Wizard").fields.MustGet("Name")
+		valueField.defaultFunc = NextSequence("WizardNumber")
+		nameField.defaultFunc = NextSequenceString("WizardNumber", "WIZ%04d")
+		Convey("DefaultGet should not consume the sequence", func() {
+			So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				defaults := env.Pool("Wizard").Call("DefaultGet").(RecordData).Underlying()
+				So(defaults.Get(value), ShouldBeNil)
+				wiz := env.Pool("Wizard").Call("Create", NewModelData(Registry.MustGet("Wizard"))).(RecordSet).Collection()
+				So(wiz.Get(value), ShouldBeBetweenOrEqual, 100, 101)
+				So(wiz.Get(Name), ShouldBeIn, "WIZ0100", "WIZ0101")
+				So(wiz.Get(Name), ShouldNotEqual, fmt.Sprintf("WIZ%04d", wiz.Get(value)))
+			}), ShouldBeNil)
+		})
+		Convey("Given values should not consume the sequence", func() {
+			So(SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+				wizModel := Registry.MustGet("Wizard")
+				wiz1 := env.Pool("Wizard").Call("Create", NewModelData(wizModel)).(RecordSet).Collection()
+				wiz2 := env.Pool("Wizard").Call("Create", NewModelData(wizModel).Set(value, 5).Set(Name, "Manual")).(RecordSet).Collection()
+				So(wiz2.Get(value), ShouldEqual, 5)
+				So(wiz2.Get(Name), ShouldEqual, "Manual")
+				wiz3 := env.Pool("Wizard").Call("Create", NewModelData(wizModel)).(RecordSet).Collection()
+				So(wiz3.Get(value), ShouldEqual, wiz1.Get(value).(int64)+2)
+			}), ShouldBeNil)
+		})
+		Convey("Concurrent creates should get distinct numbers", func() {
+			var wg sync.WaitGroup
+			values := make(chan int64, 10)
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					SimulateInNewEnvironment(security.SuperUserID, func(env Environment) {
+						wiz := env.Pool("Wizard").Call("Create", NewModelData(Registry.MustGet("Wizard"))).(RecordSet).Collection()
+						values <- wiz.Get(value).(int64)
+					})
+				}()
+			}
+			wg.Wait()
+			close(values)
+			seen := make(map[int64]bool)
+			for v := range values {
+				So(seen[v], ShouldBeFalse)
+				seen[v] = true
+			}
+			So(seen, ShouldHaveLength, 10)
+		})
+		valueField.defaultFunc = DefaultValue(0)
+		nameField.defaultFunc = nil
+		seq.Drop()
+	})
 	Convey("Boot sequences cannot be altered or dropped after bootstrap", t, func() {
 		bootSeq := Registry.MustGetSequence("TestSequence")
 		So(bootSeq.boot, ShouldBeTrue)
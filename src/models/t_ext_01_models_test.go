@@ -345,7 +345,7 @@ func TestExtModelDeclaration(t *testing.T) {
 			})
 
 		userModel.AddFields(map[string]models.FieldDefinition{
-			"Name": fields.Char{String: "Name", Help: "The user's username", Unique: true,
+			"Name": fields.Char{String: "Name", Help: "The user's username", Placeholder: "e.g. John Smith", Unique: true,
 				NoCopy: true, OnChange: userModel.Methods().MustGet("OnChangeName"),
 				OnChangeFilters: userModel.Methods().MustGet("OnChangeNameFilters"),
 				OnChangeWarning: userModel.Methods().MustGet("OnChangeNameWarning"),
@@ -0,0 +1,170 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import "sort"
+
+// A TempRecord is a record to create with CreateWithTempIDs.
+type TempRecord struct {
+	// Model is the name of the model of the record
+	Model string
+	// TempID is the negative id given to the record by the client
+	TempID int64
+	// Values are the values of the fields of the record, by field name.
+	// Relation fields can reference other records of the batch by their
+	// TempID: many2one values as an int64 and one2many or many2many
+	// values as a []int64.
+	Values FieldMap
+}
+
+// CreateWithTempIDs creates the given records, which may reference each other
+// through their temporary ids, and returns the id of each created record by
+// temporary id. It is meant for clients that create records offline and sync
+// them afterwards.
+//
+// Records are created so that the records referenced by a many2one field are
+// created first. One2many and many2many fields referencing records of the batch
+// are written once all the records are created, so that a parent and its
+// children can reference each other. CreateWithTempIDs panics if the many2one
+// fields of the records reference each other in a cycle, or if a temporary id
+// is not given to a record of the batch.
+func CreateWithTempIDs(env Environment, records []TempRecord) map[int64]int64 {
+	byTempID := make(map[int64]*TempRecord, len(records))
+	for i, rec := range records {
+		if rec.TempID >= 0 {
+			log.Panic("Temporary ids must be negative", "model", rec.Model, "tempID", rec.TempID)
+		}
+		if _, exists := byTempID[rec.TempID]; exists {
+			log.Panic("Duplicate temporary id", "model", rec.Model, "tempID", rec.TempID)
+		}
+		byTempID[rec.TempID] = &records[i]
+	}
+	res := make(map[int64]int64, len(records))
+	deferred := make(map[int64]FieldMap)
+	for _, rec := range tempRecordsCreationOrder(records, byTempID) {
+		model := Registry.MustGet(rec.Model)
+		values := make(FieldMap)
+		for field, value := range rec.Values {
+			fi := model.fields.MustGet(field)
+			if fi.fieldType.IsFKRelationType() {
+				if id, ok := tempID(value); ok {
+					value = res[id]
+				}
+			}
+			if ids, ok := value.([]int64); ok && fi.fieldType.Is2ManyRelationType() && hasTempIDs(ids) {
+				if deferred[rec.TempID] == nil {
+					deferred[rec.TempID] = make(FieldMap)
+				}
+				deferred[rec.TempID][field] = ids
+				continue
+			}
+			values[field] = value
+		}
+		rc := env.Pool(model.name)
+		res[rec.TempID] = model.Create(env, NewModelDataFromRS(rc, values)).ids[0]
+	}
+	for _, rec := range records {
+		values, ok := deferred[rec.TempID]
+		if !ok {
+			continue
+		}
+		for field, value := range values {
+			ids := value.([]int64)
+			realIds := make([]int64, len(ids))
+			for i, id := range ids {
+				realIds[i] = id
+				if id < 0 {
+					realIds[i] = res[id]
+				}
+			}
+			values[field] = realIds
+		}
+		rc := env.Pool(rec.Model).withIds([]int64{res[rec.TempID]})
+		rc.Call("Write", NewModelDataFromRS(rc, values))
+	}
+	return res
+}
+
+// tempRecordsCreationOrder returns the given records sorted so that the records
+// referenced by the many2one fields of a record come before it. It panics if
+// records reference each other in a cycle or if a temporary id is unknown.
+func tempRecordsCreationOrder(records []TempRecord, byTempID map[int64]*TempRecord) []*TempRecord {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	res := make([]*TempRecord, 0, len(records))
+	states := make(map[int64]int, len(records))
+	var visit func(rec *TempRecord, path []int64)
+	visit = func(rec *TempRecord, path []int64) {
+		switch states[rec.TempID] {
+		case visited:
+			return
+		case visiting:
+			log.Panic("Records reference each other in a cycle", "tempIDs", append(path, rec.TempID))
+		}
+		states[rec.TempID] = visiting
+		model := Registry.MustGet(rec.Model)
+		fields := make([]string, 0, len(rec.Values))
+		for field := range rec.Values {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			value := rec.Values[field]
+			fi := model.fields.MustGet(field)
+			var refs []int64
+			switch {
+			case fi.fieldType.IsFKRelationType():
+				if id, ok := tempID(value); ok {
+					refs = []int64{id}
+				}
+			case fi.fieldType.Is2ManyRelationType():
+				// Written after creation, we only check that the ids exist
+				if ids, ok := value.([]int64); ok {
+					for _, id := range ids {
+						if _, exists := byTempID[id]; id < 0 && !exists {
+							log.Panic("Unknown temporary id", "model", rec.Model, "field", field, "tempID", id)
+						}
+					}
+				}
+			}
+			for _, id := range refs {
+				ref, exists := byTempID[id]
+				if !exists {
+					log.Panic("Unknown temporary id", "model", rec.Model, "field", field, "tempID", id)
+				}
+				visit(ref, append(path, rec.TempID))
+			}
+		}
+		states[rec.TempID] = visited
+		res = append(res, rec)
+	}
+	for i := range records {
+		visit(&records[i], nil)
+	}
+	return res
+}
+
+// tempID returns the given many2one value as a temporary id and true
+// if it is a negative integer.
+func tempID(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, v < 0
+	case int:
+		return int64(v), v < 0
+	}
+	return 0, false
+}
+
+// hasTempIDs returns true if one of the given ids is a temporary id.
+func hasTempIDs(ids []int64) bool {
+	for _, id := range ids {
+		if id < 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hexya-erp/hexya/src/models/types"
+	"github.com/hexya-erp/hexya/src/models/types/dates"
+)
+
+// tombstoneTable is the name of the table in which the ids of deleted records are logged.
+const tombstoneTable = "hexya_tombstone"
+
+// purgeTombstonesPeriod is the time between two purges of expired tombstones
+const purgeTombstonesPeriod = 1 * time.Hour
+
+// tombstoneRetention is the duration during which tombstones are kept
+var tombstoneRetention = 30 * 24 * time.Hour
+
+// SetTombstoneRetention sets the duration during which the ids of deleted records
+// are kept for DeletedSince. Older tombstones are purged periodically by the worker
+// loop. A zero or negative duration keeps tombstones forever. Default is 30 days.
+func SetTombstoneRetention(retention time.Duration) {
+	tombstoneRetention = retention
+}
+
+// hasTombstones returns true if the ids of the deleted records of this
+// model are logged in the tombstone table, i.e. if it is a regular model.
+func (m *Model) hasTombstones() bool {
+	return !m.IsMixin() && !m.IsManual() && !m.IsTransient() && !m.isSystem()
+}
+
+// createTombstoneTable creates the tombstone table if it does not exist.
+func createTombstoneTable() {
+	dbExecuteNoTx(fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+	model varchar NOT NULL,
+	record_id bigint NOT NULL,
+	deleted_at timestamp without time zone NOT NULL
+)`, tombstoneTable))
+	dbExecuteNoTx(fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_model_deleted_at_index ON %[1]s (model, deleted_at)`, tombstoneTable))
+}
+
+// addTombstones logs the given ids of this RecordCollection's model as deleted
+// in the tombstone table, in the current transaction.
+func (rc *RecordCollection) addTombstones(ids []int64) {
+	if !rc.model.hasTombstones() || len(ids) == 0 {
+		return
+	}
+	rc.env.cr.Execute(fmt.Sprintf(`INSERT INTO %s (model, record_id, deleted_at) SELECT ?, unnest(?::bigint[]), ?`, tombstoneTable),
+		rc.model.name, types.IntegerArray(ids), dates.Now())
+}
+
+// DeletedSince returns the ids of the records of this model that have been
+// unlinked at or after since, ordered by deletion time. Along with ChangedSince,
+// it allows to send all the changes made since a given time to an external system.
+//
+// Deleted ids are only kept for the duration set by SetTombstoneRetention.
+// DeletedSince panics if this model is a mixin, manual, transient or system
+// model, since their deleted records are not logged.
+func (m *Model) DeletedSince(env Environment, since time.Time) []int64 {
+	if !m.hasTombstones() {
+		log.Panic("Deleted records are not logged for this model", "model", m.name)
+	}
+	env.Pool(m.name).CheckExecutionPermission(m.methods.MustGet("Load"))
+	res := make([]int64, 0)
+	env.cr.Select(&res, fmt.Sprintf(`SELECT record_id FROM %s WHERE model = ? AND deleted_at >= ? ORDER BY deleted_at, record_id`, tombstoneTable),
+		m.name, dates.DateTime{Time: since.UTC()})
+	return res
+}
+
+// PurgeTombstones removes from the database the tombstones of deleted
+// records that are older than the retention set by SetTombstoneRetention.
+func PurgeTombstones() {
+	if tombstoneRetention <= 0 {
+		return
+	}
+	dbExecuteNoTx(fmt.Sprintf(`DELETE FROM %s WHERE deleted_at < ?`, tombstoneTable), dates.Now().Add(-tombstoneRetention))
+}
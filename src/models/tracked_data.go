@@ -0,0 +1,158 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"reflect"
+	"sort"
+)
+
+// AllTracked returns the values of all records of the RecordCollection as a
+// slice of ModelData, as All does, but with change tracking: the fields that
+// are modified afterwards in each ModelData are given by DirtyFields, and can
+// be written back to the records with WriteDirty.
+func (rc *RecordCollection) AllTracked() []*ModelData {
+	res := rc.All()
+	for _, md := range res {
+		md.original = md.FieldMap.Copy()
+	}
+	return res
+}
+
+// IsTracked returns true if the changes of this ModelData are tracked,
+// i.e. if it has been returned by AllTracked. Copies are not tracked.
+func (md *ModelData) IsTracked() bool {
+	return md.original != nil
+}
+
+// DirtyFields returns the fields of this ModelData whose value has been set to a
+// new value since it has been returned by AllTracked or written by WriteDirty,
+// sorted by JSON name. Relation fields are compared by the ids of their records.
+// Fields that have been unset are not returned.
+//
+// DirtyFields returns nil if the changes of this ModelData are not tracked.
+func (md *ModelData) DirtyFields() FieldNames {
+	if !md.IsTracked() {
+		return nil
+	}
+	var res FieldNames
+	for key, value := range md.FieldMap {
+		fName := md.Model.FieldName(key)
+		if fi, ok := md.Model.fields.Get(key); ok {
+			fName = fieldName{name: fi.name, json: fi.json}
+		}
+		orig, ok := md.original[fName.JSON()]
+		if !ok {
+			orig, ok = md.original[fName.Name()]
+		}
+		if ok && trackedValuesEqual(orig, value) {
+			continue
+		}
+		res = append(res, fName)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].JSON() < res[j].JSON()
+	})
+	return res
+}
+
+// dirtyData returns a new ModelData with only the dirty fields of this ModelData
+// and the related records to create, or nil if there is nothing to write.
+func (md *ModelData) dirtyData() *ModelData {
+	dirty := md.DirtyFields()
+	if len(dirty) == 0 && len(md.ToCreate) == 0 {
+		return nil
+	}
+	res := NewModelData(md.Model)
+	for _, f := range dirty {
+		res.Set(f, md.Get(f))
+	}
+	for k, v := range md.ToCreate {
+		res.ToCreate[k] = v
+	}
+	return res
+}
+
+// trackedValuesEqual returns true if the given values of a tracked
+// field are equal. RecordSets are compared by their ids.
+func trackedValuesEqual(v1, v2 interface{}) bool {
+	rs1, ok1 := v1.(RecordSet)
+	rs2, ok2 := v2.(RecordSet)
+	if ok1 && ok2 {
+		ids1 := append([]int64{}, rs1.Ids()...)
+		ids2 := append([]int64{}, rs2.Ids()...)
+		sort.Slice(ids1, func(i, j int) bool { return ids1[i] < ids1[j] })
+		sort.Slice(ids2, func(i, j int) bool { return ids2[i] < ids2[j] })
+		return reflect.DeepEqual(ids1, ids2)
+	}
+	return reflect.DeepEqual(v1, v2)
+}
+
+// WriteDirty writes the dirty fields of each of the given ModelData returned by
+// AllTracked to its record, and returns the number of records written. Records
+// with the same changes are written with a single call to the Write method, and
+// records without changes are skipped. The changes of the given ModelData are
+// tracked from their new values afterwards.
+//
+// WriteDirty panics if one of the given ModelData is not tracked, is not of the
+// model of this RecordCollection or has no ID.
+func (rc *RecordCollection) WriteDirty(data []*ModelData) int {
+	type dirtyGroup struct {
+		data *ModelData
+		ids  []int64
+	}
+	var (
+		groups  []*dirtyGroup
+		written []*ModelData
+	)
+	for _, md := range data {
+		if !md.IsTracked() || md.Model != rc.model {
+			log.Panic("WriteDirty can only write data returned by AllTracked on the same model", "model", rc.model.name, "dataModel", md.Model.name)
+		}
+		id, _ := md.Get(ID).(int64)
+		if id == 0 {
+			log.Panic("WriteDirty cannot write data without ID", "model", rc.model.name)
+		}
+		dirty := md.dirtyData()
+		if dirty == nil {
+			continue
+		}
+		written = append(written, md)
+		var group *dirtyGroup
+		for _, g := range groups {
+			if len(dirty.ToCreate) == 0 && len(g.data.ToCreate) == 0 && dirtyMapsEqual(g.data.FieldMap, dirty.FieldMap) {
+				group = g
+				break
+			}
+		}
+		if group == nil {
+			group = &dirtyGroup{data: dirty}
+			groups = append(groups, group)
+		}
+		group.ids = append(group.ids, id)
+	}
+	for _, g := range groups {
+		rc.env.Pool(rc.model.name).withIds(g.ids).Call("Write", g.data)
+	}
+	for _, md := range written {
+		md.original = md.FieldMap.Copy()
+		md.ToCreate = make(map[string][]*ModelData)
+	}
+	return len(written)
+}
+
+// dirtyMapsEqual returns true if the given FieldMaps of dirty values have the
+// same keys and values.
+func dirtyMapsEqual(fm1, fm2 FieldMap) bool {
+	if len(fm1) != len(fm2) {
+		return false
+	}
+	for k, v1 := range fm1 {
+		v2, ok := fm2[k]
+		if !ok || !trackedValuesEqual(v1, v2) {
+			return false
+		}
+	}
+	return true
+}
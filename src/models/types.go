@@ -20,8 +20,14 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/hexya-erp/hexya/src/models/fieldtype"
+	"github.com/hexya-erp/hexya/src/models/operator"
+	"github.com/hexya-erp/hexya/src/tools/exceptions"
+	"github.com/hexya-erp/hexya/src/tools/nbutils"
+	"github.com/hexya-erp/hexya/src/tools/typesutils"
 )
 
 // A RecordRef uniquely identifies a Record by giving its model and ID.
@@ -30,6 +36,85 @@ type RecordRef struct {
 	ID        int64
 }
 
+// String returns the reference as a "ModelName,ID" string, which
+// is the format in which reference fields are stored.
+func (rr RecordRef) String() string {
+	return fmt.Sprintf("%s,%d", rr.ModelName, rr.ID)
+}
+
+// parseReference returns the RecordRef of the given "ModelName,ID" string.
+// It panics if the string is malformed or if the model does not exist.
+func parseReference(ref string) RecordRef {
+	toks := strings.Split(ref, ",")
+	if len(toks) != 2 {
+		log.Panic("Reference values must be of the form 'ModelName,ID'", "value", ref)
+	}
+	if _, ok := Registry.Get(toks[0]); !ok {
+		log.Panic("Unknown model in reference value", "model", toks[0], "value", ref)
+	}
+	id, err := strconv.ParseInt(toks[1], 10, 64)
+	if err != nil {
+		log.Panic("Invalid ID in reference value", "value", ref, "error", err)
+	}
+	return RecordRef{ModelName: toks[0], ID: id}
+}
+
+// referenceValue returns the value to store in a reference field for val,
+// which can be a RecordSet or a "ModelName,ID" string. It returns nil
+// for empty values and panics if val is a RecordSet with several records.
+func referenceValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case RecordSet:
+		if !v.Collection().IsValid() || v.IsEmpty() {
+			return nil
+		}
+		v.EnsureOne()
+		return RecordRef{ModelName: v.ModelName(), ID: v.Ids()[0]}.String()
+	case string:
+		if v == "" {
+			return nil
+		}
+		return parseReference(v).String()
+	}
+	return val
+}
+
+// referenceConditionValue returns the argument to use in an SQL query
+// on a reference field for the given condition argument.
+func referenceConditionValue(arg interface{}) interface{} {
+	if rss, ok := arg.([]RecordSet); ok {
+		res := make([]string, len(rss))
+		for i, rs := range rss {
+			res[i], _ = referenceValue(rs).(string)
+		}
+		return res
+	}
+	return referenceValue(arg)
+}
+
+// arrayConditionArg returns the operator and the argument to use in an SQL
+// query on the given array field for the given condition operator and
+// argument. The Contains operator takes a single element as argument and
+// is changed into ContainsAll with a one element array.
+func arrayConditionArg(fi *Field, op operator.Operator, arg interface{}) (operator.Operator, interface{}) {
+	if arg == nil {
+		return op, arg
+	}
+	switch op {
+	case operator.Contains:
+		op = operator.ContainsAll
+		arg = []interface{}{arg}
+	case operator.Equals, operator.NotEquals, operator.ContainsAll, operator.Overlaps:
+	default:
+		log.Panic("Operator cannot be used on array fields", "model", fi.model.name, "field", fi.name, "operator", op)
+	}
+	typedArg := reflect.New(fi.structField.Type).Interface()
+	if err := typesutils.Convert(arg, typedArg, false); err != nil {
+		log.Panic(err.Error(), "model", fi.model.name, "field", fi.name, "type", fi.structField.Type, "value", arg)
+	}
+	return op, reflect.ValueOf(typedArg).Elem().Interface()
+}
+
 // RecordSet identifies a type that holds a set of records of
 // a given model.
 type RecordSet interface {
@@ -200,6 +285,8 @@ type ModelData struct {
 	FieldMap
 	ToCreate map[string][]*ModelData
 	Model    *Model
+	// original holds the values from which changes are tracked, if any
+	original FieldMap
 }
 
 var _ RecordData = new(ModelData)
@@ -322,6 +409,103 @@ func (md *ModelData) Underlying() *ModelData {
 	return md
 }
 
+// Validate checks the values of this ModelData against the definition of the
+// fields of its model without writing anything to the database, and returns
+// the errors found, or nil if the data is valid.
+//
+// Required fields without default value must be set as for a creation, selection
+// fields must have one of their allowed values, char fields must not exceed their
+// size and values must be of the type of their field.
+func (md *ModelData) Validate(env Environment) []exceptions.ValidationError {
+	var res []exceptions.ValidationError
+	addError := func(fi *Field, msg string) {
+		res = append(res, exceptions.ValidationError{
+			Message: fmt.Sprintf(msg, fi.description),
+			Debug:   fmt.Sprintf("model: %s, field: %s, value: %v", md.Model.name, fi.name, md.FieldMap[fi.json]),
+		})
+	}
+	for _, fName := range md.Model.fields.allFieldNames() {
+		fi := md.Model.fields.MustGet(fName.JSON())
+		if fi.json == ID.JSON() || !fi.isSettable() || fi.isRelatedField() || fi.fieldType.IsNonStoredRelationType() {
+			continue
+		}
+		value, set := md.FieldMap.Get(fName)
+		if _, toCreate := md.ToCreate[fi.json]; toCreate {
+			continue
+		}
+		required := fi.required
+		if !required && fi.requiredFunc != nil {
+			req, cond := fi.requiredFunc(env)
+			required = req && (cond == nil || cond.Underlying().IsEmpty())
+		}
+		if !set {
+			if required && fi.defaultFunc == nil {
+				addError(fi, "%s is required")
+			}
+			continue
+		}
+		if valueIsEmpty(fi, value) {
+			if required {
+				addError(fi, "%s is required")
+			}
+			continue
+		}
+		switch {
+		case !valueHasFieldType(fi, value):
+			addError(fi, "%s has a value of invalid type")
+		case fi.fieldType == fieldtype.Selection:
+			if _, ok := fi.selection[fmt.Sprintf("%v", value)]; !ok {
+				addError(fi, "%s has a value which is not allowed")
+			}
+		case fi.fieldType == fieldtype.Char && fi.size > 0:
+			if utf8.RuneCountInString(value.(string)) > fi.size {
+				addError(fi, fmt.Sprintf("%%s cannot exceed %d characters", fi.size))
+			}
+		}
+	}
+	return res
+}
+
+// valueIsEmpty returns true if the given value is an empty value for the given field
+func valueIsEmpty(fi *Field, value interface{}) bool {
+	switch val := value.(type) {
+	case nil:
+		return true
+	case string:
+		return val == ""
+	case RecordSet:
+		return val.IsEmpty()
+	case interface{ IsZero() bool }:
+		return val.IsZero()
+	}
+	if fi.isRelationField() {
+		if id, err := nbutils.CastToInteger(value); err == nil {
+			return id == 0
+		}
+	}
+	return false
+}
+
+// valueHasFieldType returns true if the given non empty value can be stored in the given field
+func valueHasFieldType(fi *Field, value interface{}) bool {
+	if fi.isRelationField() {
+		switch value.(type) {
+		case RecordSet, int64, []int64:
+			return true
+		}
+		return false
+	}
+	typ := reflect.TypeOf(value)
+	fTyp := fi.structField.Type
+	if typ.AssignableTo(fTyp) {
+		return true
+	}
+	isNumber := func(k reflect.Kind) bool {
+		return k >= reflect.Int && k <= reflect.Float64
+	}
+	return isNumber(typ.Kind()) && isNumber(fTyp.Kind())
+}
+
 // fixFieldValue changes the given value for the given field by applying several fixes
 func fixFieldValue(v interface{}, fi *Field) interface{} {
 	if _, ok := v.(bool); ok && fi.fieldType != fieldtype.Boolean {
@@ -0,0 +1,138 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package types
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+
+	"github.com/hexya-erp/hexya/src/tools/nbutils"
+	"github.com/lib/pq"
+)
+
+// A StringArray is a slice of strings stored in the database as a text[] column.
+type StringArray []string
+
+// Value formats our StringArray for storing in the database.
+func (a StringArray) Value() (driver.Value, error) {
+	return pq.StringArray(a).Value()
+}
+
+// Scan sets this StringArray from the given database value or slice.
+func (a *StringArray) Scan(src interface{}) error {
+	if values, ok := sliceValues(src); ok {
+		res := make(StringArray, len(values))
+		for i, v := range values {
+			res[i] = fmt.Sprintf("%v", v)
+		}
+		*a = res
+		return nil
+	}
+	return (*pq.StringArray)(a).Scan(src)
+}
+
+// Contains returns true if value is an element of this StringArray
+func (a StringArray) Contains(value string) bool {
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+var _ sql.Scanner = new(StringArray)
+var _ driver.Valuer = StringArray{}
+
+// An IntegerArray is a slice of int64 stored in the database as an int8[] column.
+type IntegerArray []int64
+
+// Value formats our IntegerArray for storing in the database.
+func (a IntegerArray) Value() (driver.Value, error) {
+	return pq.Int64Array(a).Value()
+}
+
+// Scan sets this IntegerArray from the given database value or slice.
+func (a *IntegerArray) Scan(src interface{}) error {
+	if values, ok := sliceValues(src); ok {
+		res := make(IntegerArray, len(values))
+		for i, v := range values {
+			val, err := nbutils.CastToInteger(v)
+			if err != nil {
+				return err
+			}
+			res[i] = val
+		}
+		*a = res
+		return nil
+	}
+	return (*pq.Int64Array)(a).Scan(src)
+}
+
+// Contains returns true if value is an element of this IntegerArray
+func (a IntegerArray) Contains(value int64) bool {
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+var _ sql.Scanner = new(IntegerArray)
+var _ driver.Valuer = IntegerArray{}
+
+// A FloatArray is a slice of float64 stored in the database as a float8[] column.
+type FloatArray []float64
+
+// Value formats our FloatArray for storing in the database.
+func (a FloatArray) Value() (driver.Value, error) {
+	return pq.Float64Array(a).Value()
+}
+
+// Scan sets this FloatArray from the given database value or slice.
+func (a *FloatArray) Scan(src interface{}) error {
+	if values, ok := sliceValues(src); ok {
+		res := make(FloatArray, len(values))
+		for i, v := range values {
+			val, err := nbutils.CastToFloat(v)
+			if err != nil {
+				return err
+			}
+			res[i] = val
+		}
+		*a = res
+		return nil
+	}
+	return (*pq.Float64Array)(a).Scan(src)
+}
+
+// Contains returns true if value is an element of this FloatArray
+func (a FloatArray) Contains(value float64) bool {
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+var _ sql.Scanner = new(FloatArray)
+var _ driver.Valuer = FloatArray{}
+
+// sliceValues returns the elements of src if it is a slice other than
+// []byte, such as the []interface{} values sent by the client.
+func sliceValues(src interface{}) ([]interface{}, bool) {
+	val := reflect.ValueOf(src)
+	if val.Kind() != reflect.Slice || val.Type().Elem().Kind() == reflect.Uint8 {
+		return nil, false
+	}
+	res := make([]interface{}, val.Len())
+	for i := 0; i < val.Len(); i++ {
+		res[i] = val.Index(i).Interface()
+	}
+	return res, true
+}
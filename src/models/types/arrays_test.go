@@ -0,0 +1,54 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package types
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestArrays(t *testing.T) {
+	Convey("Testing array types", t, func() {
+		Convey("StringArray should scan database values and slices", func() {
+			var a StringArray
+			So(a.Scan([]byte(`{red,"dark blue"}`)), ShouldBeNil)
+			So(a, ShouldResemble, StringArray{"red", "dark blue"})
+			So(a.Scan([]interface{}{"green", "yellow"}), ShouldBeNil)
+			So(a, ShouldResemble, StringArray{"green", "yellow"})
+			So(a.Scan(nil), ShouldBeNil)
+			So(a, ShouldBeNil)
+			So(StringArray{"red", "blue"}.Contains("blue"), ShouldBeTrue)
+			So(StringArray{"red", "blue"}.Contains("green"), ShouldBeFalse)
+		})
+		Convey("IntegerArray should scan database values and slices", func() {
+			var a IntegerArray
+			So(a.Scan([]byte(`{1,2,3}`)), ShouldBeNil)
+			So(a, ShouldResemble, IntegerArray{1, 2, 3})
+			So(a.Scan([]interface{}{float64(4), 5}), ShouldBeNil)
+			So(a, ShouldResemble, IntegerArray{4, 5})
+			So(a.Scan([]interface{}{"six"}), ShouldNotBeNil)
+			So(IntegerArray{1, 2}.Contains(2), ShouldBeTrue)
+		})
+		Convey("FloatArray should scan database values and slices", func() {
+			var a FloatArray
+			So(a.Scan([]byte(`{1.5,2}`)), ShouldBeNil)
+			So(a, ShouldResemble, FloatArray{1.5, 2})
+			So(a.Scan([]float64{3.5}), ShouldBeNil)
+			So(a, ShouldResemble, FloatArray{3.5})
+			So(FloatArray{1.5}.Contains(2), ShouldBeFalse)
+		})
+		Convey("Arrays should be stored as postgres arrays", func() {
+			val, err := StringArray{"red", "dark blue"}.Value()
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, `{"red","dark blue"}`)
+			val, err = IntegerArray{1, 2}.Value()
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, "{1,2}")
+			val, err = FloatArray{}.Value()
+			So(err, ShouldBeNil)
+			So(val, ShouldEqual, "{}")
+		})
+	})
+}
@@ -15,7 +15,10 @@
 package models
 
 import (
+	"fmt"
 	"strings"
+
+	"github.com/hexya-erp/hexya/src/tools/exceptions"
 )
 
 var (
@@ -222,6 +225,8 @@ func consumeAndPredicates(i int, predicates []predicate, res []interface{}) ([]i
 func appendPredicateToSerial(res []interface{}, predicate predicate) []interface{} {
 	if predicate.isCond {
 		res = append(res, serializePredicates(predicate.cond.predicates)...)
+	} else if es, ok := predicate.arg.(existsSubquery); ok {
+		res = append(res, es.serialize(predicate))
 	} else {
 		res = append(res, []interface{}{joinFieldNames(predicate.exprs, ExprSep).JSON(), predicate.operator, predicate.arg})
 	}
@@ -236,6 +241,36 @@ func DefaultValue(value interface{}) func(env Environment) interface{} {
 	}
 }
 
+// NextSequence returns a function that is suitable for the Default parameter of
+// integer fields and that returns the next value of the sequence with the given
+// name, so that new records are numbered automatically.
+//
+// The value is only taken from the sequence when a record is created. New records
+// that are not saved yet (e.g. in a form) get no default value, so that they do
+// not consume numbers. Concurrent transactions always get distinct numbers.
+func NextSequence(name string) func(env Environment) interface{} {
+	return func(env Environment) interface{} {
+		// This context key is only set by Create
+		if !env.Context().GetBool("hexya_ignore_computed_defaults") {
+			return nil
+		}
+		return Registry.MustGetSequence(name).NextValue()
+	}
+}
+
+// NextSequenceString is the same as NextSequence for char fields. The value of
+// the sequence is formatted with the given format, e.g. "SO%05d".
+func NextSequenceString(name, format string) func(env Environment) interface{} {
+	next := NextSequence(name)
+	return func(env Environment) interface{} {
+		val := next(env)
+		if val == nil {
+			return nil
+		}
+		return fmt.Sprintf(format, val)
+	}
+}
+
 // cartesianProductSlices returns the cartesian product of the given RecordCollection slices.
 //
 // This function panics if all records are not pf the same model
@@ -287,3 +322,27 @@ func splitFieldNames(f FieldName, sep string) []FieldName {
 	}
 	return res
 }
+
+// raise logs the message of exc as an error with the given context and
+// panics with exc, after setting its debug information to the given context.
+func raise(exc exceptions.Exception, ctx ...interface{}) {
+	log.Error(exc.UserMessage(), ctx...)
+	debug := exc.UserMessage() + "\n"
+	for i := 0; i+1 < len(ctx); i += 2 {
+		debug += fmt.Sprintf("\t%v : %v\n", ctx[i], ctx[i+1])
+	}
+	panic(exceptions.WithDebug(exc, debug))
+}
+
+// asValidationError returns the given panic data as a ValidationError whose
+// message is the first line of the data. Exceptions are returned unchanged.
+func asValidationError(panicData interface{}) exceptions.Exception {
+	if exc, ok := panicData.(exceptions.Exception); ok {
+		return exc
+	}
+	debug := fmt.Sprintf("%v", panicData)
+	return exceptions.ValidationError{
+		Message: strings.TrimSpace(strings.SplitN(debug, "\n", 2)[0]),
+		Debug:   debug,
+	}
+}
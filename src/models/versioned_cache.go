@@ -0,0 +1,179 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hexya-erp/hexya/src/models/fieldtype"
+	"github.com/hexya-erp/hexya/src/models/types"
+)
+
+// versionSize is the size of the hex encoded versions of versioned cache fields
+const versionSize = 2 * sha256.Size
+
+// createVersionFields adds a hidden stored field holding the version of the
+// value of each stored computed field with VersionedCache set. The version is
+// a hash of the values of the field's dependencies at the time it was computed.
+func createVersionFields() {
+	for _, model := range Registry.registryByName {
+		if model.IsMixin() || model.IsManual() {
+			continue
+		}
+		var versioned []*Field
+		for _, fi := range model.fields.registryByName {
+			if fi.versionedCache {
+				versioned = append(versioned, fi)
+			}
+		}
+		for _, fi := range versioned {
+			if fi.compute == "" || !fi.stored || len(fi.depends) == 0 {
+				log.Panic("Versioned cache fields must be stored, computed and have dependencies", "model", model.name, "field", fi.name)
+			}
+			if fi.lazyCompute || fi.computeOnCreate || fi.required || fi.isContextedField() || fi.fieldType.IsNonStoredRelationType() {
+				log.Panic("Versioned cache fields cannot be lazy, computed on create only, required, contexted or non stored relations", "model", model.name, "field", fi.name)
+			}
+			versionName := fmt.Sprintf("Hexya%sVersion", fi.name)
+			version := &Field{
+				model:       model,
+				name:        versionName,
+				json:        fmt.Sprintf("hexya_%s_version", fi.json),
+				description: fi.description,
+				fieldType:   fieldtype.Char,
+				structField: reflect.StructField{Name: versionName, Type: reflect.TypeOf("")},
+				size:        versionSize,
+				stored:      true,
+				readOnly:    true,
+				noCopy:      true,
+				versionOf:   fi,
+			}
+			model.fields.add(version)
+			fi.version = version
+		}
+	}
+}
+
+// dependenciesVersion returns the version of the given versioned cache
+// field for the first record of this RecordCollection, i.e. the hash of the
+// current values of its dependencies.
+func (rc *RecordCollection) dependenciesVersion(fi *Field) string {
+	hash := sha256.New()
+	for _, dep := range fi.depends {
+		fmt.Fprintf(hash, "%s=%v;", dep, rc.dependencyValues(dep))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// dependencyValues returns the values of the given dependency path for the
+// first record of this RecordCollection. Records of relation fields are given
+// by their sorted ids, so that the values do not depend on the records order.
+func (rc *RecordCollection) dependencyValues(path string) []interface{} {
+	exprs := strings.Split(path, ExprSep)
+	recs := rc.Records()[:1]
+	for _, expr := range exprs[:len(exprs)-1] {
+		var next []*RecordCollection
+		for _, rec := range recs {
+			next = append(next, rec.Get(rec.model.FieldName(expr)).(RecordSet).Collection().Records()...)
+		}
+		recs = next
+	}
+	res := make([]interface{}, len(recs))
+	for i, rec := range recs {
+		val := rec.Get(rec.model.FieldName(exprs[len(exprs)-1]))
+		if rs, ok := val.(RecordSet); ok {
+			ids := append([]int64{}, rs.Ids()...)
+			sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+			val = ids
+		}
+		res[i] = val
+	}
+	return res
+}
+
+// addVersions sets in data the version of each versioned cache field of data
+// for the first record of this RecordCollection, so that the version is stored
+// with the computed value.
+func (rc *RecordCollection) addVersions(data *ModelData) {
+	for _, f := range data.Keys() {
+		fi, ok := rc.model.fields.Get(f)
+		if !ok || fi.version == nil {
+			continue
+		}
+		data.Set(fieldName{name: fi.version.name, json: fi.version.json}, rc.dependenciesVersion(fi))
+	}
+}
+
+// checkVersionedFields checks the versions of the versioned cache fields among
+// the given loaded fields for all the records of this RecordCollection.
+//
+// Fields are given as expressions that may go through relation fields.
+func (rc *RecordCollection) checkVersionedFields(fields []FieldName) {
+	for _, field := range fields {
+		fi := rc.model.getRelatedFieldInfo(field)
+		if !fi.versionedCache {
+			continue
+		}
+		recs := rc
+		if exprs := splitFieldNames(field, ExprSep); len(exprs) > 1 {
+			prefix := joinFieldNames(exprs[:len(exprs)-1], ExprSep)
+			recs = rc.env.Pool(fi.model.name)
+			for _, rec := range rc.Records() {
+				recs = recs.Union(rec.Get(prefix).(RecordSet).Collection())
+			}
+		}
+		recs.checkVersionedField(fi)
+	}
+}
+
+// checkVersionedField compares the stored version of the given versioned cache
+// field with the current values of its dependencies for all the records of this
+// RecordCollection. The field is computed again for the records whose version
+// does not match and stored with its new version, so that it is not computed
+// again at next load.
+//
+// The dependencies of all the records are loaded at once. Values are stored as
+// super user since reading a field must not require write access on the model.
+// In read only environments, computed values only replace the stored ones in
+// the cache.
+func (rc *RecordCollection) checkVersionedField(fi *Field) {
+	if rc.IsEmpty() || rc.hasNegIds {
+		return
+	}
+	versionField := fieldName{name: fi.version.name, json: fi.version.json}
+	toLoad := []FieldName{versionField}
+	for _, dep := range fi.depends {
+		toLoad = append(toLoad, rc.model.FieldName(dep))
+	}
+	recs := rc.env.Pool(rc.model.name).withIds(rc.ids).Load(toLoad...)
+	var staleIds []int64
+	for _, rec := range recs.Records() {
+		if stored, _ := rec.Get(versionField).(string); stored != rec.dependenciesVersion(fi) {
+			staleIds = append(staleIds, rec.ids[0])
+		}
+	}
+	if len(staleIds) == 0 {
+		return
+	}
+	stale := rc.env.Pool(rc.model.name).withIds(staleIds)
+	if !rc.env.readOnly {
+		stale.Sudo().applyMethod(fi.compute, fi.precompute)
+		return
+	}
+	if fi.precompute != "" {
+		ctx := stale.Env().Context().Copy()
+		ctx.Update(stale.Call(fi.precompute).(*types.Context))
+		stale = stale.WithNewContext(ctx)
+	}
+	for _, rec := range stale.Records() {
+		data := rec.Call(fi.compute).(RecordData).Underlying()
+		fMap := FieldMap{fi.json: data.Get(fieldName{name: fi.name, json: fi.json})}
+		rc.model.convertValuesToFieldType(&fMap, true)
+		rc.env.cache.updateEntry(rc.model, rec.ids[0], fi.json, fMap[fi.json], rc.query.ctxArgsSlug())
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package models
+
+import (
+	"reflect"
+
+	"github.com/hexya-erp/hexya/src/models/fieldtype"
+)
+
+// AddViewStruct declares a view struct with the given name for this model.
+//
+// A view struct is a subset of the stored fields of the model. The code
+// generator creates a <Model><Name>View struct with the ID and the given
+// fields and a Read<Name> method on the RecordSet that loads only these
+// columns into a slice of this struct.
+func (m *Model) AddViewStruct(name string, fields ...string) {
+	if _, exists := m.viewStructs[name]; exists {
+		log.Panic("View struct already exists", "model", m.name, "viewStruct", name)
+	}
+	fieldNames := []FieldName{ID}
+	for _, f := range fields {
+		if f == ID.Name() {
+			continue
+		}
+		fieldNames = append(fieldNames, m.FieldName(f))
+	}
+	m.viewStructs[name] = fieldNames
+}
+
+// checkViewStructs checks that the fields of all view structs can be loaded
+// directly from the columns of the model's table.
+func checkViewStructs() {
+	for _, model := range Registry.registryByName {
+		for name, fields := range model.viewStructs {
+			if _, exists := model.methods.Get("Read" + name); exists {
+				log.Panic("View struct loader conflicts with an existing method", "model", model.name, "viewStruct", name, "method", "Read"+name)
+			}
+			for _, f := range fields {
+				fi := model.fields.MustGet(f.Name())
+				if !fi.isStored() || fi.isRelatedField() || fi.fieldType.Is2ManyRelationType() || fi.fieldType == fieldtype.Reference {
+					log.Panic("View struct fields must be stored fields of the model", "model", model.name, "viewStruct", name, "field", f.Name())
+				}
+			}
+		}
+	}
+}
+
+// ReadViewStruct loads the fields of the view struct with the given name for
+// the records of this RecordCollection and stores them in dest, which must be
+// a pointer to a slice of structs with a field of the same name and type as
+// each field of the view struct.
+//
+// Only the columns of the view struct are queried and the cache is not
+// populated. Use the generated Read<Name> method instead.
+func (rc *RecordCollection) ReadViewStruct(name string, dest interface{}) {
+	destVal := reflect.ValueOf(dest)
+	if destVal.Kind() != reflect.Ptr || destVal.Elem().Kind() != reflect.Slice || destVal.Elem().Type().Elem().Kind() != reflect.Struct {
+		log.Panic("ReadViewStruct destination must be a pointer to a slice of structs", "model", rc.model.name, "viewStruct", name)
+	}
+	fields, ok := rc.model.viewStructs[name]
+	if !ok {
+		log.Panic("Unknown view struct", "model", rc.model.name, "viewStruct", name)
+	}
+	rc.CheckExecutionPermission(rc.model.methods.MustGet("Load"))
+	res := reflect.MakeSlice(destVal.Elem().Type(), 0, len(rc.ids))
+	if rc.query.isEmpty() {
+		destVal.Elem().Set(res)
+		return
+	}
+	exprs := rc.query.getAllExpressions()
+	for _, f := range fields {
+		exprs = append(exprs, []FieldName{f})
+	}
+	rc.flushIfPending(exprs...)
+	query, args, substs := rc.viewStructQuery(fields)
+	rows := rc.env.cr.readQuery(rc.env.readOnly, query, args...)
+	defer rows.Close()
+	for rows.Next() {
+		line := make(FieldMap)
+		if err := rc.model.scanToFieldMap(rows, &line, substs); err != nil {
+			log.Panic(err.Error(), "model", rc.model.name, "viewStruct", name)
+		}
+		item := reflect.New(res.Type().Elem()).Elem()
+		for _, f := range fields {
+			sf := item.FieldByName(f.Name())
+			if !sf.IsValid() {
+				log.Panic("View struct has no such field", "model", rc.model.name, "viewStruct", name, "field", f.Name())
+			}
+			if val := line[f.JSON()]; val != nil {
+				sf.Set(reflect.ValueOf(val))
+			}
+		}
+		res = reflect.Append(res, item)
+	}
+	destVal.Elem().Set(res)
+}
+
+// viewStructQuery returns the SQL query and arguments to load the given fields
+// of this RecordCollection with record rules, default order and contexts applied.
+func (rc *RecordCollection) viewStructQuery(fields []FieldName) (string, SQLParams, map[string]string) {
+	rSet, subFields := rc.prepareLoadQuery(fields)
+	return rSet.query.selectQuery(filterOnDBFields(rSet.model, subFields))
+}
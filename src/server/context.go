@@ -23,6 +23,10 @@ type Context struct {
 }
 
 // RPC serializes the given struct as JSON-RPC into the response body.
+//
+// If an error is given, it is serialized as a JSON-RPC error instead. As
+// required by JSON-RPC, the HTTP status of the response is then always
+// http.StatusOK and the error is given by its code and data.
 func (c *Context) RPC(code int, obj interface{}, err ...error) {
 	id, ok := c.Get("id")
 	if !ok {
@@ -34,7 +38,7 @@ func (c *Context) RPC(code int, obj interface{}, err ...error) {
 		id = req.ID
 	}
 	if len(err) > 0 && err[0] != nil {
-		userError, ok2 := err[0].(exceptions.UserError)
+		userError, ok2 := err[0].(exceptions.Exception)
 		if !ok2 {
 			c.AbortWithError(http.StatusInternalServerError, errors.New("error is of unknown type"))
 			return
@@ -46,13 +50,13 @@ func (c *Context) RPC(code int, obj interface{}, err ...error) {
 				Code:    code,
 				Message: "Hexya Server Error",
 				Data: JSONRPCErrorData{
-					Arguments:     []string{userError.Message},
-					ExceptionType: "user_error",
-					Debug:         userError.Debug,
+					Arguments:     []string{userError.UserMessage()},
+					ExceptionType: userError.Type(),
+					Debug:         userError.DebugInfo(),
 				},
 			},
 		}
-		c.JSON(code, respErr)
+		c.JSON(http.StatusOK, respErr)
 		return
 	}
 	resp := ResponseRPC{
@@ -63,6 +67,24 @@ func (c *Context) RPC(code int, obj interface{}, err ...error) {
 	c.JSON(code, resp)
 }
 
+// ErrorStatus returns the HTTP status code matching the type of the given error.
+//
+// It is meant for REST handlers. JSON-RPC errors sent with RPC always have the
+// http.StatusOK status.
+func ErrorStatus(err error) int {
+	switch err.(type) {
+	case exceptions.AccessError:
+		return http.StatusForbidden
+	case exceptions.MissingError:
+		return http.StatusNotFound
+	case exceptions.ConcurrencyError:
+		return http.StatusConflict
+	case exceptions.ValidationError, exceptions.UserError:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
 // BindRPCParams binds the RPC parameters to the given data object.
 func (c *Context) BindRPCParams(data interface{}) {
 	var req RequestRPC
@@ -40,6 +40,10 @@ func TestConditions(t *testing.T) {
 					rs2 := h.User().Search(env, q.User().Nums().EqualsFunc(getUserID))
 					So(func() { rs2.Load() }, ShouldNotPanic)
 				})
+				Convey("Query with subquery on a relation field", func() {
+					rs2 := h.User().Search(env, q.User().Profile().InSubquery(h.Profile().SubqueryIds(q.Profile().Age().GreaterOrEqual(12))))
+					So(func() { rs2.Load() }, ShouldNotPanic)
+				})
 				Convey("Check WHERE clause with additionnal filter", func() {
 					rs = rs.Search(q.User().ProfileFilteredOn(q.Profile().Age().GreaterOrEqual(12)))
 					So(func() { rs.Load() }, ShouldNotPanic)
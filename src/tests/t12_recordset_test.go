@@ -15,11 +15,20 @@
 package tests
 
 import (
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/hexya-erp/hexya/src/actions"
 	"github.com/hexya-erp/hexya/src/models"
+	"github.com/hexya-erp/hexya/src/models/operator"
 	"github.com/hexya-erp/hexya/src/models/security"
+	"github.com/hexya-erp/hexya/src/models/types"
+	"github.com/hexya-erp/hexya/src/tools/exceptions"
 	"github.com/hexya-erp/pool/h"
+	"github.com/hexya-erp/pool/m"
 	"github.com/hexya-erp/pool/q"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -36,6 +45,10 @@ func TestCreateRecordSet(t *testing.T) {
 				So(userJohn.Len(), ShouldEqual, 1)
 				So(userJohn.ID(), ShouldBeGreaterThan, 0)
 			})
+			Convey("Creating a user with nil or foreign data should panic", func() {
+				So(func() { h.User().Create(env, nil) }, ShouldPanic)
+				So(func() { models.Registry.MustGet("User").Create(env, h.Tag().NewData().SetName("Wrong")) }, ShouldPanic)
+			})
 			Convey("Creating user Jane with related Profile and Posts and Comments and Tags", func() {
 				userJaneData := h.User().NewData().
 					SetName("Jane Smith").
@@ -148,6 +161,223 @@ func TestCreateRecordSet(t *testing.T) {
 			})
 		}), ShouldBeNil)
 	})
+	Convey("Testing data validation before creation", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			Convey("Valid data should not return errors", func() {
+				So(h.Post().NewData().SetTitle("Valid Post").Validate(env), ShouldBeEmpty)
+				So(h.Profile().NewData().SetGender("female").Validate(env), ShouldBeEmpty)
+			})
+			Convey("Missing required fields should be reported", func() {
+				errs := h.Post().NewData().SetContent("Content without title").Validate(env)
+				So(errs, ShouldHaveLength, 1)
+				So(errs[0].Message, ShouldEqual, "Title is required")
+				errs = h.Post().NewData().SetTitle("").Validate(env)
+				So(errs, ShouldHaveLength, 1)
+			})
+			Convey("Wrong selection values and too long chars should be reported", func() {
+				So(h.Profile().NewData().SetGender("other").Validate(env), ShouldHaveLength, 1)
+				errs := h.User().NewData().SetName("Long Email").SetEmail(strings.Repeat("a", 101)).Validate(env)
+				So(errs, ShouldHaveLength, 1)
+				So(errs[0].Message, ShouldEqual, "Email cannot exceed 100 characters")
+			})
+			Convey("Values of the wrong type should be reported", func() {
+				So(h.Post().NewData().SetTitle("Typed Post").Set(h.Post().Fields().Content(), 12).Validate(env), ShouldHaveLength, 1)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing required fields enforcement", t, func() {
+		Convey("Creating a record without a required field should fail", func() {
+			err := models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+				h.Post().Create(env, h.Post().NewData().SetContent("Content without title"))
+			})
+			So(err, ShouldHaveSameTypeAs, exceptions.ValidationError{})
+			So(err.(exceptions.ValidationError).Message, ShouldEqual, "The following required fields are missing: Title")
+		})
+		Convey("Creating a record with an empty required field should fail", func() {
+			err := models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+				h.Post().Create(env, h.Post().NewData().SetTitle(""))
+			})
+			So(err, ShouldHaveSameTypeAs, exceptions.ValidationError{})
+		})
+		Convey("Clearing a required field should fail", func() {
+			err := models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+				post := h.Post().Create(env, h.Post().NewData().SetTitle("Required Post"))
+				post.SetContent("Content can be cleared")
+				post.SetContent("")
+				post.SetTitle("")
+			})
+			So(err, ShouldHaveSameTypeAs, exceptions.ValidationError{})
+			So(err.(exceptions.ValidationError).Message, ShouldEqual, "The following required fields are missing: Title")
+		})
+		Convey("Writing other fields should not check required fields", func() {
+			So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+				post := h.Post().Create(env, h.Post().NewData().SetTitle("Required Post"))
+				post.Write(h.Post().NewData().SetContent("New content"))
+				So(post.Content(), ShouldEqual, "New content")
+			}), ShouldBeNil)
+		})
+	})
+	Convey("Testing creation of records with temporary ids", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			ids := models.CreateWithTempIDs(env, []models.TempRecord{
+				{Model: "Profile", TempID: -3, Values: models.FieldMap{"City": "Temp City", "BestPost": int64(-2)}},
+				{Model: "User", TempID: -1, Values: models.FieldMap{"Name": "Temp User", "Posts": []int64{-2}}},
+				{Model: "Post", TempID: -2, Values: models.FieldMap{"Title": "Temp Post", "User": int64(-1)}},
+			})
+			So(ids, ShouldHaveLength, 3)
+			user := h.User().BrowseOne(env, ids[-1])
+			post := h.Post().BrowseOne(env, ids[-2])
+			profile := h.Profile().BrowseOne(env, ids[-3])
+			So(user.Name(), ShouldEqual, "Temp User")
+			So(post.Title(), ShouldEqual, "Temp Post")
+			So(post.User().Equals(user), ShouldBeTrue)
+			So(user.Posts().Equals(post), ShouldBeTrue)
+			So(profile.BestPost().Equals(post), ShouldBeTrue)
+			So(func() {
+				models.CreateWithTempIDs(env, []models.TempRecord{
+					{Model: "User", TempID: -1, Values: models.FieldMap{"Name": "Cycle User", "Profile": int64(-2)}},
+					{Model: "Profile", TempID: -2, Values: models.FieldMap{"BestPost": int64(-3)}},
+					{Model: "Post", TempID: -3, Values: models.FieldMap{"Title": "Cycle Post", "User": int64(-1)}},
+				})
+			}, ShouldPanic)
+			So(func() {
+				models.CreateWithTempIDs(env, []models.TempRecord{
+					{Model: "Post", TempID: -1, Values: models.FieldMap{"Title": "Orphan Post", "User": int64(-5)}},
+				})
+			}, ShouldPanic)
+		}), ShouldBeNil)
+	})
+	Convey("Testing upsert of a batch of users", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			john := h.User().Search(env, q.User().Name().Equals("John Smith"))
+			nbUsers := h.User().NewSet(env).SearchCount()
+			users := h.User().Upsert(env, []m.UserData{
+				h.User().NewData().SetName("John Smith").SetEmail("john.smith@example.com"),
+				h.User().NewData().SetName("Upserted User").SetEmail("upserted@example.com"),
+			}, []string{"Name"})
+			So(users.Len(), ShouldEqual, 2)
+			So(users.Intersect(john).Equals(john), ShouldBeTrue)
+			So(h.User().NewSet(env).SearchCount(), ShouldEqual, nbUsers+1)
+			So(john.Email(), ShouldEqual, "john.smith@example.com")
+			So(john.IsStaff(), ShouldBeTrue)
+			newUser := h.User().Search(env, q.User().Name().Equals("Upserted User"))
+			So(newUser.Email(), ShouldEqual, "upserted@example.com")
+			So(func() {
+				h.User().Upsert(env, []m.UserData{h.User().NewData().SetName("John Smith")}, []string{"Email"})
+			}, ShouldPanic)
+		}), ShouldBeNil)
+		So(models.SimulateInNewEnvironment(2, func(env models.Environment) {
+			h.User().Upsert(env, []m.UserData{
+				h.User().NewData().SetName("John Smith").SetEmail("john.smith@example.com"),
+			}, []string{"Name"})
+		}), ShouldHaveSameTypeAs, exceptions.AccessError{})
+	})
+	Convey("Testing get or create of users", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			john := h.User().Search(env, q.User().Name().Equals("John Smith"))
+			nbUsers := h.User().NewSet(env).SearchCount()
+			Convey("Existing records should be returned", func() {
+				users := h.User().GetOrCreate(env, q.User().Name().Equals("John Smith"), nil)
+				So(users.Equals(john), ShouldBeTrue)
+				So(h.User().NewSet(env).SearchCount(), ShouldEqual, nbUsers)
+			})
+			Convey("Missing records should be created with defaults and condition values", func() {
+				users := h.User().GetOrCreate(env,
+					q.User().Name().Equals("Created User").And().Email().Contains("example"),
+					h.User().NewData().SetEmail("created@example.com"))
+				So(users.Len(), ShouldEqual, 1)
+				So(users.Name(), ShouldEqual, "Created User")
+				So(users.Email(), ShouldEqual, "created@example.com")
+				So(h.User().NewSet(env).SearchCount(), ShouldEqual, nbUsers+1)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing concurrent get or create of the same user", t, func() {
+		var wg sync.WaitGroup
+		errs := make([]error, 3)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+					h.User().GetOrCreate(env, q.User().Name().Equals("Concurrent User"), nil)
+				})
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			So(err, ShouldBeNil)
+		}
+		So(models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			users := h.User().Search(env, q.User().Name().Equals("Concurrent User"))
+			So(users.Len(), ShouldEqual, 1)
+			users.Unlink()
+		}), ShouldBeNil)
+	})
+	Convey("Testing get or create of a user created by a concurrent transaction", t, func() {
+		var attempts int
+		created := make(chan error)
+		err := models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			attempts++
+			So(h.User().NewSet(env).SearchCount(), ShouldBeGreaterThan, 0)
+			if attempts == 1 {
+				// The snapshot of this transaction is taken: create the user in another one
+				go func() {
+					created <- models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+						h.User().GetOrCreate(env, q.User().Name().Equals("Raced User"), nil)
+					})
+				}()
+				So(<-created, ShouldBeNil)
+			}
+			h.User().GetOrCreate(env, q.User().Name().Equals("Raced User"), nil)
+		})
+		So(err, ShouldBeNil)
+		So(attempts, ShouldEqual, 2)
+		So(models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			users := h.User().Search(env, q.User().Name().Equals("Raced User"))
+			So(users.Len(), ShouldEqual, 1)
+			users.Unlink()
+		}), ShouldBeNil)
+	})
+	Convey("Testing GetForUpdate locks records until the end of the transaction", t, func() {
+		So(models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			h.User().Create(env, h.User().NewData().SetName("Locked User").SetNums(0))
+		}), ShouldBeNil)
+		var wg sync.WaitGroup
+		locked := make(chan struct{})
+		var once sync.Once
+		var err1, err2 error
+		var waited time.Duration
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			err1 = models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+				user := h.User().Search(env, q.User().Name().Equals("Locked User")).GetForUpdate()
+				once.Do(func() { close(locked) })
+				time.Sleep(300 * time.Millisecond)
+				user.SetNums(user.Nums() + 1)
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			<-locked
+			start := time.Now()
+			err2 = models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+				user := h.User().Search(env, q.User().Name().Equals("Locked User")).GetForUpdate()
+				user.SetNums(user.Nums() + 1)
+			})
+			waited = time.Since(start)
+		}()
+		wg.Wait()
+		So(err1, ShouldBeNil)
+		So(err2, ShouldBeNil)
+		So(waited, ShouldBeGreaterThanOrEqualTo, 200*time.Millisecond)
+		So(models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			user := h.User().Search(env, q.User().Name().Equals("Locked User"))
+			So(user.Nums(), ShouldEqual, 2)
+			user.Unlink()
+		}), ShouldBeNil)
+	})
 	security.Registry.UnregisterGroup(group1)
 }
 
@@ -184,6 +414,18 @@ func TestSearchRecordSet(t *testing.T) {
 					So(ujData.ID(), ShouldEqual, userJane.ID())
 					So(ujData.HasID(), ShouldBeTrue)
 				})
+				Convey("Getting actions to open Jane", func() {
+					action := userJane.ActionOpenRecord()
+					So(action.Type, ShouldEqual, actions.ActionActWindow)
+					So(action.Model, ShouldEqual, "User")
+					So(action.ResID, ShouldEqual, userJane.ID())
+					So(action.ViewMode, ShouldEqual, "form")
+					listAction := h.User().ActionWindow("tree,form", q.User().Name().Equals("Jane Smith"), nil)
+					So(listAction.Model, ShouldEqual, "User")
+					So(listAction.ResID, ShouldEqual, 0)
+					So(listAction.Domain, ShouldEqual, `[["name","=","Jane Smith"]]`)
+					So(func() { h.User().NewSet(env).ActionOpenRecord() }, ShouldPanic)
+				})
 			})
 
 			Convey("Testing search all users", func() {
@@ -210,6 +452,31 @@ func TestSearchRecordSet(t *testing.T) {
 					So(usersData[2].HasEmail(), ShouldBeTrue)
 				})
 			})
+			Convey("Testing search with a query builder", func() {
+				So(h.User().Query(env).All(), ShouldHaveLength, 3)
+				usersData := h.User().Query(env).
+					Where(q.User().Name().Contains("Smith")).
+					Where(q.User().Email().NotEquals("will.smith@example.com")).
+					Order("Name desc").
+					Limit(1).
+					Offset(1).
+					All()
+				So(usersData, ShouldHaveLength, 1)
+				So(usersData[0].Name(), ShouldEqual, "Jane Smith")
+				qb := h.User().Query(env).Order("Name")
+				So(qb.Limit(2).Set().Len(), ShouldEqual, 2)
+				So(qb.Set().Records()[0].Name(), ShouldEqual, "Jane Smith")
+			})
+			Convey("Reading posts with their users eagerly loaded", func() {
+				posts := h.Post().NewSet(env).SearchAll().With(h.Post().Fields().User(), h.User().Fields().Name(), h.User().Fields().Email())
+				So(posts.Len(), ShouldBeGreaterThan, 0)
+				for _, post := range posts.Records() {
+					if post.User().IsNotEmpty() {
+						So(post.User().Name(), ShouldNotBeBlank)
+					}
+				}
+				So(func() { h.Post().NewSet(env).With(h.Post().Fields().Title()) }, ShouldPanic)
+			})
 
 			Convey("Testing search on manual model", func() {
 				userViews := h.UserView().NewSet(env).SearchAll()
@@ -225,6 +492,18 @@ func TestSearchRecordSet(t *testing.T) {
 				So(recs[1].City(), ShouldEqual, "")
 				So(recs[2].City(), ShouldEqual, "")
 			})
+			Convey("Testing view struct loaders", func() {
+				userJane := h.User().Search(env, q.User().Name().Equals("Jane Smith"))
+				contacts := userJane.ReadContact()
+				So(contacts, ShouldHaveLength, 1)
+				So(contacts[0], ShouldResemble, m.UserContactView{
+					ID:      userJane.ID(),
+					Name:    "Jane Smith",
+					Email:   "jane.smith@example.com",
+					Profile: userJane.Profile().ID(),
+				})
+				So(h.User().NewSet(env).ReadContact(), ShouldBeEmpty)
+			})
 		}), ShouldBeNil)
 	})
 	group1 := security.Registry.NewGroup("group1", "Group 1")
@@ -272,9 +551,312 @@ func TestSearchRecordSet(t *testing.T) {
 				h.User().RemoveRecordRule("jOnly")
 				h.User().RemoveRecordRule("writeRule")
 			})
+			Convey("Checking search restrictions", func() {
+				var calls int
+				h.User().AddSearchRestriction("ownName", func(env models.Environment) q.UserCondition {
+					calls++
+					if name := env.Context().GetString("user_name"); name != "" {
+						return q.User().Name().Equals(name)
+					}
+					return q.User().Name().IContains("j")
+				})
+				users := h.User().NewSet(env).SearchAll()
+				So(users.Len(), ShouldEqual, 2)
+				So(users.Records()[0].Name(), ShouldBeIn, []string{"Jane Smith", "John Smith"})
+				So(h.User().Search(env, q.User().Name().Equals("Will Smith")).Len(), ShouldEqual, 0)
+				So(calls, ShouldEqual, 1)
+				users = h.User().NewSet(env).WithContext("user_name", "Jane Smith").SearchAll()
+				So(users.Len(), ShouldEqual, 1)
+				So(users.Name(), ShouldEqual, "Jane Smith")
+				So(calls, ShouldEqual, 2)
+				So(h.User().NewSet(env).Sudo().SearchAll().Len(), ShouldEqual, 3)
+				h.User().RemoveSearchRestriction("ownName")
+				So(h.User().NewSet(env).SearchAll().Len(), ShouldEqual, 3)
+			})
 		}), ShouldBeNil)
 	})
 	security.Registry.UnregisterGroup(group1)
+	Convey("Testing conditions built from record sets", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			users := h.User().Search(env, q.User().Name().Contains("Smith"))
+			So(users.Len(), ShouldEqual, 3)
+			Convey("Searching with the condition of a set should return the same set", func() {
+				So(h.User().Search(env, users.IdsCondition()).Equals(users), ShouldBeTrue)
+			})
+			Convey("The condition of a set can be composed with other clauses", func() {
+				jane := h.User().Search(env, users.IdsCondition().And().Email().Equals("jane.smith@example.com"))
+				So(jane.Len(), ShouldEqual, 1)
+				So(jane.Name(), ShouldEqual, "Jane Smith")
+				will := h.User().Search(env, q.User().Name().Equals("Will Smith"))
+				So(h.User().Search(env, will.IdsCondition().And().Email().Equals("jane.smith@example.com")).IsEmpty(), ShouldBeTrue)
+			})
+			Convey("The condition of an empty set should match no records", func() {
+				empty := h.User().NewSet(env)
+				So(h.User().Search(env, empty.IdsCondition()).IsEmpty(), ShouldBeTrue)
+				So(h.User().Search(env, empty.IdsCondition().Or().Name().Equals("Jane Smith")).Len(), ShouldEqual, 1)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing distinct values of a field", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			profiles := h.Profile().Create(env, h.Profile().NewData().SetCity("Distinct City"))
+			for _, gender := range []string{"male", "female", "male"} {
+				profiles = profiles.Union(h.Profile().Create(env, h.Profile().NewData().SetGender(gender).SetCity("Distinct City")))
+			}
+			cond := q.Profile().City().Equals("Distinct City")
+			So(h.Profile().DistinctValues(env, "Gender", cond), ShouldResemble, []interface{}{"female", "male"})
+			So(profiles.DistinctGender(), ShouldResemble, []string{"female", "male"})
+			So(profiles.DistinctCity(), ShouldResemble, []string{"Distinct City"})
+			So(h.Profile().Search(env, cond.And().Gender().Equals("male")).DistinctGender(), ShouldResemble, []string{"male"})
+			So(h.Profile().NewSet(env).DistinctGender(), ShouldBeEmpty)
+		}), ShouldBeNil)
+	})
+	Convey("Testing totals of numeric fields", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			h.Profile().Create(env, h.Profile().NewData().SetAge(10).SetMoney(1.5).SetCity("Totals City"))
+			h.Profile().Create(env, h.Profile().NewData().SetAge(20).SetMoney(2.5).SetCity("Totals City"))
+			h.Profile().Create(env, h.Profile().NewData().SetCity("Totals City"))
+			h.Profile().Create(env, h.Profile().NewData().SetAge(40).SetMoney(100).SetCity("Other Totals City"))
+			profiles := h.Profile().Search(env, q.Profile().City().Equals("Totals City"))
+			So(profiles.Totals("Age", "Money"), ShouldResemble, map[string]float64{"Age": 30, "Money": 4})
+			totals := profiles.TotalsData("Age", "Money")
+			So(totals.Age(), ShouldEqual, 30)
+			So(totals.Money(), ShouldEqual, 4)
+			So(totals.HasCity(), ShouldBeFalse)
+			So(h.Profile().NewSet(env).Totals("Age"), ShouldResemble, map[string]float64{"Age": 0})
+			So(func() { profiles.Totals("City") }, ShouldPanic)
+		}), ShouldBeNil)
+	})
+	Convey("Testing pagination", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			for i := 1; i <= 5; i++ {
+				h.Profile().Create(env, h.Profile().NewData().SetAge(int16(i)).SetCity("Page City"))
+			}
+			cond := q.Profile().City().Equals("Page City")
+			first := h.Profile().Paginate(env, cond, 1, 2, "Age")
+			So(first.Records.Len(), ShouldEqual, 2)
+			So(first.Records.Records()[0].Age(), ShouldEqual, 1)
+			So(first.Records.Records()[1].Age(), ShouldEqual, 2)
+			So(first.Total, ShouldEqual, 5)
+			So(first.PageCount, ShouldEqual, 3)
+			So(first.HasPrev, ShouldBeFalse)
+			So(first.HasNext, ShouldBeTrue)
+			middle := h.Profile().Paginate(env, cond, 2, 2, "Age")
+			So(middle.Records.Records()[0].Age(), ShouldEqual, 3)
+			So(middle.Records.Records()[1].Age(), ShouldEqual, 4)
+			So(middle.Page, ShouldEqual, 2)
+			So(middle.HasPrev, ShouldBeTrue)
+			So(middle.HasNext, ShouldBeTrue)
+			last := h.Profile().Paginate(env, cond, 3, 2, "Age DESC")
+			So(last.Records.Len(), ShouldEqual, 1)
+			So(last.Records.Age(), ShouldEqual, 1)
+			So(last.HasPrev, ShouldBeTrue)
+			So(last.HasNext, ShouldBeFalse)
+			empty := h.Profile().Paginate(env, q.Profile().City().Equals("No City"), 1, 2)
+			So(empty.Records.IsEmpty(), ShouldBeTrue)
+			So(empty.Total, ShouldEqual, 0)
+			So(empty.PageCount, ShouldEqual, 0)
+			So(empty.HasNext, ShouldBeFalse)
+			So(func() { h.Profile().Paginate(env, cond, 0, 2) }, ShouldPanic)
+		}), ShouldBeNil)
+	})
+	Convey("Testing pagination with estimated totals", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			for i := 1; i <= 5; i++ {
+				h.Profile().Create(env, h.Profile().NewData().SetAge(int16(i)).SetCity("Estimate City"))
+			}
+			env.Cr().Execute(`ANALYZE "profile"`)
+			defer models.SetCountEstimateThreshold(100000)
+			models.SetCountEstimateThreshold(1)
+			estimateEnv := h.Profile().NewSet(env).WithContext("hexya_estimate_count", true).Env()
+			all := h.Profile().Paginate(estimateEnv, q.ProfileCondition{}, 1, 2)
+			So(all.Estimated, ShouldBeTrue)
+			So(all.Total, ShouldEqual, h.Profile().NewSet(env).SearchCount())
+			filtered := h.Profile().Paginate(estimateEnv, q.Profile().City().Equals("Estimate City"), 1, 2)
+			So(filtered.Estimated, ShouldBeFalse)
+			So(filtered.Total, ShouldEqual, 5)
+			exact := h.Profile().Paginate(env, q.ProfileCondition{}, 1, 2)
+			So(exact.Estimated, ShouldBeFalse)
+			count, estimated := h.Profile().NewSet(env).SearchCountEstimate()
+			So(estimated, ShouldBeTrue)
+			So(count, ShouldEqual, exact.Total)
+		}), ShouldBeNil)
+	})
+	Convey("Testing side effects in a new transaction", t, func() {
+		var janeName string
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			userJane := h.User().Search(env, q.User().Email().Equals("jane.smith@example.com"))
+			janeName = userJane.Name()
+			userJane.SetName("Jane Rolled Back")
+			err := userJane.InNewTransaction(func(s m.UserSet) error {
+				So(s.Name(), ShouldEqual, janeName)
+				h.Tag().Create(s.Env(), h.Tag().NewData().SetName("Jane Notified"))
+				return nil
+			})
+			So(err, ShouldBeNil)
+		}), ShouldBeNil)
+		So(models.ExecuteInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			So(h.User().Search(env, q.User().Email().Equals("jane.smith@example.com")).Name(), ShouldEqual, janeName)
+			notified := h.Tag().Search(env, q.Tag().Name().Equals("Jane Notified"))
+			So(notified.Len(), ShouldEqual, 1)
+			notified.Unlink()
+		}), ShouldBeNil)
+	})
+	Convey("Testing linking many2many fields by ids", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			post := h.Post().Create(env, h.Post().NewData().SetTitle("Linked By Ids").SetContent("Content"))
+			var tagIds []int64
+			for i := 0; i < 5; i++ {
+				tagIds = append(tagIds, h.Tag().Create(env, h.Tag().NewData().SetName(fmt.Sprintf("Linked Tag %d", i))).ID())
+			}
+			So(post.AddTagsByIds(tagIds...).Tags().Len(), ShouldEqual, 5)
+			So(post.AddTagsByIds(tagIds[0], tagIds[1]).Tags().Len(), ShouldEqual, 5)
+			So(h.Tag().BrowseOne(env, tagIds[2]).Posts().Ids(), ShouldContain, post.ID())
+			post.RemoveTagsByIds(tagIds[:3]...)
+			So(post.Tags().Ids(), ShouldHaveLength, 2)
+			So(post.Tags().Ids(), ShouldContain, tagIds[4])
+			So(h.Tag().BrowseOne(env, tagIds[2]).Posts().Ids(), ShouldNotContain, post.ID())
+		}), ShouldBeNil)
+	})
+	Convey("Testing in place edits through data pointers", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			users := h.User().NewSet(env).SearchAll().OrderBy("ID")
+			data := users.AllPtr()
+			So(data, ShouldHaveLength, users.Len())
+			for _, d := range data {
+				if d.Email() == "jane.smith@example.com" {
+					d.SetNums(d.Nums() + 100)
+					d.SetIsStaff(d.IsStaff())
+				}
+			}
+			var janeData m.UserData
+			for _, d := range data {
+				if d.Email() == "jane.smith@example.com" {
+					janeData = d
+					continue
+				}
+				So(d.DirtyFields(), ShouldBeEmpty)
+			}
+			So(janeData.DirtyFields(), ShouldHaveLength, 1)
+			So(janeData.DirtyFields()[0].Name(), ShouldEqual, "Nums")
+			So(users.WriteDirty(data), ShouldEqual, 1)
+			So(janeData.DirtyFields(), ShouldBeEmpty)
+			So(h.User().Search(env, q.User().Email().Equals("jane.smith@example.com")).Nums(), ShouldEqual, janeData.Nums())
+		}), ShouldBeNil)
+	})
+	Convey("Testing display names of many2one fields in bulk", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			userJane := h.User().Search(env, q.User().Email().Equals("jane.smith@example.com"))
+			userWill := h.User().Search(env, q.User().Name().Equals("Will Smith"))
+			So(userWill.Name(), ShouldNotEqual, userJane.Name())
+			janePosts := h.Post().NewSet(env)
+			willPosts := h.Post().NewSet(env)
+			for i := 0; i < 20; i++ {
+				if i%2 == 0 {
+					janePosts = janePosts.Union(h.Post().Create(env, h.Post().NewData().SetTitle(fmt.Sprintf("Grid Post %02d", i)).SetUser(userJane)))
+					continue
+				}
+				willPosts = willPosts.Union(h.Post().Create(env, h.Post().NewData().SetTitle(fmt.Sprintf("Grid Post %02d", i)).SetUser(userWill)))
+			}
+			orphan := h.Post().Create(env, h.Post().NewData().SetTitle("Grid Post Orphan"))
+			posts := h.Post().Search(env, q.Post().Title().Contains("Grid Post"))
+			So(posts.Len(), ShouldEqual, 21)
+			before := env.QueryStats().Count
+			names := posts.UserNames()
+			So(env.QueryStats().Count-before, ShouldBeLessThanOrEqualTo, 2)
+			So(names, ShouldHaveLength, 20)
+			So(names, ShouldNotContainKey, orphan.ID())
+			for _, id := range janePosts.Ids() {
+				So(names[id], ShouldEqual, userJane.Name())
+			}
+			for _, id := range willPosts.Ids() {
+				So(names[id], ShouldEqual, userWill.Name())
+			}
+			Convey("Records pointing to other targets should not be returned", func() {
+				janeNames := janePosts.UserNames()
+				So(janeNames, ShouldHaveLength, 10)
+				for _, id := range willPosts.Ids() {
+					So(janeNames, ShouldNotContainKey, id)
+				}
+				So(orphan.UserNames(), ShouldBeEmpty)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing streamed search read", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			for i := 1; i <= 120; i++ {
+				h.Profile().Create(env, h.Profile().NewData().SetAge(int16(i)).SetCity("Export City").SetCountry("Exportland"))
+			}
+			cond := q.Profile().City().Equals("Export City")
+			next := h.Profile().SearchReadStream(env, cond, []models.FieldName{h.Profile().Fields().Age()}, 50)
+			var (
+				count   int
+				batches int
+				lastID  int64
+			)
+			for batch, ok := next(); ok; batch, ok = next() {
+				batches++
+				for _, record := range batch {
+					count++
+					So(record, ShouldHaveLength, 2)
+					So(record["age"], ShouldEqual, int16(count))
+					So(record["id"], ShouldBeGreaterThan, lastID)
+					lastID = record["id"].(int64)
+				}
+			}
+			So(count, ShouldEqual, 120)
+			So(batches, ShouldEqual, 3)
+		}), ShouldBeNil)
+	})
+	Convey("Testing updates from column expressions", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			p1 := h.Profile().Create(env, h.Profile().NewData().SetAge(3).SetMoney(12.5).SetCity("Expr City"))
+			p2 := h.Profile().Create(env, h.Profile().NewData().SetAge(2).SetMoney(100).SetCity("Expr City"))
+			p3 := h.Profile().Create(env, h.Profile().NewData().SetAge(4).SetMoney(10).SetCity("Other Expr City"))
+			cond := q.Profile().City().Equals("Expr City")
+			n := h.Profile().UpdateExpr(env, cond, map[string]models.Expr{
+				"Money": models.Col("Money").Mul(models.Col("Age")),
+				"Age":   models.Col("Age").Add(models.Val(1)),
+			})
+			So(n, ShouldEqual, 2)
+			So(p1.Money(), ShouldEqual, 37.5)
+			So(p1.Age(), ShouldEqual, 4)
+			So(p2.Money(), ShouldEqual, 200)
+			So(p2.Age(), ShouldEqual, 3)
+			So(p3.Money(), ShouldEqual, 10)
+			So(p3.Age(), ShouldEqual, 4)
+			So(func() {
+				h.Profile().UpdateExpr(env, cond, map[string]models.Expr{"City": models.Col("City").Add(models.Val("x"))})
+			}, ShouldPanic)
+			So(func() {
+				h.Profile().UpdateExpr(env, cond, map[string]models.Expr{"Money": models.Col("City").Mul(models.Val(2))})
+			}, ShouldPanic)
+			So(func() {
+				h.User().UpdateExpr(env, q.UserCondition{}, map[string]models.Expr{"Age": models.Val(3)})
+			}, ShouldPanic)
+		}), ShouldBeNil)
+	})
+	Convey("Testing multiple searches in a single query", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			jane := h.User().Search(env, q.User().Name().Equals("Jane Smith"))
+			john := h.User().Search(env, q.User().Name().Equals("John Smith"))
+			will := h.User().Search(env, q.User().Name().Equals("Will Smith"))
+			res := h.User().MultiSearch(env,
+				q.User().Name().In([]string{"Jane Smith", "John Smith"}),
+				q.User().Name().In([]string{"John Smith", "Will Smith"}),
+				q.User().Name().Equals("Nobody"),
+				q.UserCondition{},
+				q.User().ProfileFilteredOn(q.Profile().Age().GreaterOrEqual(12)).Or().Name().Equals("Will Smith"))
+			So(res, ShouldHaveLength, 5)
+			So(res[0].Equals(jane.Union(john)), ShouldBeTrue)
+			So(res[1].Equals(john.Union(will)), ShouldBeTrue)
+			So(res[2].IsEmpty(), ShouldBeTrue)
+			So(res[3].IsEmpty(), ShouldBeTrue)
+			So(res[4].Equals(h.User().Search(env,
+				q.User().ProfileFilteredOn(q.Profile().Age().GreaterOrEqual(12)).Or().Name().Equals("Will Smith"))), ShouldBeTrue)
+			So(h.User().MultiSearch(env), ShouldBeEmpty)
+		}), ShouldBeNil)
+	})
 }
 
 func TestAdvancedQueries(t *testing.T) {
@@ -337,6 +919,22 @@ func TestAdvancedQueries(t *testing.T) {
 				So(users.Len(), ShouldEqual, 1)
 				So(users.ID(), ShouldEqual, jane.ID())
 			})
+			Convey("O2M existence conditions", func() {
+				users := h.User().Search(env, q.User().PostsAny(q.Post().Title().Equals("1st Post")))
+				So(users.Len(), ShouldEqual, 1)
+				So(users.ID(), ShouldEqual, jane.ID())
+				users = h.User().Search(env, q.User().PostsNone(q.Post().Title().Equals("1st Post")))
+				So(users.Len(), ShouldEqual, 2)
+				So(users.Intersect(jane).IsEmpty(), ShouldBeTrue)
+				users = h.User().Search(env, q.User().PostsAny(q.Post().NewCondition()))
+				So(users.Len(), ShouldEqual, 1)
+				So(users.ID(), ShouldEqual, jane.ID())
+				users = h.User().Search(env, q.User().PostsNone(q.Post().NewCondition()))
+				So(users.Equals(h.User().Search(env, q.User().Posts().IsNull())), ShouldBeTrue)
+				users = h.User().Search(env, q.User().PostsAny(q.Post().TagsAny(q.Tag().Name().Equals("Trending"))))
+				So(users.Len(), ShouldEqual, 1)
+				So(users.ID(), ShouldEqual, jane.ID())
+			})
 		}), ShouldBeNil)
 	})
 	Convey("Testing advanced queries on M2M relations", t, func() {
@@ -367,6 +965,16 @@ func TestAdvancedQueries(t *testing.T) {
 				So(posts.Len(), ShouldEqual, 1)
 				So(posts.ID(), ShouldEqual, post1.ID())
 			})
+			Convey("M2M existence conditions", func() {
+				posts := h.Post().Search(env, q.Post().TagsAny(q.Tag().Name().Equals("Trending")))
+				So(posts.Len(), ShouldEqual, 1)
+				So(posts.ID(), ShouldEqual, post1.ID())
+				posts = h.Post().Search(env, q.Post().TagsNone(q.Tag().Name().Equals("Trending")).
+					And().Title().In([]string{"1st Post", "2nd Post"}))
+				So(posts.Len(), ShouldEqual, 1)
+				So(posts.ID(), ShouldEqual, post2.ID())
+				So(h.Post().Search(env, q.Post().TagsNone(q.Tag().NewCondition())).IsEmpty(), ShouldBeTrue)
+			})
 		}), ShouldBeNil)
 	})
 }
@@ -388,6 +996,16 @@ func TestUpdateRecordSet(t *testing.T) {
 				So(jv2.Nums(), ShouldEqual, 13)
 				So(jv2.HasNums(), ShouldBeTrue)
 			})
+			Convey("Only set fields should be in a new ModelData", func() {
+				data := h.User().NewData().SetName("Will").SetNums(3)
+				So(data.HasName(), ShouldBeTrue)
+				So(data.HasNums(), ShouldBeTrue)
+				So(data.HasEmail(), ShouldBeFalse)
+				So(data.HasIsStaff(), ShouldBeFalse)
+				So(data.FieldNames(), ShouldHaveLength, 2)
+				So(data.FieldNames().JSON(), ShouldContain, "name")
+				So(data.FieldNames().JSON(), ShouldContain, "nums")
+			})
 			Convey("Checking FieldMap conversion to ModelData", func() {
 				fm := models.FieldMap{
 					"Email": "jsmith2@example.com",
@@ -530,6 +1148,49 @@ func TestUpdateRecordSet(t *testing.T) {
 			})
 		}), ShouldBeNil)
 	})
+	Convey("Testing conditional updates with CompareAndSet", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			john := h.User().Search(env, q.User().Name().Equals("John Smith"))
+			So(john.CompareAndSetNums(13, 14), ShouldBeTrue)
+			So(john.Nums(), ShouldEqual, 14)
+			So(john.CompareAndSetNums(13, 15), ShouldBeFalse)
+			So(john.Nums(), ShouldEqual, 14)
+			So(john.CompareAndSetEmail("jsmith2@example.com", "jsmith3@example.com"), ShouldBeTrue)
+			So(john.Email(), ShouldEqual, "jsmith3@example.com")
+		}), ShouldBeNil)
+	})
+	Convey("Testing fields that cannot be written", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			post := h.Post().Create(env, h.Post().NewData().
+				SetTitle("Imported Post").
+				SetImportRef("IMP-001"))
+			So(post.ImportRef(), ShouldEqual, "IMP-001")
+			So(func() { post.Write(h.Post().NewData().SetImportRef("IMP-002")) }, ShouldPanic)
+			So(func() { post.Set(h.Post().Fields().ImportRef(), "IMP-002") }, ShouldPanic)
+			So(func() { post.Write(h.Post().NewData().SetTitle("Renamed Post").SetImportRef("IMP-002")) }, ShouldPanic)
+			post.InvalidateCache()
+			So(post.ImportRef(), ShouldEqual, "IMP-001")
+			So(post.Title(), ShouldEqual, "Imported Post")
+			post.SetTitle("Renamed Post")
+			So(post.Title(), ShouldEqual, "Renamed Post")
+			So(h.Post().FieldsGet(h.Post().Fields().ImportRef())["import_ref"].ReadOnly, ShouldBeTrue)
+			So(h.Post().FieldsGet(h.Post().Fields().Title())["title"].ReadOnly, ShouldBeFalse)
+		}), ShouldBeNil)
+	})
+	Convey("Testing reference fields", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			comment := h.Comment().Search(env, q.Comment().Text().Equals("First Comment"))
+			post1 := h.Post().Search(env, q.Post().Title().Equals("1st Post"))
+			So(comment.Document(), ShouldBeNil)
+			comment.SetDocument(post1)
+			So(comment.Document().ModelName(), ShouldEqual, "Post")
+			So(comment.Document().Collection().Wrap().(m.PostSet).Title(), ShouldEqual, "1st Post")
+			So(h.Comment().Search(env, q.Comment().Document().Equals(post1)).Len(), ShouldEqual, 1)
+			So(func() { comment.SetDocument(h.Post().NewSet(env).SearchAll()) }, ShouldPanic)
+			comment.SetDocument(nil)
+			So(comment.Document(), ShouldBeNil)
+		}), ShouldBeNil)
+	})
 	group1 := security.Registry.NewGroup("group1", "Group 1")
 	Convey("Testing access control list on update (write only)", t, func() {
 		So(models.SimulateInNewEnvironment(2, func(env models.Environment) {
@@ -604,6 +1265,38 @@ func TestUpdateRecordSet(t *testing.T) {
 			})
 		}), ShouldBeNil)
 	})
+	Convey("Testing changesets of writes", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			var (
+				written m.ProfileSet
+				changes map[int64]models.Changeset
+			)
+			h.Profile().AfterWrite(func(rs m.ProfileSet, c map[int64]models.Changeset) {
+				written, changes = rs, c
+			})
+			p1 := h.Profile().Create(env, h.Profile().NewData().SetAge(30).SetCity("Paris").SetMoney(10))
+			p2 := h.Profile().Create(env, h.Profile().NewData().SetAge(40).SetCity("Lyon").SetMoney(10))
+			changes = nil
+			profiles := p1.Union(p2)
+			profiles.Write(h.Profile().NewData().SetCity("Paris").SetMoney(20))
+			So(written.Len(), ShouldEqual, 2)
+			So(changes, ShouldHaveLength, 2)
+			So(changes[p1.ID()], ShouldHaveLength, 1)
+			So(changes[p1.ID()]["Money"].Old, ShouldEqual, 10)
+			So(changes[p1.ID()]["Money"].New, ShouldEqual, 20)
+			So(changes[p2.ID()], ShouldHaveLength, 2)
+			So(changes[p2.ID()]["City"].Old, ShouldEqual, "Lyon")
+			So(changes[p2.ID()]["City"].New, ShouldEqual, "Paris")
+			So(changes[p2.ID()]["Money"].New, ShouldEqual, 20)
+			changes = nil
+			p1.SetCity("Paris")
+			So(changes, ShouldBeNil)
+			p1.SetAge(31)
+			So(changes, ShouldHaveLength, 1)
+			So(changes[p1.ID()], ShouldContainKey, "Age")
+			So(changes[p1.ID()]["Age"].New, ShouldEqual, 31)
+		}), ShouldBeNil)
+	})
 	security.Registry.UnregisterGroup(group1)
 }
 
@@ -632,6 +1325,135 @@ func TestDeleteRecordSet(t *testing.T) {
 			})
 		}), ShouldBeNil)
 	})
+	Convey("Deleting records referenced without foreign key", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			tag := h.Tag().Create(env, h.Tag().NewData().SetName("Featured"))
+			post := h.Post().Create(env, h.Post().NewData().SetTitle("Featured Post").SetFeaturedTag(tag))
+			So(post.FeaturedTag().Equals(tag), ShouldBeTrue)
+			tagID := tag.ID()
+			tag.Unlink()
+			post.InvalidateCache()
+			So(post.FeaturedTag().IsEmpty(), ShouldBeTrue)
+			So(post.Search(q.Post().FeaturedTag().Equals(h.Tag().BrowseOne(env, tagID))).Len(), ShouldEqual, 1)
+		}), ShouldBeNil)
+	})
+	Convey("Searching array fields", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			post1 := h.Post().Create(env, h.Post().NewData().SetTitle("Go Post").SetKeywords([]string{"go", "sql"}))
+			post2 := h.Post().Create(env, h.Post().NewData().SetTitle("Python Post").SetKeywords([]string{"python", "sql"}))
+			h.Post().Create(env, h.Post().NewData().SetTitle("Empty Post"))
+			posts := post1.Union(post2)
+			So(post1.Keywords(), ShouldResemble, types.StringArray{"go", "sql"})
+			So(post2.Keywords().Contains("python"), ShouldBeTrue)
+			Convey("Contains should match records with the given element", func() {
+				res := h.Post().Search(env, q.Post().Keywords().Contains("sql"))
+				So(res.Len(), ShouldEqual, 2)
+				So(res.Intersect(posts).Len(), ShouldEqual, 2)
+				res = h.Post().Search(env, q.Post().Keywords().Contains("go"))
+				So(res.Equals(post1), ShouldBeTrue)
+			})
+			Convey("ContainsAll should match records with all the given elements", func() {
+				res := h.Post().Search(env, q.Post().Keywords().ContainsAll([]string{"python", "sql"}))
+				So(res.Equals(post2), ShouldBeTrue)
+				res = h.Post().Search(env, q.Post().Keywords().ContainsAll([]string{"go", "python"}))
+				So(res.IsEmpty(), ShouldBeTrue)
+			})
+			Convey("Overlaps should match records with at least one of the given elements", func() {
+				res := h.Post().Search(env, q.Post().Keywords().Overlaps([]string{"go", "python"}))
+				So(res.Len(), ShouldEqual, 2)
+				So(res.Intersect(posts).Len(), ShouldEqual, 2)
+				res = h.Post().Search(env, q.Post().Keywords().Overlaps([]string{"rust"}))
+				So(res.IsEmpty(), ShouldBeTrue)
+			})
+			Convey("Writing array fields should update the searched values", func() {
+				post1.SetKeywords(append(post1.Keywords(), "rust"))
+				res := h.Post().Search(env, q.Post().Keywords().Overlaps([]string{"rust"}))
+				So(res.Equals(post1), ShouldBeTrue)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Reading relations with a custom context", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			activeTag := h.Tag().Create(env, h.Tag().NewData().SetName("Active Tag"))
+			archivedTag := h.Tag().Create(env, h.Tag().NewData().SetName("Archived Tag"))
+			post := h.Post().Create(env, h.Post().NewData().SetTitle("Tagged Post").SetTags(activeTag.Union(archivedTag)))
+			archivedTag.SetActive(false)
+			tags := post.TagsWithContext(map[string]interface{}{"active_test": false})
+			So(tags.Len(), ShouldEqual, 2)
+			So(tags.Intersect(archivedTag).Len(), ShouldEqual, 1)
+			So(tags.Env().Context().HasKey("active_test"), ShouldBeTrue)
+			So(tags.Env().Context().GetBool("active_test"), ShouldBeFalse)
+			So(post.Env().Context().HasKey("active_test"), ShouldBeFalse)
+		}), ShouldBeNil)
+	})
+	Convey("Searching encrypted fields", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			profile := h.Profile().Create(env, h.Profile().NewData().SetSSN("123-45-6789"))
+			profile.InvalidateCache()
+			So(profile.SSN(), ShouldEqual, "123-45-6789")
+			So(h.Profile().Search(env, q.Profile().SSN().Equals("123-45-6789")).Equals(profile), ShouldBeTrue)
+			So(h.Profile().Search(env, q.Profile().SSN().Equals("123-45-6780")).IsEmpty(), ShouldBeTrue)
+			profile.SetSSN("987-65-4321")
+			So(h.Profile().Search(env, q.Profile().SSN().In([]string{"987-65-4321"})).Equals(profile), ShouldBeTrue)
+		}), ShouldBeNil)
+	})
+	Convey("Searching with a condition tree", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			ct := q.User().NewConditionTree()
+			cond := ct.Compile(ct.Group(models.And,
+				ct.Leaf(h.User().Fields().Email(), operator.IContains, "example.com"),
+				ct.Group(models.Or,
+					ct.Leaf(h.User().Fields().Name(), operator.Equals, "John Smith"),
+					ct.Group(models.And,
+						ct.Leaf(h.User().Fields().Name(), operator.Like, "Jane%"),
+						ct.Leaf(h.User().FieldName("Profile.Age"), operator.Greater, 20)))))
+			users := h.User().Search(env, cond)
+			expected := h.User().Search(env, q.User().Email().IContains("example.com").AndCond(
+				q.User().Name().Equals("John Smith").OrCond(
+					q.User().Name().Like("Jane%").And().ProfileFilteredOn(q.Profile().Age().Greater(20)))))
+			So(users.Len(), ShouldBeGreaterThan, 0)
+			So(users.Equals(expected), ShouldBeTrue)
+			So(func() { ct.Compile(ct.Leaf(h.User().Fields().Name(), operator.Equals, 12)) }, ShouldPanic)
+		}), ShouldBeNil)
+	})
+	Convey("Fetching records changed since a given time", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			oldTag := h.Tag().Create(env, h.Tag().NewData().SetName("Old Tag"))
+			writtenTag := h.Tag().Create(env, h.Tag().NewData().SetName("Written Tag"))
+			time.Sleep(10 * time.Millisecond)
+			since := time.Now()
+			newTag := h.Tag().Create(env, h.Tag().NewData().SetName("New Tag"))
+			writtenTag.SetDescription("Updated")
+			changed := h.Tag().ChangedSince(env, since)
+			So(changed.Len(), ShouldEqual, 2)
+			So(changed.Records()[0].Equals(writtenTag), ShouldBeTrue)
+			So(changed.Records()[1].Equals(newTag), ShouldBeTrue)
+			So(changed.Intersect(oldTag).IsEmpty(), ShouldBeTrue)
+			So(h.Tag().ChangedSince(env, time.Now()).IsEmpty(), ShouldBeTrue)
+		}), ShouldBeNil)
+	})
+	Convey("Fetching records deleted since a given time", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			oldTag := h.Tag().Create(env, h.Tag().NewData().SetName("Old Deleted Tag"))
+			oldTagID := oldTag.ID()
+			oldTag.Unlink()
+			time.Sleep(10 * time.Millisecond)
+			since := time.Now()
+			tag1 := h.Tag().Create(env, h.Tag().NewData().SetName("Deleted Tag 1"))
+			tag2 := h.Tag().Create(env, h.Tag().NewData().SetName("Deleted Tag 2"))
+			keptTag := h.Tag().Create(env, h.Tag().NewData().SetName("Kept Tag"))
+			ids := tag1.Union(tag2).Ids()
+			tag1.Union(tag2).Unlink()
+			deleted := h.Tag().DeletedSince(env, since)
+			So(deleted, ShouldHaveLength, 2)
+			So(deleted, ShouldContain, ids[0])
+			So(deleted, ShouldContain, ids[1])
+			So(deleted, ShouldNotContain, oldTagID)
+			So(deleted, ShouldNotContain, keptTag.ID())
+			So(h.Tag().DeletedSince(env, since.Add(-time.Hour)), ShouldContain, oldTagID)
+			So(h.Tag().DeletedSince(env, time.Now()), ShouldBeEmpty)
+		}), ShouldBeNil)
+	})
 	group1 := security.Registry.NewGroup("group1", "Group 1")
 	Convey("Checking unlink access permissions", t, func() {
 		So(models.SimulateInNewEnvironment(2, func(env models.Environment) {
@@ -686,3 +1508,35 @@ func TestDeleteRecordSet(t *testing.T) {
 	})
 	security.Registry.UnregisterGroup(group1)
 }
+
+// userNameMock is a m.UserSet whose Name method is mocked.
+type userNameMock struct {
+	m.UserSet
+}
+
+// Name returns a mocked user name
+func (u userNameMock) Name() string {
+	return "Mocked Name"
+}
+
+// greetUser returns a greeting for the given user
+func greetUser(user m.UserSet) string {
+	return "Hello " + user.Name()
+}
+
+func TestRecordSetInterfaces(t *testing.T) {
+	Convey("Testing RecordSet interfaces", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			Convey("Generated RecordSets should implement their model's interface", func() {
+				rs := h.User().NewSet(env).Collection().Wrap("User")
+				_, ok := rs.(m.UserSet)
+				So(ok, ShouldBeTrue)
+				jane := h.User().Search(env, q.User().Name().Equals("Jane Smith"))
+				So(greetUser(jane), ShouldEqual, "Hello Jane Smith")
+			})
+			Convey("Interfaces should allow mocking RecordSets", func() {
+				So(greetUser(userNameMock{}), ShouldEqual, "Hello Mocked Name")
+			})
+		}), ShouldBeNil)
+	})
+}
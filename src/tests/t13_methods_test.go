@@ -19,6 +19,7 @@ import (
 
 	"github.com/hexya-erp/hexya/src/models"
 	"github.com/hexya-erp/hexya/src/models/security"
+	"github.com/hexya-erp/hexya/src/tests/testmodule"
 	"github.com/hexya-erp/pool/h"
 	"github.com/hexya-erp/pool/m"
 	"github.com/hexya-erp/pool/q"
@@ -39,6 +40,42 @@ func TestMethods(t *testing.T) {
 			Convey("Calling recursive method", func() {
 				So(h.User().NewSet(env).RecursiveMethod(3, "Start"), ShouldEqual, "> > > > Start <, recursion 3 <, recursion 2 <, recursion 1 <")
 			})
+			Convey("Calling a method with named results", func() {
+				userJane := h.User().Search(env, q.User().Email().Equals("jane.smith@example.com"))
+				posts, titles := userJane.PostsSummary()
+				So(posts.Len(), ShouldEqual, 2)
+				So(titles, ShouldHaveLength, 2)
+				res := userJane.PostsSummaryResult()
+				So(res.Posts.Len(), ShouldEqual, 2)
+				So(res.Posts.Equals(userJane.Posts()), ShouldBeTrue)
+				So(res.Titles, ShouldHaveLength, 2)
+				So(res.Titles, ShouldContain, "1st Post")
+				So(res.Titles, ShouldContain, "2nd Post")
+			})
+			Convey("Calling a model level method without a RecordSet", func() {
+				guest := h.User().NewGuest(env, "Guest")
+				So(guest.Len(), ShouldEqual, 1)
+				So(guest.Name(), ShouldEqual, "Guest")
+				So(guest.Email(), ShouldEqual, "guest@guests.example.com")
+				So(h.User().Methods().NewGuest().Underlying().IsModelLevel(), ShouldBeTrue)
+				So(h.User().Methods().PrefixedUser().Underlying().IsModelLevel(), ShouldBeFalse)
+			})
+			Convey("Calling a method declared with @cached", func() {
+				tag := h.Tag().Create(env, h.Tag().NewData().SetName("Cached Tag").SetRate(2))
+				calls := testmodule.WeightedRateCalls
+				So(tag.WeightedRate(1.5), ShouldEqual, 3)
+				So(tag.WeightedRate(1.5), ShouldEqual, 3)
+				So(tag.WithContext("active_test", false).WeightedRate(1.5), ShouldEqual, 3)
+				So(testmodule.WeightedRateCalls, ShouldEqual, calls+1)
+				So(tag.WithContext("lang", "fr_FR").WeightedRate(1.5), ShouldEqual, 3)
+				So(testmodule.WeightedRateCalls, ShouldEqual, calls+2)
+				So(tag.WeightedRate(2), ShouldEqual, 4)
+				So(testmodule.WeightedRateCalls, ShouldEqual, calls+3)
+				tag.SetRate(3)
+				So(tag.WeightedRate(1.5), ShouldEqual, 4.5)
+				So(testmodule.WeightedRateCalls, ShouldEqual, calls+4)
+				So(h.Tag().Methods().WeightedRate().Underlying().IsMemoized(), ShouldBeTrue)
+			})
 		}), ShouldBeNil)
 	})
 }
@@ -128,6 +165,136 @@ func TestComputedStoredFields(t *testing.T) {
 				userWill := h.User().Search(env, q.User().Email().Equals("will.smith@example.com"))
 				So(func() { userWill.SetDecoratedName("FooBar") }, ShouldPanic)
 			})
+			Convey("Checking that a field computed on create only keeps its value", func() {
+				post := h.Post().Create(env, h.Post().NewData().SetTitle("Snapshot Post"))
+				So(post.OriginalTitle(), ShouldEqual, "Snapshot Post")
+				post.SetTitle("Renamed Post")
+				So(post.Title(), ShouldEqual, "Renamed Post")
+				So(post.OriginalTitle(), ShouldEqual, "Snapshot Post")
+			})
+			Convey("Checking that a lazily computed field is stored when first read", func() {
+				post := h.Post().Create(env, h.Post().NewData().SetTitle("Lazy Post"))
+				So(post.Search(q.Post().UpperTitle().IsNull()).IsEmpty(), ShouldBeFalse)
+				So(post.UpperTitle(), ShouldEqual, "LAZY POST")
+				So(post.Search(q.Post().UpperTitle().IsNull()).IsEmpty(), ShouldBeTrue)
+				So(post.RawUpperTitle(), ShouldEqual, "LAZY POST")
+				post.SetTitle("Renamed Lazy Post")
+				So(post.Search(q.Post().UpperTitle().IsNull()).IsEmpty(), ShouldBeFalse)
+				So(post.UpperTitle(), ShouldEqual, "RENAMED LAZY POST")
+				So(post.Search(q.Post().UpperTitle().IsNull()).IsEmpty(), ShouldBeTrue)
+			})
+			Convey("Checking that an empty lazily computed field is computed only once", func() {
+				post := h.Post().Create(env, h.Post().NewData().SetTitle("   "))
+				calls := testmodule.UpperTitleCalls
+				So(post.UpperTitle(), ShouldBeEmpty)
+				So(testmodule.UpperTitleCalls, ShouldEqual, calls+1)
+				post.InvalidateCache()
+				So(post.UpperTitle(), ShouldBeEmpty)
+				So(testmodule.UpperTitleCalls, ShouldEqual, calls+1)
+			})
+			Convey("Checking that a lazily computed field is not stored from a read only environment", func() {
+				post := h.Post().Create(env, h.Post().NewData().SetTitle("Read Only Lazy Post"))
+				roPost := post.WithEnv(env.ReadOnly())
+				So(roPost.UpperTitle(), ShouldEqual, "READ ONLY LAZY POST")
+				So(post.Search(q.Post().UpperTitle().IsNull()).IsEmpty(), ShouldBeFalse)
+				So(post.UpperTitle(), ShouldEqual, "READ ONLY LAZY POST")
+				So(post.Search(q.Post().UpperTitle().IsNull()).IsEmpty(), ShouldBeTrue)
+			})
+			Convey("Checking that Read and Marshal store lazily computed fields", func() {
+				post := h.Post().Create(env, h.Post().NewData().SetTitle("Read Lazy Post"))
+				data := post.Read(models.FieldNames{h.Post().Fields().UpperTitle()})
+				So(data[0].UpperTitle(), ShouldEqual, "READ LAZY POST")
+				So(post.Search(q.Post().UpperTitle().IsNull()).IsEmpty(), ShouldBeTrue)
+				post2 := h.Post().Create(env, h.Post().NewData().SetTitle("Marshaled Lazy Post"))
+				_, err := post2.Marshal()
+				So(err, ShouldBeNil)
+				So(post2.Search(q.Post().UpperTitle().IsNull()).IsEmpty(), ShouldBeTrue)
+				So(post2.RawUpperTitle(), ShouldEqual, "MARSHALED LAZY POST")
+			})
+			Convey("Checking that a versioned cache field is stored with the version of its dependencies", func() {
+				post := h.Post().Create(env, h.Post().NewData().SetTitle("Versioned Post"))
+				So(post.TitleWords(), ShouldEqual, 2)
+				version := post.TitleWordsVersion()
+				So(version, ShouldNotBeEmpty)
+				So(post.RawTitleWords(), ShouldEqual, 2)
+				post.SetAbstract("Unrelated change")
+				So(post.TitleWords(), ShouldEqual, 2)
+				So(post.TitleWordsVersion(), ShouldEqual, version)
+				post.SetTitle("Renamed Versioned Post")
+				So(post.RawTitleWords(), ShouldEqual, 3)
+				So(post.TitleWords(), ShouldEqual, 3)
+				So(post.TitleWordsVersion(), ShouldNotEqual, version)
+			})
+		}), ShouldBeNil)
+	})
+	Convey("Testing guarded computed fields", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			jane := h.User().Search(env, q.User().Email().Equals("jane.smith@example.com"))
+			jane.Write(h.User().NewData().SetIsPremium(false).SetNums(2))
+			previous := jane.PremiumNums()
+			jane.SetNums(3)
+			So(jane.PremiumNums(), ShouldEqual, previous)
+			jane.SetIsPremium(true)
+			So(jane.PremiumNums(), ShouldEqual, 30)
+			jane.SetIsPremium(false)
+			jane.SetNums(4)
+			So(jane.PremiumNums(), ShouldEqual, 30)
+		}), ShouldBeNil)
+	})
+	Convey("Testing raw access to stored computed fields", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			jane := h.User().Search(env, q.User().Email().Equals("jane.smith@example.com"))
+			So(jane.RawAge(), ShouldEqual, jane.Profile().Age())
+			env.Cr().Execute(`UPDATE "user" SET age = ? WHERE id = ?`, 99, jane.ID())
+			So(jane.RawAge(), ShouldEqual, 99)
+			So(jane.RawAge(), ShouldNotEqual, jane.Profile().Age())
+			So(func() { h.User().NewSet(env).SearchAll().RawAge() }, ShouldPanic)
+		}), ShouldBeNil)
+	})
+	Convey("Testing aggregate fields", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			tag1 := h.Tag().Create(env, h.Tag().NewData().SetName("Rated 2").SetRate(2))
+			tag2 := h.Tag().Create(env, h.Tag().NewData().SetName("Rated 3.5").SetRate(3.5))
+			post := h.Post().Create(env, h.Post().NewData().SetTitle("Rated Post"))
+			So(post.TagsRate(), ShouldEqual, 0)
+			So(post.NbTags(), ShouldEqual, 0)
+			So(post.BestTagRate(), ShouldEqual, 0)
+			Convey("Aggregates should be computed when lines are added", func() {
+				post.SetTags(tag1.Union(tag2))
+				So(post.TagsRate(), ShouldEqual, 5.5)
+				So(post.NbTags(), ShouldEqual, 2)
+				So(post.BestTagRate(), ShouldEqual, 3.5)
+				Convey("Aggregates should be updated when a line changes", func() {
+					tag1.SetRate(5)
+					So(post.TagsRate(), ShouldEqual, 8.5)
+					So(post.NbTags(), ShouldEqual, 2)
+					So(post.BestTagRate(), ShouldEqual, 5)
+				})
+				Convey("Aggregates should be updated when a line is removed", func() {
+					post.SetTags(tag2)
+					So(post.TagsRate(), ShouldEqual, 3.5)
+					So(post.NbTags(), ShouldEqual, 1)
+					So(h.Post().Search(env, q.Post().TagsRate().Equals(3.5)).Equals(post), ShouldBeTrue)
+				})
+				Convey("Aggregates should be updated when a line is unlinked", func() {
+					tag1.Unlink()
+					So(post.TagsRate(), ShouldEqual, 3.5)
+					So(post.NbTags(), ShouldEqual, 1)
+				})
+			})
+			Convey("Aggregates should be updated when links are changed from the other side", func() {
+				tag1.SetPosts(post)
+				So(post.TagsRate(), ShouldEqual, 2)
+				So(post.NbTags(), ShouldEqual, 1)
+				tag2.SetPosts(post)
+				So(post.TagsRate(), ShouldEqual, 5.5)
+				So(post.NbTags(), ShouldEqual, 2)
+				So(post.BestTagRate(), ShouldEqual, 3.5)
+				tag2.SetPosts(h.Post().NewSet(env))
+				So(post.TagsRate(), ShouldEqual, 2)
+				So(post.NbTags(), ShouldEqual, 1)
+				So(h.Post().Search(env, q.Post().TagsRate().Equals(2)).Equals(post), ShouldBeTrue)
+			})
 		}), ShouldBeNil)
 	})
 }
@@ -90,6 +90,79 @@ func TestBaseModelMethods(t *testing.T) {
 					So(evenPosts[i].Title(), ShouldEqual, fmt.Sprintf("Post no %02d", 2*i))
 				}
 			})
+			Convey("Every and Some", func() {
+				for i := 0; i < 5; i++ {
+					h.Post().Create(env, h.Post().NewData().
+						SetTitle(fmt.Sprintf("Checked post %d", i)).
+						SetUser(userJane))
+				}
+				posts := h.Post().Search(env, q.Post().Title().Contains("Checked post"))
+				var calls int
+				isEven := func(rs m.PostSet) bool {
+					calls++
+					var num int
+					fmt.Sscanf(rs.Title(), "Checked post %d", &num)
+					return num%2 == 0
+				}
+				So(posts.Every(isEven), ShouldBeFalse)
+				So(posts.Some(isEven), ShouldBeTrue)
+				So(calls, ShouldBeLessThan, 2*posts.Len())
+				evenPosts := posts.Filtered(isEven)
+				So(evenPosts.Every(isEven), ShouldBeTrue)
+				oddPosts := posts.Subtract(evenPosts)
+				So(oddPosts.Some(isEven), ShouldBeFalse)
+				So(h.Post().NewSet(env).Every(isEven), ShouldBeTrue)
+				So(h.Post().NewSet(env).Some(isEven), ShouldBeFalse)
+			})
+			Convey("Dynamic filters", func() {
+				post1 := h.Post().Search(env, q.Post().Title().Equals("1st Post"))
+				tag := h.Tag().Create(env, h.Tag().NewData().
+					SetName("Dynamic").
+					SetDescription("Dynamic filter tag").
+					SetPosts(post1))
+				So(h.Post().Search(env, tag.BestPostRelationFilter()).Equals(post1), ShouldBeTrue)
+				tag.SetPosts(h.Post().NewSet(env))
+				So(h.Post().Search(env, tag.BestPostRelationFilter()).IsEmpty(), ShouldBeTrue)
+			})
+			Convey("Mapping records to another model", func() {
+				post1 := h.Post().Search(env, q.Post().Title().Equals("1st Post"))
+				comment := h.Comment().Create(env, h.Comment().NewData().
+					SetPost(post1).
+					SetText("Great post"))
+				data := comment.MapTo(h.Post(), map[string]string{
+					"PostWriter": "User",
+					"Text":       "Title",
+				}, map[string]models.FieldTransform{
+					"Text": func(value interface{}) interface{} { return "Re: " + value.(string) },
+				}).(m.PostData)
+				So(data.Title(), ShouldEqual, "Re: Great post")
+				So(data.User().Equals(post1.User()), ShouldBeTrue)
+				answer := h.Post().Create(env, data)
+				So(answer.Title(), ShouldEqual, "Re: Great post")
+				So(answer.User().Equals(post1.User()), ShouldBeTrue)
+				So(func() { comment.MapTo(h.Post(), map[string]string{"Post": "User"}, nil) }, ShouldPanic)
+				So(func() { comment.MapTo(h.Post(), map[string]string{"Text": "Unknown"}, nil) }, ShouldPanic)
+				So(func() { h.Comment().NewSet(env).MapTo(h.Post(), map[string]string{"Text": "Title"}, nil) }, ShouldPanic)
+			})
+			Convey("Mapped fields", func() {
+				users := h.User().NewSet(env).SearchAll()
+				tags := h.Tag().NewSet(env)
+				titles := users.MappedPostsTitle()
+				for _, user := range users.Records() {
+					for _, post := range user.Posts().Records() {
+						tags = tags.Union(post.Tags())
+						So(titles, ShouldContain, post.Title())
+					}
+				}
+				So(users.MappedPostsTags().Subtract(tags).IsEmpty(), ShouldBeTrue)
+				So(tags.Subtract(users.MappedPostsTags()).IsEmpty(), ShouldBeTrue)
+			})
+			Convey("Field sections", func() {
+				fInfos := h.User().FieldsGet()
+				So(fInfos["size"].Section, ShouldEqual, "Measurements")
+				So(fInfos["education"].Section, ShouldEqual, "Resume")
+				So(fInfos["name"].Section, ShouldBeBlank)
+			})
 		}), ShouldBeNil)
 	})
 }
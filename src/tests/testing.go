@@ -113,6 +113,8 @@ func InitializeTests(moduleName string) {
 		Password: password,
 		SSLMode:  "disable",
 	})
+	// Fixed key for the encrypted fields of the tested modules
+	models.SetEncryptionKey([]byte("hexya-tests-encryption-key-32by!"))
 	models.BootStrap()
 	resourceDir, _ := filepath.Abs(filepath.Join(".", "res"))
 	server.ResourceDir = resourceDir
@@ -17,12 +17,14 @@ package testmodule
 import (
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/hexya-erp/hexya/src/actions"
 	"github.com/hexya-erp/hexya/src/models"
 	"github.com/hexya-erp/hexya/src/models/fields"
 	"github.com/hexya-erp/hexya/src/models/security"
 	"github.com/hexya-erp/hexya/src/models/types"
+	"github.com/hexya-erp/hexya/src/models/types/dates"
 	"github.com/hexya-erp/pool/h"
 	"github.com/hexya-erp/pool/m"
 	"github.com/hexya-erp/pool/q"
@@ -32,6 +34,10 @@ var (
 	// IsStaffHelp exported
 	IsStaffHelp   = "This is a var help message"
 	isPremiumHelp = "This the IsPremium Help message"
+	// WeightedRateCalls counts the executions of the cached WeightedRate method
+	WeightedRateCalls int
+	// UpperTitleCalls counts the computations of the lazy UpperTitle field
+	UpperTitleCalls int
 )
 
 const (
@@ -42,7 +48,7 @@ const (
 const isPremiumString = isPremiumDescription
 
 var fields_User = map[string]models.FieldDefinition{
-	"Name": fields.Char{String: "Name", Help: "The user's username", Unique: true,
+	"Name": fields.Char{String: "Name", Help: "The user's username", Placeholder: "e.g. John Smith", Unique: true,
 		NoCopy: true, OnChange: h.User().Methods().OnChangeName()},
 	"DecoratedName": fields.Char{Compute: h.User().Methods().ComputeDecoratedName()},
 	"Email":         fields.Char{Help: "The user's email address", Size: 100, Index: true},
@@ -55,15 +61,17 @@ var fields_User = map[string]models.FieldDefinition{
 	"Age": fields.Integer{Compute: h.User().Methods().ComputeAge(),
 		Inverse: h.User().Methods().InverseSetAge(),
 		Depends: []string{"Profile", "Profile.Age"}, Stored: true, GoType: new(int16)},
-	"Posts":     fields.One2Many{RelationModel: h.Post(), ReverseFK: "User", Copy: true},
+	"Posts":     fields.One2Many{RelationModel: h.Post(), ReverseFK: "User", Copy: true, Mapped: []string{"Title", "Tags"}},
 	"PMoney":    fields.Float{Related: "Profile.Money"},
 	"Resume":    fields.Many2One{RelationModel: h.Resume(), Embed: true},
 	"LastPost":  fields.Many2One{RelationModel: h.Post()},
 	"Email2":    fields.Char{},
 	"IsPremium": fields.Boolean{String: isPremiumString, Help: isPremiumHelp},
 	"Nums":      fields.Integer{GoType: new(int)},
-	"Size":      fields.Float{},
-	"Education": fields.Text{String: "Educational Background"},
+	"PremiumNums": fields.Integer{Compute: h.User().Methods().ComputePremiumNums(), Stored: true,
+		Depends: []string{"Nums"}, ComputeGuard: "IsPremium", GoType: new(int)},
+	"Size":      fields.Float{Section: "Measurements"},
+	"Education": fields.Text{String: "Educational Background", Section: "Resume"},
 }
 
 // DecorateEmail decorates the email of the given user
@@ -83,6 +91,10 @@ func user_ComputeAge(rs m.UserSet) m.UserData {
 	return h.User().NewData().SetAge(rs.Profile().Age())
 }
 
+func user_ComputePremiumNums(rs m.UserSet) m.UserData {
+	return h.User().NewData().SetPremiumNums(10 * rs.Nums())
+}
+
 func user_PrefixedUser(rs m.UserSet, prefix string) []string {
 	var res []string
 	for _, u := range rs.Records() {
@@ -146,6 +158,21 @@ func user_Aggregates(rs m.UserSet, fieldNames ...models.FieldName) []m.UserGroup
 	return rs.Super().Aggregates(fieldNames...)
 }
 
+func user_PostsSummary(rs m.UserSet) (posts m.PostSet, titles []string) {
+	posts = rs.Posts()
+	for _, post := range posts.Records() {
+		titles = append(titles, post.Title())
+	}
+	return
+}
+
+// NewGuest creates a new guest user with the given name.
+func user_NewGuest(rs m.UserSet, name string) m.UserSet {
+	return h.User().Create(rs.Env(), h.User().NewData().
+		SetName(name).
+		SetEmail(fmt.Sprintf("%s@guests.example.com", strings.ToLower(name))))
+}
+
 var fields_Profile = map[string]models.FieldDefinition{
 	"Age":      fields.Integer{GoType: new(int16)},
 	"Gender":   fields.Selection{Selection: types.Selection{"male": "Male", "female": "Female"}},
@@ -153,6 +180,7 @@ var fields_Profile = map[string]models.FieldDefinition{
 	"User":     fields.Rev2One{RelationModel: h.User(), ReverseFK: "Profile"},
 	"BestPost": fields.Many2One{RelationModel: h.Post()},
 	"Country":  fields.Char{},
+	"SSN":      fields.Encrypted{BlindIndex: true},
 	"UserName": fields.Char{Related: "User.Name"},
 	"Action":   fields.Char{GoType: new(actions.ActionRef)},
 }
@@ -169,16 +197,26 @@ func profile_ext_PrintAddress(rs m.ProfileSet) string {
 
 var fields_Post = map[string]models.FieldDefinition{
 	"User":             fields.Many2One{RelationModel: h.User()},
-	"Title":            fields.Char{Required: true},
+	"Title":            fields.Char{Required: true, SearchType: models.TrigramSearch},
+	"OriginalTitle":    fields.Char{Compute: h.Post().Methods().ComputeOriginalTitle(), Stored: true, ComputeOnCreateOnly: true},
+	"UpperTitle":       fields.Char{Compute: h.Post().Methods().ComputeUpperTitle(), Stored: true, LazyCompute: true, Depends: []string{"Title"}},
+	"TitleWords":       fields.Integer{Compute: h.Post().Methods().ComputeTitleWords(), Stored: true, VersionedCache: true, Depends: []string{"Title"}},
 	"Content":          fields.HTML{},
 	"Tags":             fields.Many2Many{RelationModel: h.Tag()},
+	"FeaturedTag":      fields.Many2One{RelationModel: h.Tag(), NoFK: true},
+	"Keywords":         fields.Array{},
 	"Abstract":         fields.Text{},
 	"Attachment":       fields.Binary{},
 	"LastRead":         fields.Date{},
+	"ImportRef":        fields.Char{NoWrite: true},
+	"CheckedAt":        fields.DateTime{Compute: h.Post().Methods().ComputeCheckedAt(), TimeDependent: true},
 	"Comments":         fields.One2Many{RelationModel: h.Comment(), ReverseFK: "Post"},
 	"FirstCommentText": fields.Text{Related: "Comments.Text"},
 	"FirstTagName":     fields.Char{Related: "Tags.Name"},
 	"WriterMoney":      fields.Float{Related: "User.PMoney"},
+	"TagsRate":         fields.Float{Aggregate: models.SumOf("Tags", "Rate")},
+	"NbTags":           fields.Integer{Aggregate: models.CountOf("Tags")},
+	"BestTagRate":      fields.Float{Aggregate: models.MaxOf("Tags", "Rate")},
 }
 
 func post_Create(rs m.PostSet, data m.PostData) m.PostSet {
@@ -186,6 +224,23 @@ func post_Create(rs m.PostSet, data m.PostData) m.PostSet {
 	return res
 }
 
+func post_ComputeCheckedAt(_ m.PostSet) m.PostData {
+	return h.Post().NewData().SetCheckedAt(dates.Now())
+}
+
+func post_ComputeOriginalTitle(rs m.PostSet) m.PostData {
+	return h.Post().NewData().SetOriginalTitle(rs.Title())
+}
+
+func post_ComputeUpperTitle(rs m.PostSet) m.PostData {
+	UpperTitleCalls++
+	return h.Post().NewData().SetUpperTitle(strings.ToUpper(strings.TrimSpace(rs.Title())))
+}
+
+func post_ComputeTitleWords(rs m.PostSet) m.PostData {
+	return h.Post().NewData().SetTitleWords(int64(len(strings.Fields(rs.Title()))))
+}
+
 func post_Search(rs m.PostSet, cond q.PostCondition) m.PostSet {
 	res := rs.Super().Search(cond)
 	return res
@@ -196,11 +251,12 @@ var fields_Comment = map[string]models.FieldDefinition{
 	"PostWriter":  fields.Many2One{RelationModel: h.User(), Related: "Post.User"},
 	"WriterMoney": fields.Float{Related: "PostWriter.PMoney"},
 	"Text":        fields.Text{},
+	"Document":    fields.Reference{},
 }
 
 var fields_Tag = map[string]models.FieldDefinition{
 	"Name":        fields.Char{Constraint: h.Tag().Methods().CheckNameDescription()},
-	"BestPost":    fields.Many2One{RelationModel: h.Post()},
+	"BestPost":    fields.Many2One{RelationModel: h.Post(), DynamicFilter: h.Tag().Methods().BestPostFilter(), FilterDepends: []string{"Posts"}},
 	"Posts":       fields.Many2Many{RelationModel: h.Post()},
 	"Parent":      fields.Many2One{RelationModel: h.Tag()},
 	"Description": fields.Char{Constraint: h.Tag().Methods().CheckNameDescription()},
@@ -213,6 +269,18 @@ func tag_CheckNameDescription(rs m.TagSet) {
 	}
 }
 
+func tag_BestPostFilter(rs m.TagSet) q.PostCondition {
+	return q.Post().ID().In(rs.Posts().Ids())
+}
+
+// WeightedRate returns the rate of this tag multiplied by weight.
+//
+// @cached lang
+func tag_WeightedRate(rs m.TagSet, weight float64) float64 {
+	WeightedRateCalls++
+	return float64(rs.Rate()) * weight
+}
+
 func tag_CheckRate(rs m.TagSet) {
 	if rs.Rate() < 0 || rs.Rate() > 10 {
 		log.Panic("Tag rate must be between 0 and 10")
@@ -271,16 +339,20 @@ func init() {
 
 	h.User().AddFields(fields_User)
 	h.User().Fields().Experience().SetString("Professional Experience")
+	h.User().AddViewStruct("Contact", "Name", "Email", "Profile")
 
 	h.User().NewMethod("OnChangeName", user_OnChangeName)
 	h.User().NewMethod("ComputeDecoratedName", user_ComputeDecoratedName)
 	h.User().NewMethod("ComputeAge", user_ComputeAge)
+	h.User().NewMethod("ComputePremiumNums", user_ComputePremiumNums)
 	h.User().NewMethod("PrefixedUser", user_PrefixedUser)
 	h.User().NewMethod("DecorateEmail", user_DecorateEmail)
 	h.User().NewMethod("RecursiveMethod", user_RecursiveMethod)
 	h.User().NewMethod("SubSetSuper", user_SubSetSuper)
 	h.User().NewMethod("InverseSetAge", user_InverseSetAge)
 	h.User().NewMethod("UpdateCity", user_UpdateCity)
+	h.User().NewMethod("PostsSummary", user_PostsSummary)
+	h.User().NewModelMethod("NewGuest", user_NewGuest)
 	h.User().Methods().DecorateEmail().Extend(user_ext_DecorateEmail)
 	h.User().Methods().RecursiveMethod().Extend(user_ext_RecursiveMethod)
 	h.User().Methods().SubSetSuper().Extend(user_ext_SubSetSuper)
@@ -302,6 +374,10 @@ func init() {
 
 	h.Post().Methods().Create().Extend(post_Create)
 	h.Post().Methods().Search().Extend(post_Search)
+	h.Post().NewMethod("ComputeCheckedAt", post_ComputeCheckedAt)
+	h.Post().NewMethod("ComputeOriginalTitle", post_ComputeOriginalTitle)
+	h.Post().NewMethod("ComputeUpperTitle", post_ComputeUpperTitle)
+	h.Post().NewMethod("ComputeTitleWords", post_ComputeTitleWords)
 
 	models.NewModel("Comment")
 
@@ -314,6 +390,8 @@ func init() {
 
 	h.Tag().NewMethod("CheckNameDescription", tag_CheckNameDescription).AllowGroup(security.GroupEveryone)
 	h.Tag().NewMethod("CheckRate", tag_CheckRate)
+	h.Tag().NewMethod("BestPostFilter", tag_BestPostFilter)
+	h.Tag().NewMethod("WeightedRate", tag_WeightedRate)
 
 	models.NewModel("Resume")
 
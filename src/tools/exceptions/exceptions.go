@@ -6,6 +6,46 @@ package exceptions
 
 import "fmt"
 
+// An Exception is an error that must rollback the current transaction
+// and that holds a message for the user and details for the developer.
+type Exception interface {
+	error
+	// UserMessage returns the message to display to the user
+	UserMessage() string
+	// DebugInfo returns the details of the error for the developer
+	DebugInfo() string
+	// Type returns the name of this kind of exception as sent to clients
+	Type() string
+}
+
+// WithDebug returns a copy of the given Exception with its debug
+// information replaced by debug.
+func WithDebug(exc Exception, debug string) Exception {
+	switch e := exc.(type) {
+	case UserError:
+		e.Debug = debug
+		return e
+	case ValidationError:
+		e.Debug = debug
+		return e
+	case AccessError:
+		e.Debug = debug
+		return e
+	case MissingError:
+		e.Debug = debug
+		return e
+	case ConcurrencyError:
+		e.Debug = debug
+		return e
+	}
+	return exc
+}
+
+// formatError returns the error string of an exception
+func formatError(msg, debug string) string {
+	return fmt.Sprintf("%s\n----------------------------------\n%s", msg, debug)
+}
+
 // UserError is an error that must rollback the current transaction and
 // be displayed as a warning to the user.
 type UserError struct {
@@ -16,5 +56,136 @@ type UserError struct {
 // Error method for the UserError type.
 // Returns the message.
 func (u UserError) Error() string {
-	return fmt.Sprintf("%s\n----------------------------------\n%s", u.Message, u.Debug)
+	return formatError(u.Message, u.Debug)
+}
+
+// UserMessage returns the message of this UserError
+func (u UserError) UserMessage() string {
+	return u.Message
+}
+
+// DebugInfo returns the debug information of this UserError
+func (u UserError) DebugInfo() string {
+	return u.Debug
+}
+
+// Type returns "user_error"
+func (u UserError) Type() string {
+	return "user_error"
+}
+
+// ValidationError is raised when data does not satisfy a constraint
+// of the model, such as a constraint method or an SQL constraint.
+type ValidationError struct {
+	Message string
+	Debug   string
 }
+
+// Error method for the ValidationError type.
+func (v ValidationError) Error() string {
+	return formatError(v.Message, v.Debug)
+}
+
+// UserMessage returns the message of this ValidationError
+func (v ValidationError) UserMessage() string {
+	return v.Message
+}
+
+// DebugInfo returns the debug information of this ValidationError
+func (v ValidationError) DebugInfo() string {
+	return v.Debug
+}
+
+// Type returns "validation_error"
+func (v ValidationError) Type() string {
+	return "validation_error"
+}
+
+// AccessError is raised when the current user is not allowed
+// to perform an operation.
+type AccessError struct {
+	Message string
+	Debug   string
+}
+
+// Error method for the AccessError type.
+func (a AccessError) Error() string {
+	return formatError(a.Message, a.Debug)
+}
+
+// UserMessage returns the message of this AccessError
+func (a AccessError) UserMessage() string {
+	return a.Message
+}
+
+// DebugInfo returns the debug information of this AccessError
+func (a AccessError) DebugInfo() string {
+	return a.Debug
+}
+
+// Type returns "access_error"
+func (a AccessError) Type() string {
+	return "access_error"
+}
+
+// MissingError is raised when an operation is performed on
+// records that do not exist.
+type MissingError struct {
+	Message string
+	Debug   string
+}
+
+// Error method for the MissingError type.
+func (m MissingError) Error() string {
+	return formatError(m.Message, m.Debug)
+}
+
+// UserMessage returns the message of this MissingError
+func (m MissingError) UserMessage() string {
+	return m.Message
+}
+
+// DebugInfo returns the debug information of this MissingError
+func (m MissingError) DebugInfo() string {
+	return m.Debug
+}
+
+// Type returns "missing_error"
+func (m MissingError) Type() string {
+	return "missing_error"
+}
+
+// ConcurrencyError is raised when a transaction could not be
+// completed because of concurrent updates of the same data.
+type ConcurrencyError struct {
+	Message string
+	Debug   string
+}
+
+// Error method for the ConcurrencyError type.
+func (c ConcurrencyError) Error() string {
+	return formatError(c.Message, c.Debug)
+}
+
+// UserMessage returns the message of this ConcurrencyError
+func (c ConcurrencyError) UserMessage() string {
+	return c.Message
+}
+
+// DebugInfo returns the debug information of this ConcurrencyError
+func (c ConcurrencyError) DebugInfo() string {
+	return c.Debug
+}
+
+// Type returns "concurrency_error"
+func (c ConcurrencyError) Type() string {
+	return "concurrency_error"
+}
+
+var (
+	_ Exception = UserError{}
+	_ Exception = ValidationError{}
+	_ Exception = AccessError{}
+	_ Exception = MissingError{}
+	_ Exception = ConcurrencyError{}
+)
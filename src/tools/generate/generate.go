@@ -16,22 +16,75 @@ import (
 	"text/template"
 
 	"github.com/hexya-erp/hexya/src/models"
+	"github.com/hexya-erp/hexya/src/models/fieldtype"
+	"github.com/hexya-erp/hexya/src/models/operator"
 	"github.com/hexya-erp/hexya/src/tools/strutils"
 )
 
-// A fieldData describes a field in a RecordSet
-type fieldData struct {
-	Name        string
-	JSON        string
-	RelModel    string
-	Type        string
-	IType       string
+// A FieldData describes a field in a RecordSet. It is available to
+// the pool templates through the Fields slice of ModelData.
+type FieldData struct {
+	// Name is the name of the field, e.g. "PartnerName"
+	Name string
+	// JSON is the name of the field's column in the database
+	JSON string
+	// RelModel is the name of the related model of a relation field
+	RelModel string
+	// Type is the Go type of the field in the generated code, e.g. "m.PartnerSet"
+	Type string
+	// IType is the type of the field in the interfaces package
+	IType string
+	// TypeWrapper is the type returned by the field's getter if it is not Type
 	TypeWrapper string
-	SanType     string
-	ImportPath  string
-	IsRS        bool
-	MixinField  bool
-	EmbedField  bool
+	// SanType is IType sanitized to be used in an identifier
+	SanType string
+	// ImportPath is the import path of the package of the field's type, if any
+	ImportPath string
+	// IsRS is true for relation fields
+	IsRS bool
+	// IsRef is true for reference fields
+	IsRef bool
+	// ToMany is true for one2many and many2many fields
+	ToMany bool
+	// MixinField is true for fields inherited from a mixin
+	MixinField bool
+	// EmbedField is true for fields inherited from an embedded model
+	EmbedField bool
+	// The following values are set from the field's parameters
+	// and enable the corresponding generated methods.
+	TimeDependent bool
+	OnCreateOnly  bool
+	Lazy          bool
+	Versioned     bool
+	ComputeGuard  string
+	NoFK          bool
+	Sequence      string
+	Aggregate     string
+	Section       string
+	Trigram       bool
+	NoWrite       bool
+	Required      bool
+	CompareAndSet bool
+	DynamicFilter bool
+	Toggle        bool
+	Increment     bool
+	Distinct      bool
+	Raw           bool
+	Transform     bool
+	Names         bool
+	RelationIds   bool
+	Mapped        []mappedFieldData
+}
+
+// A mappedFieldData describes a field of the related model of a
+// one2many or many2many field, that can be read across the relation.
+type mappedFieldData struct {
+	Name     string
+	JSON     string
+	RelModel string
+	Type     string
+	IType    string
+	IsRS     bool
 }
 
 // A methodData describes a method in a RecordSet
@@ -48,12 +101,75 @@ type methodData struct {
 	IReturnString    string
 	Call             string
 	ToDeclare        bool
+	ModelLevel       bool
+	Cached           bool
+	CacheContext     string
+	ResultStruct     string
+	ResultFields     []resultFieldData
+	ResultValues     string
+}
+
+// A resultFieldData describes a field of the struct returned
+// by a method with named results
+type resultFieldData struct {
+	Name string
+	Type string
+}
+
+// A viewStructData describes a view struct of a model, i.e. a struct
+// holding a subset of its fields, and its loader method
+type viewStructData struct {
+	Name       string
+	StructName string
+	Fields     []resultFieldData
 }
 
 // an operatorDef defines an operator func
+//
+// Operator is only set for the operators registered with RegisterOperator.
+// The generated func then calls ConditionField.AddOperator with it.
+// ArgType is the type of the argument if it is not the type of the field.
 type operatorDef struct {
-	Name  string
-	Multi bool
+	Name     string
+	Operator string
+	ArgType  string
+	Multi    bool
+}
+
+// arrayElemTypes gives the Go type of the elements of each array field type
+var arrayElemTypes = map[string]string{
+	"types.StringArray":  "string",
+	"types.IntegerArray": "int64",
+	"types.FloatArray":   "float64",
+}
+
+// A customOperator is an operator registered with RegisterOperator
+type customOperator struct {
+	def     operatorDef
+	goTypes map[string]bool
+}
+
+// customOperators are the operators registered with RegisterOperator
+var customOperators []customOperator
+
+// RegisterOperator adds a method with the given name to the generated condition
+// fields of the fields whose Go type is one of goTypes (e.g. "string" or
+// "float64"), or of all fields if no type is given. The method adds a condition
+// with op, which must have been registered in the models package with
+// models.RegisterOperator. If multi is true, the method expects a slice.
+//
+// This function must be called before CreatePool by the program that generates
+// the pool, as for RegisterPoolTemplate. The init functions of the modules are
+// not run when generating the pool, since their sources are only parsed.
+func RegisterOperator(name string, op operator.Operator, multi bool, goTypes ...string) {
+	co := customOperator{
+		def:     operatorDef{Name: name, Operator: string(op), Multi: multi},
+		goTypes: make(map[string]bool),
+	}
+	for _, typ := range goTypes {
+		co.goTypes[typ] = true
+	}
+	customOperators = append(customOperators, co)
 }
 
 // An fieldType holds the name and valid operators on a field type
@@ -61,30 +177,48 @@ type fieldType struct {
 	Type      string
 	SanType   string
 	IsRS      bool
+	IsDate    bool
 	Operators []operatorDef
 }
 
-// A modelData describes a RecordSet model
-type modelData struct {
-	Name                  string
-	SnakeName             string
-	ModelsPackageName     string
-	QueryPackageName      string
+// A ModelData describes a RecordSet model. It is the data with which
+// the pool templates are executed for each model, including the custom
+// templates registered with RegisterPoolTemplate.
+type ModelData struct {
+	// Name is the name of the model, e.g. "Partner"
+	Name string
+	// SnakeName is the name of the model in snake case, e.g. "partner".
+	// It is also the name of the model's packages in h and q.
+	SnakeName string
+	// ModelsPackageName is the name of the pool package with model data (h)
+	ModelsPackageName string
+	// QueryPackageName is the name of the pool package with query data (q)
+	QueryPackageName string
+	// InterfacesPackageName is the name of the pool package with model interfaces (m)
 	InterfacesPackageName string
-	ModelType             string
-	IsModelMixin          bool
-	Deps                  []string
-	RelModels             []string
-	Fields                []fieldData
-	Methods               []methodData
-	AllMethods            []methodData
-	ConditionFuncs        []string
-	Types                 []fieldType
-	TypesDeps             []string
+	// ModelType is the type of the model, e.g. "Mixin" or "Transient"
+	ModelType string
+	// IsModelMixin is true for the mixins declared in the models package
+	IsModelMixin bool
+	// Deps are the import paths needed by the fields and methods of the model
+	Deps []string
+	// ModelMethodsDeps are the import paths needed by the model's methods in h
+	ModelMethodsDeps []string
+	// RelModels are the names of the models related to this model
+	RelModels []string
+	// Fields are the fields of the model, sorted by name
+	Fields []FieldData
+	// Methods are the methods of the model, sorted by name
+	Methods        []methodData
+	AllMethods     []methodData
+	ConditionFuncs []string
+	Types          []fieldType
+	TypesDeps      []string
+	ViewStructs    []viewStructData
 }
 
-// sort sorts all slices fields of this modelData so that the generated code is always the same.
-func (m *modelData) sort() {
+// sort sorts all slices fields of this ModelData so that the generated code is always the same.
+func (m *ModelData) sort() {
 	sort.Strings(m.Deps)
 	sort.Slice(m.Fields, func(i, j int) bool {
 		return m.Fields[i].Name < m.Fields[j].Name
@@ -96,10 +230,14 @@ func (m *modelData) sort() {
 		return m.AllMethods[i].Name < m.AllMethods[j].Name
 	})
 	sort.Strings(m.Deps)
+	sort.Strings(m.ModelMethodsDeps)
 	sort.Strings(m.RelModels)
 	sort.Slice(m.Types, func(i, j int) bool {
 		return m.Types[i].Type < m.Types[j].Type
 	})
+	sort.Slice(m.ViewStructs, func(i, j int) bool {
+		return m.ViewStructs[i].Name < m.ViewStructs[j].Name
+	})
 }
 
 // createTypeIdent creates a string from the given type that
@@ -133,8 +271,8 @@ func CreatePool(modules []*ModuleInfo, dir string) {
 			mASTData.Methods[methToADD] = MethodASTData{}
 		}
 		go func(modelName string, modelASTData ModelASTData) {
-			depsMap := map[string]bool{ModelsPath: true}
-			mData := modelData{
+			depsMap := map[string]bool{ModelsPath: true, ActionsPath: true, ExceptionsPath: true}
+			mData := ModelData{
 				Name:                  modelName,
 				SnakeName:             strutils.SnakeCase(modelName),
 				ModelsPackageName:     PoolModelPackage,
@@ -145,11 +283,13 @@ func CreatePool(modules []*ModuleInfo, dir string) {
 				ConditionFuncs:        []string{"And", "AndNot", "Or", "OrNot"},
 			}
 			// Add fields
-			addFieldsToModelData(modelASTData, &mData, &depsMap)
+			addFieldsToModelData(modelsASTData, &mData, &depsMap)
 			// Add field types
 			addFieldTypesToModelData(&mData)
 			// Add methods
 			addMethodsToModelData(modelsASTData, &mData, &depsMap)
+			// Add view structs
+			addViewStructsToModelData(modelsASTData, &mData)
 			// Setting imports
 			var deps []string
 			for dep := range depsMap {
@@ -168,14 +308,25 @@ func CreatePool(modules []*ModuleInfo, dir string) {
 }
 
 // addMethodsToModelData extracts data from modelsASTData to populate methods in modelData
-func addMethodsToModelData(modelsASTData map[string]ModelASTData, modelData *modelData, depsMap *map[string]bool) {
+func addMethodsToModelData(modelsASTData map[string]ModelASTData, modelData *ModelData, depsMap *map[string]bool) {
 	modelASTData := modelsASTData[modelData.Name]
+	modelMethodsDeps := make(map[string]bool)
 	for methodName, methodASTData := range modelASTData.Methods {
 		if handler, exists := specificMethodsHandlers[methodName]; exists {
 			handler(&methodASTData, modelData, depsMap)
 			continue
 		}
+		if methodASTData.ModelLevel {
+			for _, astParam := range methodASTData.Params {
+				modelMethodsDeps[astParam.Type.ImportPath] = true
+			}
+			for _, ret := range methodASTData.Returns {
+				modelMethodsDeps[ret.ImportPath] = true
+			}
+		}
 		var params, paramsWithType, iParamsWithType, paramsType, call, returns, returnAsserts, returnString, iReturnString string
+		var resultStruct, resultValues string
+		var resultFields []resultFieldData
 		for _, astParam := range methodASTData.Params {
 			paramType := astParam.Type.Type
 			iParamType := trimInterfacePackagePrefix(paramType)
@@ -225,53 +376,129 @@ func addMethodsToModelData(modelsASTData map[string]ModelASTData, modelData *mod
 				iReturnString += fmt.Sprintf("%s,", iTyp)
 				returns += fmt.Sprintf("resTyped%d,", i)
 			}
+			if len(methodASTData.ResultNames) == len(methodASTData.Returns) && !methodASTData.ModelLevel {
+				resultStruct, resultFields, resultValues = namedResultsData(modelData.Name, &methodASTData, modelsASTData)
+			}
 		}
 		modelData.AllMethods = append(modelData.AllMethods, methodData{
 			Name:             methodName,
 			Doc:              methodASTData.Doc,
 			ToDeclare:        methodASTData.ToDeclare,
+			ModelLevel:       methodASTData.ModelLevel,
 			ParamsTypes:      strings.TrimRight(paramsType, ","),
 			IParamsWithTypes: strings.TrimRight(iParamsWithType, ","),
 			ReturnString:     strings.TrimSuffix(returnString, ","),
 			IReturnString:    strings.TrimSuffix(iReturnString, ","),
+			ResultStruct:     resultStruct,
+			ResultFields:     resultFields,
 		})
+		var cacheContext []string
+		for _, key := range methodASTData.CacheContext {
+			cacheContext = append(cacheContext, fmt.Sprintf("%q", key))
+		}
 		modelData.Methods = append(modelData.Methods, methodData{
 			Name:           methodName,
 			Doc:            methodASTData.Doc,
 			ToDeclare:      methodASTData.ToDeclare,
+			ModelLevel:     methodASTData.ModelLevel,
+			Cached:         methodASTData.Cached,
+			CacheContext:   strings.Join(cacheContext, ", "),
 			Params:         strings.TrimRight(params, ","),
 			ParamsWithType: strings.TrimRight(paramsWithType, ","),
 			ReturnAsserts:  strings.TrimSuffix(returnAsserts, "\n"),
 			Returns:        strings.TrimSuffix(returns, ","),
 			ReturnString:   strings.TrimSuffix(returnString, ","),
 			Call:           call,
+			ResultStruct:   resultStruct,
+			ResultValues:   resultValues,
 		})
 	}
+	// Model level methods are declared in the models package file,
+	// which already imports some packages.
+	imported := map[string]bool{
+		"":                                     true,
+		ModelsPath:                             true,
+		PoolPath + "/" + PoolInterfacesPackage: true,
+	}
+	if modelData.ModelType != "Mixin" {
+		imported[ActionsPath] = true
+		imported[TypesPath] = true
+		imported[PoolPath+"/"+PoolQueryPackage] = true
+	}
+	if modelData.ModelType == "" || modelData.ModelType == "Transient" {
+		imported["time"] = true
+	}
+	for dep := range modelMethodsDeps {
+		if !imported[dep] {
+			modelData.ModelMethodsDeps = append(modelData.ModelMethodsDeps, dep)
+		}
+	}
+}
+
+// namedResultsData returns the name and the fields of the struct returned by
+// the <Method>Result wrapper of the given method with named results, as well as
+// the composite literal that populates this struct from the typed results.
+func namedResultsData(modelName string, methodASTData *MethodASTData, modelsASTData map[string]ModelASTData) (string, []resultFieldData, string) {
+	structName := fmt.Sprintf("%s%sResult", modelName, methodASTData.Name)
+	fields := make([]resultFieldData, len(methodASTData.Returns))
+	var values string
+	for i, ret := range methodASTData.Returns {
+		iTyp := trimInterfacePackagePrefix(ret.Type)
+		if isRS, _ := isRecordSetType(ret.Type, modelsASTData); isRS {
+			iTyp = fmt.Sprintf("%sSet", modelName)
+		}
+		name := strings.Title(methodASTData.ResultNames[i])
+		fields[i] = resultFieldData{Name: name, Type: iTyp}
+		values += fmt.Sprintf("%s: resTyped%d,", name, i)
+	}
+	return structName, fields, fmt.Sprintf("%s.%s{%s}", PoolInterfacesPackage, structName, strings.TrimSuffix(values, ","))
 }
 
-// addFieldsToModelData extracts data from modelASTData to populate fields in modelData
-func addFieldsToModelData(modelASTData ModelASTData, modelData *modelData, depsMap *map[string]bool) {
+// addFieldsToModelData extracts data from modelsASTData to populate fields in modelData
+func addFieldsToModelData(modelsASTData map[string]ModelASTData, modelData *ModelData, depsMap *map[string]bool) {
+	modelASTData := modelsASTData[modelData.Name]
 	relModels := make(map[string]bool)
 	for fieldName, fieldASTData := range modelASTData.Fields {
-		typStr := fieldASTData.Type.Type
-		iTypStr := trimInterfacePackagePrefix(typStr)
+		typStr, iTypStr := fieldTypeStrings(fieldASTData)
 		if fieldASTData.RelModel != "" {
 			relModels[fieldASTData.RelModel] = true
-			typStr = fmt.Sprintf("%s.%sSet", PoolInterfacesPackage, fieldASTData.RelModel)
-			iTypStr = fmt.Sprintf("%sSet", fieldASTData.RelModel)
 		}
 		jsonName := strutils.GetDefaultString(fieldASTData.JSON, models.SnakeCaseFieldName(fieldName, fieldASTData.FType))
-		modelData.Fields = append(modelData.Fields, fieldData{
-			Name:       fieldName,
-			JSON:       jsonName,
-			Type:       typStr,
-			IType:      iTypStr,
-			IsRS:       fieldASTData.IsRS,
-			RelModel:   fieldASTData.RelModel,
-			SanType:    createTypeIdent(typStr),
-			MixinField: fieldASTData.MixinField,
-			EmbedField: fieldASTData.EmbedField,
-			ImportPath: fieldASTData.Type.ImportPath,
+		modelData.Fields = append(modelData.Fields, FieldData{
+			Name:          fieldName,
+			JSON:          jsonName,
+			Type:          typStr,
+			IType:         iTypStr,
+			IsRS:          fieldASTData.IsRS,
+			IsRef:         fieldASTData.FType == fieldtype.Reference,
+			ToMany:        fieldASTData.FType == fieldtype.One2Many || fieldASTData.FType == fieldtype.Many2Many,
+			RelModel:      fieldASTData.RelModel,
+			SanType:       createTypeIdent(typStr),
+			MixinField:    fieldASTData.MixinField,
+			EmbedField:    fieldASTData.EmbedField,
+			ImportPath:    fieldASTData.Type.ImportPath,
+			TimeDependent: fieldASTData.TimeDependent,
+			OnCreateOnly:  fieldASTData.OnCreateOnly,
+			Lazy:          fieldASTData.Lazy,
+			Versioned:     fieldASTData.Versioned,
+			ComputeGuard:  fieldASTData.ComputeGuard,
+			NoFK:          fieldASTData.NoFK,
+			Sequence:      fieldASTData.Sequence,
+			Aggregate:     fieldASTData.Aggregate,
+			Section:       fieldASTData.Section,
+			Trigram:       fieldASTData.Trigram,
+			NoWrite:       fieldASTData.NoWrite,
+			Required:      fieldASTData.Required && !fieldASTData.Computed,
+			CompareAndSet: fieldName != "ID" && !fieldASTData.FType.IsNonStoredRelationType() && !fieldASTData.Computed && !fieldASTData.EmbedField && !fieldASTData.NoWrite && !fieldASTData.Contexted,
+			DynamicFilter: fieldASTData.DynamicFilter && fieldASTData.RelModel != "",
+			Toggle:        fieldASTData.FType == fieldtype.Boolean && !fieldASTData.Computed && !fieldASTData.EmbedField && !fieldASTData.NoWrite && !fieldASTData.Contexted,
+			Increment:     (fieldASTData.FType == fieldtype.Integer || fieldASTData.FType == fieldtype.Float) && !fieldASTData.Computed && !fieldASTData.EmbedField && !fieldASTData.NoWrite,
+			Distinct:      fieldName != "ID" && !fieldASTData.IsRS && fieldASTData.FType != fieldtype.Binary && fieldASTData.FType != fieldtype.Reference && fieldASTData.FType != fieldtype.Encrypted && !fieldASTData.Computed && !fieldASTData.EmbedField,
+			Raw:           fieldASTData.Computed && !fieldASTData.Related && (fieldASTData.Stored || fieldASTData.Aggregate != "") && !fieldASTData.IsRS,
+			Transform:     fieldName != "ID" && isTransformableFieldType(fieldASTData.FType) && !fieldASTData.Computed && !fieldASTData.EmbedField && !fieldASTData.NoWrite,
+			Names:         fieldASTData.FType == fieldtype.Many2One,
+			RelationIds:   fieldASTData.FType == fieldtype.Many2Many && !fieldASTData.Computed && !fieldASTData.Related,
+			Mapped:        mappedFieldsData(fieldASTData, modelsASTData, depsMap),
 		})
 		(*depsMap)[fieldASTData.Type.ImportPath] = true
 	}
@@ -280,9 +507,100 @@ func addFieldsToModelData(modelASTData ModelASTData, modelData *modelData, depsM
 	}
 }
 
+// addViewStructsToModelData extracts the view structs declared for the model of
+// modelData from modelsASTData. Relation fields are given by the ID of the record.
+func addViewStructsToModelData(modelsASTData map[string]ModelASTData, modelData *ModelData) {
+	modelASTData := modelsASTData[modelData.Name]
+	for name, fieldNames := range modelASTData.ViewStructs {
+		vsData := viewStructData{
+			Name:       name,
+			StructName: fmt.Sprintf("%s%sView", modelData.Name, name),
+			Fields:     []resultFieldData{{Name: "ID", Type: "int64"}},
+		}
+		for _, fieldName := range fieldNames {
+			if fieldName == "ID" {
+				continue
+			}
+			fieldASTData, ok := modelASTData.Fields[fieldName]
+			if !ok {
+				log.Panic("Unknown field in view struct", "model", modelData.Name, "viewStruct", name, "field", fieldName)
+			}
+			typStr := trimInterfacePackagePrefix(fieldASTData.Type.Type)
+			if fieldASTData.RelModel != "" {
+				typStr = "int64"
+			}
+			vsData.Fields = append(vsData.Fields, resultFieldData{Name: fieldName, Type: typStr})
+		}
+		modelData.ViewStructs = append(modelData.ViewStructs, vsData)
+	}
+}
+
+// isTransformableFieldType returns true if a Transform method can be generated
+// for fields of the given type.
+func isTransformableFieldType(fType fieldtype.Type) bool {
+	switch fType {
+	case fieldtype.Char, fieldtype.Text, fieldtype.HTML, fieldtype.Selection, fieldtype.Integer,
+		fieldtype.Float, fieldtype.Date, fieldtype.DateTime:
+		return true
+	}
+	return false
+}
+
+// fieldTypeStrings returns the type of the given field in the pool
+// packages and its type in the interfaces package.
+func fieldTypeStrings(fieldASTData FieldASTData) (string, string) {
+	typStr := fieldASTData.Type.Type
+	iTypStr := trimInterfacePackagePrefix(typStr)
+	if fieldASTData.FType == fieldtype.Reference {
+		typStr = "models.RecordSet"
+		iTypStr = "models.RecordSet"
+	}
+	if fieldASTData.RelModel != "" {
+		typStr = fmt.Sprintf("%s.%sSet", PoolInterfacesPackage, fieldASTData.RelModel)
+		iTypStr = fmt.Sprintf("%sSet", fieldASTData.RelModel)
+	}
+	return typStr, iTypStr
+}
+
+// mappedFieldsData returns the fields of the related model of the given one2many or
+// many2many field that are listed in its Mapped parameter, to be read across the
+// relation. It panics if one of them is unknown or is a field of a mixin, an embedded,
+// reference or binary field.
+func mappedFieldsData(fieldASTData FieldASTData, modelsASTData map[string]ModelASTData, depsMap *map[string]bool) []mappedFieldData {
+	if !fieldASTData.FType.Is2ManyRelationType() || fieldASTData.RelModel == "" {
+		return nil
+	}
+	var res []mappedFieldData
+	for _, name := range fieldASTData.Mapped {
+		relField, ok := modelsASTData[fieldASTData.RelModel].Fields[name]
+		if !ok {
+			log.Panic("Unknown field in Mapped", "field", fieldASTData.Name, "model", fieldASTData.RelModel, "mapped", name)
+		}
+		if name == "ID" || relField.MixinField || relField.EmbedField ||
+			relField.FType == fieldtype.Reference || relField.FType == fieldtype.Binary {
+			log.Panic("Mapped fields cannot be ID, mixin, embedded, reference or binary fields", "field", fieldASTData.Name,
+				"model", fieldASTData.RelModel, "mapped", name)
+		}
+		typStr, iTypStr := fieldTypeStrings(relField)
+		res = append(res, mappedFieldData{
+			Name:     name,
+			JSON:     strutils.GetDefaultString(relField.JSON, models.SnakeCaseFieldName(name, relField.FType)),
+			RelModel: relField.RelModel,
+			Type:     typStr,
+			IType:    iTypStr,
+			IsRS:     relField.IsRS,
+		})
+		(*depsMap)[relField.Type.ImportPath] = true
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
 // addFieldTypesToModelData extracts field types from mData.Fields
 // and add them to mData.Types
-func addFieldTypesToModelData(mData *modelData) {
+func addFieldTypesToModelData(mData *ModelData) {
 	fTypes := make(map[string]bool)
 	tDeps := make(map[string]bool)
 	for _, f := range mData.Fields {
@@ -291,16 +609,29 @@ func addFieldTypesToModelData(mData *modelData) {
 		}
 		fTypes[f.IType] = true
 		tDeps[f.ImportPath] = true
+		operators := []operatorDef{
+			{Name: "Equals"}, {Name: "NotEquals"}, {Name: "Greater"}, {Name: "GreaterOrEqual"}, {Name: "Lower"},
+			{Name: "LowerOrEqual"}, {Name: "Like"}, {Name: "Contains"}, {Name: "NotContains"}, {Name: "IContains"},
+			{Name: "NotIContains"}, {Name: "ILike"}, {Name: "In", Multi: true}, {Name: "NotIn", Multi: true},
+			{Name: "ChildOf"},
+		}
+		if elemType, ok := arrayElemTypes[f.IType]; ok {
+			operators = []operatorDef{
+				{Name: "Equals"}, {Name: "NotEquals"}, {Name: "Contains", ArgType: elemType}, {Name: "ContainsAll"},
+				{Name: "Overlaps"},
+			}
+		}
+		for _, co := range customOperators {
+			if len(co.goTypes) == 0 || co.goTypes[f.IType] {
+				operators = append(operators, co.def)
+			}
+		}
 		mData.Types = append(mData.Types, fieldType{
-			Type:    f.IType,
-			SanType: f.SanType,
-			IsRS:    f.IsRS,
-			Operators: []operatorDef{
-				{Name: "Equals"}, {Name: "NotEquals"}, {Name: "Greater"}, {Name: "GreaterOrEqual"}, {Name: "Lower"},
-				{Name: "LowerOrEqual"}, {Name: "Like"}, {Name: "Contains"}, {Name: "NotContains"}, {Name: "IContains"},
-				{Name: "NotIContains"}, {Name: "ILike"}, {Name: "In", Multi: true}, {Name: "NotIn", Multi: true},
-				{Name: "ChildOf"},
-			},
+			Type:      f.IType,
+			SanType:   f.SanType,
+			IsRS:      f.IsRS,
+			IsDate:    f.IType == "dates.Date" || f.IType == "dates.DateTime",
+			Operators: operators,
 		})
 	}
 	for dep := range tDeps {
@@ -311,38 +642,105 @@ func addFieldTypesToModelData(mData *modelData) {
 	}
 }
 
+// A PoolPackage identifies a package of the generated pool
+// in which a file is generated for each model.
+type PoolPackage int
+
+const (
+	// InterfacesPackage is the pool package with model interfaces (m)
+	InterfacesPackage PoolPackage = iota
+	// ModelsPackage is the pool package with model data (h)
+	ModelsPackage
+	// ModelPackage is the package of each model in the models package (h/model)
+	ModelPackage
+	// QueryPackage is the pool package with query data (q)
+	QueryPackage
+	// ModelQueryPackage is the package of each model in the query package (q/model)
+	ModelQueryPackage
+)
+
+// poolPackages are all the pool packages, in generation order.
+var poolPackages = []PoolPackage{InterfacesPackage, ModelsPackage, ModelPackage, QueryPackage, ModelQueryPackage}
+
+// dir returns the directory of this PoolPackage for the given model
+// inside the given pool directory.
+func (pp PoolPackage) dir(poolDir string, mData *ModelData) string {
+	switch pp {
+	case InterfacesPackage:
+		return filepath.Join(poolDir, PoolInterfacesPackage)
+	case ModelsPackage:
+		return filepath.Join(poolDir, PoolModelPackage)
+	case ModelPackage:
+		return filepath.Join(poolDir, PoolModelPackage, mData.SnakeName)
+	case QueryPackage:
+		return filepath.Join(poolDir, PoolQueryPackage)
+	case ModelQueryPackage:
+		return filepath.Join(poolDir, PoolQueryPackage, mData.SnakeName)
+	}
+	log.Panic("Unknown pool package", "package", pp)
+	return ""
+}
+
+// poolTemplates are the templates with which the file of each model
+// is generated in each pool package.
+var poolTemplates = map[PoolPackage]*template.Template{
+	InterfacesPackage: poolInterfacesTemplate,
+	ModelsPackage:     poolModelsTemplate,
+	ModelPackage:      poolModelsDirTemplate,
+	QueryPackage:      poolQueryTemplate,
+	ModelQueryPackage: poolModelsQueryTemplate,
+}
+
+// customPoolTemplates are the templates registered with RegisterPoolTemplate
+// that generate additional files, by pool package and file suffix.
+var customPoolTemplates = make(map[PoolPackage]map[string]*template.Template)
+
+// RegisterPoolTemplate registers a template with which CreatePool generates
+// code in the given package of the pool for each model, so that projects can
+// add their own methods to the generated types. The template is executed
+// with the ModelData of the model and the result is written to the
+// "<model>_<suffix>.go" file of the package. It must therefore start with
+// the package clause and the imports it needs.
+//
+// If suffix is empty, the template replaces the default template that
+// generates the "<model>.go" file of the package.
+//
+// This function must be called before CreatePool, typically in an init function.
+func RegisterPoolTemplate(pkg PoolPackage, suffix string, tmpl *template.Template) {
+	if _, ok := poolTemplates[pkg]; !ok {
+		log.Panic("Unknown pool package", "package", pkg)
+	}
+	if suffix == "" {
+		poolTemplates[pkg] = tmpl
+		return
+	}
+	if customPoolTemplates[pkg] == nil {
+		customPoolTemplates[pkg] = make(map[string]*template.Template)
+	}
+	customPoolTemplates[pkg][suffix] = tmpl
+}
+
 // createPoolFiles creates all pool files for the given model data
-func createPoolFiles(dir string, mData *modelData) {
+func createPoolFiles(dir string, mData *ModelData) {
 	mData.sort()
-	// create the model's interface file in interface directory (m)
-	fileName := filepath.Join(dir, PoolInterfacesPackage, fmt.Sprintf("%s.go", mData.SnakeName))
-	CreateFileFromTemplate(fileName, poolInterfacesTemplate, mData)
-
-	// create the models directories (h)
-	if _, err := os.Stat(filepath.Join(dir, PoolModelPackage, mData.SnakeName)); err != nil {
-		if err = os.MkdirAll(filepath.Join(dir, PoolModelPackage, mData.SnakeName), 0755); err != nil {
-			panic(err)
+	for _, pkg := range poolPackages {
+		pkgDir := pkg.dir(dir, mData)
+		if _, err := os.Stat(pkgDir); err != nil {
+			if err = os.MkdirAll(pkgDir, 0755); err != nil {
+				panic(err)
+			}
 		}
-	}
-	// create the model's file in models directory (h)
-	fileName = filepath.Join(dir, PoolModelPackage, fmt.Sprintf("%s.go", mData.SnakeName))
-	CreateFileFromTemplate(fileName, poolModelsTemplate, mData)
-	// create the model's file in model's dir (q/model)
-	fileName = filepath.Join(dir, PoolModelPackage, mData.SnakeName, fmt.Sprintf("%s.go", mData.SnakeName))
-	CreateFileFromTemplate(fileName, poolModelsDirTemplate, mData)
-
-	// create the model's query directory (q)
-	if _, err := os.Stat(filepath.Join(dir, PoolQueryPackage, mData.SnakeName)); err != nil {
-		if err = os.MkdirAll(filepath.Join(dir, PoolQueryPackage, mData.SnakeName), 0755); err != nil {
-			panic(err)
+		CreateFileFromTemplate(filepath.Join(pkgDir, fmt.Sprintf("%s.go", mData.SnakeName)), poolTemplates[pkg], mData)
+		suffixes := make([]string, 0, len(customPoolTemplates[pkg]))
+		for suffix := range customPoolTemplates[pkg] {
+			suffixes = append(suffixes, suffix)
+		}
+		sort.Strings(suffixes)
+		for _, suffix := range suffixes {
+			fileName := filepath.Join(pkgDir, fmt.Sprintf("%s_%s.go", mData.SnakeName, suffix))
+			CreateFileFromTemplate(fileName, customPoolTemplates[pkg][suffix], mData)
 		}
 	}
-	// create the model's query file in query dir (q)
-	fileName = filepath.Join(dir, PoolQueryPackage, fmt.Sprintf("%s.go", mData.SnakeName))
-	CreateFileFromTemplate(fileName, poolQueryTemplate, mData)
-	// create the model's query file in model's query dir (q/model)
-	fileName = filepath.Join(dir, PoolQueryPackage, mData.SnakeName, fmt.Sprintf("%s.go", mData.SnakeName))
-	CreateFileFromTemplate(fileName, poolModelsQueryTemplate, mData)
 }
 
 // isRecordSetType returns true if the given typ is a RecordSet according
@@ -365,7 +763,9 @@ func isRecordSetType(typ string, models map[string]ModelASTData) (bool, bool) {
 // CreateFileFromTemplate generates a new file from the given template and data
 func CreateFileFromTemplate(fileName string, template *template.Template, data interface{}) {
 	var srcBuffer bytes.Buffer
-	template.Execute(&srcBuffer, data)
+	if err := template.Execute(&srcBuffer, data); err != nil {
+		log.Panic("Error while executing template", "error", err, "fileName", fileName)
+	}
 	srcData, err := format.Source(srcBuffer.Bytes())
 	if err != nil {
 		log.Panic("Error while formatting generated source file", "error", err, "fileName",
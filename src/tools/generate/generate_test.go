@@ -0,0 +1,535 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package generate
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/hexya-erp/hexya/src/models/fieldtype"
+	"github.com/hexya-erp/hexya/src/tools/strutils"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var helloTemplate = template.Must(template.New("").Parse(`
+package {{ .SnakeName }}
+
+// Hello returns a greeting from the {{ .Name }} model
+func (s {{ .Name }}Set) Hello() string {
+	return "Hello from {{ .Name }} with {{ len .Fields }} fields"
+}
+`))
+
+var replacedTemplate = template.Must(template.New("").Parse(`
+package {{ .QueryPackageName }}
+
+// {{ .Name }}Replaced is declared by a replaced template
+const {{ .Name }}Replaced = true
+`))
+
+// A generatedFile is a parsed pool file
+type generatedFile struct {
+	fset *token.FileSet
+	file *ast.File
+}
+
+// testModelData returns the ModelData of a model with the given name and fields
+func testModelData(name string, fields ...FieldData) ModelData {
+	mData := ModelData{
+		Name:                  name,
+		SnakeName:             strutils.SnakeCase(name),
+		ModelsPackageName:     PoolModelPackage,
+		QueryPackageName:      PoolQueryPackage,
+		InterfacesPackageName: PoolInterfacesPackage,
+		Fields:                fields,
+	}
+	addFieldTypesToModelData(&mData)
+	return mData
+}
+
+// generatePoolFiles generates the pool files of the given model in a temporary
+// directory and returns them parsed, keyed by their path relative to this directory.
+func generatePoolFiles(mData *ModelData) map[string]*generatedFile {
+	dir, err := ioutil.TempDir("", "hexya-pool")
+	So(err, ShouldBeNil)
+	defer os.RemoveAll(dir)
+	createPoolFiles(dir, mData)
+	res := make(map[string]*generatedFile)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		fset := token.NewFileSet()
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		res[relPath] = &generatedFile{fset: fset, file: file}
+		return nil
+	})
+	So(err, ShouldBeNil)
+	return res
+}
+
+// funcDecl returns the declaration of the function with the given name
+// and receiver type, or nil if it does not exist. recv must be empty for
+// functions without receiver.
+func (gf *generatedFile) funcDecl(recv, name string) *ast.FuncDecl {
+	for _, decl := range gf.file.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Name.Name != name {
+			continue
+		}
+		var recvType string
+		if fd.Recv != nil && len(fd.Recv.List) > 0 {
+			recvType = gf.source(fd.Recv.List[0].Type)
+		}
+		if recvType == recv {
+			return fd
+		}
+	}
+	return nil
+}
+
+// signature returns the signature of the given function, or an empty
+// string if it does not exist.
+func (gf *generatedFile) signature(recv, name string) string {
+	fd := gf.funcDecl(recv, name)
+	if fd == nil {
+		return ""
+	}
+	return gf.source(fd.Type)
+}
+
+// body returns the source of the body of the given function
+func (gf *generatedFile) body(recv, name string) string {
+	fd := gf.funcDecl(recv, name)
+	if fd == nil {
+		return ""
+	}
+	return gf.source(fd.Body)
+}
+
+// doc returns the doc comment of the given function
+func (gf *generatedFile) doc(recv, name string) string {
+	fd := gf.funcDecl(recv, name)
+	if fd == nil {
+		return ""
+	}
+	return fd.Doc.Text()
+}
+
+// interfaceMethod returns the signature of the given method of the given
+// interface type, or an empty string if it does not exist.
+func (gf *generatedFile) interfaceMethod(iface, name string) string {
+	ts := gf.typeSpec(iface)
+	if ts == nil {
+		return ""
+	}
+	it, ok := ts.Type.(*ast.InterfaceType)
+	if !ok {
+		return ""
+	}
+	for _, method := range it.Methods.List {
+		if len(method.Names) > 0 && method.Names[0].Name == name {
+			return gf.source(method.Type)
+		}
+	}
+	return ""
+}
+
+// typeSpec returns the declaration of the type with the given name, or nil
+func (gf *generatedFile) typeSpec(name string) *ast.TypeSpec {
+	for _, decl := range gf.file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			if ts, ok := spec.(*ast.TypeSpec); ok && ts.Name.Name == name {
+				return ts
+			}
+		}
+	}
+	return nil
+}
+
+// declaresValue returns true if a constant or variable with the given name
+// is declared in this file.
+func (gf *generatedFile) declaresValue(name string) bool {
+	for _, decl := range gf.file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			vs, ok := spec.(*ast.ValueSpec)
+			if !ok {
+				continue
+			}
+			for _, n := range vs.Names {
+				if n.Name == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// source returns the formatted source of the given node
+func (gf *generatedFile) source(node ast.Node) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, gf.fset, node); err != nil {
+		panic(err)
+	}
+	return buf.String()
+}
+
+func TestCustomPoolTemplates(t *testing.T) {
+	Convey("Testing custom pool templates", t, func() {
+		defaultQueryTemplate := poolTemplates[QueryPackage]
+		defer func() {
+			poolTemplates[QueryPackage] = defaultQueryTemplate
+			delete(customPoolTemplates, ModelPackage)
+		}()
+		RegisterPoolTemplate(ModelPackage, "hello", helloTemplate)
+		RegisterPoolTemplate(QueryPackage, "", replacedTemplate)
+		mData := testModelData("Partner",
+			FieldData{Name: "Name", JSON: "name", Type: "string", IType: "string", SanType: "String"},
+			FieldData{Name: "Email", JSON: "email", Type: "string", IType: "string", SanType: "String"},
+		)
+		files := generatePoolFiles(&mData)
+		Convey("Custom templates should generate additional files", func() {
+			hello := files[filepath.Join(PoolModelPackage, "partner", "partner_hello.go")]
+			So(hello, ShouldNotBeNil)
+			So(hello.signature("PartnerSet", "Hello"), ShouldEqual, "func() string")
+			So(hello.body("PartnerSet", "Hello"), ShouldContainSubstring, `"Hello from Partner with 2 fields"`)
+			So(files, ShouldContainKey, filepath.Join(PoolModelPackage, "partner", "partner.go"))
+		})
+		Convey("Templates with no suffix should replace the default template", func() {
+			replaced := files[filepath.Join(PoolQueryPackage, "partner.go")]
+			So(replaced, ShouldNotBeNil)
+			So(replaced.declaresValue("PartnerReplaced"), ShouldBeTrue)
+			query := files[filepath.Join(PoolQueryPackage, "partner", "partner.go")]
+			So(query, ShouldNotBeNil)
+			So(query.declaresValue("PartnerReplaced"), ShouldBeFalse)
+		})
+		Convey("Registering a template for an unknown package should panic", func() {
+			So(func() { RegisterPoolTemplate(PoolPackage(12), "hello", helloTemplate) }, ShouldPanic)
+		})
+	})
+}
+
+func TestCustomOperators(t *testing.T) {
+	Convey("Testing custom condition operators", t, func() {
+		defer func() {
+			customOperators = nil
+		}()
+		RegisterOperator("IMatches", "~*", false, "string")
+		RegisterOperator("Overlaps", "&&", true)
+		mData := testModelData("Partner",
+			FieldData{Name: "Name", JSON: "name", Type: "string", IType: "string", SanType: "String"},
+			FieldData{Name: "Rate", JSON: "rate", Type: "float64", IType: "float64", SanType: "Float64"},
+		)
+		query := generatePoolFiles(&mData)[filepath.Join(PoolQueryPackage, "partner", "partner.go")]
+		So(query, ShouldNotBeNil)
+		Convey("Custom operators should be added to the fields of the given types", func() {
+			So(query.signature("pStringConditionField", "IMatches"), ShouldEqual, "func(arg string) Condition")
+			So(query.body("pStringConditionField", "IMatches"), ShouldContainSubstring, `c.ConditionField.AddOperator("~*", arg)`)
+			So(query.signature("pFloat64ConditionField", "IMatches"), ShouldBeEmpty)
+		})
+		Convey("Custom operators without types should be added to all fields", func() {
+			So(query.signature("pStringConditionField", "Overlaps"), ShouldEqual, "func(arg []string) Condition")
+			So(query.signature("pFloat64ConditionField", "Overlaps"), ShouldEqual, "func(arg []float64) Condition")
+			So(query.body("pStringConditionField", "OverlapsEval"), ShouldContainSubstring,
+				`c.ConditionField.AddOperator("&&", models.ClientEvaluatedString(expression))`)
+		})
+	})
+}
+
+func TestArrayOperators(t *testing.T) {
+	Convey("Testing array field operators", t, func() {
+		mData := testModelData("Partner",
+			FieldData{Name: "Tags", JSON: "tags", Type: "types.StringArray", IType: "types.StringArray", SanType: "TypesStringArray", ImportPath: TypesPath},
+		)
+		query := generatePoolFiles(&mData)[filepath.Join(PoolQueryPackage, "partner", "partner.go")]
+		So(query, ShouldNotBeNil)
+		So(query.signature("pTypesStringArrayConditionField", "Contains"), ShouldEqual, "func(arg string) Condition")
+		So(query.signature("pTypesStringArrayConditionField", "ContainsFunc"), ShouldEqual, "func(arg func(models.RecordSet) string) Condition")
+		So(query.signature("pTypesStringArrayConditionField", "ContainsAll"), ShouldEqual, "func(arg types.StringArray) Condition")
+		So(query.signature("pTypesStringArrayConditionField", "Overlaps"), ShouldEqual, "func(arg types.StringArray) Condition")
+		So(query.signature("pTypesStringArrayConditionField", "Greater"), ShouldBeEmpty)
+	})
+}
+
+func TestRelationWithContextGetters(t *testing.T) {
+	Convey("Testing relation getters with a custom context", t, func() {
+		mData := testModelData("Partner",
+			FieldData{Name: "Name", JSON: "name", Type: "string", IType: "string", SanType: "String"},
+			FieldData{Name: "Tags", JSON: "tags_ids", RelModel: "Tag", Type: "m.TagSet", IType: "TagSet", SanType: "TagSet", IsRS: true},
+		)
+		files := generatePoolFiles(&mData)
+		model := files[filepath.Join(PoolModelPackage, "partner", "partner.go")]
+		So(model, ShouldNotBeNil)
+		So(model.signature("PartnerSet", "TagsWithContext"), ShouldEqual, "func(ctx map[string]interface{}) m.TagSet")
+		So(model.signature("PartnerSet", "NameWithContext"), ShouldBeEmpty)
+		iface := files[filepath.Join(PoolInterfacesPackage, "partner.go")]
+		So(iface, ShouldNotBeNil)
+		So(iface.interfaceMethod("PartnerSet", "TagsWithContext"), ShouldEqual, "func(ctx map[string]interface{}) TagSet")
+	})
+}
+
+func TestVersionedCacheGetters(t *testing.T) {
+	Convey("Testing version getters of versioned cache fields", t, func() {
+		mData := testModelData("Partner",
+			FieldData{Name: "Name", JSON: "name", Type: "string", IType: "string", SanType: "String"},
+			FieldData{Name: "Score", JSON: "score", Type: "float64", IType: "float64", SanType: "Float64", Versioned: true, Raw: true},
+		)
+		files := generatePoolFiles(&mData)
+		model := files[filepath.Join(PoolModelPackage, "partner", "partner.go")]
+		So(model, ShouldNotBeNil)
+		So(model.signature("PartnerSet", "ScoreVersion"), ShouldEqual, "func() string")
+		So(model.body("PartnerSet", "ScoreVersion"), ShouldContainSubstring, `models.NewFieldName("HexyaScoreVersion", "hexya_score_version")`)
+		So(model.signature("PartnerSet", "NameVersion"), ShouldBeEmpty)
+		iface := files[filepath.Join(PoolInterfacesPackage, "partner.go")]
+		So(iface, ShouldNotBeNil)
+		So(iface.interfaceMethod("PartnerSet", "ScoreVersion"), ShouldEqual, "func() string")
+	})
+}
+
+func TestComputeGuardDoc(t *testing.T) {
+	Convey("Testing the getter doc of guarded computed fields", t, func() {
+		mData := testModelData("Partner",
+			FieldData{Name: "Taxable", JSON: "taxable", Type: "bool", IType: "bool", SanType: "Bool"},
+			FieldData{Name: "Tax", JSON: "tax", Type: "float64", IType: "float64", SanType: "Float64", ComputeGuard: "Taxable", Raw: true},
+		)
+		model := generatePoolFiles(&mData)[filepath.Join(PoolModelPackage, "partner", "partner.go")]
+		So(model, ShouldNotBeNil)
+		So(model.doc("PartnerSet", "Tax"), ShouldContainSubstring, `Tax is only computed for records whose "Taxable" field`)
+		So(model.doc("PartnerSet", "Taxable"), ShouldNotContainSubstring, "is only computed")
+	})
+}
+
+func TestCachedMethods(t *testing.T) {
+	Convey("Testing methods declared with a @cached directive", t, func() {
+		Convey("The directive should be extracted from the method doc", func() {
+			doc, cached, ctxKeys := extractCachedDirective("RateAt returns the rate at the given date.\n@cached lang company_id\n")
+			So(doc, ShouldEqual, "RateAt returns the rate at the given date.\n")
+			So(cached, ShouldBeTrue)
+			So(ctxKeys, ShouldResemble, []string{"lang", "company_id"})
+			_, cached, _ = extractCachedDirective("RateAt returns the rate at the given date.")
+			So(cached, ShouldBeFalse)
+		})
+		Convey("The method should be declared memoized in the pool", func() {
+			mData := testModelData("Partner")
+			mData.Methods = []methodData{
+				{Name: "RateAt", Doc: "// RateAt returns the rate", ParamsWithType: "factor float64", Params: "factor",
+					ReturnString: "float64", Returns: "resTyped", ReturnAsserts: "resTyped, _ := res.(float64)", Call: "Call",
+					ToDeclare: true, Cached: true, CacheContext: `"lang"`},
+				{Name: "Score", Doc: "// Score returns the score", ReturnString: "float64", Returns: "resTyped",
+					ReturnAsserts: "resTyped, _ := res.(float64)", Call: "Call", ToDeclare: true, Cached: true},
+			}
+			model := generatePoolFiles(&mData)[filepath.Join(PoolModelPackage, "partner", "partner.go")]
+			So(model, ShouldNotBeNil)
+			So(model.body("", "init"), ShouldContainSubstring, `AddEmptyMethod("RateAt").MemoizeOn("lang")`)
+			So(model.body("", "init"), ShouldContainSubstring, `AddEmptyMethod("Score").Memoize()`)
+			So(model.signature("PartnerSet", "RateAt"), ShouldEqual, "func(factor float64) float64")
+			So(model.doc("PartnerSet", "RateAt"), ShouldContainSubstring,
+				"The results of RateAt are cached in the environment by arguments and by the \"lang\" context keys,")
+		})
+	})
+}
+
+func TestNamedResultsMethods(t *testing.T) {
+	Convey("Testing methods with named results", t, func() {
+		modelsASTData := map[string]ModelASTData{"User": newModelASTData("User")}
+		modelsASTData["User"].Methods["PostsSummary"] = MethodASTData{
+			Name:        "PostsSummary",
+			Doc:         "// PostsSummary returns the posts and their titles",
+			Returns:     []TypeData{{Type: "m.PostSet"}, {Type: "[]string"}},
+			ResultNames: []string{"posts", "titles"},
+			ToDeclare:   true,
+		}
+		mData := testModelData("User")
+		depsMap := make(map[string]bool)
+		addMethodsToModelData(modelsASTData, &mData, &depsMap)
+		files := generatePoolFiles(&mData)
+		model := files[filepath.Join(PoolModelPackage, "user", "user.go")]
+		So(model, ShouldNotBeNil)
+		So(model.signature("UserSet", "PostsSummary"), ShouldEqual, "func() (m.PostSet, []string)")
+		So(model.signature("UserSet", "PostsSummaryResult"), ShouldEqual, "func() m.UserPostsSummaryResult")
+		So(model.body("UserSet", "PostsSummaryResult"), ShouldContainSubstring, "resTyped0, resTyped1 := s.PostsSummary()")
+		So(model.body("UserSet", "PostsSummaryResult"), ShouldContainSubstring,
+			"return m.UserPostsSummaryResult{Posts: resTyped0, Titles: resTyped1}")
+		iface := files[filepath.Join(PoolInterfacesPackage, "user.go")]
+		So(iface, ShouldNotBeNil)
+		So(iface.interfaceMethod("UserSet", "PostsSummary"), ShouldEqual, "func() (PostSet, []string)")
+		So(iface.interfaceMethod("UserSet", "PostsSummaryResult"), ShouldEqual, "func() UserPostsSummaryResult")
+		result := iface.typeSpec("UserPostsSummaryResult")
+		So(result, ShouldNotBeNil)
+		So(result.Type, ShouldHaveSameTypeAs, &ast.StructType{})
+	})
+}
+
+func TestRelationNamesGetters(t *testing.T) {
+	Convey("Testing display names getters of many2one fields", t, func() {
+		mData := testModelData("Partner",
+			FieldData{Name: "Name", JSON: "name", Type: "string", IType: "string", SanType: "String"},
+			FieldData{Name: "Country", JSON: "country_id", RelModel: "Country", Type: "m.CountrySet", IType: "CountrySet", SanType: "CountrySet", IsRS: true, Names: true},
+		)
+		files := generatePoolFiles(&mData)
+		model := files[filepath.Join(PoolModelPackage, "partner", "partner.go")]
+		So(model, ShouldNotBeNil)
+		So(model.signature("PartnerSet", "CountryNames"), ShouldEqual, "func() map[int64]string")
+		So(model.body("PartnerSet", "CountryNames"), ShouldContainSubstring,
+			`s.RecordCollection.RelationNames(models.NewFieldName("Country", "country_id"))`)
+		So(model.signature("PartnerSet", "NameNames"), ShouldBeEmpty)
+		iface := files[filepath.Join(PoolInterfacesPackage, "partner.go")]
+		So(iface, ShouldNotBeNil)
+		So(iface.interfaceMethod("PartnerSet", "CountryNames"), ShouldEqual, "func() map[int64]string")
+	})
+}
+
+func TestRelationIdsMethods(t *testing.T) {
+	Convey("Testing methods linking many2many fields by ids", t, func() {
+		mData := testModelData("Partner",
+			FieldData{Name: "Name", JSON: "name", Type: "string", IType: "string", SanType: "String"},
+			FieldData{Name: "Categories", JSON: "categories_ids", RelModel: "Category", Type: "m.CategorySet", IType: "CategorySet", SanType: "CategorySet", IsRS: true, ToMany: true, RelationIds: true},
+		)
+		files := generatePoolFiles(&mData)
+		model := files[filepath.Join(PoolModelPackage, "partner", "partner.go")]
+		So(model, ShouldNotBeNil)
+		So(model.signature("PartnerSet", "AddCategoriesByIds"), ShouldEqual, "func(ids ...int64) m.PartnerSet")
+		So(model.body("PartnerSet", "AddCategoriesByIds"), ShouldContainSubstring,
+			`s.RecordCollection.AddRelationIds(models.NewFieldName("Categories", "categories_ids"), ids)`)
+		So(model.signature("PartnerSet", "RemoveCategoriesByIds"), ShouldEqual, "func(ids ...int64) m.PartnerSet")
+		So(model.body("PartnerSet", "RemoveCategoriesByIds"), ShouldContainSubstring,
+			`s.RecordCollection.RemoveRelationIds(models.NewFieldName("Categories", "categories_ids"), ids)`)
+		So(model.signature("PartnerSet", "AddNameByIds"), ShouldBeEmpty)
+		iface := files[filepath.Join(PoolInterfacesPackage, "partner.go")]
+		So(iface, ShouldNotBeNil)
+		So(iface.interfaceMethod("PartnerSet", "AddCategoriesByIds"), ShouldEqual, "func(ids ...int64) PartnerSet")
+		So(iface.interfaceMethod("PartnerSet", "RemoveCategoriesByIds"), ShouldEqual, "func(ids ...int64) PartnerSet")
+	})
+}
+
+func TestMappedFieldsData(t *testing.T) {
+	Convey("Testing the fields read across to-many relations", t, func() {
+		modelsASTData := map[string]ModelASTData{
+			"Line": {
+				Name: "Line",
+				Fields: map[string]FieldASTData{
+					"Product":  {Name: "Product", FType: fieldtype.Many2One, RelModel: "Product", IsRS: true},
+					"Quantity": {Name: "Quantity", FType: fieldtype.Float, Type: TypeData{Type: "float64"}},
+					"Notes":    {Name: "Notes", FType: fieldtype.Text, Type: TypeData{Type: "string"}},
+					"Image":    {Name: "Image", FType: fieldtype.Binary, Type: TypeData{Type: "string"}},
+				},
+			},
+		}
+		lines := FieldASTData{Name: "Lines", FType: fieldtype.One2Many, RelModel: "Line", IsRS: true}
+		depsMap := make(map[string]bool)
+		Convey("No getters should be generated for fields that do not opt in", func() {
+			So(mappedFieldsData(lines, modelsASTData, &depsMap), ShouldBeEmpty)
+		})
+		Convey("Getters should only be generated for the fields listed in Mapped", func() {
+			lines.Mapped = []string{"Quantity", "Product"}
+			mapped := mappedFieldsData(lines, modelsASTData, &depsMap)
+			So(mapped, ShouldHaveLength, 2)
+			So(mapped[0].Name, ShouldEqual, "Product")
+			So(mapped[0].Type, ShouldEqual, "m.ProductSet")
+			So(mapped[1].Name, ShouldEqual, "Quantity")
+			So(mapped[1].Type, ShouldEqual, "float64")
+		})
+		Convey("Unknown or binary fields in Mapped should panic", func() {
+			lines.Mapped = []string{"Unknown"}
+			So(func() { mappedFieldsData(lines, modelsASTData, &depsMap) }, ShouldPanic)
+			lines.Mapped = []string{"Image"}
+			So(func() { mappedFieldsData(lines, modelsASTData, &depsMap) }, ShouldPanic)
+		})
+	})
+}
+
+func TestDistinctFlag(t *testing.T) {
+	Convey("Testing which fields get a Distinct method", t, func() {
+		modelsASTData := map[string]ModelASTData{
+			"Partner": {
+				Name: "Partner",
+				Fields: map[string]FieldASTData{
+					"Name": {Name: "Name", FType: fieldtype.Char, Type: TypeData{Type: "string"}},
+					"SSN":  {Name: "SSN", FType: fieldtype.Encrypted, Type: TypeData{Type: "string"}},
+				},
+			},
+		}
+		modelData := ModelData{Name: "Partner"}
+		depsMap := make(map[string]bool)
+		addFieldsToModelData(modelsASTData, &modelData, &depsMap)
+		distinct := make(map[string]bool)
+		for _, field := range modelData.Fields {
+			distinct[field.Name] = field.Distinct
+		}
+		So(distinct["Name"], ShouldBeTrue)
+		So(distinct["SSN"], ShouldBeFalse)
+	})
+}
+
+func TestCompareAndSetFlag(t *testing.T) {
+	Convey("Testing which fields get a CompareAndSet method", t, func() {
+		modelsASTData := map[string]ModelASTData{
+			"Partner": {
+				Name: "Partner",
+				Fields: map[string]FieldASTData{
+					"Name":        {Name: "Name", FType: fieldtype.Char, Type: TypeData{Type: "string"}},
+					"Description": {Name: "Description", FType: fieldtype.Char, Type: TypeData{Type: "string"}, Contexted: true},
+				},
+			},
+		}
+		modelData := ModelData{Name: "Partner"}
+		depsMap := make(map[string]bool)
+		addFieldsToModelData(modelsASTData, &modelData, &depsMap)
+		compareAndSet := make(map[string]bool)
+		for _, field := range modelData.Fields {
+			compareAndSet[field.Name] = field.CompareAndSet
+		}
+		So(compareAndSet["Name"], ShouldBeTrue)
+		So(compareAndSet["Description"], ShouldBeFalse)
+	})
+}
+
+func TestToggleFlag(t *testing.T) {
+	Convey("Testing which fields get a Toggle method", t, func() {
+		modelsASTData := map[string]ModelASTData{
+			"Partner": {
+				Name: "Partner",
+				Fields: map[string]FieldASTData{
+					"Active":   {Name: "Active", FType: fieldtype.Boolean, Type: TypeData{Type: "bool"}},
+					"Featured": {Name: "Featured", FType: fieldtype.Boolean, Type: TypeData{Type: "bool"}, Contexted: true},
+					"Name":     {Name: "Name", FType: fieldtype.Char, Type: TypeData{Type: "string"}},
+				},
+			},
+		}
+		modelData := ModelData{Name: "Partner"}
+		depsMap := make(map[string]bool)
+		addFieldsToModelData(modelsASTData, &modelData, &depsMap)
+		toggle := make(map[string]bool)
+		for _, field := range modelData.Fields {
+			toggle[field.Name] = field.Toggle
+		}
+		So(toggle["Active"], ShouldBeTrue)
+		So(toggle["Featured"], ShouldBeFalse)
+		So(toggle["Name"], ShouldBeFalse)
+	})
+}
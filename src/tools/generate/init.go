@@ -12,6 +12,12 @@ const (
 	HexyaPath = "github.com/hexya-erp/hexya"
 	// ModelsPath is the go import path of the hexya/models package
 	ModelsPath = HexyaPath + "/src/models"
+	// ActionsPath is the go import path of the hexya/actions package
+	ActionsPath = HexyaPath + "/src/actions"
+	// ExceptionsPath is the go import path of the hexya/tools/exceptions package
+	ExceptionsPath = HexyaPath + "/src/tools/exceptions"
+	// TypesPath is the go import path of the hexya/models/types package
+	TypesPath = HexyaPath + "/src/models/types"
 	// DatesPath is the go import path of the hexya/models/types/dates package
 	DatesPath = HexyaPath + "/src/models/types/dates"
 	// PoolPath is the go import path of the autogenerated pool package
@@ -95,18 +95,37 @@ type TypeData struct {
 // A FieldASTData is a holder for a field's data that will be used
 // for pool code generation
 type FieldASTData struct {
-	Name        string
-	JSON        string
-	Help        string
-	Description string
-	Selection   map[string]string
-	RelModel    string
-	Type        TypeData
-	FType       fieldtype.Type
-	IsRS        bool
-	MixinField  bool
-	EmbedField  bool
-	embed       bool
+	Name          string
+	JSON          string
+	Help          string
+	Placeholder   string
+	Section       string
+	Description   string
+	Selection     map[string]string
+	RelModel      string
+	Type          TypeData
+	FType         fieldtype.Type
+	IsRS          bool
+	MixinField    bool
+	EmbedField    bool
+	TimeDependent bool
+	OnCreateOnly  bool
+	Lazy          bool
+	Versioned     bool
+	ComputeGuard  string
+	NoFK          bool
+	Trigram       bool
+	NoWrite       bool
+	Required      bool
+	Contexted     bool
+	Computed      bool
+	Related       bool
+	Stored        bool
+	DynamicFilter bool
+	Mapped        []string
+	Sequence      string
+	Aggregate     string
+	embed         bool
 }
 
 // A ParamData holds the name and type of a method parameter
@@ -119,12 +138,18 @@ type ParamData struct {
 // A MethodASTData is a holder for a method's data that will be used
 // for pool code generation
 type MethodASTData struct {
-	Name      string
-	Doc       string
-	PkgPath   string
-	Params    []ParamData
-	Returns   []TypeData
-	ToDeclare bool
+	Name        string
+	Doc         string
+	PkgPath     string
+	Params      []ParamData
+	Returns     []TypeData
+	ResultNames []string
+	ToDeclare   bool
+	ModelLevel  bool
+	// Cached is true if the method's doc has a @cached directive.
+	// CacheContext holds the context keys given to the directive.
+	Cached       bool
+	CacheContext []string
 }
 
 // A ModelASTData holds fields and methods data of a Model
@@ -136,6 +161,7 @@ type ModelASTData struct {
 	Methods      map[string]MethodASTData
 	Mixins       map[string]bool
 	Embeds       map[string]bool
+	ViewStructs  map[string][]string
 	Validated    bool
 }
 
@@ -148,6 +174,7 @@ func newModelASTData(name string) ModelASTData {
 		Methods:      make(map[string]MethodASTData),
 		Mixins:       make(map[string]bool),
 		Embeds:       make(map[string]bool),
+		ViewStructs:  make(map[string][]string),
 		ModelType:    "",
 	}
 }
@@ -208,7 +235,8 @@ func defaultFields(name string) map[string]FieldASTData {
 				Type:       "dates.DateTime",
 				ImportPath: DatesPath,
 			},
-			FType: fieldtype.DateTime,
+			FType:    fieldtype.DateTime,
+			Computed: true,
 		}
 		res["DisplayName"] = FieldASTData{
 			Name:        "DisplayName",
@@ -216,6 +244,7 @@ func defaultFields(name string) map[string]FieldASTData {
 			Description: "Display Name",
 			Type:        TypeData{Type: "string"},
 			FType:       fieldtype.Char,
+			Computed:    true,
 		}
 	case "ModelMixin":
 		res["HexyaExternalID"] = FieldASTData{
@@ -258,13 +287,17 @@ func GetModelsASTDataForModules(modInfos []*ModuleInfo, validate bool) map[strin
 					}
 					switch {
 					case fnctName == "addMethod":
-						parseAddMethod(node, modInfo, &modelsData, false)
+						parseAddMethod(node, modInfo, &modelsData, false, false)
 					case fnctName == "NewMethod":
-						parseAddMethod(node, modInfo, &modelsData, true)
+						parseAddMethod(node, modInfo, &modelsData, true, false)
+					case fnctName == "NewModelMethod":
+						parseAddMethod(node, modInfo, &modelsData, true, true)
 					case fnctName == "InheritModel":
 						parseMixInModel(node, modInfo, &modelsData)
 					case fnctName == "AddFields":
 						parseAddFields(node, modInfo, &modelsData)
+					case fnctName == "AddViewStruct":
+						parseAddViewStruct(node, modInfo, &modelsData)
 					case strutils.StartsAndEndsWith(fnctName, "New", "Model"):
 						parseNewModel(node, &modelsData)
 					}
@@ -418,8 +451,11 @@ func parseAddFields(node *ast.CallExpr, modInfo *ModuleInfo, modelsData *map[str
 			typeStr = strings.TrimSuffix(ft.Sel.Name, "Field")
 		}
 		var importPath string
-		if typeStr == "Date" || typeStr == "DateTime" {
+		switch typeStr {
+		case "Date", "DateTime":
 			importPath = DatesPath
+		case "Array":
+			importPath = TypesPath
 		}
 
 		var fieldParams []ast.Expr
@@ -449,6 +485,24 @@ func parseAddFields(node *ast.CallExpr, modInfo *ModuleInfo, modelsData *map[str
 	}
 }
 
+// parseAddViewStruct parses the given node which is an AddViewStruct function
+func parseAddViewStruct(node *ast.CallExpr, modInfo *ModuleInfo, modelsData *map[string]ModelASTData) {
+	fNode := node.Fun.(*ast.SelectorExpr)
+	modelName, err := extractModel(fNode.X, modInfo)
+	if err != nil {
+		log.Panic("Unable to extract model while visiting AST", "error", err, "node", modInfo.FSet.Position(node.Pos()))
+	}
+	if _, exists := (*modelsData)[modelName]; !exists {
+		(*modelsData)[modelName] = newModelASTData(modelName)
+	}
+	viewName := parseStringValue(node.Args[0])
+	var fields []string
+	for _, arg := range node.Args[1:] {
+		fields = append(fields, parseStringValue(arg))
+	}
+	(*modelsData)[modelName].ViewStructs[viewName] = fields
+}
+
 // parseFieldAttribute parses the given KeyValueExpr of a field definition
 func parseFieldAttribute(fElem *ast.KeyValueExpr, fData FieldASTData, modInfo *ModuleInfo) FieldASTData {
 	switch fElem.Key.(*ast.Ident).Name {
@@ -456,6 +510,10 @@ func parseFieldAttribute(fElem *ast.KeyValueExpr, fData FieldASTData, modInfo *M
 		fData.JSON = parseStringValue(fElem.Value)
 	case "Help":
 		fData.Help = parseStringValue(fElem.Value)
+	case "Placeholder":
+		fData.Placeholder = parseStringValue(fElem.Value)
+	case "Section":
+		fData.Section = parseStringValue(fElem.Value)
 	case "String":
 		fData.Description = parseStringValue(fElem.Value)
 	case "Selection":
@@ -473,10 +531,100 @@ func parseFieldAttribute(fElem *ast.KeyValueExpr, fData FieldASTData, modInfo *M
 		if fElem.Value.(*ast.Ident).Name == "true" {
 			fData.embed = true
 		}
+	case "TimeDependent":
+		if fElem.Value.(*ast.Ident).Name == "true" {
+			fData.TimeDependent = true
+		}
+	case "SearchType":
+		if sel, ok := fElem.Value.(*ast.SelectorExpr); ok && sel.Sel.Name == "TrigramSearch" {
+			fData.Trigram = true
+		}
+	case "Compute":
+		fData.Computed = true
+	case "Related":
+		fData.Computed = true
+		fData.Related = true
+	case "Stored":
+		if fElem.Value.(*ast.Ident).Name == "true" {
+			fData.Stored = true
+		}
+	case "Aggregate":
+		fData.Computed = true
+		fData.Aggregate = parseAggregate(fElem.Value)
+	case "DynamicFilter":
+		fData.DynamicFilter = true
+	case "Mapped":
+		fData.Mapped = extractStringSlice(fElem.Value)
+	case "Default":
+		if call, ok := fElem.Value.(*ast.CallExpr); ok && len(call.Args) > 0 {
+			if sel, ok := call.Fun.(*ast.SelectorExpr); ok && strings.HasPrefix(sel.Sel.Name, "NextSequence") {
+				fData.Sequence = parseStringValue(call.Args[0])
+			}
+		}
+	case "ComputeOnCreateOnly":
+		if fElem.Value.(*ast.Ident).Name == "true" {
+			fData.OnCreateOnly = true
+		}
+	case "LazyCompute":
+		if fElem.Value.(*ast.Ident).Name == "true" {
+			fData.Lazy = true
+		}
+	case "VersionedCache":
+		if fElem.Value.(*ast.Ident).Name == "true" {
+			fData.Versioned = true
+		}
+	case "ComputeGuard":
+		fData.ComputeGuard = parseStringValue(fElem.Value)
+	case "NoFK":
+		if fElem.Value.(*ast.Ident).Name == "true" {
+			fData.NoFK = true
+		}
+	case "NoWrite":
+		if fElem.Value.(*ast.Ident).Name == "true" {
+			fData.NoWrite = true
+		}
+	case "Required":
+		if fElem.Value.(*ast.Ident).Name == "true" {
+			fData.Required = true
+		}
+	case "Contexts":
+		fData.Contexted = true
 	}
 	return fData
 }
 
+// parseAggregate returns a description of the aggregate declared by
+// the given expr (e.g. models.SumOf("Lines", "Subtotal")) for the doc
+// comments of the generated getters.
+func parseAggregate(expr ast.Expr) string {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok || len(call.Args) == 0 {
+		return ""
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return ""
+	}
+	relation := parseStringValue(call.Args[0])
+	if sel.Sel.Name == "CountOf" || len(call.Args) < 2 {
+		return fmt.Sprintf("the number of records of %q", relation)
+	}
+	var function string
+	switch sel.Sel.Name {
+	case "SumOf":
+		function = "sum"
+	case "AvgOf":
+		function = "average"
+	case "MinOf":
+		function = "minimum"
+	case "MaxOf":
+		function = "maximum"
+	default:
+		return ""
+	}
+	return fmt.Sprintf("the %s of %q over the records of %q", function, parseStringValue(call.Args[1]), relation)
+}
+
 // parseStringValue returns the value of a string expr which can be a literal
 // or an identifier for a string.
 func parseStringValue(expr ast.Expr) string {
@@ -506,8 +654,21 @@ func extractSelection(expr ast.Expr) map[string]string {
 	return res
 }
 
-// parseAddMethod parses the given node which is an addMethod function
-func parseAddMethod(node *ast.CallExpr, modInfo *ModuleInfo, modelsData *map[string]ModelASTData, toDeclare bool) {
+// extractStringSlice returns the values of the string slice literal
+// specified by expr.
+func extractStringSlice(expr ast.Expr) []string {
+	var res []string
+	if e, ok := expr.(*ast.CompositeLit); ok {
+		for _, elt := range e.Elts {
+			res = append(res, parseStringValue(elt))
+		}
+	}
+	return res
+}
+
+// parseAddMethod parses the given node which is an addMethod function.
+// modelLevel is true for methods declared with NewModelMethod.
+func parseAddMethod(node *ast.CallExpr, modInfo *ModuleInfo, modelsData *map[string]ModelASTData, toDeclare, modelLevel bool) {
 	fNode := node.Fun.(*ast.SelectorExpr)
 	modelName, err := extractModel(fNode.X, modInfo)
 	if err != nil {
@@ -527,20 +688,46 @@ func parseAddMethod(node *ast.CallExpr, modInfo *ModuleInfo, modelsData *map[str
 	case *ast.FuncLit:
 		funcType = fd.Type
 	}
+	doc, cached, cacheContext := extractCachedDirective(doc)
 	if _, exists := (*modelsData)[modelName]; !exists {
 		(*modelsData)[modelName] = newModelASTData(modelName)
 	}
 	methData := MethodASTData{
-		Name:      methodName,
-		Doc:       formatDocString(doc),
-		PkgPath:   modInfo.PkgPath,
-		Params:    extractParams(funcType, modInfo),
-		Returns:   extractReturnType(funcType, modInfo),
-		ToDeclare: toDeclare,
+		Name:         methodName,
+		Doc:          formatDocString(doc),
+		PkgPath:      modInfo.PkgPath,
+		Params:       extractParams(funcType, modInfo),
+		Returns:      extractReturnType(funcType, modInfo),
+		ResultNames:  extractResultNames(funcType),
+		ToDeclare:    toDeclare,
+		ModelLevel:   modelLevel,
+		Cached:       cached,
+		CacheContext: cacheContext,
 	}
 	(*modelsData)[modelName].Methods[methodName] = methData
 }
 
+// extractCachedDirective removes the @cached directive line from the given
+// method doc. It returns the remaining doc, true if the directive was found
+// and the context keys listed after it, such as in "@cached lang tz".
+func extractCachedDirective(doc string) (string, bool, []string) {
+	var (
+		lines        []string
+		cached       bool
+		cacheContext []string
+	)
+	for _, line := range strings.Split(doc, "\n") {
+		tokens := strings.Fields(line)
+		if len(tokens) > 0 && tokens[0] == "@cached" {
+			cached = true
+			cacheContext = tokens[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), cached, cacheContext
+}
+
 // A generalMixinError is returned if the mixin is
 // a general mixin set in NewXXXXModel function.
 type generalMixinError struct{}
@@ -677,7 +864,29 @@ func extractReturnType(ft *ast.FuncType, modInfo *ModuleInfo) []TypeData {
 	var res []TypeData
 	if ft.Results != nil {
 		for _, l := range ft.Results.List {
-			res = append(res, getTypeData(l.Type, modInfo))
+			typData := getTypeData(l.Type, modInfo)
+			res = append(res, typData)
+			for i := 1; i < len(l.Names); i++ {
+				res = append(res, typData)
+			}
+		}
+	}
+	return res
+}
+
+// extractResultNames returns the names of the results of the given function type.
+// It returns nil if the results are not named.
+func extractResultNames(ft *ast.FuncType) []string {
+	var res []string
+	if ft.Results == nil {
+		return nil
+	}
+	for _, l := range ft.Results.List {
+		if len(l.Names) == 0 {
+			return nil
+		}
+		for _, nn := range l.Names {
+			res = append(res, nn.Name)
 		}
 	}
 	return res
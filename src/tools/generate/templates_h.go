@@ -16,10 +16,18 @@ package {{ .ModelsPackageName }}
 import (
 	"github.com/hexya-erp/hexya/src/models"
 {{- if ne .ModelType "Mixin" }}	
+	"github.com/hexya-erp/hexya/src/actions"
+	"github.com/hexya-erp/hexya/src/models/types"
 	"github.com/hexya-erp/pool/{{ .QueryPackageName }}"
+{{- end }}
+{{- if or (eq .ModelType "") (eq .ModelType "Transient") }}
+	"time"
 {{- end }}
 	"github.com/hexya-erp/pool/{{ .ModelsPackageName }}/{{ .SnakeName }}"
     "github.com/hexya-erp/pool/{{ .InterfacesPackageName }}"
+{{- range .ModelMethodsDeps }}
+	"{{ . }}"
+{{- end }}
 )
 
 // ------- MODEL ---------
@@ -57,6 +65,36 @@ func (md {{ .Name }}Model) Create(env models.Environment, data {{ .InterfacesPac
 	}
 }
 
+// Upsert inserts the given {{ .Name }} data in a single query, or updates the existing
+// records with the same values for conflictFields, which must be the fields of a unique
+// constraint. It returns the inserted and updated records.
+//
+// Upsert bypasses the Create and Write methods and the record rules. It panics if the
+// user of env is not the superuser.
+func (md {{ .Name }}Model) Upsert(env models.Environment, data []{{ .InterfacesPackageName }}.{{ .Name }}Data, conflictFields []string) {{ .InterfacesPackageName }}.{{ .Name }}Set {
+	rData := make([]models.RecordData, len(data))
+	for i, d := range data {
+		rData[i] = d
+	}
+	fields := make([]models.FieldName, len(conflictFields))
+	for i, f := range conflictFields {
+		fields[i] = md.FieldName(f)
+	}
+	return {{ .SnakeName }}.{{ .Name }}Set{
+		RecordCollection: md.Model.Upsert(env, rData, fields),
+	}
+}
+
+// GetOrCreate returns the {{ .Name }} records matching the given condition, or
+// creates a new one from defaults and the values searched with Equals in cond.
+// Concurrent creations of the same record are resolved by the retry of serialization
+// errors of ExecuteInNewEnvironment.
+func (md {{ .Name }}Model) GetOrCreate(env models.Environment, cond {{ $.QueryPackageName }}.{{ .Name }}Condition, defaults {{ .InterfacesPackageName }}.{{ .Name }}Data) {{ .InterfacesPackageName }}.{{ .Name }}Set {
+	return {{ .SnakeName }}.{{ .Name }}Set{
+		RecordCollection: md.Model.GetOrCreate(env, cond, defaults),
+	}
+}
+
 // Search searches the database and returns a new {{ .Name }}Set instance
 // with the records found.
 func (md {{ .Name }}Model) Search(env models.Environment, cond {{ $.QueryPackageName }}.{{ .Name }}Condition) {{ .InterfacesPackageName }}.{{ .Name }}Set {
@@ -65,6 +103,39 @@ func (md {{ .Name }}Model) Search(env models.Environment, cond {{ $.QueryPackage
 	}
 }
 
+// MultiSearch searches the database with a single query and returns for each
+// given condition a {{ .Name }}Set with the records matching it.
+func (md {{ .Name }}Model) MultiSearch(env models.Environment, conds ...{{ $.QueryPackageName }}.{{ .Name }}Condition) []{{ .InterfacesPackageName }}.{{ .Name }}Set {
+	underlyings := make([]models.Conditioner, len(conds))
+	for i, cond := range conds {
+		underlyings[i] = cond
+	}
+	rcs := md.Model.MultiSearch(env, underlyings...)
+	res := make([]{{ .InterfacesPackageName }}.{{ .Name }}Set, len(rcs))
+	for i, rc := range rcs {
+		res[i] = {{ .SnakeName }}.{{ .Name }}Set{
+			RecordCollection: rc,
+		}
+	}
+	return res
+}
+
+// SubqueryIds returns a Subquery selecting the ids of the {{ .Name }} records
+// matching the given condition. It can be given to the InSubquery method of a
+// condition on a relation field pointing to {{ .Name }}.
+func (md {{ .Name }}Model) SubqueryIds(cond {{ $.QueryPackageName }}.{{ .Name }}Condition) models.Subquery {
+	return md.Model.SubqueryIds(cond)
+}
+
+// ActionWindow returns a window action displaying {{ .Name }} records with
+// the given comma separated view modes (e.g. "tree,form").
+//
+// Only the records matching cond are displayed, unless cond is empty.
+// ctx is passed to the client and may be nil.
+func (md {{ .Name }}Model) ActionWindow(viewMode string, cond {{ $.QueryPackageName }}.{{ .Name }}Condition, ctx *types.Context) *actions.Action {
+	return actions.NewWindowAction(md, viewMode, cond, ctx)
+}
+
 // Browse returns a new RecordSet with the records with the given ids.
 // Note that this function is just a shorcut for Search on a list of ids.
 func (md {{ .Name }}Model) Browse(env models.Environment, ids []int64) {{ .InterfacesPackageName }}.{{ .Name }}Set {
@@ -73,6 +144,32 @@ func (md {{ .Name }}Model) Browse(env models.Environment, ids []int64) {{ .Inter
 	}
 }
 
+// BrowseStrict returns a new RecordSet with the records with the given ids.
+// It panics with the list of missing ids if some of the records do not exist.
+func (md {{ .Name }}Model) BrowseStrict(env models.Environment, ids []int64) {{ .InterfacesPackageName }}.{{ .Name }}Set {
+	return {{ .SnakeName }}.{{ .Name }}Set{
+		RecordCollection: md.Model.BrowseStrict(env, ids),
+	}
+}
+
+// BrowseExternal returns a new RecordSet with the records with the given external IDs,
+// in the given order. It panics with the list of unresolved external IDs if some of
+// the records do not exist.
+func (md {{ .Name }}Model) BrowseExternal(env models.Environment, externalIDs ...string) {{ .InterfacesPackageName }}.{{ .Name }}Set {
+	return {{ .SnakeName }}.{{ .Name }}Set{
+		RecordCollection: md.Model.BrowseExternal(env, externalIDs...),
+	}
+}
+
+// BrowseOrdered returns a new RecordSet with the records with the given ids, in the
+// given order, e.g. as ranked by an external search engine. Ids of records that do
+// not exist are skipped.
+func (md {{ .Name }}Model) BrowseOrdered(env models.Environment, ids []int64) {{ .InterfacesPackageName }}.{{ .Name }}Set {
+	return {{ .SnakeName }}.{{ .Name }}Set{
+		RecordCollection: md.Model.BrowseOrdered(env, ids),
+	}
+}
+
 // BrowseOne returns a new RecordSet with the record with the given id.
 // Note that this function is just a shorcut for Search on the given id.
 func (md {{ .Name }}Model) BrowseOne(env models.Environment, id int64) {{ .InterfacesPackageName }}.{{ .Name }}Set {
@@ -81,6 +178,143 @@ func (md {{ .Name }}Model) BrowseOne(env models.Environment, id int64) {{ .Inter
 	}
 }
 
+// DistinctValues returns the distinct values of the given field among the {{ .Name }}
+// records matching cond, in ascending order and without nulls. All the records are
+// considered if cond is empty.
+func (md {{ .Name }}Model) DistinctValues(env models.Environment, field string, cond {{ $.QueryPackageName }}.{{ .Name }}Condition) []interface{} {
+	return md.Model.DistinctValues(env, md.FieldName(field), cond)
+}
+
+// UpdateExpr sets the fields of the {{ .Name }} records matching cond to the given
+// expressions in a single UPDATE query, without loading the records. All the records
+// are updated if cond is empty. It returns the number of updated records.
+func (md {{ .Name }}Model) UpdateExpr(env models.Environment, cond {{ $.QueryPackageName }}.{{ .Name }}Condition, assignments map[string]models.Expr) int {
+	return md.Model.UpdateExpr(env, cond, assignments)
+}
+
+// AddSearchRestriction registers fn with the given name to restrict the {{ .Name }} records
+// that can be accessed in an Environment to those matching the condition it returns.
+// The superuser is not restricted.
+func (md {{ .Name }}Model) AddSearchRestriction(name string, fn func(env models.Environment) {{ $.QueryPackageName }}.{{ .Name }}Condition) {
+	md.Model.AddSearchRestriction(name, func(env models.Environment) models.Conditioner {
+		return fn(env)
+	})
+}
+
+// A {{ .Name }}Page is a page of {{ .Name }} records returned by Paginate
+// with its pagination metadata.
+type {{ .Name }}Page struct {
+	Records {{ .InterfacesPackageName }}.{{ .Name }}Set
+	models.PageInfo
+}
+
+// Paginate returns the given page of the {{ .Name }} records matching cond, pages having
+// pageSize records and starting at 1, sorted by order or by the model's default order.
+// All the records are considered if cond is empty.
+func (md {{ .Name }}Model) Paginate(env models.Environment, cond {{ $.QueryPackageName }}.{{ .Name }}Condition, page, pageSize int, order ...string) {{ .Name }}Page {
+	rc, info := md.Model.Paginate(env, cond, page, pageSize, order...)
+	return {{ .Name }}Page{
+		Records:  {{ .SnakeName }}.{{ .Name }}Set{RecordCollection: rc},
+		PageInfo: info,
+	}
+}
+
+// SearchReadStream returns an iterator over the values of the given fields of the
+// {{ .Name }} records matching cond, all records being considered if cond is empty.
+// Each call of the returned function gives the next batch of at most batchSize records
+// and true, or nil and false when all records have been returned. Records are fetched
+// in ID order and only the given fields are read, so that memory usage stays bounded.
+func (md {{ .Name }}Model) SearchReadStream(env models.Environment, cond {{ $.QueryPackageName }}.{{ .Name }}Condition, fields []models.FieldName, batchSize int) func() ([]map[string]interface{}, bool) {
+	return md.Model.SearchReadStream(env, cond, fields, batchSize)
+}
+
+{{ if or (eq .ModelType "") (eq .ModelType "Transient") }}
+// ChangedSince returns the {{ .Name }} records created or written at or after since,
+// ordered by write date, then by creation date. Deleted records are not returned.
+func (md {{ .Name }}Model) ChangedSince(env models.Environment, since time.Time) {{ .InterfacesPackageName }}.{{ .Name }}Set {
+	return {{ .SnakeName }}.{{ .Name }}Set{
+		RecordCollection: md.Model.ChangedSince(env, since),
+	}
+}
+{{ end }}
+{{ if eq .ModelType "" }}
+// DeletedSince returns the ids of the {{ .Name }} records unlinked at or after since,
+// ordered by deletion time. Ids are only kept for the retention set by
+// models.SetTombstoneRetention.
+func (md {{ .Name }}Model) DeletedSince(env models.Environment, since time.Time) []int64 {
+	return md.Model.DeletedSince(env, since)
+}
+{{ end }}
+// Unmarshal returns a {{ .Name }}Set with the records of data, as returned by Marshal.
+// The values of data are put in the cache so that the records are not fetched again.
+// They are discarded if data has been marshaled with another definition of {{ .Name }}.
+func (md {{ .Name }}Model) Unmarshal(env models.Environment, data []byte) {{ .InterfacesPackageName }}.{{ .Name }}Set {
+	return {{ .SnakeName }}.{{ .Name }}Set{
+		RecordCollection: md.Model.Unmarshal(env, data),
+	}
+}
+
+// AfterWrite registers the given hook to be called after each write on {{ .Name }}
+// records, with the changes of the written fields of each modified record by id.
+func (md {{ .Name }}Model) AfterWrite(hook func(rs {{ .InterfacesPackageName }}.{{ .Name }}Set, changes map[int64]models.Changeset)) {
+	md.Model.AfterWrite(func(rc *models.RecordCollection, changes map[int64]models.Changeset) {
+		hook({{ .SnakeName }}.{{ .Name }}Set{RecordCollection: rc}, changes)
+	})
+}
+
+// AddPartialUniqueConstraint adds a unique index in the database on the given fields
+// that only applies to the {{ .Name }} records matching cond.
+func (md {{ .Name }}Model) AddPartialUniqueConstraint(name string, fields []models.FieldName, cond {{ $.QueryPackageName }}.{{ .Name }}Condition, errorString string) {
+	md.Model.AddPartialUniqueConstraint(name, fields, cond, errorString)
+}
+
+// Query returns a {{ .Name }}QueryBuilder to search {{ .Name }} records in the given Environment.
+// Without any call to Where, the query matches all the records.
+func (md {{ .Name }}Model) Query(env models.Environment) {{ .Name }}QueryBuilder {
+	return {{ .Name }}QueryBuilder{
+		set: md.NewSet(env).SearchAll(),
+	}
+}
+
+// A {{ .Name }}QueryBuilder combines the condition, order, limit and offset of a search
+// on {{ .Name }} records. Each method returns a new {{ .Name }}QueryBuilder.
+//
+// Get a {{ .Name }}QueryBuilder with {{ .Name }}().Query(env).
+type {{ .Name }}QueryBuilder struct {
+	set {{ .InterfacesPackageName }}.{{ .Name }}Set
+}
+
+// Where adds cond to the conditions of this query. Several calls
+// to Where are combined with AND.
+func (qb {{ .Name }}QueryBuilder) Where(cond {{ $.QueryPackageName }}.{{ .Name }}Condition) {{ .Name }}QueryBuilder {
+	return {{ .Name }}QueryBuilder{set: qb.set.Search(cond)}
+}
+
+// Order sets the ORDER BY expressions of this query (e.g. "Name desc").
+func (qb {{ .Name }}QueryBuilder) Order(exprs ...string) {{ .Name }}QueryBuilder {
+	return {{ .Name }}QueryBuilder{set: qb.set.OrderBy(exprs...)}
+}
+
+// Limit sets the maximum number of records returned by this query.
+func (qb {{ .Name }}QueryBuilder) Limit(limit int) {{ .Name }}QueryBuilder {
+	return {{ .Name }}QueryBuilder{set: qb.set.Limit(limit)}
+}
+
+// Offset sets the number of records to skip before returning records.
+func (qb {{ .Name }}QueryBuilder) Offset(offset int) {{ .Name }}QueryBuilder {
+	return {{ .Name }}QueryBuilder{set: qb.set.Offset(offset)}
+}
+
+// Set executes this query and returns the matching records as a {{ .Name }}Set.
+func (qb {{ .Name }}QueryBuilder) Set() {{ .InterfacesPackageName }}.{{ .Name }}Set {
+	return qb.set
+}
+
+// All executes this query and returns the values of the matching records.
+func (qb {{ .Name }}QueryBuilder) All() []{{ .InterfacesPackageName }}.{{ .Name }}Data {
+	return qb.set.All()
+}
+
 {{ end }}
 
 // NewData returns a pointer to a new empty {{ .Name }}Data instance.
@@ -126,6 +360,27 @@ func (md {{ .Name }}Model) Coalesce(lst ...{{ .InterfacesPackageName }}.{{ .Name
 	return last
 }
 
+{{ range .Methods }}
+{{- if .ModelLevel }}
+{{ .Doc }}
+{{- if .Cached }}
+//
+// The results of {{ .Name }} are cached in the environment by arguments
+{{- if .CacheContext }} and by the {{ .CacheContext }} context keys{{ end }},
+// until records are modified or the transaction ends.
+{{- end }}
+func (md {{ $.Name }}Model) {{ .Name }}(env models.Environment{{ if ne .ParamsWithType "" }}, {{ .ParamsWithType }}{{ end }}) ({{ .ReturnString }}) {
+{{- if eq .Returns "" }}
+	md.NewSet(env).Collection().Call("{{ .Name }}", {{ .Params}})
+{{- else }}
+	res := md.NewSet(env).Collection().{{ .Call }}("{{ .Name }}", {{ .Params}})
+	{{ .ReturnAsserts }}
+	return {{ .Returns }}
+{{- end }}
+}
+{{ end }}
+{{- end }}
+
 // {{ .Name }} returns the unique instance of the {{ .Name }}Model type
 // which is used to extend the {{ .Name }} model or to get a {{ .Name }}Set through
 // its NewSet() function.
@@ -242,6 +497,13 @@ func (d {{ $.Name }}Data) MergeWith(other {{ .InterfacesPackageName }}.{{ $.Name
 	d.ModelData.MergeWith(other.Underlying())
 }
 
+// Validate checks the values of this {{ $.Name }}Data against the definition of the
+// {{ $.Name }} fields without writing to the database, and returns the errors found.
+// Required fields without default value must be set, as for a creation.
+func (d {{ $.Name }}Data) Validate(env models.Environment) []exceptions.ValidationError {
+	return d.ModelData.Validate(env)
+}
+
 {{ range .Fields }}
 // {{ .Name }} returns the value of the {{ .Name }} field.
 // If this {{ .Name }} is not set in this {{ $.Name }}Data, then
@@ -253,6 +515,9 @@ func (d {{ $.Name }}Data) {{ .Name }}() {{ .Type }} {
 		val = models.InvalidRecordCollection("{{ .RelModel }}")
 	}
 	return val.(models.RecordSet).Collection().Wrap().({{ .Type }})
+{{- else if .IsRef }}
+	res, _ := val.({{ .Type }})
+	return res
 {{- else }}
 	if !d.Has(models.NewFieldName("{{ .Name }}", "{{ .JSON }}")) {
 		return *new({{ .Type }})
@@ -330,6 +595,7 @@ type {{ .Name }}Set struct {
 }
 
 var _ models.RecordSet = {{ .Name }}Set{}
+var _ {{ .InterfacesPackageName }}.{{ .Name }}Set = {{ .Name }}Set{}
 
 // {{ .Name }}SetHexyaFunc is a dummy function to uniquely match interfaces.
 func (s {{ .Name }}Set) {{ .Name }}SetHexyaFunc() {}
@@ -352,6 +618,49 @@ func (s {{ .Name }}Set) ForceLoad(fields ...models.FieldName) {{ .InterfacesPack
 	return s
 }
 
+// GetForUpdate re-reads the records of this {{ .Name }}Set and locks their rows
+// until the end of the transaction, so that they can be safely read, modified
+// and written back. Concurrent calls on the same records block until this
+// transaction ends. It panics outside a transaction.
+func (s {{ .Name }}Set) GetForUpdate() {{ .InterfacesPackageName }}.{{ .Name }}Set {
+	return {{ .Name }}Set{RecordCollection: s.RecordCollection.GetForUpdate()}
+}
+
+// ActionOpenRecord returns a window action opening this {{ .Name }} record
+// in form view. It panics if this {{ .Name }}Set is not a singleton.
+func (s {{ .Name }}Set) ActionOpenRecord() *actions.Action {
+	return actions.NewOpenRecordAction(s)
+}
+
+// With returns a new {{ .Name }}Set that loads the given fields of the records
+// pointed at by relationField with a single JOIN when this set is loaded.
+//
+// It panics if relationField is not a many2one or one2one field of the {{ .Name }}
+// model or if fields are not stored fields of the related model.
+func (s {{ .Name }}Set) With(relationField models.FieldName, fields ...models.FieldName) {{ .InterfacesPackageName }}.{{ .Name }}Set {
+	return s.RecordCollection.With(relationField, fields...).Wrap("{{ .Name }}").({{ .InterfacesPackageName }}.{{ .Name }}Set)
+}
+
+// IdsCondition returns a condition matching the records of this {{ .Name }}Set
+// by their ids. It matches no records if this {{ .Name }}Set is empty.
+func (s {{ .Name }}Set) IdsCondition() {{ $.QueryPackageName }}.{{ .Name }}Condition {
+	return {{ $.QueryPackageName }}.{{ .Name }}Condition{
+		Condition: s.RecordCollection.IdsCondition(),
+	}
+}
+
+// ActiveRecords returns a new {{ .Name }}Set with the records of the
+// 'active_ids' key of the context.
+func (s {{ .Name }}Set) ActiveRecords() {{ .InterfacesPackageName }}.{{ .Name }}Set {
+	return s.RecordCollection.ActiveRecords().Wrap("{{ .Name }}").({{ .InterfacesPackageName }}.{{ .Name }}Set)
+}
+
+// Explain returns the execution plan of the query loading the records of
+// this {{ .Name }}Set filtered by cond. It panics if Debug mode is not enabled.
+func (s {{ .Name }}Set) Explain(cond {{ $.QueryPackageName }}.{{ .Name }}Condition) string {
+	return s.RecordCollection.Explain(cond.Underlying())
+}
+
 // Records returns a slice with all the records of this RecordSet, as singleton
 // RecordSets
 func (s {{ .Name }}Set) Records() []{{ .InterfacesPackageName }}.{{ .Name }}Set {
@@ -386,6 +695,30 @@ func (s {{ .Name }}Set) First() {{ .InterfacesPackageName }}.{{ .Name }}Data {
 	}
 }
 
+// Totals returns the sums of the given numeric fields over the records of this
+// {{ .Name }}Set by field name, computed in a single query. It panics if a field
+// is not a stored integer or float field.
+func (s {{ .Name }}Set) Totals(fields ...string) map[string]float64 {
+	return s.RecordCollection.Totals(s.fieldNames(fields)...)
+}
+
+// TotalsData returns a {{ .Name }}Data with the sums of the given numeric fields over
+// the records of this {{ .Name }}Set, e.g. for the footer of a list.
+func (s {{ .Name }}Set) TotalsData(fields ...string) {{ .InterfacesPackageName }}.{{ .Name }}Data {
+	return &{{ .Name }}Data{
+		s.RecordCollection.TotalsData(s.fieldNames(fields)...),
+	}
+}
+
+// fieldNames returns the FieldName of each of the given {{ .Name }} fields.
+func (s {{ .Name }}Set) fieldNames(fields []string) []models.FieldName {
+	res := make([]models.FieldName, len(fields))
+	for i, f := range fields {
+		res[i] = s.Collection().Model().FieldName(f)
+	}
+	return res
+}
+
 // All returns the values of all Records of the RecordCollection as a slice of {{ .Name }}Data pointers.
 func (s {{ .Name }}Set) All() []{{ .InterfacesPackageName }}.{{ .Name }}Data {
 	allSlice := s.RecordCollection.All()
@@ -396,6 +729,106 @@ func (s {{ .Name }}Set) All() []{{ .InterfacesPackageName }}.{{ .Name }}Data {
 	return res
 }
 
+// AllPtr returns the values of all Records of this {{ .Name }}Set as a slice of {{ .Name }}Data
+// pointers with change tracking, so that they can be edited in place. The modified fields
+// of each {{ .Name }}Data are then written back to its record with WriteDirty.
+func (s {{ .Name }}Set) AllPtr() []{{ .InterfacesPackageName }}.{{ .Name }}Data {
+	allSlice := s.RecordCollection.AllTracked()
+	res := make([]{{ .InterfacesPackageName }}.{{ .Name }}Data, len(allSlice))
+	for i, v := range allSlice {
+		res[i] = &{{ .Name }}Data{v}
+	}
+	return res
+}
+
+// WriteDirty writes the modified fields of each of the given {{ .Name }}Data returned by
+// AllPtr to its record, and returns the number of records written. Records with the same
+// changes are written with a single call to Write, and records without changes are skipped.
+func (s {{ .Name }}Set) WriteDirty(data []{{ .InterfacesPackageName }}.{{ .Name }}Data) int {
+	mds := make([]*models.ModelData, len(data))
+	for i, d := range data {
+		mds[i] = d.Underlying()
+	}
+	return s.RecordCollection.WriteDirty(mds)
+}
+
+// MapTo returns a new data object of the target model populated with the values of this
+// {{ .Name }} record. mapping gives for each field of {{ .Name }} the name of the target
+// field to set, and transforms optionally converts the values of some fields.
+//
+// The result can be asserted to the Data type of the target model (e.g. m.InvoiceData).
+// MapTo panics if this {{ .Name }}Set is not a singleton.
+func (s {{ .Name }}Set) MapTo(target models.Modeler, mapping map[string]string, transforms map[string]models.FieldTransform) models.RecordData {
+	return s.RecordCollection.MapTo(target, mapping, transforms).Wrap().(models.RecordData)
+}
+
+// Next returns the {{ .Name }} record that comes after this one when sorted by
+// the given order (e.g. "Name desc, ID"), or an empty {{ .Name }}Set if this is the
+// last one. Next panics if this {{ .Name }}Set is not a singleton.
+func (s {{ .Name }}Set) Next(order string) {{ .InterfacesPackageName }}.{{ .Name }}Set {
+	return {{ .Name }}Set{RecordCollection: s.RecordCollection.Next(order)}
+}
+
+// Previous returns the {{ .Name }} record that comes before this one when sorted by
+// the given order, or an empty {{ .Name }}Set if this is the first one.
+// Previous panics if this {{ .Name }}Set is not a singleton.
+func (s {{ .Name }}Set) Previous(order string) {{ .InterfacesPackageName }}.{{ .Name }}Set {
+	return {{ .Name }}Set{RecordCollection: s.RecordCollection.Previous(order)}
+}
+
+// RecursiveChildren returns all the descendants of the records of this {{ .Name }}Set
+// through parentField, which must be a many2one field pointing to {{ .Name }} itself.
+// Descendants are fetched with a single recursive query and cycles are supported.
+func (s {{ .Name }}Set) RecursiveChildren(parentField string) {{ .InterfacesPackageName }}.{{ .Name }}Set {
+	return {{ .Name }}Set{RecordCollection: s.RecordCollection.RecursiveChildren(s.RecordCollection.Model().FieldName(parentField))}
+}
+
+// RecursiveParents returns all the ancestors of the records of this {{ .Name }}Set
+// through parentField, which must be a many2one field pointing to {{ .Name }} itself.
+// Ancestors are fetched with a single recursive query and cycles are supported.
+func (s {{ .Name }}Set) RecursiveParents(parentField string) {{ .InterfacesPackageName }}.{{ .Name }}Set {
+	return {{ .Name }}Set{RecordCollection: s.RecordCollection.RecursiveParents(s.RecordCollection.Model().FieldName(parentField))}
+}
+
+// ForEachParallel calls fn on each {{ .Name }} record of this {{ .Name }}Set, with at most
+// concurrency calls at the same time. Each call runs in its own goroutine, Environment
+// and transaction, which is committed only if fn returns nil.
+//
+// It returns the errors of each record in the order of this {{ .Name }}Set, or nil if
+// all the calls succeeded.
+func (s {{ .Name }}Set) ForEachParallel(concurrency int, fn func(rec {{ .InterfacesPackageName }}.{{ .Name }}Set) error) []error {
+	return s.RecordCollection.ForEachParallel(concurrency, func(rc *models.RecordCollection) error {
+		return fn({{ .Name }}Set{RecordCollection: rc})
+	})
+}
+
+// InNewTransaction calls fn with the records of this {{ .Name }}Set in a new Environment
+// and transaction, which is committed if fn returns nil, even if the current transaction
+// is rolled back later. fn does not see the uncommitted changes of the current transaction
+// and must not modify records it has modified.
+//
+// It returns the error of fn, or its panic as an error.
+func (s {{ .Name }}Set) InNewTransaction(fn func(s {{ .InterfacesPackageName }}.{{ .Name }}Set) error) error {
+	return s.RecordCollection.InNewTransaction(func(rc *models.RecordCollection) error {
+		return fn({{ .Name }}Set{RecordCollection: rc})
+	})
+}
+
+// Iterate returns an iterator over the values of the {{ .Name }} records matching cond.
+// Each call of the returned function gives the next record's values and true, or nil
+// and false when all records have been returned. Records are fetched by batches of
+// batchSize records in ID order, so that memory usage stays bounded.
+func (s {{ .Name }}Set) Iterate(cond {{ $.QueryPackageName }}.{{ .Name }}Condition, batchSize int) func() ({{ .InterfacesPackageName }}.{{ .Name }}Data, bool) {
+	next := s.RecordCollection.Iterate(cond, batchSize)
+	return func() ({{ .InterfacesPackageName }}.{{ .Name }}Data, bool) {
+		data, ok := next()
+		if !ok {
+			return nil, false
+		}
+		return &{{ .Name }}Data{data}, true
+	}
+}
+
 // Sorted returns a new {{ .Name}}Set sorted according to the given less function.
 //
 // The less function should return true if rs1 < rs2
@@ -419,9 +852,83 @@ func (s {{ .Name}}Set) Filtered(test func(rs {{ .InterfacesPackageName }}.{{ .Na
 	return res.Wrap("{{ .Name }}").({{ .InterfacesPackageName }}.{{ .Name}}Set)
 }
 
+// Every returns true if test is true for all the records of this {{ .Name }}Set,
+// which are given to test as singletons. It stops at the first record for which
+// test is false and returns true if this {{ .Name }}Set is empty.
+func (s {{ .Name}}Set) Every(test func(rs {{ .InterfacesPackageName }}.{{ .Name}}Set) bool) bool {
+	return s.RecordCollection.Every(func(rc models.RecordSet) bool {
+		return test({{ .Name }}Set{RecordCollection: rc.Collection()})
+	})
+}
+
+// Some returns true if test is true for at least one record of this {{ .Name }}Set,
+// given to test as a singleton. It stops at the first record for which test is
+// true and returns false if this {{ .Name }}Set is empty.
+func (s {{ .Name}}Set) Some(test func(rs {{ .InterfacesPackageName }}.{{ .Name}}Set) bool) bool {
+	return s.RecordCollection.Some(func(rc models.RecordSet) bool {
+		return test({{ .Name }}Set{RecordCollection: rc.Collection()})
+	})
+}
+
 {{ range .Fields }}
 // {{ .Name }} is a getter for the value of the "{{ .Name }}" field of the first
 // record in this RecordSet. It returns the Go zero value if the RecordSet is empty.
+{{- if .TimeDependent }}
+//
+// {{ .Name }} depends on the current time: its value is never cached
+// and is recomputed on each call.
+{{- end }}
+{{- if .OnCreateOnly }}
+//
+// {{ .Name }} is computed once when the record is created and is
+// not recomputed afterwards.
+{{- end }}
+{{- if .Lazy }}
+//
+// {{ .Name }} is computed and stored when it is first read. It is
+// cleared when one of its dependencies changes and computed again on
+// the next read.
+{{- end }}
+{{- if .Versioned }}
+//
+// {{ .Name }} is stored with the version of its dependencies. When the
+// stored version does not match its dependencies, it is computed again
+// when loaded, without being stored.
+{{- end }}
+{{- if .ComputeGuard }}
+//
+// {{ .Name }} is only computed for records whose "{{ .ComputeGuard }}" field
+// is set. Other records keep their previous value, or the zero value if
+// {{ .Name }} is not stored.
+{{- end }}
+{{- if .NoFK }}
+//
+// {{ .Name }} has no foreign key in the database: an empty {{ .RelModel }}Set
+// is returned if the referenced record has been deleted.
+{{- end }}
+{{- if .Sequence }}
+//
+// {{ .Name }} is numbered from the "{{ .Sequence }}" sequence when
+// the record is created.
+{{- end }}
+{{- if .Aggregate }}
+//
+// {{ .Name }} is stored and computed as {{ .Aggregate }}.
+{{- end }}
+{{- if .Trigram }}
+//
+// {{ .Name }} has a trigram index: Contains, IContains, Like and ILike
+// conditions on this field do not need to scan the whole table.
+{{- end }}
+{{- if .Section }}
+//
+// {{ .Name }} is displayed in the "{{ .Section }}" section of forms.
+{{- end }}
+{{- if .Required }}
+//
+// {{ .Name }} is required: it must be given when creating a record (unless
+// it has a default value) and it cannot be cleared afterwards.
+{{- end }}
 func (s {{ $.Name }}Set) {{ .Name }}() {{ .Type }} {
 {{- if .IsRS }}
 	res, _ := s.RecordCollection.Get(models.NewFieldName("{{ .Name }}", "{{ .JSON }}")).(models.RecordSet).Collection().Wrap("{{ .RelModel }}").({{ .Type }})
@@ -430,7 +937,15 @@ func (s {{ $.Name }}Set) {{ .Name }}() {{ .Type }} {
 {{- end }}
 	return res 
 }
-
+{{ if .IsRS }}
+// {{ .Name }}WithContext returns the value of the "{{ .Name }}" field read with the
+// context of this RecordSet extended by the keys of ctx, e.g. to include archived
+// records. The context of this RecordSet is left unchanged.
+func (s {{ $.Name }}Set) {{ .Name }}WithContext(ctx map[string]interface{}) {{ .Type }} {
+	res, _ := s.RecordCollection.RelationWithContext(models.NewFieldName("{{ .Name }}", "{{ .JSON }}"), ctx).Wrap("{{ .RelModel }}").({{ .Type }})
+	return res
+}
+{{ end }}{{ if not .NoWrite }}
 // Set{{ .Name }} is a setter for the value of the "{{ .Name }}" field of this
 // RecordSet. All Records of this RecordSet will be updated. Each call to this
 // method makes an update query in the database.
@@ -439,8 +954,124 @@ func (s {{ $.Name }}Set) {{ .Name }}() {{ .Type }} {
 func (s {{ $.Name }}Set) Set{{ .Name }}(value {{ .Type }}) {
 	s.RecordCollection.Set(models.NewFieldName("{{ .Name }}", "{{ .JSON }}"), value)
 }
+{{ end }}{{ if .CompareAndSet }}
+// CompareAndSet{{ .Name }} sets the "{{ .Name }}" field of this record to value
+// only if its current value in the database is expected. It returns true if the
+// record has been updated.
+//
+// CompareAndSet{{ .Name }} panics if the RecordSet is not a singleton.
+func (s {{ $.Name }}Set) CompareAndSet{{ .Name }}(expected, value {{ .Type }}) bool {
+	return s.RecordCollection.CompareAndSet(models.NewFieldName("{{ .Name }}", "{{ .JSON }}"), expected, value)
+}
+{{ end }}
+{{ if .Toggle }}
+// Toggle{{ .Name }} inverts the value of the "{{ .Name }}" field of all the records
+// of this RecordSet in a single UPDATE query.
+func (s {{ $.Name }}Set) Toggle{{ .Name }}() {{ $.InterfacesPackageName }}.{{ $.Name }}Set {
+	return {{ $.Name }}Set{RecordCollection: s.RecordCollection.Toggle(models.NewFieldName("{{ .Name }}", "{{ .JSON }}"))}
+}
+{{ end }}
+{{- if .Increment }}
+// Increment{{ .Name }} adds delta to the "{{ .Name }}" field of all the records of this
+// RecordSet in a single UPDATE query. Use a negative delta to decrement.
+func (s {{ $.Name }}Set) Increment{{ .Name }}(delta {{ .Type }}) {{ $.InterfacesPackageName }}.{{ $.Name }}Set {
+	return {{ $.Name }}Set{RecordCollection: s.RecordCollection.Increment(models.NewFieldName("{{ .Name }}", "{{ .JSON }}"), delta)}
+}
+{{ end }}
+{{- if .Distinct }}
+// Distinct{{ .Name }} returns the distinct values of the "{{ .Name }}" field among the
+// records of this RecordSet, in ascending order and without nulls.
+func (s {{ $.Name }}Set) Distinct{{ .Name }}() []{{ .Type }} {
+	values := s.RecordCollection.DistinctValues(models.NewFieldName("{{ .Name }}", "{{ .JSON }}"))
+	res := make([]{{ .Type }}, len(values))
+	for i, v := range values {
+		res[i] = v.({{ .Type }})
+	}
+	return res
+}
+{{ end }}
+{{- if .Transform }}
+// Transform{{ .Name }} sets the "{{ .Name }}" field of all the records of this RecordSet
+// to the result of fn applied to its current value. Records are loaded and written by
+// batches, except if fn is strings.TrimSpace, strings.ToUpper or strings.ToLower which
+// are executed by the database in a single UPDATE query.
+func (s {{ $.Name }}Set) Transform{{ .Name }}(fn func({{ .Type }}) {{ .Type }}) {
+	s.RecordCollection.Transform(models.NewFieldName("{{ .Name }}", "{{ .JSON }}"), fn)
+}
+{{ end }}
+{{- if .Versioned }}
+// {{ .Name }}Version returns the version of the stored value of the "{{ .Name }}" field,
+// i.e. the hash of the values of its dependencies when it was last computed.
+func (s {{ $.Name }}Set) {{ .Name }}Version() string {
+	res, _ := s.RecordCollection.Get(models.NewFieldName("Hexya{{ .Name }}Version", "hexya_{{ .JSON }}_version")).(string)
+	return res
+}
 {{ end }}
+{{- if .Names }}
+// {{ .Name }}Names returns the display name of the {{ .RelModel }} record of the "{{ .Name }}"
+// field of each record of this RecordSet, mapped by record ID. Records with an empty field are
+// omitted. Names are fetched in a single query whatever the number of records.
+func (s {{ $.Name }}Set) {{ .Name }}Names() map[int64]string {
+	return s.RecordCollection.RelationNames(models.NewFieldName("{{ .Name }}", "{{ .JSON }}"))
+}
+{{ end }}
+{{- if .RelationIds }}
+// Add{{ .Name }}ByIds links the records of this RecordSet to the {{ .RelModel }} records
+// with the given ids through the "{{ .Name }}" field, keeping the existing links. Links are
+// inserted in a single query without loading the {{ .RelModel }} records. Ids of records that
+// do not exist are skipped, unless the 'hexya_strict_relation_ids' context key is set.
+func (s {{ $.Name }}Set) Add{{ .Name }}ByIds(ids ...int64) {{ $.InterfacesPackageName }}.{{ $.Name }}Set {
+	return {{ $.Name }}Set{RecordCollection: s.RecordCollection.AddRelationIds(models.NewFieldName("{{ .Name }}", "{{ .JSON }}"), ids)}
+}
 
+// Remove{{ .Name }}ByIds removes the links between the records of this RecordSet and the
+// {{ .RelModel }} records with the given ids through the "{{ .Name }}" field in a single query.
+func (s {{ $.Name }}Set) Remove{{ .Name }}ByIds(ids ...int64) {{ $.InterfacesPackageName }}.{{ $.Name }}Set {
+	return {{ $.Name }}Set{RecordCollection: s.RecordCollection.RemoveRelationIds(models.NewFieldName("{{ .Name }}", "{{ .JSON }}"), ids)}
+}
+{{ end }}
+{{- if .Raw }}
+// Raw{{ .Name }} returns the value of the "{{ .Name }}" field as it is persisted in the
+// database, without triggering its recomputation. This is a diagnostic tool.
+// Raw{{ .Name }} panics if this {{ $.Name }}Set is not a singleton.
+func (s {{ $.Name }}Set) Raw{{ .Name }}() {{ .Type }} {
+	res, _ := s.RecordCollection.RawValue(models.NewFieldName("{{ .Name }}", "{{ .JSON }}")).({{ .Type }})
+	return res
+}
+{{ end }}
+{{- $field := . }}
+{{- range .Mapped }}
+// Mapped{{ $field.Name }}{{ .Name }} returns the values of the "{{ .Name }}" field of all the
+// {{ $field.RelModel }} records of the "{{ $field.Name }}" field of this RecordSet.
+func (s {{ $.Name }}Set) Mapped{{ $field.Name }}{{ .Name }}() {{ if .IsRS }}{{ .Type }}{{ else }}[]{{ .Type }}{{ end }} {
+{{- if .IsRS }}
+	res, _ := s.RecordCollection.Mapped(models.NewFieldName("{{ $field.Name }}", "{{ $field.JSON }}"), models.NewFieldName("{{ .Name }}", "{{ .JSON }}")).(models.RecordSet).Collection().Wrap("{{ .RelModel }}").({{ .Type }})
+{{- else }}
+	res, _ := s.RecordCollection.Mapped(models.NewFieldName("{{ $field.Name }}", "{{ $field.JSON }}"), models.NewFieldName("{{ .Name }}", "{{ .JSON }}")).([]{{ .Type }})
+{{- end }}
+	return res
+}
+{{ end }}
+{{- if .DynamicFilter }}
+// {{ .Name }}RelationFilter returns the condition that {{ .RelModel }} records must satisfy
+// to be set in the "{{ .Name }}" field, given the current values of this RecordSet.
+func (s {{ $.Name }}Set) {{ .Name }}RelationFilter() {{ $.QueryPackageName }}.{{ .RelModel }}Condition {
+	return {{ $.QueryPackageName }}.{{ .RelModel }}Condition{
+		Condition: s.RecordCollection.RelationFilter(models.NewFieldName("{{ .Name }}", "{{ .JSON }}")),
+	}
+}
+{{ end }}
+{{- end }}
+
+{{ range .ViewStructs }}
+// Read{{ .Name }} loads the columns of the {{ .Name }} view struct of the records
+// of this RecordSet into a slice of {{ .StructName }}, without populating the cache.
+func (s {{ $.Name }}Set) Read{{ .Name }}() []{{ $.InterfacesPackageName }}.{{ .StructName }} {
+	var res []{{ $.InterfacesPackageName }}.{{ .StructName }}
+	s.RecordCollection.ReadViewStruct("{{ .Name }}", &res)
+	return res
+}
+{{ end }}
 // Super returns a RecordSet with a modified callstack so that call to the current
 // method will execute the next method layer.
 //
@@ -473,7 +1104,14 @@ func (s {{ .Name }}Set) ModelData(fMap models.FieldMap) {{ .InterfacesPackageNam
 }
 
 {{ range .Methods }}
+{{- if not .ModelLevel }}
 {{ .Doc }}
+{{- if .Cached }}
+//
+// The results of {{ .Name }} are cached in the environment by arguments
+{{- if .CacheContext }} and by the {{ .CacheContext }} context keys{{ end }},
+// until records are modified or the transaction ends.
+{{- end }}
 func (s {{ $.Name }}Set) {{ .Name }}({{ .ParamsWithType }}) ({{ .ReturnString }}) {
 {{- if eq .Returns "" }}
 	s.Collection().Call("{{ .Name }}", {{ .Params}})
@@ -483,7 +1121,15 @@ func (s {{ $.Name }}Set) {{ .Name }}({{ .ParamsWithType }}) ({{ .ReturnString }}
 	return {{ .Returns }}
 {{- end }}
 }
-
+{{ if .ResultStruct }}
+// {{ .Name }}Result calls {{ .Name }} and returns its named results as a
+// {{ $.InterfacesPackageName }}.{{ .ResultStruct }}.
+func (s {{ $.Name }}Set) {{ .Name }}Result({{ .ParamsWithType }}) {{ $.InterfacesPackageName }}.{{ .ResultStruct }} {
+	{{ .Returns }} := s.{{ .Name }}({{ .Params }})
+	return {{ .ResultValues }}
+}
+{{ end }}
+{{- end }}
 {{ end }}
 
 {{- if not .IsModelMixin }}
@@ -522,6 +1168,9 @@ func init() {
 {{- range .Methods }}
 {{- if .ToDeclare }}
 	models.Registry.MustGet("{{ $.Name }}").AddEmptyMethod("{{ .Name }}")
+{{- if .Cached }}
+{{- if .CacheContext }}.MemoizeOn({{ .CacheContext }}){{ else }}.Memoize(){{ end }}
+{{- end }}
 {{- end }}
 {{- end }}
 {{- if not .IsModelMixin }}
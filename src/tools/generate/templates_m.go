@@ -28,10 +28,35 @@ type {{ .Name }}Set interface {
 	//
 	// It also returns this {{ .Name }}Set.
 	ForceLoad(fields ...models.FieldName) {{ .Name }}Set
+	// GetForUpdate re-reads the records of this {{ .Name }}Set and locks their rows
+	// until the end of the transaction, so that they can be safely read, modified
+	// and written back. It panics outside a transaction.
+	GetForUpdate() {{ .Name }}Set
+	// With returns a new {{ .Name }}Set that loads the given fields of the records
+	// pointed at by relationField with a single JOIN when this set is loaded.
+	With(relationField models.FieldName, fields ...models.FieldName) {{ .Name }}Set
+	// IdsCondition returns a condition matching the records of this {{ .Name }}Set
+	// by their ids. It matches no records if this {{ .Name }}Set is empty.
+	IdsCondition() {{ $.QueryPackageName }}.{{ .Name }}Condition
+	// ActiveRecords returns a new {{ .Name }}Set with the records of the
+	// 'active_ids' key of the context.
+	ActiveRecords() {{ .Name }}Set
+	// Explain returns the execution plan of the query loading the records of
+	// this {{ .Name }}Set filtered by cond. It panics if Debug mode is not enabled.
+	Explain(cond {{ $.QueryPackageName }}.{{ .Name }}Condition) string
+	// ActionOpenRecord returns a window action opening this {{ .Name }} record
+	// in form view. It panics if this {{ .Name }}Set is not a singleton.
+	ActionOpenRecord() *actions.Action
 	{{- range .Fields }}
 	// {{ .Name }} is a getter for the value of the "{{ .Name }}" field of the first
 	// record in this RecordSet. It returns the Go zero value if the RecordSet is empty.
 	{{ .Name }}() {{ .IType }}
+	{{- if .IsRS }}
+	// {{ .Name }}WithContext returns the value of the "{{ .Name }}" field read with the
+	// context of this RecordSet extended by the keys of ctx.
+	{{ .Name }}WithContext(ctx map[string]interface{}) {{ .IType }}
+	{{- end }}
+	{{- if not .NoWrite }}
 	// Set{{ .Name }} is a setter for the value of the "{{ .Name }}" field of this
 	// RecordSet. All Records of this RecordSet will be updated. Each call to this
 	// method makes an update query in the database.
@@ -39,9 +64,81 @@ type {{ .Name }}Set interface {
 	// Set{{ .Name }} panics if the RecordSet is empty.
 	Set{{ .Name }}(value {{ .IType }})
 	{{- end }}
+	{{- if .CompareAndSet }}
+	// CompareAndSet{{ .Name }} sets the "{{ .Name }}" field of this record to value
+	// only if its current value in the database is expected. It returns true if the
+	// record has been updated.
+	CompareAndSet{{ .Name }}(expected, value {{ .IType }}) bool
+	{{- end }}
+	{{- if .Toggle }}
+	// Toggle{{ .Name }} inverts the value of the "{{ .Name }}" field of all the records
+	// of this RecordSet in a single UPDATE query.
+	Toggle{{ .Name }}() {{ $.Name }}Set
+	{{- end }}
+	{{- if .Increment }}
+	// Increment{{ .Name }} adds delta to the "{{ .Name }}" field of all the records of this
+	// RecordSet in a single UPDATE query. Use a negative delta to decrement.
+	Increment{{ .Name }}(delta {{ .IType }}) {{ $.Name }}Set
+	{{- end }}
+	{{- if .Distinct }}
+	// Distinct{{ .Name }} returns the distinct values of the "{{ .Name }}" field among the
+	// records of this RecordSet, in ascending order and without nulls.
+	Distinct{{ .Name }}() []{{ .IType }}
+	{{- end }}
+	{{- if .Transform }}
+	// Transform{{ .Name }} sets the "{{ .Name }}" field of all the records of this RecordSet
+	// to the result of fn applied to its current value.
+	Transform{{ .Name }}(fn func({{ .IType }}) {{ .IType }})
+	{{- end }}
+	{{- if .Versioned }}
+	// {{ .Name }}Version returns the version of the stored value of the "{{ .Name }}" field,
+	// i.e. the hash of the values of its dependencies when it was last computed.
+	{{ .Name }}Version() string
+	{{- end }}
+	{{- if .Names }}
+	// {{ .Name }}Names returns the display name of the {{ .RelModel }} record of the "{{ .Name }}"
+	// field of each record of this RecordSet, mapped by record ID.
+	{{ .Name }}Names() map[int64]string
+	{{- end }}
+	{{- if .RelationIds }}
+	// Add{{ .Name }}ByIds links the records of this RecordSet to the {{ .RelModel }} records
+	// with the given ids through the "{{ .Name }}" field, keeping the existing links.
+	Add{{ .Name }}ByIds(ids ...int64) {{ $.Name }}Set
+	// Remove{{ .Name }}ByIds removes the links between the records of this RecordSet and
+	// the {{ .RelModel }} records with the given ids through the "{{ .Name }}" field.
+	Remove{{ .Name }}ByIds(ids ...int64) {{ $.Name }}Set
+	{{- end }}
+	{{- if .Raw }}
+	// Raw{{ .Name }} returns the value of the "{{ .Name }}" field as it is persisted in the
+	// database, without triggering its recomputation.
+	Raw{{ .Name }}() {{ .IType }}
+	{{- end }}
+	{{- $field := . }}
+	{{- range .Mapped }}
+	// Mapped{{ $field.Name }}{{ .Name }} returns the values of the "{{ .Name }}" field of all the
+	// {{ $field.RelModel }} records of the "{{ $field.Name }}" field of this RecordSet.
+	Mapped{{ $field.Name }}{{ .Name }}() {{ if .IsRS }}{{ .IType }}{{ else }}[]{{ .IType }}{{ end }}
+	{{- end }}
+	{{- if .DynamicFilter }}
+	// {{ .Name }}RelationFilter returns the condition that {{ .RelModel }} records must satisfy
+	// to be set in the "{{ .Name }}" field, given the current values of this RecordSet.
+	{{ .Name }}RelationFilter() {{ $.QueryPackageName }}.{{ .RelModel }}Condition
+	{{- end }}
+	{{- end }}
+	{{- range .ViewStructs }}
+	// Read{{ .Name }} loads the columns of the {{ .Name }} view struct of the records
+	// of this RecordSet into a slice of {{ .StructName }}, without populating the cache.
+	Read{{ .Name }}() []{{ .StructName }}
+	{{- end }}
 	{{- range .AllMethods }}
+	{{- if not .ModelLevel }}
 	{{ .Doc }}
 	{{ .Name }}({{ .IParamsWithTypes }}) ({{ .IReturnString }})
+	{{- if .ResultStruct }}
+	// {{ .Name }}Result calls {{ .Name }} and returns its named results as a {{ .ResultStruct }}.
+	{{ .Name }}Result({{ .IParamsWithTypes }}) {{ .ResultStruct }}
+	{{- end }}
+	{{- end }}
 	{{- end }}
 	// Super returns a RecordSet with a modified callstack so that call to the current
 	// method will execute the next method layer.
@@ -70,6 +167,53 @@ type {{ .Name }}Set interface {
 	First() {{ .Name }}Data
 	// All returns the values of all Records of the RecordCollection as a slice of {{ .Name }}Data pointers.
 	All() []{{ .Name }}Data
+	// AllPtr returns the values of all Records of this {{ .Name }}Set as a slice of {{ .Name }}Data
+	// pointers with change tracking, to be edited in place and written back with WriteDirty.
+	AllPtr() []{{ .Name }}Data
+	// WriteDirty writes the modified fields of each of the given {{ .Name }}Data returned by
+	// AllPtr to its record, and returns the number of records written.
+	WriteDirty(data []{{ .Name }}Data) int
+	// Totals returns the sums of the given numeric fields over the records of this
+	// {{ .Name }}Set by field name, computed in a single query.
+	Totals(fields ...string) map[string]float64
+	// TotalsData returns a {{ .Name }}Data with the sums of the given numeric fields
+	// over the records of this {{ .Name }}Set.
+	TotalsData(fields ...string) {{ .Name }}Data
+	// MapTo returns a new data object of the target model populated with the values of this
+	// {{ .Name }} record, according to the given mapping of field names and optional transforms.
+	// The result can be asserted to the Data type of the target model.
+	MapTo(target models.Modeler, mapping map[string]string, transforms map[string]models.FieldTransform) models.RecordData
+	// Next returns the {{ .Name }} record that comes after this one when sorted by
+	// the given order, or an empty {{ .Name }}Set if this is the last one.
+	Next(order string) {{ .Name }}Set
+	// Previous returns the {{ .Name }} record that comes before this one when sorted by
+	// the given order, or an empty {{ .Name }}Set if this is the first one.
+	Previous(order string) {{ .Name }}Set
+	// RecursiveChildren returns all the descendants of the records of this {{ .Name }}Set
+	// through parentField, fetched with a single recursive query.
+	RecursiveChildren(parentField string) {{ .Name }}Set
+	// RecursiveParents returns all the ancestors of the records of this {{ .Name }}Set
+	// through parentField, fetched with a single recursive query.
+	RecursiveParents(parentField string) {{ .Name }}Set
+	// Marshal returns the values of the stored fields of the records of this
+	// {{ .Name }}Set encoded with msgpack, to be loaded back with Unmarshal.
+	Marshal() ([]byte, error)
+	// Every returns true if test is true for all the records of this {{ .Name }}Set.
+	// It stops at the first record for which test is false.
+	Every(test func({{ .Name }}Set) bool) bool
+	// Some returns true if test is true for at least one record of this {{ .Name }}Set.
+	// It stops at the first record for which test is true.
+	Some(test func({{ .Name }}Set) bool) bool
+	// ForEachParallel calls fn on each {{ .Name }} record of this {{ .Name }}Set in concurrent
+	// goroutines, each in its own transaction, and returns the errors of each record
+	// or nil if all the calls succeeded.
+	ForEachParallel(concurrency int, fn func(rec {{ .Name }}Set) error) []error
+	// InNewTransaction calls fn with the records of this {{ .Name }}Set in a new transaction
+	// that is committed independently of the current one if fn returns nil.
+	InNewTransaction(fn func(s {{ .Name }}Set) error) error
+	// Iterate returns an iterator over the values of the {{ .Name }} records matching cond,
+	// which are fetched by batches of batchSize records to keep memory usage bounded.
+	Iterate(cond {{ $.QueryPackageName }}.{{ .Name }}Condition, batchSize int) func() ({{ .Name }}Data, bool)
 }
 
 // {{ .Name }}Data is used to hold values of an {{ .Name }} object instance
@@ -109,6 +253,12 @@ type {{ .Name }}Data interface {
 	OrderedKeys() []string
 	// FieldNames returns the {{ .Name }}Data keys as a slice of FieldNames.
 	FieldNames() models.FieldNames
+	// DirtyFields returns the fields of this {{ .Name }}Data that have been modified since it
+	// has been returned by AllPtr or written by WriteDirty, or nil if changes are not tracked.
+	DirtyFields() models.FieldNames
+	// Validate checks the values of this {{ .Name }}Data against the definition of the
+	// {{ .Name }} fields without writing to the database, and returns the errors found.
+	Validate(env models.Environment) []exceptions.ValidationError
 {{- range .Fields }}
 	// {{ .Name }} returns the value of the {{ .Name }} field.
 	// If this {{ .Name }} is not set in this {{ $.Name }}Data, then
@@ -141,5 +291,23 @@ type {{ .Name }}GroupAggregateRow interface {
 	// Condition can be used to query the aggregated rows separately if needed
 	Condition() {{ $.QueryPackageName }}.{{ .Name }}Condition
 }
-
+{{ range .AllMethods }}
+{{- if .ResultStruct }}
+// {{ .ResultStruct }} holds the named results of the {{ .Name }} method of {{ $.Name }}Set,
+// as returned by {{ .Name }}Result.
+type {{ .ResultStruct }} struct {
+	{{- range .ResultFields }}
+	{{ .Name }} {{ .Type }}
+	{{- end }}
+}
+{{ end }}
+{{- end }}
+{{ range .ViewStructs }}
+// {{ .StructName }} holds the fields of the {{ .Name }} view struct of {{ $.Name }}.
+type {{ .StructName }} struct {
+	{{- range .Fields }}
+	{{ .Name }} {{ .Type }}
+	{{- end }}
+}
+{{ end }}
 `))
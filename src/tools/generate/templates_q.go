@@ -18,6 +18,8 @@ import (
 
 type {{ .Name }}Condition = {{ .SnakeName }}.Condition
 
+type {{ .Name }}ConditionTree = {{ .SnakeName }}.ConditionTree
+
 // {{ .Name }} returns a {{ .SnakeName }}.ConditionStart for {{ .Name }}Model
 func {{ .Name }}() {{ .SnakeName }}.ConditionStart {
 	return {{ .SnakeName }}.ConditionStart{
@@ -105,6 +107,31 @@ func (cs ConditionStart) NewCondition() Condition {
 	}
 }
 
+// NewConditionTree returns a new ConditionTree to build a {{ $.Name }} Condition
+// from a tree of AND/OR groups and leaf predicates.
+func (cs ConditionStart) NewConditionTree() ConditionTree {
+	return ConditionTree{
+		ConditionTree: models.Registry.MustGet("{{ $.Name }}").NewConditionTree(),
+	}
+}
+
+// ------- CONDITION TREE ---------
+
+// A ConditionTree builds a {{ $.Name }} Condition from a tree of AND/OR groups
+// and leaf predicates whose fields, operators and values are only known at
+// runtime. Leaves are validated against the {{ $.Name }} fields when compiled.
+type ConditionTree struct {
+	*models.ConditionTree
+}
+
+// Compile returns the Condition of the given root node of this tree.
+// It panics if a field, an operator or a value of a leaf is invalid.
+func (ct ConditionTree) Compile(root models.ConditionNode) Condition {
+	return Condition{
+		Condition: ct.ConditionTree.Compile(root),
+	}
+}
+
 {{ range .Fields }}
 // {{ .Name }} adds the "{{ .Name }}" field to the Condition
 func (cs ConditionStart) {{ .Name }}() p{{ .SanType }}ConditionField {
@@ -122,6 +149,23 @@ func (cs ConditionStart) {{ .Name }}FilteredOn(cond {{ .RelModel }}Condition) Co
 	}
 }
 {{ end }}
+{{ if .ToMany }}
+// {{ .Name }}Any matches the records with at least one record in the "{{ .Name }}"
+// field matching the given condition. It is rendered as an SQL EXISTS subquery.
+func (cs ConditionStart) {{ .Name }}Any(cond {{ .RelModel }}Condition) Condition {
+	return Condition{
+		Condition: cs.Any(models.NewFieldName("{{ .Name }}", "{{ .JSON }}"), cond.Underlying()),
+	}
+}
+
+// {{ .Name }}None matches the records without any record in the "{{ .Name }}"
+// field matching the given condition. It is rendered as an SQL NOT EXISTS subquery.
+func (cs ConditionStart) {{ .Name }}None(cond {{ .RelModel }}Condition) Condition {
+	return Condition{
+		Condition: cs.None(models.NewFieldName("{{ .Name }}", "{{ .JSON }}"), cond.Underlying()),
+	}
+}
+{{ end }}
 {{ end }}
 
 // ------- CONDITION FIELDS ----------
@@ -135,18 +179,18 @@ type p{{ $typ.SanType }}ConditionField struct {
 
 {{ range $typ.Operators }}
 // {{ .Name }} adds a condition value to the ConditionPath
-func (c p{{ $typ.SanType }}ConditionField) {{ .Name }}(arg {{ if and .Multi (not $typ.IsRS) }}[]{{ end }}{{ $typ.Type }}) Condition {
+func (c p{{ $typ.SanType }}ConditionField) {{ .Name }}(arg {{ if .ArgType }}{{ .ArgType }}{{ else }}{{ if and .Multi (not $typ.IsRS) }}[]{{ end }}{{ $typ.Type }}{{ end }}) Condition {
 	return Condition{
-		Condition: c.ConditionField.{{ .Name }}(arg),
+		Condition: {{ if .Operator }}c.ConditionField.AddOperator("{{ .Operator }}", arg){{ else }}c.ConditionField.{{ .Name }}(arg){{ end }},
 	}
 }
 
 // {{ .Name }}Func adds a function value to the ConditionPath.
 // The function will be evaluated when the query is performed and
 // it will be given the RecordSet on which the query is made as parameter
-func (c p{{ $typ.SanType }}ConditionField) {{ .Name }}Func(arg func (models.RecordSet) {{ if and .Multi (not $typ.IsRS) }}[]{{ end }}{{ if $typ.IsRS }}models.RecordSet{{ else }}{{ $typ.Type }}{{ end }}) Condition {
+func (c p{{ $typ.SanType }}ConditionField) {{ .Name }}Func(arg func (models.RecordSet) {{ if .ArgType }}{{ .ArgType }}{{ else }}{{ if and .Multi (not $typ.IsRS) }}[]{{ end }}{{ if $typ.IsRS }}models.RecordSet{{ else }}{{ $typ.Type }}{{ end }}{{ end }}) Condition {
 	return Condition{
-		Condition: c.ConditionField.{{ .Name }}(arg),
+		Condition: {{ if .Operator }}c.ConditionField.AddOperator("{{ .Operator }}", arg){{ else }}c.ConditionField.{{ .Name }}(arg){{ end }},
 	}
 }
 
@@ -156,12 +200,69 @@ func (c p{{ $typ.SanType }}ConditionField) {{ .Name }}Func(arg func (models.Reco
 // be used server-side.
 func (c p{{ $typ.SanType }}ConditionField) {{ .Name }}Eval(expression string) Condition {
 	return Condition{
-		Condition: c.ConditionField.{{ .Name }}(models.ClientEvaluatedString(expression)),
+		Condition: {{ if .Operator }}c.ConditionField.AddOperator("{{ .Operator }}", models.ClientEvaluatedString(expression)){{ else }}c.ConditionField.{{ .Name }}(models.ClientEvaluatedString(expression)){{ end }},
+	}
+}
+
+{{ end }}
+{{ if $typ.IsRS }}
+// InSubquery adds a condition value to the ConditionPath that matches the records
+// selected by the given Subquery. The ids are not fetched but selected by an SQL subquery.
+func (c p{{ $typ.SanType }}ConditionField) InSubquery(sq models.Subquery) Condition {
+	return Condition{
+		Condition: c.ConditionField.In(sq),
+	}
+}
+
+// NotInSubquery adds a condition value to the ConditionPath that excludes the records
+// selected by the given Subquery. The ids are not fetched but selected by an SQL subquery.
+func (c p{{ $typ.SanType }}ConditionField) NotInSubquery(sq models.Subquery) Condition {
+	return Condition{
+		Condition: c.ConditionField.NotIn(sq),
 	}
 }
 
+// InIdsOrChildOf adds a condition value to the ConditionPath that matches the records
+// with the given ids or one of their descendants in the hierarchy of the related model.
+func (c p{{ $typ.SanType }}ConditionField) InIdsOrChildOf(ids []int64) Condition {
+	return Condition{
+		Condition: c.ConditionField.InIdsOrChildOf(ids),
+	}
+}
 {{ end }}
+{{ if $typ.IsDate }}
+// Today matches the values of this field that are on the current day, in the timezone
+// given by the "tz" key of the context. The date is computed when the query is performed.
+func (c p{{ $typ.SanType }}ConditionField) Today() Condition {
+	return Condition{
+		Condition: c.ConditionField.Today(),
+	}
+}
 
+// LastNDays matches the values of this field that are on one of the last n days,
+// including the current day, in the timezone given by the "tz" key of the context.
+func (c p{{ $typ.SanType }}ConditionField) LastNDays(n int) Condition {
+	return Condition{
+		Condition: c.ConditionField.LastNDays(n),
+	}
+}
+
+// ThisMonth matches the values of this field that are in the current month,
+// in the timezone given by the "tz" key of the context.
+func (c p{{ $typ.SanType }}ConditionField) ThisMonth() Condition {
+	return Condition{
+		Condition: c.ConditionField.ThisMonth(),
+	}
+}
+
+// ThisYear matches the values of this field that are in the current year,
+// in the timezone given by the "tz" key of the context.
+func (c p{{ $typ.SanType }}ConditionField) ThisYear() Condition {
+	return Condition{
+		Condition: c.ConditionField.ThisYear(),
+	}
+}
+{{ end }}
 // IsNull checks if the current condition field is null
 func (c p{{ $typ.SanType }}ConditionField) IsNull() Condition {
 	return Condition{
@@ -180,7 +180,15 @@ func GetLogger(moduleName string) Logger {
 // error with the panic message. This function is separated from
 // LogAndPanic so that unwanted panics can still be logged with
 // this function.
+//
+// If panicData is an exceptions.Exception, the returned error is of the
+// same type with the stacktrace appended to its debug information.
+// Otherwise, it is an exceptions.UserError.
 func LogPanicData(panicData interface{}) error {
+	if exc, ok := panicData.(exceptions.Exception); ok {
+		log.Error("Hexya panicked", "type", exc.Type(), "msg", exc.UserMessage())
+		return exceptions.WithDebug(exc, fmt.Sprintf("%s\n\n%s", exc.DebugInfo(), stack(1)))
+	}
 	msg := fmt.Sprintf("%v", panicData)
 	log.Error("Hexya panicked", "msg", msg)
 